@@ -2,30 +2,36 @@ package blocks
 
 import (
 	"context"
+	"fmt"
 	"github.com/KevinSmall/ethgraph/chain"
-	"github.com/KevinSmall/ethgraph/logr"
-	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
 	"math/big"
 	"time"
 )
 
-func GetEstimatedBlockTimeForTransaction(uniqueBlocksMap BlockMap, blockNumber uint64, txIndex uint) time.Time {
+func GetEstimatedBlockTimeForTransaction(uniqueBlocksMap BlockMap, blockNumber uint64, txIndex uint) (time.Time, error) {
 	blockMapValue, exists := uniqueBlocksMap[BlockKey{BlockNumber: blockNumber}]
 	if !exists {
-		logr.Error.Panicf("Block %v missing in internal uniqueBlocksMap", blockNumber)
+		return time.Time{}, fmt.Errorf("block %v missing in internal uniqueBlocksMap", blockNumber)
 	}
 	blockDurationSeconds := float64(12) // arbitrary estimate
 	proportionThroughBlockInSeconds := (float64(txIndex) / float64(blockMapValue.TransactionCount)) * blockDurationSeconds
 	timeToAdd := time.Duration(proportionThroughBlockInSeconds * float64(time.Second))
 	estimatedTime := blockMapValue.BlockTimestamp.Add(timeToAdd)
-	return estimatedTime
+	return estimatedTime, nil
 }
 
-func GetBlockFromChain(client ethereum.ChainReader, blockKey BlockKey) (
+// BlockReader is the part of an EVM client needed to read blocks. It is satisfied by
+// *ethclient.Client and allows fakes to be injected in tests.
+type BlockReader interface {
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+}
+
+func GetBlockFromChain(ctx context.Context, client BlockReader, blockKey BlockKey) (
 	blockData BlockDataFromSource, err error) {
 	blockNumber := big.NewInt(int64(blockKey.BlockNumber))
 
-	block, err := client.BlockByNumber(context.Background(), blockNumber)
+	block, err := client.BlockByNumber(ctx, blockNumber)
 	if err != nil {
 		return BlockDataFromSource{}, err
 	}
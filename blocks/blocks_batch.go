@@ -0,0 +1,62 @@
+package blocks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"time"
+)
+
+// blockHeaderJson is the part of an eth_getBlockByNumber result needed for block master data.
+// Asking for transaction hashes rather than whole transactions keeps the result small.
+type blockHeaderJson struct {
+	Number       hexutil.Uint64 `json:"number"`
+	Timestamp    hexutil.Uint64 `json:"timestamp"`
+	Transactions []common.Hash  `json:"transactions"`
+}
+
+// GetBlocksFromChain is GetBlockFromChain for many blocks, reading only their headers and
+// transaction hashes, in batch requests of batchSize blocks. The blocks are returned in the
+// order of blockKeys.
+func GetBlocksFromChain(ctx context.Context, client chain.BatchCaller, blockKeys []BlockKey, batchSize int) (
+	[]BlockDataFromSource, error) {
+
+	rawResults := make([]json.RawMessage, len(blockKeys))
+	calls := make([]rpc.BatchElem, len(blockKeys))
+	for i, blockKey := range blockKeys {
+		calls[i] = rpc.BatchElem{
+			Method: "eth_getBlockByNumber",
+			Args:   []interface{}{hexutil.EncodeUint64(blockKey.BlockNumber), false},
+			Result: &rawResults[i],
+		}
+	}
+	if err := chain.SendBatches(ctx, client, calls, batchSize); err != nil {
+		return nil, err
+	}
+
+	blocksData := make([]BlockDataFromSource, len(blockKeys))
+	for i, call := range calls {
+		blockNumber := blockKeys[i].BlockNumber
+		if call.Error != nil {
+			return nil, fmt.Errorf("block %v: %w", blockNumber, call.Error)
+		}
+		if len(rawResults[i]) == 0 || string(rawResults[i]) == "null" {
+			return nil, fmt.Errorf("block %v: %w", blockNumber, ethereum.NotFound)
+		}
+		var header blockHeaderJson
+		if err := json.Unmarshal(rawResults[i], &header); err != nil {
+			return nil, fmt.Errorf("block %v: %w", blockNumber, err)
+		}
+		blocksData[i] = BlockDataFromSource{
+			BlockNumber:      uint64(header.Number),
+			BlockTimestamp:   time.Unix(int64(header.Timestamp), 0),
+			TransactionCount: uint(len(header.Transactions)),
+		}
+	}
+	return blocksData, nil
+}
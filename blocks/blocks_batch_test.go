@@ -0,0 +1,49 @@
+package blocks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+	"testing"
+	"time"
+)
+
+// fakeBatchCaller answers every eth_getBlockByNumber with result, and records the args
+type fakeBatchCaller struct {
+	result string
+	args   [][]interface{}
+}
+
+func (f *fakeBatchCaller) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	for i := range b {
+		f.args = append(f.args, b[i].Args)
+		*b[i].Result.(*json.RawMessage) = json.RawMessage(f.result)
+	}
+	return nil
+}
+
+func TestGetBlocksFromChain(t *testing.T) {
+	caller := &fakeBatchCaller{result: `{"number":"0x10","timestamp":"0x64","transactions":["0x244c8173556a0e15b26db7a7729a66cca0f8689a19a7b6e709ccfe47096074a0"]}`}
+	blocksData, err := GetBlocksFromChain(context.Background(), caller, []BlockKey{{BlockNumber: 16}}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := BlockDataFromSource{BlockNumber: 16, BlockTimestamp: time.Unix(100, 0), TransactionCount: 1}
+	if len(blocksData) != 1 || blocksData[0] != expected {
+		t.Errorf("expected %+v, got %+v", expected, blocksData)
+	}
+	// Only transaction hashes are asked for, not whole transactions
+	if args := caller.args[0]; args[0] != "0x10" || args[1] != false {
+		t.Errorf("expected args 0x10 and false, got %v", args)
+	}
+}
+
+func TestGetBlocksFromChainNotFound(t *testing.T) {
+	caller := &fakeBatchCaller{result: "null"}
+	_, err := GetBlocksFromChain(context.Background(), caller, []BlockKey{{BlockNumber: 16}}, 10)
+	if !errors.Is(err, ethereum.NotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
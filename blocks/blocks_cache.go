@@ -0,0 +1,110 @@
+package blocks
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/logr"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// LoadTimeProbes loads the block timestamps cached locally for chainId. If there is no
+// cache file yet, the probes start empty.
+func LoadTimeProbes(chainId string) *TimeProbes {
+	probes := &TimeProbes{
+		chainId:    chainId,
+		timestamps: make(map[uint64]time.Time),
+	}
+
+	filename := getBlockCacheFilename(chainId)
+	file, err := os.Open(filename)
+	if err != nil {
+		logr.Trace.Printf("Failed to open file: %s. It probably doesn't exist yet: %s.", filename, err)
+		return probes
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+
+	// Skip first row of headers
+	_, err = reader.Read()
+	if err != nil {
+		logr.Warning.Printf("Error when processing block file %s %s. Try deleting it and rerunning.", filename, err)
+		return probes
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logr.Warning.Printf("Error when processing file %s contents: %s", filename, err)
+			break
+		}
+		if len(record) != 3 || record[0] != chainId {
+			continue
+		}
+		blockNumber, err := strconv.ParseUint(record[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		blockTimestamp, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		probes.timestamps[blockNumber] = time.Unix(blockTimestamp, 0)
+	}
+	return probes
+}
+
+// Save writes the probes to the local cache .csv file, if any new block timestamps were read.
+// If any troubles, it just logs a warning.
+func (p *TimeProbes) Save() {
+	if !p.isChanged {
+		return
+	}
+
+	blockNumbers := make([]uint64, 0, len(p.timestamps))
+	for blockNumber := range p.timestamps {
+		blockNumbers = append(blockNumbers, blockNumber)
+	}
+	sort.Slice(blockNumbers, func(i, j int) bool {
+		return blockNumbers[i] < blockNumbers[j]
+	})
+
+	filename := getBlockCacheFilename(p.chainId)
+	file, err := os.Create(filename)
+	if err != nil {
+		logr.Warning.Printf("Block cache file %s not written: %s", filename, err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	err = writer.Write([]string{"ChainId", "BlockNumber", "BlockTimestamp"})
+	if err != nil {
+		logr.Warning.Printf("Block cache file %s not written: %s", filename, err)
+		return
+	}
+	for _, blockNumber := range blockNumbers {
+		err = writer.Write([]string{
+			p.chainId,
+			strconv.FormatUint(blockNumber, 10),
+			strconv.FormatInt(p.timestamps[blockNumber].Unix(), 10)})
+		if err != nil {
+			logr.Warning.Printf("Block cache file %s not written: %s", filename, err)
+			return
+		}
+	}
+	p.isChanged = false
+}
+
+func getBlockCacheFilename(chainId string) (filename string) {
+	return fmt.Sprintf(".blocks_%s_cache.csv", chainId)
+}
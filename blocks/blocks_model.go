@@ -19,3 +19,11 @@ type BlockDataFromSource struct {
 }
 
 type BlockMap map[BlockKey]BlockMapValue
+
+// TimeProbes holds block timestamps already read from chain, keyed on block number. They are
+// cached locally in a .csv file per chainId so searching blocks by time is cheap on reruns.
+type TimeProbes struct {
+	chainId    string
+	timestamps map[uint64]time.Time
+	isChanged  bool
+}
@@ -0,0 +1,117 @@
+package blocks
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+)
+
+// defaultMaxReorgDepth is how many recent block hashes are kept to find where a chain
+// reorganisation forked from, reorganisations deeper than this are not recoverable
+const defaultMaxReorgDepth uint64 = 128
+
+// HeaderReader is the part of an EVM client needed to read block headers. It is satisfied by
+// *ethclient.Client and allows fakes to be injected in tests.
+type HeaderReader interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// ChainTracker records the hashes of the recent blocks read, so that a chain reorganisation
+// is detected when a newly read block does not link to them by its parent hash
+type ChainTracker struct {
+	client HeaderReader
+	hashes map[uint64]common.Hash
+
+	// MaxReorgDepth is how many recent block hashes are kept
+	MaxReorgDepth uint64
+}
+
+// NewChainTracker creates a ChainTracker with no blocks recorded
+func NewChainTracker(client HeaderReader) *ChainTracker {
+	return &ChainTracker{
+		client:        client,
+		hashes:        make(map[uint64]common.Hash),
+		MaxReorgDepth: defaultMaxReorgDepth,
+	}
+}
+
+// Extend reads the headers of blocks [blockFrom, blockTo] and records their hashes. Each block
+// must link by parent hash to the block before it, whether recorded earlier or in this call.
+// If a block does not link, the chain has been reorganised: the fork point is found, hashes
+// from it onwards are forgotten, and forkBlock is returned as the first block that must be
+// read again.
+func (t *ChainTracker) Extend(ctx context.Context, blockFrom uint64, blockTo uint64) (forkBlock uint64, isReorg bool, err error) {
+	for blockNumber := blockFrom; blockNumber <= blockTo; blockNumber++ {
+		header, err := t.client.HeaderByNumber(ctx, new(big.Int).SetUint64(blockNumber))
+		if err != nil {
+			return 0, false, err
+		}
+		if blockNumber > 0 {
+			parentHash, exists := t.hashes[blockNumber-1]
+			if exists && parentHash != header.ParentHash {
+				forkBlock, err = t.findForkBlock(ctx, blockNumber-1)
+				if err != nil {
+					return 0, false, err
+				}
+				t.Rollback(forkBlock)
+				return forkBlock, true, nil
+			}
+		}
+		t.hashes[blockNumber] = header.Hash()
+	}
+	t.prune(blockTo)
+	return 0, false, nil
+}
+
+// findForkBlock walks back from blockNumber to the last block whose recorded hash is still on
+// chain, and returns the block after it, the first block that was reorganised away
+func (t *ChainTracker) findForkBlock(ctx context.Context, blockNumber uint64) (uint64, error) {
+	for {
+		recordedHash, exists := t.hashes[blockNumber]
+		if !exists {
+			return 0, fmt.Errorf("chain reorganisation at block %v is deeper than the %v blocks tracked",
+				blockNumber, t.MaxReorgDepth)
+		}
+		header, err := t.client.HeaderByNumber(ctx, new(big.Int).SetUint64(blockNumber))
+		if err != nil {
+			return 0, err
+		}
+		if header.Hash() == recordedHash {
+			return blockNumber + 1, nil
+		}
+		if blockNumber == 0 {
+			return 0, nil
+		}
+		blockNumber--
+	}
+}
+
+// IsCanonical returns true if blockHash is the hash recorded for the block, meaning data read
+// from that block is still on chain as far as is known
+func (t *ChainTracker) IsCanonical(blockNumber uint64, blockHash common.Hash) bool {
+	recordedHash, exists := t.hashes[blockNumber]
+	return exists && recordedHash == blockHash
+}
+
+// Rollback forgets the hashes of blocks from blockNumber onwards
+func (t *ChainTracker) Rollback(blockNumber uint64) {
+	for recordedBlockNumber := range t.hashes {
+		if recordedBlockNumber >= blockNumber {
+			delete(t.hashes, recordedBlockNumber)
+		}
+	}
+}
+
+// prune forgets hashes too old to be needed to find a fork point
+func (t *ChainTracker) prune(latestBlock uint64) {
+	if latestBlock < t.MaxReorgDepth {
+		return
+	}
+	for recordedBlockNumber := range t.hashes {
+		if recordedBlockNumber <= latestBlock-t.MaxReorgDepth {
+			delete(t.hashes, recordedBlockNumber)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package blocks
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"testing"
+)
+
+// fakeHeaderChain is a chain of headers linked by parent hash, that can be reorganised
+type fakeHeaderChain struct {
+	headers []*types.Header
+}
+
+func newFakeHeaderChain(length int) *fakeHeaderChain {
+	c := &fakeHeaderChain{}
+	c.reorganise(0, length, 0)
+	return c
+}
+
+// reorganise replaces the headers from block forkBlock onwards with a fork of the given length,
+// the fork id makes the new headers hash differently to the old ones
+func (c *fakeHeaderChain) reorganise(forkBlock int, length int, forkId byte) {
+	c.headers = c.headers[:forkBlock]
+	for blockNumber := forkBlock; blockNumber < forkBlock+length; blockNumber++ {
+		header := &types.Header{Number: big.NewInt(int64(blockNumber)), Extra: []byte{forkId}}
+		if blockNumber > 0 {
+			header.ParentHash = c.headers[blockNumber-1].Hash()
+		}
+		c.headers = append(c.headers, header)
+	}
+}
+
+func (c *fakeHeaderChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return c.headers[number.Int64()], nil
+}
+
+func TestChainTrackerExtendsWithoutReorg(t *testing.T) {
+	headerChain := newFakeHeaderChain(20)
+	tracker := NewChainTracker(headerChain)
+
+	for _, blockRange := range [][2]uint64{{5, 9}, {10, 10}, {11, 15}} {
+		_, isReorg, err := tracker.Extend(context.Background(), blockRange[0], blockRange[1])
+		if err != nil || isReorg {
+			t.Errorf("Extend(%v, %v) = %v, %v, expected no reorg", blockRange[0], blockRange[1], isReorg, err)
+		}
+	}
+	if !tracker.IsCanonical(12, headerChain.headers[12].Hash()) {
+		t.Errorf("expected block 12 to be canonical")
+	}
+}
+
+func TestChainTrackerDetectsReorg(t *testing.T) {
+	headerChain := newFakeHeaderChain(20)
+	tracker := NewChainTracker(headerChain)
+	_, _, err := tracker.Extend(context.Background(), 5, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldHash := headerChain.headers[13].Hash()
+
+	// Blocks 13 onwards are replaced
+	headerChain.reorganise(13, 7, 1)
+	forkBlock, isReorg, err := tracker.Extend(context.Background(), 16, 19)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isReorg || forkBlock != 13 {
+		t.Errorf("expected reorg from block 13, got %v, %v", isReorg, forkBlock)
+	}
+	if tracker.IsCanonical(13, oldHash) {
+		t.Errorf("expected old block 13 to be forgotten")
+	}
+
+	// Reading again from the fork block links up
+	_, isReorg, err = tracker.Extend(context.Background(), 13, 19)
+	if err != nil || isReorg {
+		t.Errorf("expected no reorg reading again from fork block, got %v, %v", isReorg, err)
+	}
+	if !tracker.IsCanonical(13, headerChain.headers[13].Hash()) {
+		t.Errorf("expected new block 13 to be canonical")
+	}
+}
+
+func TestChainTrackerFailsOnReorgDeeperThanTracked(t *testing.T) {
+	headerChain := newFakeHeaderChain(20)
+	tracker := NewChainTracker(headerChain)
+	tracker.MaxReorgDepth = 3
+	_, _, err := tracker.Extend(context.Background(), 5, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerChain.reorganise(8, 12, 1)
+	_, _, err = tracker.Extend(context.Background(), 16, 19)
+	if err == nil {
+		t.Errorf("expected an error for a reorg deeper than the blocks tracked")
+	}
+	if tracker.IsCanonical(10, headerChain.headers[10].Hash()) {
+		t.Errorf("expected pruned block 10 not to be canonical")
+	}
+}
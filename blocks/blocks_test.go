@@ -1,6 +1,7 @@
 package blocks
 
 import (
+	"context"
 	"github.com/KevinSmall/ethgraph/test"
 	"testing"
 )
@@ -11,7 +12,7 @@ func TestGetBlockFromChain(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Unable to create mock client %s", err)
 	}
-	blockData, err := GetBlockFromChain(client, BlockKey{0})
+	blockData, err := GetBlockFromChain(context.Background(), client, BlockKey{0})
 	if err != nil {
 		t.Fatal(err)
 	} else if blockData.BlockNumber == 0 {
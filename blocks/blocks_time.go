@@ -0,0 +1,106 @@
+package blocks
+
+import (
+	"context"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/logr"
+	"math/big"
+	"time"
+)
+
+// FindFirstBlockAtOrAfter binary searches the chain for the first block with a timestamp at or
+// after targetTime, considering blocks up to latestBlock. Block timestamps seen are recorded in
+// probes, and probes already known narrow the search, so repeated searches are cheap.
+func FindFirstBlockAtOrAfter(ctx context.Context, client HeaderReader, probes *TimeProbes, targetTime time.Time, latestBlock uint64) (uint64, error) {
+	latestTime, err := probes.GetBlockTime(ctx, client, latestBlock)
+	if err != nil {
+		return 0, err
+	}
+	if latestTime.Before(targetTime) {
+		return 0, fmt.Errorf("time %s is after the latest block %v at %s", targetTime.UTC().Format(time.RFC3339), latestBlock, latestTime.UTC().Format(time.RFC3339))
+	}
+	return probes.search(ctx, client, latestBlock, func(blockTime time.Time) bool {
+		return !blockTime.Before(targetTime)
+	})
+}
+
+// FindLastBlockAtOrBefore binary searches the chain for the last block with a timestamp at or
+// before targetTime, considering blocks up to latestBlock. If targetTime is after the latest
+// block, then the latest block is returned.
+func FindLastBlockAtOrBefore(ctx context.Context, client HeaderReader, probes *TimeProbes, targetTime time.Time, latestBlock uint64) (uint64, error) {
+	latestTime, err := probes.GetBlockTime(ctx, client, latestBlock)
+	if err != nil {
+		return 0, err
+	}
+	if !latestTime.After(targetTime) {
+		return latestBlock, nil
+	}
+	firstAfter, err := probes.search(ctx, client, latestBlock, func(blockTime time.Time) bool {
+		return blockTime.After(targetTime)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if firstAfter == 0 {
+		return 0, fmt.Errorf("time %s is before the first block", targetTime.UTC().Format(time.RFC3339))
+	}
+	return firstAfter - 1, nil
+}
+
+// search returns the first block in [0, latestBlock] for which isAtOrAfterTarget is true. Block
+// times only ever increase, so isAtOrAfterTarget is false up to some block then true afterwards.
+// The caller guarantees it is true for latestBlock.
+func (p *TimeProbes) search(ctx context.Context, client HeaderReader, latestBlock uint64,
+	isAtOrAfterTarget func(blockTime time.Time) bool) (uint64, error) {
+
+	// Narrow the search using probes from earlier searches. Invariant: the answer is in (low, high],
+	// with low == -1 meaning the answer could be block zero.
+	low := int64(-1)
+	high := int64(latestBlock)
+	for blockNumber, blockTime := range p.timestamps {
+		if int64(blockNumber) > int64(latestBlock) {
+			continue
+		}
+		if isAtOrAfterTarget(blockTime) {
+			if int64(blockNumber) < high {
+				high = int64(blockNumber)
+			}
+		} else if int64(blockNumber) > low {
+			low = int64(blockNumber)
+		}
+	}
+
+	probeCount := 0
+	for high-low > 1 {
+		middle := low + (high-low)/2
+		blockTime, err := p.GetBlockTime(ctx, client, uint64(middle))
+		if err != nil {
+			return 0, err
+		}
+		probeCount++
+		if isAtOrAfterTarget(blockTime) {
+			high = middle
+		} else {
+			low = middle
+		}
+	}
+	logr.Trace.Printf("Block %v found after %v probes of the chain\n", high, probeCount)
+	return uint64(high), nil
+}
+
+// GetBlockTime returns the block timestamp from probes, or reads it from chain and records it.
+// Only the block header is read, not the block with its transactions.
+func (p *TimeProbes) GetBlockTime(ctx context.Context, client HeaderReader, blockNumber uint64) (time.Time, error) {
+	blockTime, exists := p.timestamps[blockNumber]
+	if exists {
+		return blockTime, nil
+	}
+	header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(blockNumber))
+	if err != nil {
+		return time.Time{}, err
+	}
+	blockTime = time.Unix(int64(header.Time), 0)
+	p.timestamps[blockNumber] = blockTime
+	p.isChanged = true
+	return blockTime, nil
+}
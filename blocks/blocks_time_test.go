@@ -0,0 +1,112 @@
+package blocks
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+var fakeGenesisTime = time.Date(2023, time.March, 14, 0, 0, 0, 0, time.UTC)
+
+// fakeHeaderReader has a block every 12 seconds from fakeGenesisTime, and counts the reads
+type fakeHeaderReader struct {
+	reads int
+}
+
+func (f *fakeHeaderReader) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	f.reads++
+	blockTime := fakeGenesisTime.Add(time.Duration(number.Int64()) * 12 * time.Second)
+	return &types.Header{Number: number, Time: uint64(blockTime.Unix())}, nil
+}
+
+func TestFindBlocksByTime(t *testing.T) {
+	client := &fakeHeaderReader{}
+	probes := &TimeProbes{chainId: "1", timestamps: make(map[uint64]time.Time)}
+	latestBlock := uint64(1_000_000)
+
+	testCases := []struct {
+		targetTime      time.Time
+		expectedAtAfter uint64
+		expectedAtUntil uint64
+	}{
+		// Exactly on block 1000
+		{fakeGenesisTime.Add(12_000 * time.Second), 1000, 1000},
+		// Between block 1000 and 1001
+		{fakeGenesisTime.Add(12_005 * time.Second), 1001, 1000},
+		// Genesis
+		{fakeGenesisTime, 0, 0},
+		// After the latest block
+		{fakeGenesisTime.Add(24_000_000 * time.Second), 0, latestBlock},
+	}
+
+	for _, tc := range testCases {
+		blockAtOrAfter, err := FindFirstBlockAtOrAfter(context.Background(), client, probes, tc.targetTime, latestBlock)
+		if tc.targetTime.After(fakeGenesisTime.Add(12 * time.Second * time.Duration(latestBlock))) {
+			if err == nil {
+				t.Errorf("expected an error for time %s after the latest block", tc.targetTime)
+			}
+		} else if err != nil || blockAtOrAfter != tc.expectedAtAfter {
+			t.Errorf("FindFirstBlockAtOrAfter(%s) = %v, %v, expected %v", tc.targetTime, blockAtOrAfter, err, tc.expectedAtAfter)
+		}
+
+		blockAtOrBefore, err := FindLastBlockAtOrBefore(context.Background(), client, probes, tc.targetTime, latestBlock)
+		if err != nil || blockAtOrBefore != tc.expectedAtUntil {
+			t.Errorf("FindLastBlockAtOrBefore(%s) = %v, %v, expected %v", tc.targetTime, blockAtOrBefore, err, tc.expectedAtUntil)
+		}
+	}
+}
+
+func TestFindBlocksByTimeReusesProbes(t *testing.T) {
+	client := &fakeHeaderReader{}
+	probes := &TimeProbes{chainId: "1", timestamps: make(map[uint64]time.Time)}
+	targetTime := fakeGenesisTime.Add(12_345 * 12 * time.Second)
+
+	_, err := FindFirstBlockAtOrAfter(context.Background(), client, probes, targetTime, 1_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readsFirstSearch := client.reads
+
+	// The same search again needs no reads, the probes already bracket the answer
+	blockNumber, err := FindFirstBlockAtOrAfter(context.Background(), client, probes, targetTime, 1_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blockNumber != 12_345 {
+		t.Errorf("expected block 12345, got %v", blockNumber)
+	}
+	if client.reads != readsFirstSearch {
+		t.Errorf("expected no more reads on repeat search, got %v more", client.reads-readsFirstSearch)
+	}
+}
+
+func TestTimeProbesCache(t *testing.T) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workingDir)
+
+	probes := LoadTimeProbes("1")
+	_, err = probes.GetBlockTime(context.Background(), &fakeHeaderReader{}, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	probes.Save()
+
+	reloadedProbes := LoadTimeProbes("1")
+	blockTime, exists := reloadedProbes.timestamps[42]
+	if !exists {
+		t.Fatalf("expected block 42 in reloaded probes")
+	}
+	if !blockTime.Equal(fakeGenesisTime.Add(42 * 12 * time.Second)) {
+		t.Errorf("expected reloaded time %s, got %s", fakeGenesisTime.Add(42*12*time.Second), blockTime)
+	}
+}
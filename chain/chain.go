@@ -3,7 +3,7 @@
 // distinguish the token types.
 //   - No graph-related logic is applied here, this is pure event log handling.
 //   - For performance reasons, no additional chain reads are allowed here. It must only be
-//     a single log query hitting the chain.
+//     log queries hitting the chain, one per block range window.
 package chain
 
 import (
@@ -12,13 +12,41 @@ import (
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"math/big"
 )
 
-func GetTransferEventsByBlock(client *ethclient.Client, blockNumberInt uint64,
+// LogFetcher is the part of an EVM client needed to read event logs. It is satisfied by
+// *ethclient.Client and allows fakes to be injected in tests.
+type LogFetcher interface {
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// GetTransferEventsByBlock returns the transfer events for a single block
+func GetTransferEventsByBlock(ctx context.Context, client LogFetcher, blockNumberInt uint64,
 	onlyThisTokenAddress string) ([]*TransferEvent, error) {
 
+	return GetTransferEventsByBlockRange(ctx, client, blockNumberInt, blockNumberInt, NewTransferFilter(onlyThisTokenAddress))
+}
+
+// GetTransferEventsByBlockRange returns the transfer events for the block range [blockFrom, blockTo]
+// using a single log query per filter query. Use a RangeFetcher for large ranges, since providers
+// cap the size of results.
+func GetTransferEventsByBlockRange(ctx context.Context, client LogFetcher, blockFrom uint64, blockTo uint64,
+	filter TransferFilter) ([]*TransferEvent, error) {
+
+	logs, err := getTransferLogsByBlockRange(ctx, client, blockFrom, blockTo, filter)
+	if err != nil {
+		return nil, err
+	}
+	logr.Trace.Println("Blocks: ", blockFrom, "to", blockTo, "Logs found: ", len(logs))
+
+	events := logsToEvents(logs)
+	return events, nil
+}
+
+func getTransferLogsByBlockRange(ctx context.Context, client LogFetcher, blockFrom uint64, blockTo uint64,
+	filter TransferFilter) ([]types.Log, error) {
+
 	// Notes on how to use FilterQuery
 	// Filter info:
 	//
@@ -39,32 +67,23 @@ func GetTransferEventsByBlock(client *ethclient.Client, blockNumberInt uint64,
 	//		{{A}, {B}}         matches topic A in first position AND B in second position
 	//		{{A, B}, {C, D}}   matches topic (A OR B) in first position AND (C OR D) in second position
 
-	// the block number to retrieve transactions from
-	blockNumberBig := big.NewInt(int64(blockNumberInt))
+	var logs []types.Log
+	queries := filter.queries()
+	for _, query := range queries {
+		query.FromBlock = new(big.Int).SetUint64(blockFrom)
+		query.ToBlock = new(big.Int).SetUint64(blockTo)
 
-	// create a filter query for the specified block
-	var addresses []common.Address
-	if onlyThisTokenAddress != "" {
-		addresses = []common.Address{common.HexToAddress(onlyThisTokenAddress)}
-	}
-	query := ethereum.FilterQuery{
-		Addresses: addresses,
-		FromBlock: blockNumberBig,
-		ToBlock:   blockNumberBig,
-		Topics: [][]common.Hash{{common.HexToHash(transferEventKeccakTokens),
-			common.HexToHash(transferEventKeccakHybridSingle),
-			common.HexToHash(transferEventKeccakHybridBatch),
-		}},
+		// retrieve the logs matching the filter query
+		queryLogs, err := client.FilterLogs(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, queryLogs...)
 	}
-	// retrieve the logs matching the filter query
-	logs, err := client.FilterLogs(context.Background(), query)
-	if err != nil {
-		return nil, err
+	if len(queries) > 1 {
+		logs = removeDuplicateLogs(logs)
 	}
-	logr.Trace.Println("Block: ", blockNumberInt, "Logs found: ", len(logs))
-
-	events := logsToEvents(logs)
-	return events, nil
+	return logs, nil
 }
 
 func logsToEvents(logs []types.Log) []*TransferEvent {
@@ -73,6 +92,11 @@ func logsToEvents(logs []types.Log) []*TransferEvent {
 
 	// iterate through the logs
 	for _, log := range logs {
+		// Removed logs were reverted by a chain reorganisation, they are not movements
+		if log.Removed {
+			logr.Trace.Printf("Transaction %s log %v was removed by a chain reorganisation\n", log.TxHash.Hex(), log.Index)
+			continue
+		}
 		// log.Topics contain only indexed logs
 		if len(log.Topics) == 3 {
 			//-----------------------------------------------------------------
@@ -83,6 +107,7 @@ func logsToEvents(logs []types.Log) []*TransferEvent {
 			value := new(big.Int).SetBytes(log.Data)
 			event := TransferEvent{
 				BlockNumber:       log.BlockNumber,
+				BlockHash:         log.BlockHash,
 				TxHash:            log.TxHash,
 				TxIndex:           log.TxIndex,
 				TransferType:      ERC20,
@@ -107,6 +132,7 @@ func logsToEvents(logs []types.Log) []*TransferEvent {
 				nftId := log.Topics[3].Big().String()
 				event := TransferEvent{
 					BlockNumber:       log.BlockNumber,
+					BlockHash:         log.BlockHash,
 					TxHash:            log.TxHash,
 					TxIndex:           log.TxIndex,
 					TransferType:      ERC721,
@@ -130,6 +156,7 @@ func logsToEvents(logs []types.Log) []*TransferEvent {
 				to := common.HexToAddress(log.Topics[3].Hex())
 				event := TransferEvent{
 					BlockNumber:       log.BlockNumber,
+					BlockHash:         log.BlockHash,
 					TxHash:            log.TxHash,
 					TxIndex:           log.TxIndex,
 					TransferType:      ERC1155_SINGLE,
@@ -154,6 +181,7 @@ func logsToEvents(logs []types.Log) []*TransferEvent {
 					to := common.HexToAddress(log.Topics[3].Hex())
 					event := TransferEvent{
 						BlockNumber:       log.BlockNumber,
+						BlockHash:         log.BlockHash,
 						TxHash:            log.TxHash,
 						TxIndex:           log.TxIndex,
 						TransferType:      ERC1155_BATCH,
@@ -0,0 +1,52 @@
+package chain
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// DefaultBatchSize is how many calls are sent in one JSON-RPC batch request, if not set
+const DefaultBatchSize = 100
+
+// BatchCaller is the part of an EVM client needed to send several calls in one JSON-RPC batch
+// request. It is satisfied by the Client from NewClient and allows fakes to be injected in tests.
+type BatchCaller interface {
+	BatchCallContext(ctx context.Context, b []rpc.BatchElem) error
+}
+
+// batchClient is an *ethclient.Client that can also send batch requests over its rpc client
+type batchClient struct {
+	*ethclient.Client
+	rpcClient *rpc.Client
+}
+
+var _ Client = batchClient{}
+
+// NewClient returns the Client for an rpc client connected to a chain
+func NewClient(rpcClient *rpc.Client) Client {
+	return batchClient{Client: ethclient.NewClient(rpcClient), rpcClient: rpcClient}
+}
+
+func (c batchClient) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	return c.rpcClient.BatchCallContext(ctx, b)
+}
+
+// SendBatches sends the calls in batch requests of at most batchSize calls, one request at a time.
+// A batchSize of 0 or less means DefaultBatchSize. An error sending a request is returned, an
+// error for a single call is left in its BatchElem.Error.
+func SendBatches(ctx context.Context, client BatchCaller, calls []rpc.BatchElem, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	for from := 0; from < len(calls); from += batchSize {
+		to := from + batchSize
+		if to > len(calls) {
+			to = len(calls)
+		}
+		if err := client.BatchCallContext(ctx, calls[from:to]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/logr"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A cassette is a directory of recorded JSON-RPC calls, one file per distinct call. The file is
+// named after a hash of the call with its ids removed, since the ids depend on the order calls
+// are made in, and holds every response the call got, in order. Replaying serves the responses
+// in the same order, the last one again once all have been served.
+
+// cassetteEntry is one file of a cassette
+type cassetteEntry struct {
+	Request   json.RawMessage   `json:"request"`
+	Responses []json.RawMessage `json:"responses"`
+}
+
+// cassette is the entries of a cassette directory, keyed on file name
+type cassette struct {
+	dir     string
+	lock    sync.Mutex
+	entries map[string]*cassetteEntry
+	served  map[string]int // how many responses of each entry have been replayed
+}
+
+// newRecordingTransport returns a transport over base recording to the cassette directory dir,
+// or base if dir is empty
+func newRecordingTransport(base http.RoundTripper, dir string) (http.RoundTripper, error) {
+	if dir == "" {
+		return base, nil
+	}
+	c, err := openCassette(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingTransport{base: base, cassette: c}, nil
+}
+
+func openCassette(dir string) (*cassette, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &cassette{dir: dir, entries: make(map[string]*cassetteEntry), served: make(map[string]int)}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var entry cassetteEntry
+		if err := json.Unmarshal(contents, &entry); err != nil {
+			return nil, fmt.Errorf("cassette file %s: %w", file, err)
+		}
+		c.entries[filepath.Base(file)] = &entry
+	}
+	return c, nil
+}
+
+// record adds the response to the call, and writes the entry of the call to its file
+func (c *cassette) record(request []byte, response []byte) error {
+	name, err := cassetteFileName(request)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, exists := c.entries[name]
+	if !exists {
+		entry = &cassetteEntry{Request: append([]byte{}, request...)}
+		c.entries[name] = entry
+	}
+	entry.Responses = append(entry.Responses, append([]byte{}, response...))
+	contents, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.dir, name), contents, 0644)
+}
+
+// replay returns the next recorded response to the call, with its ids changed to those of the
+// call, or false if the call was never recorded
+func (c *cassette) replay(request []byte) ([]byte, bool, error) {
+	name, err := cassetteFileName(request)
+	if err != nil {
+		return nil, false, err
+	}
+	c.lock.Lock()
+	entry, exists := c.entries[name]
+	if !exists || len(entry.Responses) == 0 {
+		c.lock.Unlock()
+		return nil, false, nil
+	}
+	served := c.served[name]
+	if served < len(entry.Responses)-1 {
+		c.served[name] = served + 1
+	}
+	response := entry.Responses[served]
+	c.lock.Unlock()
+
+	response, err = replaceIds(entry.Request, request, response)
+	return response, true, err
+}
+
+// cassetteFileName returns the file name of a call, a hash of the call with its ids removed
+func cassetteFileName(request []byte) (string, error) {
+	var call interface{}
+	if err := json.Unmarshal(request, &call); err != nil {
+		return "", err
+	}
+	removeIds := func(message interface{}) {
+		if object, ok := message.(map[string]interface{}); ok {
+			delete(object, "id")
+		}
+	}
+	if batch, ok := call.([]interface{}); ok {
+		for _, message := range batch {
+			removeIds(message)
+		}
+	} else {
+		removeIds(call)
+	}
+	// Maps are marshalled with their keys sorted, so the same call always gives the same hash
+	canonical, err := json.Marshal(call)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(canonical)
+	return hex.EncodeToString(hash[:16]) + ".json", nil
+}
+
+// replaceIds returns the recorded response with the ids of the recorded request replaced by the
+// ids of the request now, matched on their position in a batch
+func replaceIds(recordedRequest []byte, request []byte, response []byte) ([]byte, error) {
+	recordedIds, err := messageIds(recordedRequest)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := messageIds(request)
+	if err != nil {
+		return nil, err
+	}
+	newIds := make(map[string]json.RawMessage, len(ids))
+	for i := range recordedIds {
+		newIds[string(recordedIds[i])] = ids[i]
+	}
+
+	var messages []map[string]json.RawMessage
+	if isBatch(response) {
+		err = json.Unmarshal(response, &messages)
+	} else {
+		messages = make([]map[string]json.RawMessage, 1)
+		err = json.Unmarshal(response, &messages[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, message := range messages {
+		if newId, exists := newIds[string(message["id"])]; exists {
+			message["id"] = newId
+		}
+	}
+	if isBatch(response) {
+		return json.Marshal(messages)
+	}
+	return json.Marshal(messages[0])
+}
+
+// messageIds returns the ids of the messages of a call, in order
+func messageIds(request []byte) ([]json.RawMessage, error) {
+	type idOnly struct {
+		Id json.RawMessage `json:"id"`
+	}
+	var messages []idOnly
+	var err error
+	if isBatch(request) {
+		err = json.Unmarshal(request, &messages)
+	} else {
+		messages = make([]idOnly, 1)
+		err = json.Unmarshal(request, &messages[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]json.RawMessage, len(messages))
+	for i, message := range messages {
+		ids[i] = message.Id
+	}
+	return ids, nil
+}
+
+// isBatch returns true if the JSON-RPC call or response is a batch, an array of messages
+func isBatch(message []byte) bool {
+	trimmed := bytes.TrimSpace(message)
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// recordingTransport is an http.RoundTripper that records every call made over base, and the
+// response it got, to a cassette
+type recordingTransport struct {
+	base     http.RoundTripper
+	cassette *cassette
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if err := t.cassette.record(body, respBody); err != nil {
+		logr.Warning.Printf("Call not recorded: %s\n", err)
+	}
+	return resp, nil
+}
+
+// ReplayServer is a local JSON-RPC server answering calls with the responses recorded to a
+// cassette directory with DialOptions.RecordDir, so a run can be repeated without the chain
+type ReplayServer struct {
+	// URL to connect to, in place of the url of the chain recorded
+	URL string
+
+	cassette *cassette
+	server   *http.Server
+}
+
+// NewReplayServer starts a ReplayServer for the cassette directory dir on a free local port
+func NewReplayServer(dir string) (*ReplayServer, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	c, err := openCassette(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.entries) == 0 {
+		return nil, fmt.Errorf("no calls recorded in cassette %s", dir)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &ReplayServer{URL: "http://" + listener.Addr().String(), cassette: c}
+	s.server = &http.Server{Handler: s}
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// ServeHTTP answers a call with its next recorded response, or a JSON-RPC error if the call was
+// never recorded
+func (s *ReplayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response, exists, err := s.cassette.replay(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !exists {
+		logr.Warning.Printf("Call not in cassette %s: %s\n", s.cassette.dir, body)
+		response = notRecordedResponse(body)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// notRecordedResponse returns a JSON-RPC error response to each message of the call
+func notRecordedResponse(request []byte) []byte {
+	ids, _ := messageIds(request)
+	notRecorded := func(id json.RawMessage) map[string]interface{} {
+		if len(id) == 0 {
+			id = json.RawMessage("null")
+		}
+		return map[string]interface{}{"jsonrpc": "2.0", "id": id,
+			"error": map[string]interface{}{"code": -32000, "message": "call not recorded in cassette"}}
+	}
+	var response []byte
+	if isBatch(request) {
+		var messages []map[string]interface{}
+		for _, id := range ids {
+			messages = append(messages, notRecorded(id))
+		}
+		response, _ = json.Marshal(messages)
+	} else if len(ids) == 1 {
+		response, _ = json.Marshal(notRecorded(ids[0]))
+	}
+	return response
+}
+
+// Close stops the server
+func (s *ReplayServer) Close() error {
+	err := s.server.Close()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,120 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// countingServer answers any call with the number of calls it has had
+func countingServer(t *testing.T) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		call := atomic.AddInt32(&calls, 1)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"0x%x"}`, requestId(body), call)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+// requestId returns the raw id of a single JSON-RPC call
+func requestId(body []byte) string {
+	ids, _ := messageIds(body)
+	return string(ids[0])
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	cassetteDir := t.TempDir()
+	server, calls := countingServer(t)
+
+	// Record two eth_blockNumber calls, which get different responses
+	client, err := DialContextWithOptions(context.Background(), server.URL, DialOptions{RecordDir: cassetteDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.BlockNumber(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.Close()
+	server.Close()
+
+	replay, err := NewReplayServer(cassetteDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	client, err = DialContextWithOptions(context.Background(), replay.URL, DialOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// The responses are replayed in the order recorded, then the last again
+	for _, expected := range []uint64{1, 2, 2} {
+		blockNumber, err := client.BlockNumber(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blockNumber != expected {
+			t.Errorf("expected block %v replayed, got %v", expected, blockNumber)
+		}
+	}
+	if *calls != 2 {
+		t.Errorf("expected 2 calls to the server, got %v", *calls)
+	}
+
+	// A call never recorded fails
+	if _, err := client.NetworkID(context.Background()); err == nil {
+		t.Errorf("expected an error for a call not recorded")
+	}
+}
+
+func TestReplaceIds(t *testing.T) {
+	testCases := []struct {
+		recordedRequest string
+		request         string
+		response        string
+		expected        string
+	}{
+		{`{"id":1,"method":"eth_blockNumber"}`, `{"id":7,"method":"eth_blockNumber"}`,
+			`{"id":1,"jsonrpc":"2.0","result":"0x1"}`,
+			`{"id":7,"jsonrpc":"2.0","result":"0x1"}`},
+		{`[{"id":1,"method":"a"},{"id":2,"method":"b"}]`, `[{"id":8,"method":"a"},{"id":9,"method":"b"}]`,
+			`[{"id":2,"result":"b"},{"id":1,"result":"a"}]`,
+			`[{"id":9,"result":"b"},{"id":8,"result":"a"}]`},
+	}
+	for _, tc := range testCases {
+		replaced, err := replaceIds([]byte(tc.recordedRequest), []byte(tc.request), []byte(tc.response))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(replaced) != tc.expected {
+			t.Errorf("replaceIds(%s) = %s, expected %s", tc.response, replaced, tc.expected)
+		}
+	}
+}
+
+func TestCassetteFileNameIgnoresIds(t *testing.T) {
+	first, err := cassetteFileName([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["0x1",false]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cassetteFileName([]byte(`{"method":"eth_getBlockByNumber","params":["0x1",false],"id":42,"jsonrpc":"2.0"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := cassetteFileName([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["0x2",false]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second || first == other {
+		t.Errorf("expected the same file for the same call with other ids, got %s, %s and %s", first, second, other)
+	}
+}
@@ -0,0 +1,43 @@
+package chain
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"net/http"
+)
+
+// Client is everything ethgraph reads from an EVM chain. It is satisfied by the client from
+// NewClient, which is safe for concurrent use, so one Client is shared by all the workers reading
+// a chain rather than each dialling its own. Fakes can be injected in tests.
+type Client interface {
+	LogFetcher
+	ReceiptFetcher
+	BatchCaller
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+	NetworkID(ctx context.Context) (*big.Int, error)
+	CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error)
+	CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+	Close()
+}
+
+// maxIdleConnsPerEndpoint is how many connections to each endpoint are kept open between calls,
+// enough for every worker of a pool to reuse its connection rather than open a new one
+const maxIdleConnsPerEndpoint = 100
+
+// pooledTransport is the http transport all clients make their calls over, keeping connections
+// open to be reused. http.DefaultTransport keeps only 2 per host, so with more workers than that
+// most calls would pay for a new TCP and TLS handshake.
+var pooledTransport = newPooledTransport()
+
+func newPooledTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 0
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerEndpoint
+	return transport
+}
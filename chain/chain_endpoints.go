@@ -0,0 +1,320 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/ethereum/go-ethereum/rpc"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// unhealthyAfterFailures is how many calls in a row must fail before an endpoint is unhealthy
+const unhealthyAfterFailures = 3
+
+// unhealthyCoolDown is how long an unhealthy endpoint is only used if every endpoint is
+// unhealthy, after this it is tried again like any other
+const unhealthyCoolDown = 30 * time.Second
+
+// JSON-RPC error codes of the endpoint failing rather than the call being wrong, -32000 to
+// -32099 are the range left to servers for their own errors, such as "header not found"
+const (
+	errorCodeInternal       = -32603
+	errorCodeServerErrorMax = -32000
+	errorCodeServerErrorMin = -32099
+)
+
+// endpointHealth is how calls to one endpoint have gone recently
+type endpointHealth struct {
+	consecutiveFailures int
+	unhealthyUntil      time.Time
+}
+
+// isEndpointHealthy returns false if calls of this client to the endpoint have failed recently
+func (t *endpointsTransport) isEndpointHealthy(endpointUrl string) bool {
+	t.healthLock.Lock()
+	defer t.healthLock.Unlock()
+	health, exists := t.healthMap[endpointUrl]
+	return !exists || time.Now().After(health.unhealthyUntil)
+}
+
+// recordEndpointSuccess marks the endpoint healthy again
+func (t *endpointsTransport) recordEndpointSuccess(endpointUrl string) {
+	t.healthLock.Lock()
+	defer t.healthLock.Unlock()
+	delete(t.healthMap, endpointUrl)
+}
+
+// recordEndpointFailure counts a failed call to the endpoint, marking it unhealthy once enough
+// calls in a row have failed
+func (t *endpointsTransport) recordEndpointFailure(endpointUrl string, err error) {
+	t.healthLock.Lock()
+	defer t.healthLock.Unlock()
+	health, exists := t.healthMap[endpointUrl]
+	if !exists {
+		health = &endpointHealth{}
+		t.healthMap[endpointUrl] = health
+	}
+	health.consecutiveFailures++
+	if health.consecutiveFailures >= unhealthyAfterFailures && time.Now().After(health.unhealthyUntil) {
+		health.unhealthyUntil = time.Now().Add(unhealthyCoolDown)
+		logr.Warning.Printf("Endpoint %s failed %v calls in a row, used only as a last resort for %s: %s\n",
+			redactUrl(endpointUrl), health.consecutiveFailures, unhealthyCoolDown, err)
+	}
+}
+
+// endpointsTransport is an http.RoundTripper that spreads calls across several endpoints of the
+// same chain in turn, skipping unhealthy ones, and tries a call that fails on one endpoint on
+// the others. The health of the endpoints is its own, so clients dialled to the same endpoints
+// do not mark them unhealthy for each other.
+type endpointsTransport struct {
+	base      http.RoundTripper
+	endpoints []*url.URL
+	next      uint32 // the endpoint the next call starts at
+
+	healthLock sync.Mutex // guards healthMap
+	healthMap  map[string]*endpointHealth
+}
+
+func newEndpointsTransport(base http.RoundTripper, urls []string) (*endpointsTransport, error) {
+	t := &endpointsTransport{base: base, healthMap: make(map[string]*endpointHealth)}
+	for _, endpointUrl := range urls {
+		endpoint, err := url.Parse(endpointUrl)
+		if err != nil {
+			return nil, err
+		}
+		if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+			return nil, fmt.Errorf("endpoint %s: with more than one endpoint all must be http or https", redactUrl(endpointUrl))
+		}
+		t.endpoints = append(t.endpoints, endpoint)
+	}
+	return t, nil
+}
+
+// RoundTrip sends the call to the next healthy endpoint, and on to the others if it fails there.
+// A call fails on an endpoint with a transport error, a status of 5xx or 429 Too Many Requests,
+// or a JSON-RPC error of the server such as "internal error" or "header not found".
+func (t *endpointsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The body is kept so the call can be sent again
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var lastErr error
+	var lastResp *http.Response // the last response with a JSON-RPC error, if any
+	for _, endpoint := range t.order() {
+		attemptReq := req.Clone(req.Context())
+		attemptReq.URL = endpoint
+		attemptReq.Host = endpoint.Host
+		if body != nil {
+			attemptReq.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		resp, err := t.base.RoundTrip(attemptReq)
+		if err == nil {
+			var isRpcErr bool
+			isRpcErr, err = checkEndpointResponse(resp)
+			if err == nil {
+				if lastResp != nil {
+					lastResp.Body.Close()
+				}
+				t.recordEndpointSuccess(endpoint.String())
+				return resp, nil
+			}
+			if isRpcErr {
+				if lastResp != nil {
+					lastResp.Body.Close()
+				}
+				lastResp = resp
+			}
+		}
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			if lastResp != nil {
+				lastResp.Body.Close()
+			}
+			return nil, ctxErr
+		}
+		t.recordEndpointFailure(endpoint.String(), err)
+		lastErr = err
+	}
+	// The caller gets the JSON-RPC error itself, with its code, rather than a transport error
+	if lastResp != nil {
+		return lastResp, nil
+	}
+	return nil, fmt.Errorf("call failed on all %v endpoints, last error: %w", len(t.endpoints), lastErr)
+}
+
+// checkEndpointResponse returns an error if the response is the endpoint failing: a status of
+// 5xx or 429 Too Many Requests, or a JSON-RPC error of the server, see isServerRpcError. If
+// isRpcErr is true the error is a JSON-RPC error and resp can still be read, else resp is
+// closed if err is not nil.
+func checkEndpointResponse(resp *http.Response) (isRpcErr bool, err error) {
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		resp.Body.Close()
+		return false, fmt.Errorf("status %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, nil
+	}
+	// The body is read to look for errors and put back for the caller
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return false, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if rpcErr := serverRpcError(body); rpcErr != nil {
+		return true, rpcErr
+	}
+	return false, nil
+}
+
+// jsonRpcError is the error of a JSON-RPC response
+type jsonRpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *jsonRpcError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %v: %s", e.Code, e.Message)
+}
+
+func (e *jsonRpcError) ErrorCode() int {
+	return e.Code
+}
+
+// rpcResponse is the part of a JSON-RPC response looked at for errors
+type rpcResponse struct {
+	Error *jsonRpcError `json:"error"`
+}
+
+// serverRpcError returns the first error of the JSON-RPC response, or of any response in a
+// batch, that is the server failing, or nil if there is none
+func serverRpcError(body []byte) *jsonRpcError {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil
+	}
+	var responses []rpcResponse
+	if trimmed[0] == '[' {
+		if json.Unmarshal(trimmed, &responses) != nil {
+			return nil
+		}
+	} else {
+		var response rpcResponse
+		if json.Unmarshal(trimmed, &response) != nil {
+			return nil
+		}
+		responses = []rpcResponse{response}
+	}
+	for _, response := range responses {
+		if response.Error != nil && isServerRpcError(response.Error) {
+			return response.Error
+		}
+	}
+	return nil
+}
+
+// isServerRpcError returns true if the JSON-RPC error is the endpoint failing, so the call may
+// work on another endpoint. Reverts and log queries refused as too large are the call itself,
+// and would fail the same way everywhere.
+func isServerRpcError(rpcErr *jsonRpcError) bool {
+	if rpcErr.Code != errorCodeInternal && (rpcErr.Code < errorCodeServerErrorMin || rpcErr.Code > errorCodeServerErrorMax) {
+		return false
+	}
+	if strings.Contains(strings.ToLower(rpcErr.Message), "revert") {
+		return false
+	}
+	return !isResponseTooLargeError(rpcErr)
+}
+
+// order returns the endpoints to try a call on, healthy ones first in turn, then unhealthy ones
+func (t *endpointsTransport) order() []*url.URL {
+	start := int(atomic.AddUint32(&t.next, 1) - 1)
+	var healthy, unhealthy []*url.URL
+	for i := range t.endpoints {
+		endpoint := t.endpoints[(start+i)%len(t.endpoints)]
+		if t.isEndpointHealthy(endpoint.String()) {
+			healthy = append(healthy, endpoint)
+		} else {
+			unhealthy = append(unhealthy, endpoint)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// DialEndpointsWithOptions connects a client to the chain at the urls. With one url it is
+// DialContextWithOptions. With more, all must be http or https, and calls are spread across
+// them and moved to another if one fails, held to the one rate limiter of options. The
+// endpoints are not checked to be the same chain, see CreateEvmClientWithOptions.
+func DialEndpointsWithOptions(ctx context.Context, urls []string, options DialOptions) (Client, error) {
+	switch len(urls) {
+	case 0:
+		return nil, errors.New("no endpoint url given")
+	case 1:
+		return DialContextWithOptions(ctx, urls[0], options)
+	}
+	endpoints, err := newEndpointsTransport(pooledTransport, urls)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := newRecordingTransport(endpoints, options.RecordDir)
+	if err != nil {
+		return nil, err
+	}
+	rpcClient, err := rpc.DialHTTPWithClient(urls[0], &http.Client{Transport: transport})
+	if err != nil {
+		return nil, err
+	}
+	return newLimiterClient(NewClient(rpcClient), options.RateLimiter), nil
+}
+
+// checkSameChain returns the chainId the endpoints all report, or an error if they do not agree.
+// The calls are held to limiter but not recorded.
+func checkSameChain(ctx context.Context, urls []string, limiter *RateLimiter) (string, error) {
+	var firstChainId string
+	for i, endpointUrl := range urls {
+		client, err := DialContextWithOptions(ctx, endpointUrl, DialOptions{RateLimiter: limiter})
+		if err != nil {
+			return "", fmt.Errorf("endpoint %s: %w", redactUrl(endpointUrl), err)
+		}
+		chainId, err := client.NetworkID(ctx)
+		client.Close()
+		if err != nil {
+			return "", fmt.Errorf("endpoint %s: error when reading chain to get chainId: %w", redactUrl(endpointUrl), err)
+		}
+		if i == 0 {
+			firstChainId = chainId.String()
+		} else if chainId.String() != firstChainId {
+			return "", fmt.Errorf("endpoint %s has chainId %s, but %s has chainId %s",
+				redactUrl(endpointUrl), chainId, redactUrl(urls[0]), firstChainId)
+		}
+	}
+	return firstChainId, nil
+}
+
+// redactUrl returns the url without its path, query or user, which often hold an API key
+func redactUrl(endpointUrl string) string {
+	endpoint, err := url.Parse(endpointUrl)
+	if err != nil || endpoint.Host == "" {
+		return "<endpoint>"
+	}
+	redacted := endpoint.Scheme + "://" + endpoint.Host
+	if strings.Trim(endpoint.Path, "/") != "" || endpoint.RawQuery != "" || endpoint.User != nil {
+		redacted += "/..."
+	}
+	return redacted
+}
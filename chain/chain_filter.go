@@ -0,0 +1,179 @@
+package chain
+
+import (
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"sort"
+	"strings"
+)
+
+// maxWalletAddressesPerQuery caps how many wallet addresses go into the topic filter of a single
+// log query, providers reject very large filters
+const maxWalletAddressesPerQuery = 100
+
+// TransferFilter describes which transfer event logs are selected from the chain
+type TransferFilter struct {
+	// TokenAddresses restricts logs to those emitted by these token contracts, empty means any token
+	TokenAddresses []common.Address
+
+	// WalletAddresses restricts logs to those where any of these addresses is the from or to
+	// address of the movement, empty means any address
+	WalletAddresses []common.Address
+}
+
+// NewTransferFilter creates a filter for all transfer events, or only those emitted by the
+// token onlyThisTokenAddress if it is not empty
+func NewTransferFilter(onlyThisTokenAddress string) TransferFilter {
+	var tokenAddresses []common.Address
+	if onlyThisTokenAddress != "" {
+		tokenAddresses = []common.Address{common.HexToAddress(onlyThisTokenAddress)}
+	}
+	return TransferFilter{TokenAddresses: tokenAddresses}
+}
+
+// queries returns the log filter queries, without block range, that together select the
+// transfer events the filter describes. The topics of a query are AND-ed together, so wallet
+// addresses in the from position and in the to position each need their own query. The from
+// and to addresses are topics[1] and topics[2] for ERC20 and ERC721, but topics[2] and topics[3]
+// for ERC1155 since topics[1] is the operator.
+func (filter TransferFilter) queries() []ethereum.FilterQuery {
+	tokensTopic := []common.Hash{common.HexToHash(transferEventKeccakTokens)}
+	hybridTopic := []common.Hash{common.HexToHash(transferEventKeccakHybridSingle),
+		common.HexToHash(transferEventKeccakHybridBatch)}
+
+	if len(filter.WalletAddresses) == 0 {
+		return []ethereum.FilterQuery{{
+			Addresses: filter.TokenAddresses,
+			Topics:    [][]common.Hash{append(tokensTopic, hybridTopic...)},
+		}}
+	}
+
+	var queries []ethereum.FilterQuery
+	for start := 0; start < len(filter.WalletAddresses); start += maxWalletAddressesPerQuery {
+		end := start + maxWalletAddressesPerQuery
+		if end > len(filter.WalletAddresses) {
+			end = len(filter.WalletAddresses)
+		}
+		walletTopic := addressesToTopics(filter.WalletAddresses[start:end])
+		queries = append(queries,
+			// ERC20 and ERC721 from, then to
+			ethereum.FilterQuery{Addresses: filter.TokenAddresses, Topics: [][]common.Hash{tokensTopic, walletTopic}},
+			ethereum.FilterQuery{Addresses: filter.TokenAddresses, Topics: [][]common.Hash{tokensTopic, {}, walletTopic}},
+			// ERC1155 from, then to
+			ethereum.FilterQuery{Addresses: filter.TokenAddresses, Topics: [][]common.Hash{hybridTopic, {}, walletTopic}},
+			ethereum.FilterQuery{Addresses: filter.TokenAddresses, Topics: [][]common.Hash{hybridTopic, {}, {}, walletTopic}},
+		)
+	}
+	return queries
+}
+
+// matchesLog returns true if the log is a transfer event log selected by the filter. This is
+// the same selection the queries make, for logs that were read some other way.
+func (filter TransferFilter) matchesLog(log *types.Log) bool {
+	if len(log.Topics) == 0 {
+		return false
+	}
+	var fromPosition, toPosition int
+	switch log.Topics[0].Hex() {
+	case transferEventKeccakTokens:
+		if len(log.Topics) != 3 && len(log.Topics) != 4 {
+			return false
+		}
+		fromPosition, toPosition = 1, 2
+	case transferEventKeccakHybridSingle, transferEventKeccakHybridBatch:
+		if len(log.Topics) != 4 {
+			return false
+		}
+		fromPosition, toPosition = 2, 3
+	default:
+		return false
+	}
+
+	if len(filter.TokenAddresses) > 0 && !containsAddress(filter.TokenAddresses, log.Address) {
+		return false
+	}
+	if len(filter.WalletAddresses) > 0 &&
+		!containsAddress(filter.WalletAddresses, common.BytesToAddress(log.Topics[fromPosition].Bytes())) &&
+		!containsAddress(filter.WalletAddresses, common.BytesToAddress(log.Topics[toPosition].Bytes())) {
+		return false
+	}
+	return true
+}
+
+// MatchesEvent returns true if the event is selected by the filter, for events that were read
+// without the filter, for example from a local store
+func (filter TransferFilter) MatchesEvent(event *TransferEvent) bool {
+	if len(filter.TokenAddresses) > 0 && !containsAddress(filter.TokenAddresses, event.LogEmitterAddress) {
+		return false
+	}
+	if len(filter.WalletAddresses) > 0 &&
+		!containsAddress(filter.WalletAddresses, event.LogAddressFrom) &&
+		!containsAddress(filter.WalletAddresses, event.LogAddressTo) {
+		return false
+	}
+	return true
+}
+
+// IsAll returns true if the filter selects every transfer event
+func (filter TransferFilter) IsAll() bool {
+	return len(filter.TokenAddresses) == 0 && len(filter.WalletAddresses) == 0
+}
+
+// Key returns a string that is the same for filters that select the same events, whatever the
+// order of their addresses
+func (filter TransferFilter) Key() string {
+	if filter.IsAll() {
+		return "all"
+	}
+	return "tokens=" + addressesKey(filter.TokenAddresses) + ";wallets=" + addressesKey(filter.WalletAddresses)
+}
+
+func addressesKey(addresses []common.Address) string {
+	hexAddresses := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		hexAddresses = append(hexAddresses, strings.ToLower(address.Hex()))
+	}
+	sort.Strings(hexAddresses)
+	return strings.Join(hexAddresses, ",")
+}
+
+func containsAddress(addresses []common.Address, address common.Address) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// addressesToTopics left pads addresses to 32 bytes, which is how indexed addresses appear in topics
+func addressesToTopics(addresses []common.Address) []common.Hash {
+	topics := make([]common.Hash, 0, len(addresses))
+	for _, address := range addresses {
+		topics = append(topics, common.BytesToHash(address.Bytes()))
+	}
+	return topics
+}
+
+// logKey uniquely identifies a log on chain
+type logKey struct {
+	txHash common.Hash
+	index  uint
+}
+
+// removeDuplicateLogs removes logs seen more than once, which happens when a log matches
+// more than one query, for example a movement between two of the wallet addresses
+func removeDuplicateLogs(logs []types.Log) []types.Log {
+	seen := make(map[logKey]bool, len(logs))
+	uniqueLogs := logs[:0]
+	for _, log := range logs {
+		key := logKey{txHash: log.TxHash, index: log.Index}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		uniqueLogs = append(uniqueLogs, log)
+	}
+	return uniqueLogs
+}
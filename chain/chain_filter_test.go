@@ -0,0 +1,93 @@
+package chain
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"testing"
+)
+
+const testWalletAddress = "0x71660c4005BA85c37ccec55d0C4493E66Fe775d3"
+
+func TestTransferFilterQueriesWithoutWallets(t *testing.T) {
+	filter := NewTransferFilter("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	queries := filter.queries()
+	if len(queries) != 1 {
+		t.Fatalf("expected 1 query, got %v", len(queries))
+	}
+	if len(queries[0].Addresses) != 1 {
+		t.Errorf("expected 1 token address, got %v", len(queries[0].Addresses))
+	}
+	if len(queries[0].Topics) != 1 || len(queries[0].Topics[0]) != 3 {
+		t.Errorf("expected only topic[0] with 3 event signatures, got %v", queries[0].Topics)
+	}
+}
+
+func TestTransferFilterQueriesWithWallets(t *testing.T) {
+	wallet := common.HexToAddress(testWalletAddress)
+	walletTopic := common.BytesToHash(wallet.Bytes())
+	filter := TransferFilter{WalletAddresses: []common.Address{wallet}}
+	queries := filter.queries()
+	if len(queries) != 4 {
+		t.Fatalf("expected 4 queries, got %v", len(queries))
+	}
+
+	// The wallet must be in the from or to position for each token standard
+	expectedWalletPositions := []int{1, 2, 2, 3}
+	for i, query := range queries {
+		position := expectedWalletPositions[i]
+		if len(query.Topics) != position+1 {
+			t.Errorf("query %v expected %v topics, got %v", i, position+1, len(query.Topics))
+			continue
+		}
+		if len(query.Topics[position]) != 1 || query.Topics[position][0] != walletTopic {
+			t.Errorf("query %v expected wallet topic in position %v, got %v", i, position, query.Topics)
+		}
+	}
+}
+
+func TestTransferFilterQueriesChunkWallets(t *testing.T) {
+	filter := TransferFilter{}
+	for i := 0; i < maxWalletAddressesPerQuery+1; i++ {
+		filter.WalletAddresses = append(filter.WalletAddresses, common.BigToAddress(common.Big1))
+	}
+	queries := filter.queries()
+	if len(queries) != 8 {
+		t.Errorf("expected 8 queries for two chunks of wallets, got %v", len(queries))
+	}
+}
+
+func TestRemoveDuplicateLogs(t *testing.T) {
+	txHash := common.HexToHash("0x244c8173556a0e15b26db7a7729a66cca0f8689a19a7b6e709ccfe47096074a0")
+	logs := []types.Log{
+		{TxHash: txHash, Index: 8},
+		{TxHash: txHash, Index: 9},
+		{TxHash: txHash, Index: 8},
+	}
+	uniqueLogs := removeDuplicateLogs(logs)
+	if len(uniqueLogs) != 2 {
+		t.Errorf("expected 2 unique logs, got %v", len(uniqueLogs))
+	}
+}
+
+func TestTransferFilterKeyAndMatchesEvent(t *testing.T) {
+	wallet := common.HexToAddress(testWalletAddress)
+	other := common.BigToAddress(common.Big1)
+	filter := TransferFilter{WalletAddresses: []common.Address{wallet, other}}
+	reordered := TransferFilter{WalletAddresses: []common.Address{other, wallet}}
+	if filter.Key() != reordered.Key() {
+		t.Errorf("expected the same key whatever the address order, got %s and %s", filter.Key(), reordered.Key())
+	}
+	if filter.Key() == (TransferFilter{TokenAddresses: []common.Address{wallet, other}}).Key() {
+		t.Errorf("expected token and wallet filters to have different keys")
+	}
+	if (TransferFilter{}).Key() != "all" {
+		t.Errorf("expected key all for empty filter, got %s", (TransferFilter{}).Key())
+	}
+
+	if !filter.MatchesEvent(&TransferEvent{LogAddressTo: wallet}) {
+		t.Errorf("expected event to the wallet to match")
+	}
+	if filter.MatchesEvent(&TransferEvent{LogEmitterAddress: wallet}) {
+		t.Errorf("expected event emitted by the wallet not to match a wallet filter")
+	}
+}
@@ -18,6 +18,9 @@ type TransferEvent struct {
 	// Block number
 	BlockNumber uint64
 
+	// Block hash, identifies which block at BlockNumber the event was read from if the chain reorganises
+	BlockHash common.Hash
+
 	// Block timestamp from chain (enrichment)
 	BlockTimestamp time.Time
 
@@ -73,6 +76,7 @@ type TransferEvent struct {
 func (event *TransferEvent) Print(title string) {
 	logr.Info.Println("------------", title, " -----------")
 	logr.Info.Println("BlockNumber:", event.BlockNumber)
+	logr.Info.Println("BlockHash:", event.BlockHash.Hex())
 	logr.Info.Println("BlockTimestamp:", event.BlockTimestamp.Format("2006-01-02 15:04:05"))
 	logr.Info.Println("TxHash:", event.TxHash.Hex())
 	logr.Info.Println("TxIndex:", event.TxIndex)
@@ -0,0 +1,186 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/ethereum/go-ethereum/rpc"
+	"strings"
+	"time"
+)
+
+// Window sizes are in blocks. Providers cap both the block span and the result size of
+// a single eth_getLogs, so the window starts small and adapts to what the chain returns.
+const defaultInitialWindow uint64 = 10
+const defaultMaxWindow uint64 = 2_000
+
+// defaultSparseLogCount is the number of logs below which a window is considered sparse
+// and the next window is doubled
+const defaultSparseLogCount = 1_000
+
+// defaultDenseLogCount is the number of logs above which a window is considered dense
+// and the next window is halved, before the provider starts refusing queries
+const defaultDenseLogCount = 5_000
+
+// defaultCeilingDecayWindows is how many windows are fetched after a refusal before the window
+// may grow to the size that was refused again
+const defaultCeilingDecayWindows = 50
+
+// errorCodeLimitExceeded is the JSON-RPC error code some providers (e.g. Infura) use when
+// a log query returns too many results
+const errorCodeLimitExceeded = -32005
+
+// responseTooLargeErrorFragments are lowercase fragments of the error messages providers
+// return when a log query spans too many blocks or returns too many results
+var responseTooLargeErrorFragments = []string{
+	"too many results",
+	"response size exceeded",
+	"response size is larger",
+	"query returned more than",
+	"log response size exceeded",
+	"block range is too large",
+	"block range too large",
+	"exceed maximum block range",
+	"range limit exceeded",
+	"query timeout exceeded",
+}
+
+// RangeFetcher fetches transfer events over a block range using eth_getLogs queries of
+// [from, to] windows. When the provider refuses a window as too large the window is
+// bisected and retried, and when results are sparse the window is grown again, but only
+// toward the size refused, not back to it, until the refusal has decayed.
+type RangeFetcher struct {
+	client LogFetcher
+	filter TransferFilter
+	window uint64
+
+	// ceiling is the size of the last window refused, 0 if none, and ceilingAge is how many
+	// windows have been fetched since
+	ceiling    uint64
+	ceilingAge int
+
+	// MaxWindow is the largest window in blocks that is ever queried
+	MaxWindow uint64
+
+	// SparseLogCount is the log count below which the next window is doubled
+	SparseLogCount int
+
+	// DenseLogCount is the log count above which the next window is halved
+	DenseLogCount int
+
+	// CeilingDecayWindows is how many windows are fetched after a refusal before the window may
+	// grow to the size refused again, as the density of logs changes along the chain
+	CeilingDecayWindows int
+
+	// ThrottleDelay is an optional pause before each query, some chain providers throttle calls
+	ThrottleDelay time.Duration
+
+	// OnWindowFetched is optionally called after each window has been fetched successfully
+	OnWindowFetched func(blockFrom uint64, blockTo uint64, events []*TransferEvent)
+}
+
+// NewRangeFetcher creates a RangeFetcher with default window sizes
+func NewRangeFetcher(client LogFetcher, filter TransferFilter) *RangeFetcher {
+	return &RangeFetcher{
+		client:              client,
+		filter:              filter,
+		window:              defaultInitialWindow,
+		MaxWindow:           defaultMaxWindow,
+		SparseLogCount:      defaultSparseLogCount,
+		DenseLogCount:       defaultDenseLogCount,
+		CeilingDecayWindows: defaultCeilingDecayWindows,
+	}
+}
+
+// FetchEvents returns all transfer events in the block range [blockFrom, blockTo]. If it fails
+// part way through, for example because ctx is cancelled, the events of the windows already
+// fetched are returned along with the error.
+func (f *RangeFetcher) FetchEvents(ctx context.Context, blockFrom uint64, blockTo uint64) ([]*TransferEvent, error) {
+	var allEvents []*TransferEvent
+	from := blockFrom
+	for from <= blockTo {
+		to := blockTo
+		if blockTo-from >= f.window {
+			to = from + f.window - 1
+		}
+
+		if f.ThrottleDelay > 0 {
+			select {
+			case <-time.After(f.ThrottleDelay):
+			case <-ctx.Done():
+				return allEvents, ctx.Err()
+			}
+		}
+		logs, err := getTransferLogsByBlockRange(ctx, f.client, from, to, f.filter)
+		if err != nil {
+			if isResponseTooLargeError(err) && to > from {
+				// Bisect the window and retry the same starting block, and grow no larger than
+				// this again until the refusal has decayed
+				f.ceiling = to - from + 1
+				f.ceilingAge = 0
+				f.window = f.ceiling / 2
+				logr.Trace.Printf("Blocks %v to %v refused by provider, window reduced to %v blocks\n", from, to, f.window)
+				continue
+			}
+			return allEvents, err
+		}
+		logr.Trace.Println("Blocks: ", from, "to", to, "Logs found: ", len(logs))
+
+		events := logsToEvents(logs)
+		if f.OnWindowFetched != nil {
+			f.OnWindowFetched(from, to, events)
+		}
+		allEvents = append(allEvents, events...)
+		f.adjustWindow(len(logs), to-from+1)
+
+		if to == blockTo {
+			break
+		}
+		from = to + 1
+	}
+	return allEvents, nil
+}
+
+// adjustWindow grows or shrinks the window for the next query based on how many logs the
+// last query of windowUsed blocks returned. Below the ceiling of the last refusal the window
+// grows halfway to it rather than doubling, so it never reaches the size refused.
+func (f *RangeFetcher) adjustWindow(logCount int, windowUsed uint64) {
+	if f.ceiling > 0 {
+		f.ceilingAge++
+		if f.ceilingAge >= f.CeilingDecayWindows {
+			f.ceiling = 0
+		}
+	}
+	switch {
+	case logCount < f.SparseLogCount && windowUsed == f.window:
+		if f.ceiling > 0 && f.window*2 >= f.ceiling {
+			f.window += (f.ceiling - f.window) / 2
+		} else {
+			f.window *= 2
+		}
+	case logCount > f.DenseLogCount:
+		f.window /= 2
+	}
+	if f.window > f.MaxWindow {
+		f.window = f.MaxWindow
+	}
+	if f.window < 1 {
+		f.window = 1
+	}
+}
+
+// isResponseTooLargeError returns true if err is the provider refusing a log query because
+// its block range or result size is too large
+func isResponseTooLargeError(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == errorCodeLimitExceeded {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, fragment := range responseTooLargeErrorFragments {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
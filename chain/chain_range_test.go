@@ -0,0 +1,150 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"testing"
+)
+
+// fakeLogFetcher returns logsPerBlock ERC20 transfer logs for every block, and refuses queries
+// spanning more than maxBlocks blocks the way a provider does
+type fakeLogFetcher struct {
+	logsPerBlock int
+	maxBlocks    uint64
+	queries      int
+	refusals     int
+}
+
+func (f *fakeLogFetcher) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.queries++
+	from := q.FromBlock.Uint64()
+	to := q.ToBlock.Uint64()
+	if to-from+1 > f.maxBlocks {
+		f.refusals++
+		return nil, errors.New("query returned more than 10000 results")
+	}
+	var logs []types.Log
+	for block := from; block <= to; block++ {
+		for i := 0; i < f.logsPerBlock; i++ {
+			logs = append(logs, types.Log{
+				Address: common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"),
+				Topics: []common.Hash{common.HexToHash(transferEventKeccakTokens),
+					common.HexToHash("0x01"),
+					common.HexToHash("0x02")},
+				Data:        big.NewInt(int64(block)).Bytes(),
+				BlockNumber: block,
+				Index:       uint(i),
+			})
+		}
+	}
+	return logs, nil
+}
+
+func TestRangeFetcherBisectsRefusedWindows(t *testing.T) {
+	fake := &fakeLogFetcher{logsPerBlock: 2, maxBlocks: 3}
+	fetcher := NewRangeFetcher(fake, TransferFilter{})
+
+	events, err := fetcher.FetchEvents(context.Background(), 100, 149)
+	if err != nil {
+		t.Fatalf("FetchEvents returned an error: %v", err)
+	}
+	if len(events) != 100 {
+		t.Fatalf("expected 100 events, got %v", len(events))
+	}
+	seen := make(map[uint64]int)
+	for _, event := range events {
+		seen[event.BlockNumber]++
+	}
+	for block := uint64(100); block <= 149; block++ {
+		if seen[block] != 2 {
+			t.Errorf("expected 2 events for block %v, got %v", block, seen[block])
+		}
+	}
+}
+
+func TestRangeFetcherGrowsSparseWindows(t *testing.T) {
+	fake := &fakeLogFetcher{logsPerBlock: 1, maxBlocks: 10_000}
+	fetcher := NewRangeFetcher(fake, TransferFilter{})
+
+	events, err := fetcher.FetchEvents(context.Background(), 0, 9_999)
+	if err != nil {
+		t.Fatalf("FetchEvents returned an error: %v", err)
+	}
+	if len(events) != 10_000 {
+		t.Fatalf("expected 10000 events, got %v", len(events))
+	}
+	// One query per block would be 10000 queries, growing windows needs far fewer
+	if fake.queries > 20 {
+		t.Errorf("expected window growth to need at most 20 queries, got %v", fake.queries)
+	}
+}
+
+func TestRangeFetcherDoesNotGrowBackToRefusedWindow(t *testing.T) {
+	fake := &fakeLogFetcher{logsPerBlock: 1, maxBlocks: 100}
+	fetcher := NewRangeFetcher(fake, TransferFilter{})
+
+	events, err := fetcher.FetchEvents(context.Background(), 0, 9_999)
+	if err != nil {
+		t.Fatalf("FetchEvents returned an error: %v", err)
+	}
+	if len(events) != 10_000 {
+		t.Fatalf("expected 10000 events, got %v", len(events))
+	}
+	// Doubling straight back to the refused window would refuse every other query, over 100.
+	// With the ceiling the window closes in on the limit with a few refusals, and a few more
+	// each time the ceiling decays.
+	if fake.refusals > 20 {
+		t.Errorf("expected at most 20 refused queries, got %v of %v", fake.refusals, fake.queries)
+	}
+}
+
+func TestRangeFetcherFailsOnSingleBlockRefused(t *testing.T) {
+	fake := &fakeLogFetcher{logsPerBlock: 1, maxBlocks: 0}
+	fetcher := NewRangeFetcher(fake, TransferFilter{})
+
+	_, err := fetcher.FetchEvents(context.Background(), 0, 10)
+	if err == nil {
+		t.Fatalf("expected an error when a single block is refused")
+	}
+}
+
+func TestRangeFetcherReturnsEventsSoFarWhenCancelled(t *testing.T) {
+	fake := &fakeLogFetcher{logsPerBlock: 1, maxBlocks: 10_000}
+	fetcher := NewRangeFetcher(fake, TransferFilter{})
+	ctx, cancel := context.WithCancel(context.Background())
+	fetcher.OnWindowFetched = func(blockFrom uint64, blockTo uint64, events []*TransferEvent) {
+		cancel()
+	}
+
+	events, err := fetcher.FetchEvents(ctx, 0, 9_999)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	if len(events) != int(defaultInitialWindow) || fake.queries != 1 {
+		t.Errorf("expected only the first window of %v events from 1 query, got %v events from %v queries",
+			defaultInitialWindow, len(events), fake.queries)
+	}
+}
+
+func TestIsResponseTooLargeError(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{errors.New("query returned more than 10000 results"), true},
+		{errors.New("Log response size exceeded. You can make eth_getLogs requests with up to a 2K block range"), true},
+		{errors.New("connection refused"), false},
+	}
+	for _, tc := range testCases {
+		if actual := isResponseTooLargeError(tc.err); actual != tc.expected {
+			t.Errorf("isResponseTooLargeError(%q) = %v, expected %v", tc.err, actual, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/time/rate"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// slowdownStartRequestsPerSecond is the rate calls are slowed to when the provider first says
+// the calls are too fast, if no rate limit was set
+const slowdownStartRequestsPerSecond = 10
+
+// minRequestsPerSecond is the slowest calls are ever slowed to
+const minRequestsPerSecond = 0.5
+
+// slowdownCoolDown is how long after one slowdown before another, so many calls refused at the
+// same time only slow calls down once
+const slowdownCoolDown = time.Second
+
+// speedUpAfterSuccesses is how many calls in a row must succeed after a slowdown before calls
+// are sped up again, by speedUpFactor each time, up to the rate limit set
+const speedUpAfterSuccesses = 20
+const speedUpFactor = 1.25
+
+// unlimitedRequestsPerSecond is the rate above which calls are no longer limited, when speeding
+// up again if no rate limit was set
+const unlimitedRequestsPerSecond = 1_000
+
+// maxRateLimitedRetries is how many times a call the provider refuses as too fast is retried,
+// after slowing down, before the refusal is returned
+const maxRateLimitedRetries = 5
+
+// rateLimitErrorFragments are lowercase fragments of the JSON-RPC error messages providers
+// return when calls are made too fast
+var rateLimitErrorFragments = []string{
+	"rate limit",
+	"ratelimit",
+	"too many requests",
+	"requests per second",
+	"exceeded the rate",
+}
+
+// RateLimit caps the calls made to chain, see NewRateLimiter
+type RateLimit struct {
+	// RequestsPerSecond is the most calls started per second, 0 means no limit
+	RequestsPerSecond float64
+
+	// MaxConcurrency is the most calls in flight at the same time, 0 means no limit
+	MaxConcurrency int
+}
+
+// DialOptions says how the calls of a client are made. The zero value is no rate limit and no
+// recording.
+type DialOptions struct {
+	// RateLimiter holds the calls to a rate limit, whether over http, https, ws or wss. Clients
+	// dialled with the same RateLimiter share its limit. nil means a RateLimiter of its own with
+	// no limit, so calls still slow down if the provider says they are too fast.
+	RateLimiter *RateLimiter
+
+	// RecordDir if not empty is the cassette directory every call made over http and https is
+	// recorded to, adding to any calls already recorded there, see NewReplayServer
+	RecordDir string
+}
+
+// DialContextWithOptions connects a client to the chain at url. All calls made with the client
+// are held to the rate limiter of options. For http and https urls the calls are also recorded
+// if options has a RecordDir, other urls like ws and wss connect without recording.
+func DialContextWithOptions(ctx context.Context, url string, options DialOptions) (Client, error) {
+	var rpcClient *rpc.Client
+	var err error
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		var transport http.RoundTripper
+		transport, err = newRecordingTransport(pooledTransport, options.RecordDir)
+		if err != nil {
+			return nil, err
+		}
+		rpcClient, err = rpc.DialHTTPWithClient(url, &http.Client{Transport: transport})
+	} else {
+		rpcClient, err = rpc.DialContext(ctx, url)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newLimiterClient(NewClient(rpcClient), options.RateLimiter), nil
+}
+
+// RateLimiter holds calls to a rate limit and a number in flight, and slows down when the
+// provider says the calls are too fast. It is safe to share by clients used at the same time.
+type RateLimiter struct {
+	limiter  *rate.Limiter
+	maxLimit rate.Limit    // the rate limit set, calls are never sped up past this
+	slots    chan struct{} // a call holds a slot while in flight, nil if no limit
+
+	lock         sync.Mutex // guards the rest
+	successes    int
+	lastSlowdown time.Time
+}
+
+// NewRateLimiter returns a RateLimiter holding calls to limit
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	maxLimit := rate.Inf
+	if limit.RequestsPerSecond > 0 {
+		maxLimit = rate.Limit(limit.RequestsPerSecond)
+	}
+	l := &RateLimiter{
+		limiter:  rate.NewLimiter(maxLimit, 1),
+		maxLimit: maxLimit,
+	}
+	if limit.MaxConcurrency > 0 {
+		l.slots = make(chan struct{}, limit.MaxConcurrency)
+	}
+	return l
+}
+
+// do makes a call with call once there is a slot free and the rate limit allows it. If the
+// provider says the call is too fast, calls are slowed down and the call is tried again, up to
+// maxRateLimitedRetries times before the refusal is returned.
+func (l *RateLimiter) do(ctx context.Context, call func() error) error {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+			defer func() { <-l.slots }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		if err := l.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		err := call()
+		if !isRateLimitError(err) {
+			l.speedUp()
+			return err
+		}
+		l.slowDown()
+		if attempt >= maxRateLimitedRetries {
+			return err
+		}
+	}
+}
+
+// rateLimitedClient is a Client making every call, whatever its transport, held to a rate
+// limiter, which can be shared with other clients. A batch request is one call.
+type rateLimitedClient struct {
+	Client
+	*RateLimiter
+}
+
+func newRateLimitedClient(client Client, limit RateLimit) *rateLimitedClient {
+	return newLimiterClient(client, NewRateLimiter(limit))
+}
+
+// newLimiterClient returns a client making its calls with client held to limiter, or to a
+// limiter of its own with no limit if limiter is nil
+func newLimiterClient(client Client, limiter *RateLimiter) *rateLimitedClient {
+	if limiter == nil {
+		limiter = NewRateLimiter(RateLimit{})
+	}
+	return &rateLimitedClient{Client: client, RateLimiter: limiter}
+}
+
+func (c *rateLimitedClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) (logs []types.Log, err error) {
+	err = c.do(ctx, func() error {
+		var callErr error
+		logs, callErr = c.Client.FilterLogs(ctx, q)
+		return callErr
+	})
+	return logs, err
+}
+
+func (c *rateLimitedClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (receipt *types.Receipt, err error) {
+	err = c.do(ctx, func() error {
+		var callErr error
+		receipt, callErr = c.Client.TransactionReceipt(ctx, txHash)
+		return callErr
+	})
+	return receipt, err
+}
+
+func (c *rateLimitedClient) BlockByNumber(ctx context.Context, number *big.Int) (block *types.Block, err error) {
+	err = c.do(ctx, func() error {
+		var callErr error
+		block, callErr = c.Client.BlockByNumber(ctx, number)
+		return callErr
+	})
+	return block, err
+}
+
+func (c *rateLimitedClient) HeaderByNumber(ctx context.Context, number *big.Int) (header *types.Header, err error) {
+	err = c.do(ctx, func() error {
+		var callErr error
+		header, callErr = c.Client.HeaderByNumber(ctx, number)
+		return callErr
+	})
+	return header, err
+}
+
+func (c *rateLimitedClient) BlockNumber(ctx context.Context) (blockNumber uint64, err error) {
+	err = c.do(ctx, func() error {
+		var callErr error
+		blockNumber, callErr = c.Client.BlockNumber(ctx)
+		return callErr
+	})
+	return blockNumber, err
+}
+
+func (c *rateLimitedClient) NetworkID(ctx context.Context) (networkId *big.Int, err error) {
+	err = c.do(ctx, func() error {
+		var callErr error
+		networkId, callErr = c.Client.NetworkID(ctx)
+		return callErr
+	})
+	return networkId, err
+}
+
+func (c *rateLimitedClient) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) (code []byte, err error) {
+	err = c.do(ctx, func() error {
+		var callErr error
+		code, callErr = c.Client.CodeAt(ctx, contract, blockNumber)
+		return callErr
+	})
+	return code, err
+}
+
+func (c *rateLimitedClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) (result []byte, err error) {
+	err = c.do(ctx, func() error {
+		var callErr error
+		result, callErr = c.Client.CallContract(ctx, call, blockNumber)
+		return callErr
+	})
+	return result, err
+}
+
+func (c *rateLimitedClient) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (sub ethereum.Subscription, err error) {
+	err = c.do(ctx, func() error {
+		var callErr error
+		sub, callErr = c.Client.SubscribeNewHead(ctx, ch)
+		return callErr
+	})
+	return sub, err
+}
+
+// rateLimitedBatchError is the error of a call in a batch refused as too fast
+type rateLimitedBatchError struct {
+	err error
+}
+
+func (e *rateLimitedBatchError) Error() string {
+	return e.err.Error()
+}
+
+// BatchCallContext sends the batch as one call. If the provider refuses some of the calls in
+// the batch as too fast, only those are sent again.
+func (c *rateLimitedClient) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	pending := make([]int, len(b))
+	for i := range b {
+		pending[i] = i
+	}
+	err := c.do(ctx, func() error {
+		batch := make([]rpc.BatchElem, len(pending))
+		for j, i := range pending {
+			batch[j] = b[i]
+			batch[j].Error = nil
+		}
+		if err := c.Client.BatchCallContext(ctx, batch); err != nil {
+			return err
+		}
+		var refused []int
+		for j, i := range pending {
+			b[i].Error = batch[j].Error
+			if isRateLimitError(batch[j].Error) {
+				refused = append(refused, i)
+			}
+		}
+		pending = refused
+		if len(pending) > 0 {
+			return &rateLimitedBatchError{err: b[pending[0]].Error}
+		}
+		return nil
+	})
+	// Calls still refused after the retries keep their error in their BatchElem
+	var batchErr *rateLimitedBatchError
+	if errors.As(err, &batchErr) {
+		return nil
+	}
+	return err
+}
+
+// slowDown halves the rate limit, unless it was slowed down very recently
+func (l *RateLimiter) slowDown() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.successes = 0
+	if time.Since(l.lastSlowdown) < slowdownCoolDown {
+		return
+	}
+	l.lastSlowdown = time.Now()
+
+	limit := l.limiter.Limit()
+	if limit == rate.Inf {
+		limit = slowdownStartRequestsPerSecond
+	} else {
+		limit /= 2
+	}
+	if limit < minRequestsPerSecond {
+		limit = minRequestsPerSecond
+	}
+	l.limiter.SetLimit(limit)
+	logr.Warning.Printf("Provider says calls are too fast, slowing to %.1f calls per second\n", float64(limit))
+}
+
+// speedUp raises the rate limit back towards the one set, after enough calls in a row succeed
+func (l *RateLimiter) speedUp() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	limit := l.limiter.Limit()
+	if limit == l.maxLimit {
+		return
+	}
+	l.successes++
+	if l.successes < speedUpAfterSuccesses {
+		return
+	}
+	l.successes = 0
+	limit *= speedUpFactor
+	if limit > l.maxLimit || l.maxLimit == rate.Inf && limit > unlimitedRequestsPerSecond {
+		limit = l.maxLimit
+	}
+	l.limiter.SetLimit(limit)
+	logr.Trace.Printf("Calls sped up to %.1f calls per second\n", float64(limit))
+}
+
+// isRateLimitError returns true if err is the provider refusing the call as too fast, either
+// with HTTP status 429 or a JSON-RPC error saying so
+func isRateLimitError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, fragment := range rateLimitErrorFragments {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
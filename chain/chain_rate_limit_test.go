@@ -0,0 +1,295 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/time/rate"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const okResponse = `{"jsonrpc":"2.0","id":1,"result":"0x1"}`
+
+// rateLimitingServer refuses its first refusals calls with refusal, then answers okResponse
+func rateLimitingServer(t *testing.T, refusals int32, refusal func(w http.ResponseWriter)) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "eth_blockNumber") {
+			t.Errorf("expected the call body sent every time, got %q", body)
+		}
+		if atomic.AddInt32(&calls, 1) <= refusals {
+			refusal(w)
+			return
+		}
+		io.WriteString(w, okResponse)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+// dialRateLimited connects a client held to limit to the server at url
+func dialRateLimited(t *testing.T, url string, limit RateLimit) *rateLimitedClient {
+	rpcClient, err := rpc.DialHTTP(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newRateLimitedClient(NewClient(rpcClient), limit)
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestRateLimitedClientRetriesAndSlowsDown(t *testing.T) {
+	testCases := []struct {
+		name    string
+		refusal func(w http.ResponseWriter)
+	}{
+		{"HTTP 429", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}},
+		{"JSON-RPC error", func(w http.ResponseWriter) {
+			io.WriteString(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32005,"message":"Your app has exceeded its compute units per second capacity, see rate limits"}}`)
+		}},
+	}
+	for _, tc := range testCases {
+		server, calls := rateLimitingServer(t, 1, tc.refusal)
+		client := dialRateLimited(t, server.URL, RateLimit{RequestsPerSecond: 100})
+
+		if blockNumber, err := client.BlockNumber(context.Background()); err != nil || blockNumber != 1 {
+			t.Errorf("%s: expected the call retried until answered, got block %v, error %v", tc.name, blockNumber, err)
+		}
+		if *calls != 2 {
+			t.Errorf("%s: expected 2 calls, got %v", tc.name, *calls)
+		}
+		if limit := client.limiter.Limit(); limit != 50 {
+			t.Errorf("%s: expected the rate halved to 50, got %v", tc.name, limit)
+		}
+	}
+}
+
+func TestRateLimitedClientGivesUp(t *testing.T) {
+	server, calls := rateLimitingServer(t, 100, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	client := dialRateLimited(t, server.URL, RateLimit{})
+	client.limiter.SetBurst(maxRateLimitedRetries + 1)
+
+	_, err := client.BlockNumber(context.Background())
+	if !isRateLimitError(err) {
+		t.Errorf("expected the refusal returned, got %v", err)
+	}
+	if *calls != maxRateLimitedRetries+1 {
+		t.Errorf("expected %v calls, got %v", maxRateLimitedRetries+1, *calls)
+	}
+	if limit := client.limiter.Limit(); limit != slowdownStartRequestsPerSecond {
+		t.Errorf("expected no limit slowed to %v, got %v", slowdownStartRequestsPerSecond, limit)
+	}
+}
+
+func TestRateLimiterSpeedsUpAgain(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{RequestsPerSecond: 100})
+	limiter.limiter.SetLimit(10)
+	for i := 0; i < speedUpAfterSuccesses*20; i++ {
+		limiter.speedUp()
+	}
+	if limit := limiter.limiter.Limit(); limit != 100 {
+		t.Errorf("expected the rate back up to the limit of 100 and no further, got %v", limit)
+	}
+
+	limiter = NewRateLimiter(RateLimit{})
+	limiter.limiter.SetLimit(10)
+	for i := 0; i < speedUpAfterSuccesses*40; i++ {
+		limiter.speedUp()
+	}
+	if limit := limiter.limiter.Limit(); limit != rate.Inf {
+		t.Errorf("expected no limit again, got %v", limit)
+	}
+}
+
+func TestRateLimitedClientMaxConcurrency(t *testing.T) {
+	var running, maxRunning int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			most := atomic.LoadInt32(&maxRunning)
+			if now <= most || atomic.CompareAndSwapInt32(&maxRunning, most, now) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		io.WriteString(w, okResponse)
+	}))
+	defer server.Close()
+	client := dialRateLimited(t, server.URL, RateLimit{MaxConcurrency: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.BlockNumber(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxRunning > 2 {
+		t.Errorf("expected at most 2 calls in flight, got %v", maxRunning)
+	}
+}
+
+func TestRateLimitedClientBatchRetriesRefusedCalls(t *testing.T) {
+	// The call for block 2 is refused the first time
+	var lock sync.Mutex
+	callsPerBlock := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var requests []struct {
+			Id     json.RawMessage `json:"id"`
+			Params []string        `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requests); err != nil {
+			t.Error(err)
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		var responses []string
+		for _, request := range requests {
+			block := request.Params[0]
+			callsPerBlock[block]++
+			if block == "0x2" && callsPerBlock[block] == 1 {
+				responses = append(responses, `{"jsonrpc":"2.0","id":`+string(request.Id)+`,"error":{"code":429,"message":"rate limit exceeded"}}`)
+				continue
+			}
+			responses = append(responses, `{"jsonrpc":"2.0","id":`+string(request.Id)+`,"result":"`+block+`"}`)
+		}
+		io.WriteString(w, "["+strings.Join(responses, ",")+"]")
+	}))
+	defer server.Close()
+	client := dialRateLimited(t, server.URL, RateLimit{})
+
+	results := make([]string, 2)
+	batch := []rpc.BatchElem{
+		{Method: "eth_test", Args: []interface{}{"0x1"}, Result: &results[0]},
+		{Method: "eth_test", Args: []interface{}{"0x2"}, Result: &results[1]},
+	}
+	if err := client.BatchCallContext(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	for i, elem := range batch {
+		if elem.Error != nil {
+			t.Errorf("expected call %v answered, got %v", i, elem.Error)
+		}
+	}
+	if results[0] != "0x1" || results[1] != "0x2" {
+		t.Errorf("expected results 0x1 and 0x2, got %v", results)
+	}
+	if callsPerBlock["0x1"] != 1 || callsPerBlock["0x2"] != 2 {
+		t.Errorf("expected only the refused call sent again, got calls %v", callsPerBlock)
+	}
+}
+
+func TestDialContextUsesRateLimit(t *testing.T) {
+	server, calls := rateLimitingServer(t, 1, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	options := DialOptions{RateLimiter: NewRateLimiter(RateLimit{RequestsPerSecond: 1000})}
+	client, err := DialContextWithOptions(context.Background(), server.URL, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	blockNumber, err := client.BlockNumber(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blockNumber != 1 || *calls != 2 {
+		t.Errorf("expected block 1 after a refused call, got block %v after %v calls", blockNumber, *calls)
+	}
+}
+
+func TestClientsShareRateLimiter(t *testing.T) {
+	testCases := []struct {
+		name     string
+		shared   bool
+		expected rate.Limit
+	}{
+		{"shared limiter", true, slowdownStartRequestsPerSecond},
+		{"limiter of its own", false, rate.Inf},
+	}
+	for _, tc := range testCases {
+		server, _ := rateLimitingServer(t, 1, func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		})
+		limiter := NewRateLimiter(RateLimit{})
+		client, err := DialContextWithOptions(context.Background(), server.URL, DialOptions{RateLimiter: limiter})
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherOptions := DialOptions{}
+		if tc.shared {
+			otherOptions.RateLimiter = limiter
+		}
+		otherClient, err := DialContextWithOptions(context.Background(), server.URL, otherOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The call refused as too fast slows down the other client only if it shares the limiter
+		if _, err = client.BlockNumber(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if actual := otherClient.(*rateLimitedClient).limiter.Limit(); actual != tc.expected {
+			t.Errorf("%s: expected the other client limited to %v, got %v", tc.name, tc.expected, actual)
+		}
+		client.Close()
+		otherClient.Close()
+	}
+}
+
+// rateLimitingService is the eth namespace of a JSON-RPC server, refusing its first call to
+// eth_blockNumber as too fast
+type rateLimitingService struct {
+	calls int32
+}
+
+func (s *rateLimitingService) BlockNumber() (hexutil.Uint64, error) {
+	if atomic.AddInt32(&s.calls, 1) == 1 {
+		return 0, errors.New("rate limit exceeded")
+	}
+	return 1, nil
+}
+
+func TestDialContextUsesRateLimitOverWebsocket(t *testing.T) {
+	service := &rateLimitingService{}
+	rpcServer := rpc.NewServer()
+	if err := rpcServer.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+	defer rpcServer.Stop()
+	server := httptest.NewServer(rpcServer.WebsocketHandler([]string{"*"}))
+	defer server.Close()
+	options := DialOptions{RateLimiter: NewRateLimiter(RateLimit{RequestsPerSecond: 1000})}
+	client, err := DialContextWithOptions(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	blockNumber, err := client.BlockNumber(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blockNumber != 1 || service.calls != 2 {
+		t.Errorf("expected block 1 after a refused call, got block %v after %v calls", blockNumber, service.calls)
+	}
+}
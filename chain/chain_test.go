@@ -0,0 +1,26 @@
+package chain
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"testing"
+)
+
+func TestLogsToEventsKeepsBlockHashAndSkipsRemovedLogs(t *testing.T) {
+	blockHash := common.HexToHash("0x01")
+	wallet := common.HexToAddress(testWalletAddress)
+	other := common.BigToAddress(big.NewInt(42))
+	log := *newTestTokenLog(transferEventKeccakTokens, other, wallet, other, 0)
+	log.BlockHash = blockHash
+	removedLog := *newTestTokenLog(transferEventKeccakTokens, other, wallet, other, 1)
+	removedLog.Removed = true
+
+	events := logsToEvents([]types.Log{log, removedLog})
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %v", len(events))
+	}
+	if events[0].BlockHash != blockHash {
+		t.Errorf("expected block hash %s, got %s", blockHash.Hex(), events[0].BlockHash.Hex())
+	}
+}
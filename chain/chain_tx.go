@@ -0,0 +1,33 @@
+package chain
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ReceiptFetcher is the part of an EVM client needed to read transaction receipts. It is
+// satisfied by *ethclient.Client and allows fakes to be injected in tests.
+type ReceiptFetcher interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// GetTransferEventsByTransaction returns the transfer events of a single transaction, read
+// from its receipt. Receipts hold every log of the transaction, so only the logs that match
+// the filter are kept.
+func GetTransferEventsByTransaction(ctx context.Context, client ReceiptFetcher, txHash common.Hash,
+	filter TransferFilter) ([]*TransferEvent, error) {
+
+	receipt, err := client.TransactionReceipt(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []types.Log
+	for _, log := range receipt.Logs {
+		if filter.matchesLog(log) {
+			logs = append(logs, *log)
+		}
+	}
+	return logsToEvents(logs), nil
+}
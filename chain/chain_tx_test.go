@@ -0,0 +1,86 @@
+package chain
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"testing"
+)
+
+// approvalEventKeccak is the keccak256 hash of the ERC20 Approval event signature, it has the
+// same topic layout as Transfer so must not be selected
+const approvalEventKeccak = "0x8c5be1e5ebec7d5bd14b71427d1e84f3dd0359bc118fe38a28fa7c7c4e3b925"
+
+// fakeReceiptFetcher returns the same receipt for any transaction
+type fakeReceiptFetcher struct {
+	receipt *types.Receipt
+}
+
+func (f *fakeReceiptFetcher) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return f.receipt, nil
+}
+
+func newTestTokenLog(topic0 string, token common.Address, from common.Address, to common.Address, index uint) *types.Log {
+	return &types.Log{
+		Address: token,
+		Topics: []common.Hash{common.HexToHash(topic0),
+			common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())},
+		Data:  common.LeftPadBytes(big.NewInt(1000).Bytes(), 32),
+		Index: index,
+	}
+}
+
+func TestGetTransferEventsByTransaction(t *testing.T) {
+	token := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	otherToken := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	wallet := common.HexToAddress(testWalletAddress)
+	other := common.BigToAddress(big.NewInt(42))
+	client := &fakeReceiptFetcher{receipt: &types.Receipt{Logs: []*types.Log{
+		newTestTokenLog(approvalEventKeccak, token, wallet, other, 0),
+		newTestTokenLog(transferEventKeccakTokens, token, wallet, other, 1),
+		newTestTokenLog(transferEventKeccakTokens, otherToken, other, other, 2),
+	}}}
+
+	testCases := []struct {
+		filter        TransferFilter
+		expectedIndex []uint
+	}{
+		// Approval is never a movement
+		{TransferFilter{}, []uint{1, 2}},
+		{TransferFilter{TokenAddresses: []common.Address{otherToken}}, []uint{2}},
+		{TransferFilter{WalletAddresses: []common.Address{wallet}}, []uint{1}},
+	}
+
+	for _, tc := range testCases {
+		events, err := GetTransferEventsByTransaction(context.Background(), client, common.Hash{}, tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != len(tc.expectedIndex) {
+			t.Errorf("filter %+v expected %v events, got %v", tc.filter, len(tc.expectedIndex), len(events))
+			continue
+		}
+		for i, event := range events {
+			if event.LogIndex != tc.expectedIndex[i] {
+				t.Errorf("filter %+v expected log index %v, got %v", tc.filter, tc.expectedIndex[i], event.LogIndex)
+			}
+		}
+	}
+}
+
+func TestTransferFilterMatchesLogERC1155(t *testing.T) {
+	wallet := common.HexToAddress(testWalletAddress)
+	operator := common.BigToAddress(big.NewInt(7))
+	other := common.BigToAddress(big.NewInt(42))
+	log := &types.Log{Topics: []common.Hash{common.HexToHash(transferEventKeccakHybridSingle),
+		common.BytesToHash(operator.Bytes()), common.BytesToHash(other.Bytes()), common.BytesToHash(wallet.Bytes())}}
+
+	if !(TransferFilter{WalletAddresses: []common.Address{wallet}}).matchesLog(log) {
+		t.Errorf("expected ERC1155 log to match wallet in to position")
+	}
+	// The operator is not the from or to address
+	if (TransferFilter{WalletAddresses: []common.Address{operator}}).matchesLog(log) {
+		t.Errorf("expected ERC1155 log not to match on operator")
+	}
+}
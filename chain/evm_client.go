@@ -4,8 +4,8 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
+	"fmt"
 	"github.com/KevinSmall/ethgraph/logr"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"strings"
 )
 
@@ -16,8 +16,8 @@ type EvmClient struct {
 	Name              string
 	ChainId           string
 	LatestBlockNumber uint64
-	Url               string
-	Client            *ethclient.Client
+	Urls              []string // calls are spread across all these endpoints of the chain
+	Client            Client   // shared by everything reading the chain, safe for concurrent use
 }
 
 var chainIdMap = make(map[string]string)
@@ -51,31 +51,67 @@ func getChainName(chainId string) string {
 // CreateEvmClient gets an EVM client and name. The name comes from reading embedded file copied
 // from this JSON https://github.com/DefiLlama/chainlist/blob/main/constants/chainIds.json
 func CreateEvmClient(url string) (EvmClient, error) {
+	return CreateEvmClientWithOptions(context.Background(), []string{url}, DialOptions{})
+}
+
+// CreateEvmClientWithOptions is CreateEvmClient for a chain with one or more endpoints, with ctx
+// bounding the connection and the first reads from chain. Calls are spread across the endpoints,
+// see DialEndpointsWithOptions, and made as options says. Every endpoint must report the same
+// chainId.
+func CreateEvmClientWithOptions(ctx context.Context, urls []string, options DialOptions) (EvmClient, error) {
+	// Checking the endpoints counts towards the same rate limit as the client
+	if options.RateLimiter == nil {
+		options.RateLimiter = NewRateLimiter(RateLimit{})
+	}
+	if len(urls) > 1 {
+		if _, err := checkSameChain(ctx, urls, options.RateLimiter); err != nil {
+			return EvmClient{}, err
+		}
+	}
 
 	// connect to the EVM client
-	client, err := ethclient.Dial(url)
+	client, err := DialEndpointsWithOptions(ctx, urls, options)
 	if err != nil {
 		return EvmClient{}, err
 	}
 
 	// Get chainId
-	chainId, err := client.NetworkID(context.Background())
+	chainId, err := client.NetworkID(ctx)
 	if err != nil {
-		logr.Error.Panicln("Error when reading chain to get chainId: ", err)
+		client.Close()
+		return EvmClient{}, fmt.Errorf("error when reading chain to get chainId: %w", err)
 	}
 	chainName := getChainName(chainId.String())
 
 	// Get the latest block
-	blockNumber, err := client.BlockNumber(context.Background())
+	blockNumber, err := client.BlockNumber(ctx)
 	if err != nil {
-		logr.Error.Panicln("Error when reading chain to get latest block: ", err)
+		client.Close()
+		return EvmClient{}, fmt.Errorf("error when reading chain to get latest block: %w", err)
 	}
 
 	return EvmClient{
 		Name:              chainName,
 		ChainId:           chainId.String(),
 		LatestBlockNumber: blockNumber,
-		Url:               url,
+		Urls:              urls,
 		Client:            client,
 	}, nil
 }
+
+// Close closes the connection of the client to the chain, if it has one. The client cannot read
+// the chain after.
+func (e EvmClient) Close() {
+	if e.Client != nil {
+		e.Client.Close()
+	}
+}
+
+// CreateOfflineEvmClient gets an EVM client name for a chainId without connecting to the chain.
+// The client has no connection, so can only be used with data already held locally.
+func CreateOfflineEvmClient(chainId string) EvmClient {
+	return EvmClient{
+		Name:    getChainName(chainId),
+		ChainId: chainId,
+	}
+}
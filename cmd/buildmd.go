@@ -9,7 +9,7 @@ import (
 
 // buildmdCmd represents the buildmd command for building .csv token master data
 var buildmdCmd = &cobra.Command{
-	Use:   "buildmd <url>",
+	Use:   "buildmd <url>...",
 	Short: "For internal use to build cache of token names and decimals.",
 	Long: `For internal use. Creates a .csv file of all tokens in the given block range
 that have valid ERC20 master data of name and decimals. This .csv is built into
@@ -19,7 +19,7 @@ new releases of ethgraph. For example:
 
 Will scan the block range from and to and all valid token master data 
 will get written to a .csv file.`,
-	Args: cobra.ExactArgs(1),
+	Args: urlArgs,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		// Validate block from and to
 		from, err := cmd.Flags().GetUint64("block-from")
@@ -36,9 +36,16 @@ will get written to a .csv file.`,
 		// validation successful
 		return nil
 	},
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Errors from here on are not usage errors
+		cmd.SilenceUsage = true
 		logr.SetVerbosity(true)
-		services.BuildMasterData(args[0], flagBlockFrom, flagBlockTo)
+		urls, stop, err := startUrlArgs(args)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		return services.BuildMasterData(cmd.Context(), urls, flagBlockFrom, flagBlockTo, flagBatchSize, getDialOptions())
 	},
 }
 
@@ -51,4 +58,6 @@ func init() {
 
 	buildmdCmd.PersistentFlags().Uint64VarP(&flagBlockTo, "block-to", "t", 1, "Block number to eg 16667150")
 	buildmdCmd.MarkPersistentFlagRequired("block-to")
+
+	addBatchSizeFlag(buildmdCmd)
 }
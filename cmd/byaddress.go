@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/KevinSmall/ethgraph/services"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+// byaddressCmd represents the byaddress command to build by wallet addresses in a block range
+var byaddressCmd = &cobra.Command{
+	Use:   "byaddress <url>...",
+	Short: "Builds GraphML from data selected by wallet addresses in a range of blocks",
+	Long: `Builds GraphML from all token movements where any of the given wallet addresses is
+the from or to address, in a range of blocks. For example:
+
+    1) select Transfer events by block range, where the wallet is the from or to address:
+       ethgraph byaddress "https://chain-rpc-endpoint" -f 16670050 -t 16670150 -a 0x71660c4005BA85c37ccec55d0C4493E66Fe775d3
+
+    2) select Transfer events by block range, touching any of several wallets:
+       ethgraph byaddress "https://chain-rpc-endpoint" -f 16670050 -t 16670150 -a 0x71660c4005BA85c37ccec55d0C4493E66Fe775d3 -a 0xDA9dfA130Df4dE4673b89022EE50ff26f6EA73Cf
+
+    3) select Transfer events by block range, where the wallet is the from or to address, only for token USDT:
+       ethgraph byaddress "https://chain-rpc-endpoint" -f 16670050 -t 16670150 -a 0x71660c4005BA85c37ccec55d0C4493E66Fe775d3 -o 0xdAC17F958D2ee523a2206206994597C13D831ec7`,
+
+	Args: urlOrOfflineArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Validate block from and to
+		from, err := cmd.Flags().GetUint64("block-from")
+		if err != nil {
+			return err
+		}
+		to, err := cmd.Flags().GetUint64("block-to")
+		if err != nil {
+			return err
+		}
+		if from > to {
+			return errors.New("the --block-from flag must be less than or equal to the --block-to flag")
+		}
+		// Validate wallet addresses
+		walletAddresses, err := cmd.Flags().GetStringSlice("address")
+		if err != nil {
+			return err
+		}
+		for _, walletAddress := range walletAddresses {
+			if !common.IsHexAddress(walletAddress) {
+				return fmt.Errorf("the --address value %s is not a valid hex address", walletAddress)
+			}
+		}
+		// Validate "only this address" if it exists
+		onlyThisAddress, err := cmd.Flags().GetString("only-token-address")
+		if err != nil {
+			return err
+		}
+		if onlyThisAddress != "" && !common.IsHexAddress(onlyThisAddress) {
+			return errors.New("the --only-token-address value is not a valid hex address. Use for example 0xdAC17F958D2ee523a2206206994597C13D831ec7 for USDT")
+		}
+		// validation successful
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Errors from here on are not usage errors
+		cmd.SilenceUsage = true
+		if flagIsVerboseOutputRequested {
+			logr.SetVerbosity(true)
+		} else {
+			logr.SetVerbosity(false)
+		}
+		urls, stop, err := startUrlArgs(args)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		return services.BuildByBlockRange(cmd.Context(), getExtractOptions(urls))
+	},
+	Aliases: []string{"bya"},
+}
+
+func init() {
+
+	rootCmd.AddCommand(byaddressCmd)
+
+	byaddressCmd.PersistentFlags().StringSliceVarP(&flagWalletAddresses, "address", "a", nil, "Wallet address to select events for, where it is the from or to address. Repeat the flag for several addresses.")
+	byaddressCmd.MarkPersistentFlagRequired("address")
+
+	byaddressCmd.PersistentFlags().Uint64VarP(&flagBlockFrom, "block-from", "f", 0, "Block number from eg 16667050")
+	byaddressCmd.MarkPersistentFlagRequired("block-from")
+
+	byaddressCmd.PersistentFlags().Uint64VarP(&flagBlockTo, "block-to", "t", 1, "Block number to eg 16667150")
+	byaddressCmd.MarkPersistentFlagRequired("block-to")
+
+	byaddressCmd.PersistentFlags().StringVarP(&flagOnlyThisTokenAddress, "only-token-address", "o", "", "Only select events for the specified token address eg USDT is 0xdAC17F958D2ee523a2206206994597C13D831ec7")
+
+	byaddressCmd.PersistentFlags().BoolVarP(&flagDoNotFetchMissingMasterData, "no-fetch-master-data", "n", false, "If set with -n then no fetch of master data for unknown tokens (faster runtime). If omitted (which is the default) then master data is fetched (longer runtime).")
+
+	byaddressCmd.PersistentFlags().BoolVarP(&flagForceSerialExecution, "force-serial-execution", "s", false, "If set with -s then serial execution is forced, PLUS a cap is set on HTTP requests to 10 per second (longer runtime).")
+
+	byaddressCmd.PersistentFlags().BoolVarP(&flagClearTokenCache, "clear-token-cache", "c", false, "If set with -c then the token cache file .tokens_*_cache.csv is deleted (longer runtime). The * in the filename is the chainId see https://chainlist.org/, so 1 for Ethereum.")
+
+	addEventStoreFlags(byaddressCmd)
+
+	byaddressCmd.PersistentFlags().BoolVar(&flagWritePartial, "write-partial", false, "If set then pressing Ctrl+C while reading still writes the graph of the events read so far, marked with the graph attribute partial=true.")
+
+	addWorkPoolFlags(byaddressCmd)
+
+	addGraphFileFlags(byaddressCmd)
+
+	byaddressCmd.PersistentFlags().BoolVarP(&flagIsVerboseOutputRequested, "verbose-output", "v", false, "If set with -v then detailed logging information written to stdout.")
+}
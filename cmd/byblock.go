@@ -10,9 +10,10 @@ import (
 
 // byblockCmd represents the byblock command to build by a block range
 var byblockCmd = &cobra.Command{
-	Use:   "byblock <url>",
+	Use:   "byblock <url>...",
 	Short: "Builds GraphML from data selected by a range of blocks",
-	Long: `Builds GraphML from data selected by a range of blocks. For example:
+	Long: `Builds GraphML from data selected by a range of blocks. Events read are kept in a local
+event store file .events_*_store.db, so blocks already read are not read again. For example:
 
     1) select Transfer events by block range:
        ethgraph byblock "https://chain-rpc-endpoint" -f 16670050 -t 16670150 
@@ -24,9 +25,15 @@ var byblockCmd = &cobra.Command{
        ethgraph byblock "https://chain-rpc-endpoint" -f 16670050 -t 16670150 -c
 
 	4) select Transfer events by block range, fetching all data in serial, capping the number of HTTP requests to 10 per second:
-	   ethgraph byblock "https://chain-rpc-endpoint" -f 16670050 -t 16670150 -s`,
+	   ethgraph byblock "https://chain-rpc-endpoint" -f 16670050 -t 16670150 -s
 
-	Args: cobra.ExactArgs(1),
+    5) select Transfer events by block range, only from events already read into the local event store:
+       ethgraph byblock --offline --chain-id 1 -f 16670050 -t 16670150
+
+    6) continue a run that was interrupted part way through reading blocks:
+       ethgraph byblock "https://chain-rpc-endpoint" -f 16670050 -t 16720050 --resume`,
+
+	Args: urlOrOfflineArgs,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		// Validate block from and to
 		from, err := cmd.Flags().GetUint64("block-from")
@@ -51,18 +58,20 @@ var byblockCmd = &cobra.Command{
 		// validation successful
 		return nil
 	},
-	Run: func(cmd *cobra.Command, args []string) {
-		if *flagIsVerboseOutputRequested {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Errors from here on are not usage errors
+		cmd.SilenceUsage = true
+		if flagIsVerboseOutputRequested {
 			logr.SetVerbosity(true)
 		} else {
 			logr.SetVerbosity(false)
 		}
-		services.BuildByBlockRange(args[0],
-			flagBlockFrom, flagBlockTo,
-			*flagOnlyThisTokenAddress,
-			*flagDoNotFetchMissingMasterData,
-			*flagForceSerialExecution,
-			*flagClearTokenCache)
+		urls, stop, err := startUrlArgs(args)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		return services.BuildByBlockRange(cmd.Context(), getExtractOptions(urls))
 	},
 	Aliases: []string{"byb"},
 }
@@ -77,13 +86,21 @@ func init() {
 	byblockCmd.PersistentFlags().Uint64VarP(&flagBlockTo, "block-to", "t", 1, "Block number to eg 16667150")
 	byblockCmd.MarkPersistentFlagRequired("block-to")
 
-	flagOnlyThisTokenAddress = byblockCmd.PersistentFlags().StringP("only-token-address", "o", "", "Only select events for the specified token address eg USDT is 0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	byblockCmd.PersistentFlags().StringVarP(&flagOnlyThisTokenAddress, "only-token-address", "o", "", "Only select events for the specified token address eg USDT is 0xdAC17F958D2ee523a2206206994597C13D831ec7")
+
+	byblockCmd.PersistentFlags().BoolVarP(&flagDoNotFetchMissingMasterData, "no-fetch-master-data", "n", false, "If set with -n then no fetch of master data for unknown tokens (faster runtime). If omitted (which is the default) then master data is fetched (longer runtime).")
+
+	byblockCmd.PersistentFlags().BoolVarP(&flagForceSerialExecution, "force-serial-execution", "s", false, "If set with -s then serial execution is forced, PLUS a cap is set on HTTP requests to 10 per second (longer runtime).")
+
+	byblockCmd.PersistentFlags().BoolVarP(&flagClearTokenCache, "clear-token-cache", "c", false, "If set with -c then the token cache file .tokens_*_cache.csv is deleted (longer runtime). The * in the filename is the chainId see https://chainlist.org/, so 1 for Ethereum.")
+
+	addEventStoreFlags(byblockCmd)
 
-	flagDoNotFetchMissingMasterData = byblockCmd.PersistentFlags().BoolP("no-fetch-master-data", "n", false, "If set with -n then no fetch of master data for unknown tokens (faster runtime). If omitted (which is the default) then master data is fetched (longer runtime).")
+	byblockCmd.PersistentFlags().BoolVar(&flagWritePartial, "write-partial", false, "If set then pressing Ctrl+C while reading still writes the graph of the events read so far, marked with the graph attribute partial=true.")
 
-	flagForceSerialExecution = byblockCmd.PersistentFlags().BoolP("force-serial-execution", "s", false, "If set with -s then serial execution is forced, PLUS a cap is set on HTTP requests to 10 per second (longer runtime).")
+	addWorkPoolFlags(byblockCmd)
 
-	flagClearTokenCache = byblockCmd.PersistentFlags().BoolP("clear-token-cache", "c", false, "If set with -c then the token cache file .tokens_*_cache.csv is deleted (longer runtime). The * in the filename is the chainId see https://chainlist.org/, so 1 for Ethereum.")
+	addGraphFileFlags(byblockCmd)
 
-	flagIsVerboseOutputRequested = byblockCmd.PersistentFlags().BoolP("verbose-output", "v", false, "If set with -v then detailed logging information written to stdout.")
+	byblockCmd.PersistentFlags().BoolVarP(&flagIsVerboseOutputRequested, "verbose-output", "v", false, "If set with -v then detailed logging information written to stdout.")
 }
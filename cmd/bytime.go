@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/conv"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/KevinSmall/ethgraph/services"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+// Parsed values of the time flags, set during validation
+var timeFrom time.Time
+var timeTo time.Time
+var lastDuration time.Duration
+
+// bytimeCmd represents the bytime command to build by a time window
+var bytimeCmd = &cobra.Command{
+	Use:   "bytime <url>...",
+	Short: "Builds GraphML from data selected by a time window",
+	Long: `Builds GraphML from data selected by a time window. The window is resolved to a range
+of blocks by searching block timestamps on chain. Block timestamps read are cached in the local
+file .blocks_*_cache.csv so reruns are cheap. For example:
+
+    1) select Transfer events by time window, times are RFC3339:
+       ethgraph bytime "https://chain-rpc-endpoint" --from-time 2023-03-14T09:00:00Z --to-time 2023-03-14T09:30:00Z
+
+    2) select Transfer events from a time up to the latest block:
+       ethgraph bytime "https://chain-rpc-endpoint" --from-time 2023-03-14T09:00:00Z
+
+    3) select Transfer events in the last 30 minutes up to the latest block, durations like 90m, 1h or 7d are allowed:
+       ethgraph bytime "https://chain-rpc-endpoint" --last 30m
+
+    4) select Transfer events in the last hour, only for token USDT:
+       ethgraph bytime "https://chain-rpc-endpoint" --last 1h -o 0xdAC17F958D2ee523a2206206994597C13D831ec7`,
+
+	Args: urlArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Validate time window, either --last or --from-time with optional --to-time
+		var err error
+		if flagLast != "" {
+			if flagTimeFrom != "" || flagTimeTo != "" {
+				return errors.New("the --last flag cannot be combined with --from-time or --to-time")
+			}
+			lastDuration, err = conv.ParseDurationWithDays(flagLast)
+			if err != nil {
+				return fmt.Errorf("the --last value is not a valid duration, use for example 90m, 1h or 7d: %w", err)
+			}
+			if lastDuration <= 0 {
+				return errors.New("the --last value must be a positive duration")
+			}
+		} else {
+			if flagTimeFrom == "" {
+				return errors.New("either the --from-time or the --last flag is required")
+			}
+			timeFrom, err = time.Parse(time.RFC3339, flagTimeFrom)
+			if err != nil {
+				return fmt.Errorf("the --from-time value is not RFC3339, use for example 2023-03-14T09:00:00Z: %w", err)
+			}
+			timeTo = time.Time{}
+			if flagTimeTo != "" {
+				timeTo, err = time.Parse(time.RFC3339, flagTimeTo)
+				if err != nil {
+					return fmt.Errorf("the --to-time value is not RFC3339, use for example 2023-03-14T09:30:00Z: %w", err)
+				}
+				if timeTo.Before(timeFrom) {
+					return errors.New("the --from-time flag must be before or equal to the --to-time flag")
+				}
+			}
+		}
+		// Validate "only this address" if it exists
+		onlyThisAddress, err := cmd.Flags().GetString("only-token-address")
+		if err != nil {
+			return err
+		}
+		if onlyThisAddress != "" && !common.IsHexAddress(onlyThisAddress) {
+			return errors.New("the --only-token-address value is not a valid hex address. Use for example 0xdAC17F958D2ee523a2206206994597C13D831ec7 for USDT")
+		}
+		// validation successful
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Errors from here on are not usage errors
+		cmd.SilenceUsage = true
+		if flagIsVerboseOutputRequested {
+			logr.SetVerbosity(true)
+		} else {
+			logr.SetVerbosity(false)
+		}
+		urls, stop, err := startUrlArgs(args)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		return services.BuildByTimeRange(cmd.Context(), timeFrom, timeTo, lastDuration, getExtractOptions(urls))
+	},
+	Aliases: []string{"byt"},
+}
+
+func init() {
+
+	rootCmd.AddCommand(bytimeCmd)
+
+	bytimeCmd.PersistentFlags().StringVar(&flagTimeFrom, "from-time", "", "Time from in RFC3339 eg 2023-03-14T09:00:00Z")
+
+	bytimeCmd.PersistentFlags().StringVar(&flagTimeTo, "to-time", "", "Time to in RFC3339 eg 2023-03-14T09:30:00Z. If omitted then up to the latest block.")
+
+	bytimeCmd.PersistentFlags().StringVar(&flagLast, "last", "", "Duration up to the latest block eg 90m, 1h or 7d. Use instead of --from-time and --to-time.")
+
+	bytimeCmd.PersistentFlags().StringVarP(&flagOnlyThisTokenAddress, "only-token-address", "o", "", "Only select events for the specified token address eg USDT is 0xdAC17F958D2ee523a2206206994597C13D831ec7")
+
+	bytimeCmd.PersistentFlags().BoolVarP(&flagDoNotFetchMissingMasterData, "no-fetch-master-data", "n", false, "If set with -n then no fetch of master data for unknown tokens (faster runtime). If omitted (which is the default) then master data is fetched (longer runtime).")
+
+	bytimeCmd.PersistentFlags().BoolVarP(&flagForceSerialExecution, "force-serial-execution", "s", false, "If set with -s then serial execution is forced, PLUS a cap is set on HTTP requests to 10 per second (longer runtime).")
+
+	bytimeCmd.PersistentFlags().BoolVarP(&flagClearTokenCache, "clear-token-cache", "c", false, "If set with -c then the token cache file .tokens_*_cache.csv is deleted (longer runtime). The * in the filename is the chainId see https://chainlist.org/, so 1 for Ethereum.")
+
+	bytimeCmd.PersistentFlags().BoolVar(&flagWritePartial, "write-partial", false, "If set then pressing Ctrl+C while reading still writes the graph of the events read so far, marked with the graph attribute partial=true.")
+
+	addWorkPoolFlags(bytimeCmd)
+
+	addGraphFileFlags(bytimeCmd)
+
+	bytimeCmd.PersistentFlags().BoolVarP(&flagIsVerboseOutputRequested, "verbose-output", "v", false, "If set with -v then detailed logging information written to stdout.")
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/KevinSmall/ethgraph/services"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+// bytxCmd represents the bytx command to build by a list of transaction hashes
+var bytxCmd = &cobra.Command{
+	Use:   "bytx <url>...",
+	Short: "Builds GraphML from data selected by transaction hashes",
+	Long: `Builds GraphML from the token movements in a list of transactions, read from the
+transaction receipts. For example:
+
+    1) select Transfer events by transaction hash:
+       ethgraph bytx "https://chain-rpc-endpoint" --tx 0x244c8173556a0e15b26db7a7729a66cca0f8689a19a7b6e709ccfe47096074a0
+
+    2) select Transfer events by transaction hashes read from a file, one hash per line, lines starting # are ignored:
+       ethgraph bytx "https://chain-rpc-endpoint" --tx-file hashes.txt
+
+    3) select Transfer events by transaction hash, only for token USDT:
+       ethgraph bytx "https://chain-rpc-endpoint" --tx 0x244c8173556a0e15b26db7a7729a66cca0f8689a19a7b6e709ccfe47096074a0 -o 0xdAC17F958D2ee523a2206206994597C13D831ec7`,
+
+	Args: urlArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Gather hashes from flag and file
+		if flagTxHashFile != "" {
+			fileTxHashes, err := readTxHashFile(flagTxHashFile)
+			if err != nil {
+				return err
+			}
+			flagTxHashes = append(flagTxHashes, fileTxHashes...)
+		}
+		if len(flagTxHashes) == 0 {
+			return errors.New("at least one transaction hash is required, use --tx or --tx-file")
+		}
+		// Validate hashes
+		for _, txHash := range flagTxHashes {
+			if !isHexHash(txHash) {
+				return fmt.Errorf("the transaction hash %s is not a valid hex hash", txHash)
+			}
+		}
+		// Validate "only this address" if it exists
+		onlyThisAddress, err := cmd.Flags().GetString("only-token-address")
+		if err != nil {
+			return err
+		}
+		if onlyThisAddress != "" && !common.IsHexAddress(onlyThisAddress) {
+			return errors.New("the --only-token-address value is not a valid hex address. Use for example 0xdAC17F958D2ee523a2206206994597C13D831ec7 for USDT")
+		}
+		// validation successful
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Errors from here on are not usage errors
+		cmd.SilenceUsage = true
+		if flagIsVerboseOutputRequested {
+			logr.SetVerbosity(true)
+		} else {
+			logr.SetVerbosity(false)
+		}
+		urls, stop, err := startUrlArgs(args)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		return services.BuildByTransactions(cmd.Context(), flagTxHashes, getExtractOptions(urls))
+	},
+	Aliases: []string{"byx"},
+}
+
+// readTxHashFile reads transaction hashes from a file, one per line. Blank lines and lines
+// starting with # are ignored.
+func readTxHashFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var txHashes []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		txHashes = append(txHashes, line)
+	}
+	return txHashes, scanner.Err()
+}
+
+// isHexHash returns true if s is a 0x prefixed 32 byte hex hash
+func isHexHash(s string) bool {
+	b, err := hexutil.Decode(s)
+	return err == nil && len(b) == common.HashLength
+}
+
+func init() {
+
+	rootCmd.AddCommand(bytxCmd)
+
+	bytxCmd.PersistentFlags().StringSliceVar(&flagTxHashes, "tx", nil, "Transaction hash to select events for. Repeat the flag for several transactions.")
+
+	bytxCmd.PersistentFlags().StringVar(&flagTxHashFile, "tx-file", "", "File of transaction hashes to select events for, one hash per line.")
+
+	bytxCmd.PersistentFlags().StringVarP(&flagOnlyThisTokenAddress, "only-token-address", "o", "", "Only select events for the specified token address eg USDT is 0xdAC17F958D2ee523a2206206994597C13D831ec7")
+
+	bytxCmd.PersistentFlags().BoolVarP(&flagDoNotFetchMissingMasterData, "no-fetch-master-data", "n", false, "If set with -n then no fetch of master data for unknown tokens (faster runtime). If omitted (which is the default) then master data is fetched (longer runtime).")
+
+	bytxCmd.PersistentFlags().BoolVarP(&flagForceSerialExecution, "force-serial-execution", "s", false, "If set with -s then serial execution is forced, PLUS a cap is set on HTTP requests to 10 per second (longer runtime).")
+
+	bytxCmd.PersistentFlags().BoolVarP(&flagClearTokenCache, "clear-token-cache", "c", false, "If set with -c then the token cache file .tokens_*_cache.csv is deleted (longer runtime). The * in the filename is the chainId see https://chainlist.org/, so 1 for Ethereum.")
+
+	addWorkPoolFlags(bytxCmd)
+
+	addGraphFileFlags(bytxCmd)
+
+	bytxCmd.PersistentFlags().BoolVarP(&flagIsVerboseOutputRequested, "verbose-output", "v", false, "If set with -v then detailed logging information written to stdout.")
+}
@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestAppCmdWithNoParams(t *testing.T) {
@@ -12,3 +16,46 @@ func TestAppCmdWithNoParams(t *testing.T) {
 		t.Logf("Successfully executed root cmd without params which should show usage")
 	}
 }
+
+// TestByblockReplaysCassette runs the byblock command end to end with --replay, answering the
+// calls to chain from the cassette of the extract tests, and compares the graph written with
+// its golden file
+func TestByblockReplaysCassette(t *testing.T) {
+	cassetteDir, err := filepath.Abs("../extract/testdata/cassette_byblock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile("../extract/testdata/cassette_byblock.graphml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workingDir)
+	// Graph timestamps are written in local time, the golden file is in UTC
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+
+	rootCmd.SetArgs([]string{"byblock", "--replay", cassetteDir, "-f", "100", "-t", "110"})
+	defer func() {
+		rootCmd.SetArgs(nil)
+		flagReplayDir = ""
+	}()
+	if err = rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := os.ReadFile("ethereum.graphml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, golden) {
+		t.Errorf("graph written differs from the golden file of the extract tests")
+	}
+}
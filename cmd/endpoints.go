@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/spf13/cobra"
+)
+
+// urlArgs validates the url arguments, at least one url is required either as an argument or
+// with --rpc, unless calls are replayed with --replay
+func urlArgs(cmd *cobra.Command, args []string) error {
+	if flagReplayDir != "" {
+		if len(args)+len(flagRpcUrls) > 0 {
+			return errors.New("a url cannot be given with the --replay flag, calls are answered from the cassette")
+		}
+		if flagRecordDir != "" {
+			return errors.New("the --record and --replay flags cannot be used together")
+		}
+		return nil
+	}
+	if len(args)+len(flagRpcUrls) == 0 {
+		return errors.New("at least one url is required, as an argument or with the --rpc flag")
+	}
+	return nil
+}
+
+// startUrlArgs returns the urls of the chain endpoints, from the arguments then the --rpc flags.
+// If calls are replayed with --replay, a replay server is started and its url returned instead.
+// stop closes the replay server, if any, once the command is done.
+func startUrlArgs(args []string) (urls []string, stop func(), err error) {
+	stop = func() {}
+	if flagOffline {
+		return nil, stop, nil
+	}
+	if flagReplayDir != "" {
+		replayServer, err := chain.NewReplayServer(flagReplayDir)
+		if err != nil {
+			return nil, stop, err
+		}
+		return []string{replayServer.URL}, func() { replayServer.Close() }, nil
+	}
+	urls = make([]string, 0, len(args)+len(flagRpcUrls))
+	urls = append(urls, args...)
+	return append(urls, flagRpcUrls...), stop, nil
+}
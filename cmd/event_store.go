@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/spf13/cobra"
+)
+
+// urlOrOfflineArgs validates the arguments of commands that can build from the local event
+// store, a url is required unless --offline is set
+func urlOrOfflineArgs(cmd *cobra.Command, args []string) error {
+	if flagOffline {
+		if flagChainId == "" {
+			return errors.New("the --chain-id flag is required with --offline, for example 1 for Ethereum")
+		}
+		return nil
+	}
+	return urlArgs(cmd, args)
+}
+
+// getOfflineChainId returns the chainId to build for from the local event store, or empty when
+// building from the chain
+func getOfflineChainId() string {
+	if !flagOffline {
+		return ""
+	}
+	return flagChainId
+}
+
+// addEventStoreFlags adds the flags to build from the local event store only, or to resume
+// reading blocks into it
+func addEventStoreFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&flagOffline, "offline", false, "If set then the chain is not read, the graph is built only from events already in the local event store file .events_*_store.db. Needs --chain-id.")
+
+	cmd.PersistentFlags().StringVar(&flagChainId, "chain-id", "", "ChainId of the local event store to use with --offline, see https://chainlist.org/, so 1 for Ethereum.")
+
+	cmd.PersistentFlags().BoolVar(&flagResume, "resume", false, "If set then an earlier run that was interrupted part way through reading blocks is continued, using its progress in the checkpoint file .checkpoint_*.jsonl. Use the same flags as the interrupted run.")
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/KevinSmall/ethgraph/extract"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/KevinSmall/ethgraph/services"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var flagTsv bool
+var flagParquet bool
+
+// exportCmd groups the commands that export data as tables rather than graphs
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports data as tables rather than graphs",
+}
+
+// exportEventsCmd represents the export events command to export transfer events by a block range
+var exportEventsCmd = &cobra.Command{
+	Use:   "events <url>...",
+	Short: "Exports the transfer events of a range of blocks as CSV or Parquet",
+	Long: `Exports the transfer events of a range of blocks as CSV or Parquet, one row per token
+movement, with values in full rather than rounded. The file is called <chainname>_events.csv. For example:
+
+    1) export Transfer events by block range:
+       ethgraph export events "https://chain-rpc-endpoint" -f 16670050 -t 16670150
+
+    2) export Transfer events by block range, only for token USDT, tab separated:
+       ethgraph export events "https://chain-rpc-endpoint" -f 16670050 -t 16670150 -o 0xdAC17F958D2ee523a2206206994597C13D831ec7 --tsv
+
+    3) export Transfer events by block range as Parquet, zstd compressed, for DuckDB or Spark:
+       ethgraph export events "https://chain-rpc-endpoint" -f 16670050 -t 16670150 --parquet --parquet-compression zstd`,
+
+	Args: urlOrOfflineArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Validate block from and to
+		from, err := cmd.Flags().GetUint64("block-from")
+		if err != nil {
+			return err
+		}
+		to, err := cmd.Flags().GetUint64("block-to")
+		if err != nil {
+			return err
+		}
+		if from > to {
+			return errors.New("the --block-from flag must be less than or equal to the --block-to flag")
+		}
+		// Validate "only this address" if it exists
+		onlyThisAddress, err := cmd.Flags().GetString("only-token-address")
+		if err != nil {
+			return err
+		}
+		if onlyThisAddress != "" && !common.IsHexAddress(onlyThisAddress) {
+			return errors.New("the --only-token-address value is not a valid hex address. Use for example 0xdAC17F958D2ee523a2206206994597C13D831ec7 for USDT")
+		}
+		if flagTsv && flagParquet {
+			return errors.New("only one of the --tsv and --parquet flags can be set")
+		}
+		// validation successful
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Errors from here on are not usage errors
+		cmd.SilenceUsage = true
+		if flagIsVerboseOutputRequested {
+			logr.SetVerbosity(true)
+		} else {
+			logr.SetVerbosity(false)
+		}
+		urls, stop, err := startUrlArgs(args)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		return services.ExportEventsByBlockRange(cmd.Context(), getExtractOptions(urls), getEventFormat())
+	},
+}
+
+// getEventFormat returns the format of the table of events from the --tsv and --parquet flags
+func getEventFormat() string {
+	switch {
+	case flagTsv:
+		return extract.EventFormatTsv
+	case flagParquet:
+		return extract.EventFormatParquet
+	}
+	return extract.EventFormatCsv
+}
+
+func init() {
+
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.AddCommand(exportEventsCmd)
+
+	exportEventsCmd.PersistentFlags().Uint64VarP(&flagBlockFrom, "block-from", "f", 0, "Block number from eg 16667050")
+	exportEventsCmd.MarkPersistentFlagRequired("block-from")
+
+	exportEventsCmd.PersistentFlags().Uint64VarP(&flagBlockTo, "block-to", "t", 1, "Block number to eg 16667150")
+	exportEventsCmd.MarkPersistentFlagRequired("block-to")
+
+	exportEventsCmd.PersistentFlags().StringVarP(&flagOnlyThisTokenAddress, "only-token-address", "o", "", "Only select events for the specified token address eg USDT is 0xdAC17F958D2ee523a2206206994597C13D831ec7")
+
+	exportEventsCmd.PersistentFlags().BoolVarP(&flagDoNotFetchMissingMasterData, "no-fetch-master-data", "n", false, "If set with -n then no fetch of master data for unknown tokens (faster runtime), their scaled values and symbols are left empty. If omitted (which is the default) then master data is fetched (longer runtime).")
+
+	exportEventsCmd.PersistentFlags().BoolVarP(&flagForceSerialExecution, "force-serial-execution", "s", false, "If set with -s then serial execution is forced, PLUS a cap is set on HTTP requests to 10 per second (longer runtime).")
+
+	exportEventsCmd.PersistentFlags().BoolVarP(&flagClearTokenCache, "clear-token-cache", "c", false, "If set with -c then the token cache file .tokens_*_cache.csv is deleted (longer runtime). The * in the filename is the chainId see https://chainlist.org/, so 1 for Ethereum.")
+
+	addEventStoreFlags(exportEventsCmd)
+
+	addWorkPoolFlags(exportEventsCmd)
+
+	exportEventsCmd.PersistentFlags().BoolVar(&flagTsv, "tsv", false, "If set then the events are written tab separated, to <chainname>_events.tsv.")
+
+	exportEventsCmd.PersistentFlags().BoolVar(&flagParquet, "parquet", false, "If set then the events are written as Parquet with typed columns, to <chainname>_events.parquet.")
+
+	addParquetFlags(exportEventsCmd)
+
+	exportEventsCmd.PersistentFlags().BoolVarP(&flagIsVerboseOutputRequested, "verbose-output", "v", false, "If set with -v then detailed logging information written to stdout.")
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/extract"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// getExtractOptions returns the options that select the events to read from the chain at urls
+// and say how to read them, from the flags. Flags a command does not have are left at their
+// defaults, and a command that selects events another way sets its own fields on top.
+func getExtractOptions(urls []string) extract.Options {
+	filter := chain.NewTransferFilter(flagOnlyThisTokenAddress)
+	for _, walletAddress := range flagWalletAddresses {
+		filter.WalletAddresses = append(filter.WalletAddresses, common.HexToAddress(walletAddress))
+	}
+	return extract.Options{
+		Urls:                        urls,
+		OfflineChainId:              getOfflineChainId(),
+		BlockFrom:                   flagBlockFrom,
+		BlockTo:                     flagBlockTo,
+		Filter:                      filter,
+		DoNotFetchMissingMasterData: flagDoNotFetchMissingMasterData,
+		ForceSerialExecution:        flagForceSerialExecution,
+		Dial:                        getDialOptions(),
+		Progress:                    printProgress,
+		Pool:                        getPoolOptions(),
+		BatchSize:                   flagBatchSize,
+		ClearTokenCache:             flagClearTokenCache,
+		Resume:                      flagResume,
+		WritePartial:                flagWritePartial,
+		WriteOptions:                getWriteOptions(),
+	}
+}
+
+// printProgress prints how each step of reading from chain goes on one line, with a dot for each
+// call in serial execution
+func printProgress(step string, stage extract.ProgressStage) {
+	switch stage {
+	case extract.ProgressStarted:
+		fmt.Printf("Getting %s...", step)
+	case extract.ProgressAdvanced:
+		fmt.Printf(".")
+	case extract.ProgressDone:
+		fmt.Printf("done.\n")
+	case extract.ProgressFailed:
+		fmt.Printf("failed.\n")
+	}
+}
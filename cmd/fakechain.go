@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/test/fakechain"
+	"github.com/spf13/cobra"
+	"net"
+	"net/http"
+)
+
+var flagFakechainAddress string
+var fakechainConfig = fakechain.DefaultConfig()
+
+// fakechainCmd groups the commands for fake chains, it is hidden since it is only for testing
+var fakechainCmd = &cobra.Command{
+	Use:    "fakechain",
+	Short:  "Stand-ins for chains, for testing",
+	Hidden: true,
+}
+
+// fakechainServeCmd represents the fakechain serve command for serving generated transfers
+var fakechainServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves a chain of generated transfers over JSON-RPC",
+	Long: `Serves a chain of ERC20, ERC721 and ERC1155 transfers generated from a seed over JSON-RPC,
+for testing and benchmarking without a provider. The same seed always gives the same chain:
+
+    ethgraph fakechain serve --seed 7 --blocks 10000
+    ethgraph byblock "http://127.0.0.1:8545" -f 1 -t 10000`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Errors from here on are not usage errors
+		cmd.SilenceUsage = true
+
+		listener, err := net.Listen("tcp", flagFakechainAddress)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Serving chainId %v, blocks 0 to %v, on http://%s\n",
+			fakechainConfig.ChainId, fakechainConfig.LatestBlock, listener.Addr())
+
+		// Ctrl+C stops serving
+		server := &http.Server{Handler: fakechain.New(fakechainConfig)}
+		go func() {
+			<-cmd.Context().Done()
+			server.Close()
+		}()
+		err = server.Serve(listener)
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fakechainCmd)
+	fakechainCmd.AddCommand(fakechainServeCmd)
+
+	flags := fakechainServeCmd.Flags()
+	flags.StringVar(&flagFakechainAddress, "address", "127.0.0.1:8545", "Host and port to serve on.")
+	flags.Int64Var(&fakechainConfig.Seed, "seed", fakechainConfig.Seed, "Seed the transfers are generated from.")
+	flags.Uint64Var(&fakechainConfig.ChainId, "chain-id", fakechainConfig.ChainId, "ChainId of the chain.")
+	flags.Uint64Var(&fakechainConfig.LatestBlock, "blocks", fakechainConfig.LatestBlock, "Number of the latest block.")
+	flags.IntVar(&fakechainConfig.TransfersPerBlock, "transfers-per-block", fakechainConfig.TransfersPerBlock, "Transfer logs in every block.")
+	flags.IntVar(&fakechainConfig.Wallets, "wallets", fakechainConfig.Wallets, "Wallet addresses transfers are between.")
+	flags.IntVar(&fakechainConfig.Hubs, "hubs", fakechainConfig.Hubs, "Wallets that are hubs, such as exchanges.")
+	flags.Float64Var(&fakechainConfig.HubShare, "hub-share", fakechainConfig.HubShare, "Share of from and to addresses that are a hub.")
+	flags.Float64Var(&fakechainConfig.MintShare, "mint-share", fakechainConfig.MintShare, "Share of transfers from the zero address.")
+	flags.IntVar(&fakechainConfig.Tokens, "tokens", fakechainConfig.Tokens, "Token contracts of each of ERC20, ERC721 and ERC1155.")
+	flags.Float64Var(&fakechainConfig.Erc721Share, "erc721-share", fakechainConfig.Erc721Share, "Share of transfers that are ERC721.")
+	flags.Float64Var(&fakechainConfig.Erc1155Share, "erc1155-share", fakechainConfig.Erc1155Share, "Share of transfers that are ERC1155.")
+	flags.Float64Var(&fakechainConfig.BatchShare, "batch-share", fakechainConfig.BatchShare, "Share of ERC1155 transfers that are a TransferBatch.")
+	flags.IntVar(&fakechainConfig.MaxBatchLength, "max-batch-length", fakechainConfig.MaxBatchLength, "Most ids in a TransferBatch.")
+	flags.IntVar(&fakechainConfig.MaxLogsPerQuery, "max-logs", fakechainConfig.MaxLogsPerQuery, "Most logs one eth_getLogs returns before the query is refused, 0 for no limit.")
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/KevinSmall/ethgraph/services"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+// followCmd represents the follow command to build live from new blocks as they arrive
+var followCmd = &cobra.Command{
+	Use:   "follow <url>...",
+	Short: "Builds GraphML live from new blocks as they arrive on chain",
+	Long: `Builds GraphML live, following new blocks from the latest block as they arrive on
+chain. A block is read once it has the given number of confirmations, and the GraphML file is
+rewritten as the graph grows. For ws:// and wss:// urls new blocks are subscribed to, else the
+chain is polled. Runs until Ctrl+C is pressed, or until --stop-after-blocks blocks are read.
+For example:
+
+    1) follow all Transfer events for token USDT, over a websocket url:
+       ethgraph follow "wss://chain-rpc-endpoint" -o 0xdAC17F958D2ee523a2206206994597C13D831ec7
+
+    2) follow Transfer events where a wallet is the from or to address, polling every 5 seconds:
+       ethgraph follow "https://chain-rpc-endpoint" -a 0x71660c4005BA85c37ccec55d0C4493E66Fe775d3 --poll-interval 5s
+
+    3) follow all Transfer events with no confirmation wait, stopping after 100 blocks:
+       ethgraph follow "https://chain-rpc-endpoint" --confirmations 0 --stop-after-blocks 100`,
+
+	Args: urlArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Validate wallet addresses
+		walletAddresses, err := cmd.Flags().GetStringSlice("address")
+		if err != nil {
+			return err
+		}
+		for _, walletAddress := range walletAddresses {
+			if !common.IsHexAddress(walletAddress) {
+				return fmt.Errorf("the --address value %s is not a valid hex address", walletAddress)
+			}
+		}
+		// Validate intervals
+		pollInterval, err := cmd.Flags().GetDuration("poll-interval")
+		if err != nil {
+			return err
+		}
+		if pollInterval <= 0 {
+			return errors.New("the --poll-interval flag must be positive")
+		}
+		writeInterval, err := cmd.Flags().GetDuration("write-interval")
+		if err != nil {
+			return err
+		}
+		if writeInterval < 0 {
+			return errors.New("the --write-interval flag must not be negative")
+		}
+		// Validate "only this address" if it exists
+		onlyThisAddress, err := cmd.Flags().GetString("only-token-address")
+		if err != nil {
+			return err
+		}
+		if onlyThisAddress != "" && !common.IsHexAddress(onlyThisAddress) {
+			return errors.New("the --only-token-address value is not a valid hex address. Use for example 0xdAC17F958D2ee523a2206206994597C13D831ec7 for USDT")
+		}
+		// validation successful
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Errors from here on are not usage errors
+		cmd.SilenceUsage = true
+		if flagIsVerboseOutputRequested {
+			logr.SetVerbosity(true)
+		} else {
+			logr.SetVerbosity(false)
+		}
+		urls, stop, err := startUrlArgs(args)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		return services.BuildByFollow(cmd.Context(),
+			flagConfirmations,
+			flagPollInterval,
+			flagWriteInterval,
+			flagStopAfterBlocks,
+			getExtractOptions(urls))
+	},
+	Aliases: []string{"fo"},
+}
+
+func init() {
+
+	rootCmd.AddCommand(followCmd)
+
+	followCmd.PersistentFlags().StringSliceVarP(&flagWalletAddresses, "address", "a", nil, "Only select events where this wallet address is the from or to address. Repeat the flag for several addresses.")
+
+	followCmd.PersistentFlags().Uint64Var(&flagConfirmations, "confirmations", 12, "Number of blocks on top of a block before it is read, reduces the chance of reading blocks that are later reorganised away.")
+
+	followCmd.PersistentFlags().DurationVar(&flagPollInterval, "poll-interval", 12*time.Second, "How often the chain is polled for new blocks, not used for ws:// and wss:// urls.")
+
+	followCmd.PersistentFlags().DurationVar(&flagWriteInterval, "write-interval", time.Minute, "Least time between rewrites of the GraphML file. Zero rewrites the file for every new block with events.")
+
+	followCmd.PersistentFlags().Uint64Var(&flagStopAfterBlocks, "stop-after-blocks", 0, "Stop following after this many blocks are read. Zero means follow until Ctrl+C is pressed.")
+
+	followCmd.PersistentFlags().StringVarP(&flagOnlyThisTokenAddress, "only-token-address", "o", "", "Only select events for the specified token address eg USDT is 0xdAC17F958D2ee523a2206206994597C13D831ec7")
+
+	followCmd.PersistentFlags().BoolVarP(&flagDoNotFetchMissingMasterData, "no-fetch-master-data", "n", false, "If set with -n then no fetch of master data for unknown tokens (faster runtime). If omitted (which is the default) then master data is fetched (longer runtime).")
+
+	followCmd.PersistentFlags().BoolVarP(&flagForceSerialExecution, "force-serial-execution", "s", false, "If set with -s then serial execution is forced, PLUS a cap is set on HTTP requests to 10 per second (longer runtime).")
+
+	followCmd.PersistentFlags().BoolVarP(&flagClearTokenCache, "clear-token-cache", "c", false, "If set with -c then the token cache file .tokens_*_cache.csv is deleted (longer runtime). The * in the filename is the chainId see https://chainlist.org/, so 1 for Ethereum.")
+
+	addWorkPoolFlags(followCmd)
+
+	addGraphFileFlags(followCmd)
+
+	followCmd.PersistentFlags().BoolVarP(&flagIsVerboseOutputRequested, "verbose-output", "v", false, "If set with -v then detailed logging information written to stdout.")
+}
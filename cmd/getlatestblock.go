@@ -8,15 +8,22 @@ import (
 
 // getlatestblockCmd represents the getlatestblock command for getting the most recent block
 var getlatestblockCmd = &cobra.Command{
-	Use:   "getblock <url>",
+	Use:   "getblock <url>...",
 	Short: "Gets latest block number",
 	Long: `Gets the most recent block number from the given chain:
 
     ethgraph getblock "https://chain-rpc-endpoint"`,
-	Args: cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	Args: urlArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Errors from here on are not usage errors
+		cmd.SilenceUsage = true
 		logr.SetVerbosity(false)
-		services.GetLatestBlockNumber(args[0])
+		urls, stop, err := startUrlArgs(args)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		return services.GetLatestBlockNumber(cmd.Context(), urls, getDialOptions())
 	},
 	Aliases: []string{"glb"},
 }
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"github.com/KevinSmall/ethgraph/extract"
+	"github.com/KevinSmall/ethgraph/graph"
+	"github.com/KevinSmall/ethgraph/parquetfile"
+	"github.com/spf13/cobra"
+)
+
+// formatValue is the value of the --format flag, only the formats in extract.Formats are accepted
+type formatValue string
+
+var flagFormat = formatValue(graph.FormatGraphML)
+var flagClusterByTx bool
+
+// compressionValue is the value of the --parquet-compression flag, only the compressions in
+// parquetfile.Compressions are accepted
+type compressionValue string
+
+var flagParquetCompression = compressionValue(parquetfile.CompressionSnappy)
+var flagParquetRowGroupMB int64
+
+func (f *formatValue) String() string {
+	return string(*f)
+}
+
+func (f *formatValue) Set(format string) error {
+	if err := extract.CheckFormat(format); err != nil {
+		return err
+	}
+	*f = formatValue(format)
+	return nil
+}
+
+func (f *formatValue) Type() string {
+	return "string"
+}
+
+func (c *compressionValue) String() string {
+	return string(*c)
+}
+
+func (c *compressionValue) Set(compression string) error {
+	if err := parquetfile.CheckCompression(compression); err != nil {
+		return err
+	}
+	*c = compressionValue(compression)
+	return nil
+}
+
+func (c *compressionValue) Type() string {
+	return "string"
+}
+
+// getWriteOptions returns how the graph file is written
+func getWriteOptions() graph.WriteOptions {
+	return graph.WriteOptions{
+		Format:      string(flagFormat),
+		ClusterByTx: flagClusterByTx,
+		Parquet:     getParquetOptions(),
+	}
+}
+
+// getParquetOptions returns how Parquet files are written
+func getParquetOptions() parquetfile.Options {
+	return parquetfile.Options{
+		Compression:  string(flagParquetCompression),
+		RowGroupSize: flagParquetRowGroupMB * 1024 * 1024,
+	}
+}
+
+// addGraphFileFlags adds the flags for how the graph file is written
+func addGraphFileFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().Var(&flagFormat, "format", "Format of the graph file written: graphml, gexf for Gephi with the times nodes and edges appear ready for its timeline, dot for Graphviz, neo4j for a directory of CSVs for neo4j-admin import and a Cypher script, or parquet for a directory of nodes.parquet and edges.parquet tables. The file is named <chainname>.<format>.")
+
+	cmd.PersistentFlags().BoolVar(&flagClusterByTx, "cluster-by-tx", false, "If set with --format dot then the movements of each transaction are drawn together in a box labelled with the transaction hash.")
+
+	addParquetFlags(cmd)
+}
+
+// addParquetFlags adds the flags for how Parquet files are written
+func addParquetFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().Var(&flagParquetCompression, "parquet-compression", "Compression of Parquet files: snappy, gzip, zstd or none.")
+
+	cmd.PersistentFlags().Int64Var(&flagParquetRowGroupMB, "parquet-row-group-mb", parquetfile.DefaultRowGroupSize/(1024*1024), "Size in MB of the row groups of Parquet files. Larger row groups compress better, smaller ones need less memory to write and read.")
+}
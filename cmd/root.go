@@ -1,27 +1,60 @@
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"time"
 
+	"github.com/KevinSmall/ethgraph/chain"
 	"github.com/spf13/cobra"
 )
 
+// serialRequestsPerSecond caps calls to chain in serial execution, if --rps is not set
+const serialRequestsPerSecond = 10
+
 //------------------------------------------------------------------------------
 //  Global Flags, these can get written to by any command
 //------------------------------------------------------------------------------
 
 var flagBlockFrom uint64
 var flagBlockTo uint64
-var flagOnlyThisTokenAddress *string
-var flagDoNotFetchMissingMasterData *bool
-var flagForceSerialExecution *bool
-var flagClearTokenCache *bool
-var flagIsVerboseOutputRequested *bool
+var flagOnlyThisTokenAddress string
+var flagWalletAddresses []string
+var flagSeedAddresses []string
+var flagExcludeAddresses []string
+var flagTxHashes []string
+var flagTxHashFile string
+var flagTimeFrom string
+var flagTimeTo string
+var flagLast string
+var flagHops int
+var flagConfirmations uint64
+var flagPollInterval time.Duration
+var flagWriteInterval time.Duration
+var flagStopAfterBlocks uint64
+var flagMaxFanOut int
+var flagOffline bool
+var flagChainId string
+var flagResume bool
+var flagWritePartial bool
+var flagWorkers int
+var flagRetries int
+var flagBatchSize int
+var flagRequestsPerSecond float64
+var flagMaxConcurrency int
+var flagRpcUrls []string
+var flagRecordDir string
+var flagReplayDir string
+var flagDoNotFetchMissingMasterData bool
+var flagForceSerialExecution bool
+var flagClearTokenCache bool
+var flagIsVerboseOutputRequested bool
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Version: "1.0.1",
-	Use:     "ethgraph <command> <url> [flags]",
+	Use:     "ethgraph <command> <url>... [flags]",
 	Short:   "Ethgraph builds GraphML files of ERC20, ERC721 and ERC1155 token movements from EVM-compatible chains",
 	Long: `Ethgraph is a CLI tool that queries Ethereum or other EVM-compatible chains to
 extract the logs that contracts emit when a Transfer event occurs. Each Transfer event
@@ -41,20 +74,75 @@ Examples:
     4) select Transfer events by block range, fetching all data in serial, capping the number of HTTP requests to 10 per second:
 	   ethgraph byblock "https://chain-rpc-endpoint" -f 16670050 -t 16670150 -s
 
-    5) display the latest block number for a chain:
-       ethgraph getblock "https://chain-rpc-endpoint"`,
+    5) select Transfer events by block range, only where a wallet address is the from or to address:
+       ethgraph byaddress "https://chain-rpc-endpoint" -f 16670050 -t 16670150 -a 0x71660c4005BA85c37ccec55d0C4493E66Fe775d3
+
+    6) follow the money 3 hops out from a wallet address, by block range:
+       ethgraph trace "https://chain-rpc-endpoint" -f 16670050 -t 16670150 --seed 0x71660c4005BA85c37ccec55d0C4493E66Fe775d3 --hops 3
+
+    7) select Transfer events by time window, here the last hour up to the latest block:
+       ethgraph bytime "https://chain-rpc-endpoint" --last 1h
+
+    8) select Transfer events by transaction hash:
+       ethgraph bytx "https://chain-rpc-endpoint" --tx 0x244c8173556a0e15b26db7a7729a66cca0f8689a19a7b6e709ccfe47096074a0
+
+    9) follow new blocks live for a token, rewriting the graph as new blocks arrive:
+       ethgraph follow "wss://chain-rpc-endpoint" -o 0xdAC17F958D2ee523a2206206994597C13D831ec7
+
+    10) select Transfer events by block range, only from events already read into the local event store:
+       ethgraph byblock --offline --chain-id 1 -f 16670050 -t 16670150
+
+    11) display the latest block number for a chain:
+       ethgraph getblock "https://chain-rpc-endpoint"
+
+    12) export the transfer events of a block range as CSV rather than a graph:
+       ethgraph export events "https://chain-rpc-endpoint" -f 16670050 -t 16670150`,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Ctrl+C cancels the context the commands run with, so work in flight is stopped cleanly, and
+// a second Ctrl+C kills the process as usual.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// getDialOptions returns how calls to chain are made, from the flags. Every call of the command
+// is held to the one rate limit returned.
+func getDialOptions() chain.DialOptions {
+	requestsPerSecond := flagRequestsPerSecond
+	if requestsPerSecond == 0 && flagForceSerialExecution {
+		requestsPerSecond = serialRequestsPerSecond
+	}
+	return chain.DialOptions{
+		RateLimiter: chain.NewRateLimiter(chain.RateLimit{
+			RequestsPerSecond: requestsPerSecond,
+			MaxConcurrency:    flagMaxConcurrency,
+		}),
+		RecordDir: flagRecordDir,
+	}
+}
+
 func init() {
+	rootCmd.PersistentFlags().StringArrayVar(&flagRpcUrls, "rpc", nil, "Another url of an endpoint of the same chain, can be repeated. Calls are spread across all the urls given, and moved to another if one fails.")
+
+	rootCmd.PersistentFlags().StringVar(&flagRecordDir, "record", "", "Directory to record every call to chain and its response to, as a cassette that --replay can answer the same calls from later.")
+
+	rootCmd.PersistentFlags().StringVar(&flagReplayDir, "replay", "", "Directory of a cassette recorded with --record, to answer the calls to chain from instead of a url. Calls not recorded fail.")
+
+	rootCmd.PersistentFlags().Float64Var(&flagRequestsPerSecond, "rps", 0, "Most calls to chain per second, shared by all calls. If omitted (which is the default) then there is no limit, except 10 per second with -s. Calls slow down anyway if the provider says they are too fast.")
+
+	rootCmd.PersistentFlags().IntVar(&flagMaxConcurrency, "max-concurrency", 0, "Most calls to chain in flight at the same time, shared by all calls. If omitted (which is the default) then there is no limit.")
+
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	//will be global for your application.
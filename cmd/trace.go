@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/KevinSmall/ethgraph/services"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+// traceCmd represents the trace command to follow token movements outwards from seed addresses
+var traceCmd = &cobra.Command{
+	Use:   "trace <url>...",
+	Short: "Builds GraphML by following token movements outwards from seed addresses",
+	Long: `Builds GraphML by following token movements outwards from seed addresses in a range
+of blocks. At each hop the counterparties of the addresses found so far are followed,
+capped at the most active counterparties per hop. The zero address, known addresses such as
+exchanges and any --exclude addresses are shown but never followed. Each address node has a
+hopDistance attribute. For example:
+
+    1) follow the money 3 hops out from a wallet address, by block range:
+       ethgraph trace "https://chain-rpc-endpoint" -f 16670050 -t 16670150 --seed 0x71660c4005BA85c37ccec55d0C4493E66Fe775d3 --hops 3
+
+    2) follow the money 2 hops out, following at most 10 counterparties per hop:
+       ethgraph trace "https://chain-rpc-endpoint" -f 16670050 -t 16670150 --seed 0x71660c4005BA85c37ccec55d0C4493E66Fe775d3 --hops 2 --max-fan-out 10
+
+    3) follow the money 2 hops out, never following a given address:
+       ethgraph trace "https://chain-rpc-endpoint" -f 16670050 -t 16670150 --seed 0x71660c4005BA85c37ccec55d0C4493E66Fe775d3 --exclude 0xDA9dfA130Df4dE4673b89022EE50ff26f6EA73Cf`,
+
+	Args: urlArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Validate block from and to
+		from, err := cmd.Flags().GetUint64("block-from")
+		if err != nil {
+			return err
+		}
+		to, err := cmd.Flags().GetUint64("block-to")
+		if err != nil {
+			return err
+		}
+		if from > to {
+			return errors.New("the --block-from flag must be less than or equal to the --block-to flag")
+		}
+		// Validate seed and exclude addresses
+		for _, flagName := range []string{"seed", "exclude"} {
+			flagAddresses, err := cmd.Flags().GetStringSlice(flagName)
+			if err != nil {
+				return err
+			}
+			for _, flagAddress := range flagAddresses {
+				if !common.IsHexAddress(flagAddress) {
+					return fmt.Errorf("the --%s value %s is not a valid hex address", flagName, flagAddress)
+				}
+			}
+		}
+		// Validate hops and fan-out
+		hops, err := cmd.Flags().GetInt("hops")
+		if err != nil {
+			return err
+		}
+		if hops < 1 {
+			return errors.New("the --hops flag must be at least 1")
+		}
+		maxFanOut, err := cmd.Flags().GetInt("max-fan-out")
+		if err != nil {
+			return err
+		}
+		if maxFanOut < 0 {
+			return errors.New("the --max-fan-out flag must not be negative")
+		}
+		// Validate "only this address" if it exists
+		onlyThisAddress, err := cmd.Flags().GetString("only-token-address")
+		if err != nil {
+			return err
+		}
+		if onlyThisAddress != "" && !common.IsHexAddress(onlyThisAddress) {
+			return errors.New("the --only-token-address value is not a valid hex address. Use for example 0xdAC17F958D2ee523a2206206994597C13D831ec7 for USDT")
+		}
+		// validation successful
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Errors from here on are not usage errors
+		cmd.SilenceUsage = true
+		if flagIsVerboseOutputRequested {
+			logr.SetVerbosity(true)
+		} else {
+			logr.SetVerbosity(false)
+		}
+		urls, stop, err := startUrlArgs(args)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		return services.BuildByTrace(cmd.Context(),
+			flagSeedAddresses,
+			flagHops,
+			flagMaxFanOut,
+			flagExcludeAddresses,
+			getExtractOptions(urls))
+	},
+	Aliases: []string{"tr"},
+}
+
+func init() {
+
+	rootCmd.AddCommand(traceCmd)
+
+	traceCmd.PersistentFlags().StringSliceVar(&flagSeedAddresses, "seed", nil, "Seed address to start following the money from. Repeat the flag for several seeds.")
+	traceCmd.MarkPersistentFlagRequired("seed")
+
+	traceCmd.PersistentFlags().IntVar(&flagHops, "hops", 2, "How many hops out from the seed addresses to follow.")
+
+	traceCmd.PersistentFlags().IntVar(&flagMaxFanOut, "max-fan-out", 25, "Most counterparties followed per hop, the most active are followed. Zero means no cap.")
+
+	traceCmd.PersistentFlags().StringSliceVar(&flagExcludeAddresses, "exclude", nil, "Address that is never followed, in addition to the zero address and known addresses like exchanges. Repeat the flag for several addresses.")
+
+	traceCmd.PersistentFlags().Uint64VarP(&flagBlockFrom, "block-from", "f", 0, "Block number from eg 16667050")
+	traceCmd.MarkPersistentFlagRequired("block-from")
+
+	traceCmd.PersistentFlags().Uint64VarP(&flagBlockTo, "block-to", "t", 1, "Block number to eg 16667150")
+	traceCmd.MarkPersistentFlagRequired("block-to")
+
+	traceCmd.PersistentFlags().StringVarP(&flagOnlyThisTokenAddress, "only-token-address", "o", "", "Only select events for the specified token address eg USDT is 0xdAC17F958D2ee523a2206206994597C13D831ec7")
+
+	traceCmd.PersistentFlags().BoolVarP(&flagDoNotFetchMissingMasterData, "no-fetch-master-data", "n", false, "If set with -n then no fetch of master data for unknown tokens (faster runtime). If omitted (which is the default) then master data is fetched (longer runtime).")
+
+	traceCmd.PersistentFlags().BoolVarP(&flagForceSerialExecution, "force-serial-execution", "s", false, "If set with -s then serial execution is forced, PLUS a cap is set on HTTP requests to 10 per second (longer runtime).")
+
+	traceCmd.PersistentFlags().BoolVarP(&flagClearTokenCache, "clear-token-cache", "c", false, "If set with -c then the token cache file .tokens_*_cache.csv is deleted (longer runtime). The * in the filename is the chainId see https://chainlist.org/, so 1 for Ethereum.")
+
+	addWorkPoolFlags(traceCmd)
+
+	addGraphFileFlags(traceCmd)
+
+	traceCmd.PersistentFlags().BoolVarP(&flagIsVerboseOutputRequested, "verbose-output", "v", false, "If set with -v then detailed logging information written to stdout.")
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/work"
+	"github.com/spf13/cobra"
+)
+
+// getPoolOptions returns how many calls to chain are made at the same time, and how often
+// failed calls are retried, when not in serial execution
+func getPoolOptions() work.Options {
+	return work.Options{
+		Workers: flagWorkers,
+		Retries: flagRetries,
+	}
+}
+
+// addWorkPoolFlags adds the flags for how calls to chain are made when not in serial execution
+func addWorkPoolFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().IntVar(&flagWorkers, "workers", work.DefaultWorkers, "Number of calls to chain made at the same time, when not in serial execution.")
+
+	cmd.PersistentFlags().IntVar(&flagRetries, "retries", 3, "Number of times a failed call to chain is retried, with a growing delay between tries, when not in serial execution.")
+
+	addBatchSizeFlag(cmd)
+}
+
+// addBatchSizeFlag adds the flag for how many calls to chain are sent in one batch request
+func addBatchSizeFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().IntVar(&flagBatchSize, "batch-size", chain.DefaultBatchSize, "Number of calls for block times and token names sent to chain in one batch request. Use a smaller batch size for a provider that limits batch requests.")
+}
@@ -7,6 +7,7 @@ import (
 	"math/big"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var zeroAddress = common.Address{}
@@ -84,3 +85,40 @@ func SafeScaleTokenValue(tokenValue *big.Int, decimals int) (resultFloat float64
 	}
 	return math.Round(resultFloat*100) / 100
 }
+
+// ScaleTokenValueExact scales a token value by the given decimals and returns the exact decimal
+// string, with no trailing zeros after the decimal point. So 123456789 and 6 decimals will
+// return 123.456789, and 1500000 and 6 decimals will return 1.5. Decimals of 0 or less return
+// the value unscaled.
+func ScaleTokenValueExact(tokenValue *big.Int, decimals int) string {
+	if decimals <= 0 {
+		return tokenValue.String()
+	}
+	sign := ""
+	if tokenValue.Sign() < 0 {
+		sign = "-"
+	}
+	digits := new(big.Int).Abs(tokenValue).String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	whole := digits[:len(digits)-decimals]
+	fraction := strings.TrimRight(digits[len(digits)-decimals:], "0")
+	if fraction == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + fraction
+}
+
+// ParseDurationWithDays parses a duration like time.ParseDuration does, e.g. 90m or 1h30m, and
+// also accepts a whole number of days with a d suffix, e.g. 7d
+func ParseDurationWithDays(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseUint(strings.TrimSuffix(s, "d"), 10, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
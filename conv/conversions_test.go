@@ -4,6 +4,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"math/big"
 	"testing"
+	"time"
 )
 
 func TestFormatBlockNumberWithUnderscores(t *testing.T) {
@@ -61,3 +62,56 @@ func TestPrettyTrimAddress(t *testing.T) {
 		}
 	}
 }
+
+func TestParseDurationWithDays(t *testing.T) {
+	testCases := []struct {
+		s           string
+		expected    time.Duration
+		expectError bool
+	}{
+		{"1h", time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"xd", 0, true},
+		{"garbage", 0, true},
+	}
+
+	for _, tc := range testCases {
+		actual, err := ParseDurationWithDays(tc.s)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("ParseDurationWithDays(%q) expected an error", tc.s)
+			}
+			continue
+		}
+		if err != nil || actual != tc.expected {
+			t.Errorf("ParseDurationWithDays(%q) = %v, %v, expected %v", tc.s, actual, err, tc.expected)
+		}
+	}
+}
+
+func TestScaleTokenValueExact(t *testing.T) {
+	maxUint256, _ := new(big.Int).SetString("115792089237316195423570985008687907853269984665640564039457584007913129639935", 10)
+	testCases := []struct {
+		tokenValue *big.Int
+		decimals   int
+		expected   string
+	}{
+		{big.NewInt(123456789), 6, "123.456789"},
+		{big.NewInt(1500000), 6, "1.5"},
+		{big.NewInt(2000000), 6, "2"},
+		{big.NewInt(1), 18, "0.000000000000000001"},
+		{big.NewInt(123456789), 0, "123456789"},
+		{big.NewInt(0), 18, "0"},
+		{big.NewInt(-1500000), 6, "-1.5"},
+		{big.NewInt(42), -1, "42"},
+		{maxUint256, 18, "115792089237316195423570985008687907853269984665640564039457.584007913129639935"},
+	}
+
+	for _, tc := range testCases {
+		result := ScaleTokenValueExact(tc.tokenValue, tc.decimals)
+		if result != tc.expected {
+			t.Errorf("ScaleTokenValueExact(%v, %v) = %v, expected %v", tc.tokenValue, tc.decimals, result, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package extract reads transfer events from an EVM chain, enriches them with block times and
+// token and address master data, and builds and writes the graph of them. Every step returns an
+// error rather than stopping the program, so it can be used as a library as well as by the
+// ethgraph commands.
+package extract
+
+import (
+	"context"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/graph"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/KevinSmall/ethgraph/work"
+)
+
+// Options selects the events to read and says how to read them
+type Options struct {
+	// Urls of the chain RPC endpoints, calls are spread across them, not used if offline
+	Urls []string
+
+	// OfflineChainId if not empty means the chain is not used at all, and events and block master
+	// data are read only from the local event store for this chainId
+	OfflineChainId string
+
+	// BlockFrom and BlockTo are the block range to read, inclusive
+	BlockFrom uint64
+	BlockTo   uint64
+
+	// Filter selects which transfer events to read
+	Filter chain.TransferFilter
+
+	// DoNotFetchMissingMasterData if true skips reading master data for unknown tokens from chain
+	DoNotFetchMissingMasterData bool
+
+	// ForceSerialExecution if true reads from chain one call at a time. How fast calls are made
+	// is capped by the rate limit of Dial.
+	ForceSerialExecution bool
+
+	// Dial says how calls to chain are made, such as the rate limit they are held to and whether
+	// they are recorded
+	Dial chain.DialOptions
+
+	// Progress if not nil is told how each step of reading from chain goes, nothing is printed
+	// otherwise
+	Progress ProgressFunc
+
+	// Pool says how many calls to chain are made at the same time, and how often failed calls
+	// are retried, when not in serial execution
+	Pool work.Options
+
+	// BatchSize is how many calls for block and token master data are sent in one JSON-RPC batch
+	// request, 0 means chain.DefaultBatchSize
+	BatchSize int
+
+	// ClearTokenCache if true deletes the local token cache file before loading token master data
+	ClearTokenCache bool
+
+	// NoEventStore if true reads everything from chain, without using the local event store
+	NoEventStore bool
+
+	// Resume if true continues an earlier run that was interrupted part way through reading blocks
+	Resume bool
+
+	// WritePartial if true means that if ctx is cancelled while reading, the graph of the events
+	// read so far is still written, marked with the graph attribute partial=true
+	WritePartial bool
+
+	// GraphOptions adds attributes to the graph, and holds the token and address master data of
+	// the run, see LoadMasterData
+	GraphOptions graph.Options
+
+	// Filename of the graph file written, if empty it is named after the chain
+	Filename string
+
+	// WriteOptions says how the graph file is written, such as its format
+	WriteOptions graph.WriteOptions
+}
+
+// Result is everything produced by Run
+type Result struct {
+	// Chain is the chain the events were read from. Its client is closed when Run returns, so it
+	// cannot be used to read the chain after.
+	Chain chain.EvmClient
+
+	// Events are the enriched events in the graph
+	Events []*chain.TransferEvent
+
+	// CreationResult has the counts of nodes, edges and events in the graph
+	CreationResult graph.CreationResult
+
+	// Filename is the graph file written
+	Filename string
+
+	// Partial is true if the graph written has only the events read before ctx was cancelled
+	Partial bool
+}
+
+func (opts Options) isOffline() bool {
+	return opts.OfflineChainId != ""
+}
+
+// Connect creates the client for the chain at urls, making calls as dialOptions says. With more
+// than one url calls are spread across them, and all must be endpoints of the same chain.
+func Connect(ctx context.Context, urls []string, dialOptions chain.DialOptions) (chain.EvmClient, error) {
+	evmChain, err := chain.CreateEvmClientWithOptions(ctx, urls, dialOptions)
+	if err != nil {
+		return chain.EvmClient{}, err
+	}
+	if len(urls) > 1 {
+		logr.Info.Printf("Connecting to: %s with ChainId: %s over %v endpoints\n", evmChain.Name, evmChain.ChainId, len(urls))
+	} else {
+		logr.Info.Printf("Connecting to: %s with ChainId: %s\n", evmChain.Name, evmChain.ChainId)
+	}
+	return evmChain, nil
+}
+
+// ConnectOffline creates a client for chainId with no connection, for reading only the local
+// event store
+func ConnectOffline(chainId string) chain.EvmClient {
+	evmChain := chain.CreateOfflineEvmClient(chainId)
+	logr.Info.Printf("Offline, reading event store for: %s with ChainId: %s\n", evmChain.Name, evmChain.ChainId)
+	return evmChain
+}
+
+// Run connects to the chain given in opts, or the local event store if offline, then reads,
+// enriches and writes the graph of the events selected by opts. The client connected is closed
+// before Run returns.
+func Run(ctx context.Context, opts Options) (Result, error) {
+	evmChain, err := connectFor(ctx, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	defer evmChain.Close()
+	return RunOnChain(ctx, evmChain, opts)
+}
+
+// connectFor connects to the chain given in opts, or the local event store if offline
+func connectFor(ctx context.Context, opts Options) (chain.EvmClient, error) {
+	if opts.isOffline() {
+		return ConnectOffline(opts.OfflineChainId), nil
+	}
+	return Connect(ctx, opts.Urls, opts.Dial)
+}
+
+// RunOnChain is Run for a chain already connected to. If ctx is cancelled while reading, and
+// opts.WritePartial is true, the graph of the events read so far is written, and the error of
+// ctx is returned along with the result.
+func RunOnChain(ctx context.Context, evmChain chain.EvmClient, opts Options) (Result, error) {
+	result := Result{Chain: evmChain}
+	if err := CheckWriteOptions(opts.WriteOptions); err != nil {
+		return result, err
+	}
+	LoadMasterData(evmChain, &opts)
+
+	// Prepare []allEvents
+	// Does do:      data cleansing, ERC1155 decompose
+	// Does not do:  business logic, no master data reads
+	allEvents, err := FetchEvents(ctx, evmChain, opts)
+	if err != nil {
+		return runPartial(ctx, evmChain, allEvents, opts, result, err)
+	}
+
+	// Time field enrichment, token and address master data
+	enrichedEvents, err := Enrich(ctx, evmChain, allEvents, opts)
+	if err != nil {
+		return runPartial(ctx, evmChain, allEvents, opts, result, err)
+	}
+	allEvents = enrichedEvents
+	result.Events = allEvents
+
+	// Prepare and write Graph
+	ethGraph, creationResult, err := BuildGraph(ctx, evmChain, allEvents, opts)
+	if err != nil {
+		return result, err
+	}
+	result.CreationResult = creationResult
+	result.Filename, err = WriteGraph(evmChain, ethGraph, allEvents, opts)
+	return result, err
+}
+
+// runPartial writes the graph of the events read before ctx was cancelled, if opts.WritePartial
+// is true. Block times still missing are read from chain, without ctx so a cancelled ctx does
+// not stop them, but no token master data is. runErr, the error that stopped the run, is
+// returned along with the result, unless writing the partial graph fails too.
+func runPartial(ctx context.Context, evmChain chain.EvmClient, allEvents []*chain.TransferEvent, opts Options,
+	result Result, runErr error) (Result, error) {
+
+	if !opts.WritePartial || ctx.Err() == nil {
+		return result, runErr
+	}
+	logr.Warning.Printf("Stopped after reading %v events, writing partial graph\n", len(allEvents))
+
+	opts.DoNotFetchMissingMasterData = true
+	opts.GraphOptions.Partial = true
+	allEvents, err := Enrich(context.Background(), evmChain, allEvents, opts)
+	if err != nil {
+		return result, err
+	}
+	result.Events = allEvents
+
+	ethGraph, creationResult, err := BuildGraph(context.Background(), evmChain, allEvents, opts)
+	if err != nil {
+		return result, err
+	}
+	result.CreationResult = creationResult
+	result.Filename, err = WriteGraph(evmChain, ethGraph, allEvents, opts)
+	if err != nil {
+		return result, err
+	}
+	result.Partial = true
+	return result, runErr
+}
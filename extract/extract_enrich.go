@@ -0,0 +1,260 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/blocks"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/KevinSmall/ethgraph/masterdata/addresses"
+	"github.com/KevinSmall/ethgraph/masterdata/tokens"
+	"github.com/KevinSmall/ethgraph/store"
+	"github.com/ethereum/go-ethereum/common"
+	"sort"
+	"time"
+)
+
+// Enrich adds the time fields to the events, from the master data of their blocks. Master data
+// for tokens not seen before is read from chain into opts.GraphOptions.Tokens, loaded with
+// LoadMasterData, unless opts.DoNotFetchMissingMasterData is set or offline.
+func Enrich(ctx context.Context, evmChain chain.EvmClient, allEvents []*chain.TransferEvent, opts Options) (
+	[]*chain.TransferEvent, error) {
+
+	uniqueBlocksMap, err := FetchBlockMasterData(ctx, evmChain, allEvents, opts)
+	if err != nil {
+		return nil, err
+	}
+	allEvents, err = EnrichWithTimeEstimates(allEvents, uniqueBlocksMap)
+	if err != nil {
+		return nil, err
+	}
+
+	// Complete the token master data
+	if !opts.DoNotFetchMissingMasterData && !opts.isOffline() {
+		err = FetchMissingTokenMasterData(ctx, evmChain, allEvents, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return allEvents, nil
+}
+
+// FetchBlockMasterData returns the block master data for the blocks the events are in. Blocks
+// in the local event store are read from there, unless opts.NoEventStore is set, and the rest
+// are read from chain.
+func FetchBlockMasterData(ctx context.Context, evmChain chain.EvmClient, allEvents []*chain.TransferEvent, opts Options) (
+	blocks.BlockMap, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Prepare block master data, first find out what blocks need master data
+	uniqueBlocksMap := blocks.BuildUniqueBlocksFromEvents(allEvents)
+	storedBlocksMap := make(blocks.BlockMap)
+	if !opts.NoEventStore {
+		eventStore, err := store.Open(evmChain.ChainId)
+		if err != nil {
+			return nil, err
+		}
+		storedBlocksMap, err = eventStore.GetBlocks(uniqueBlocksMap)
+		eventStore.Close()
+		if err != nil {
+			return nil, err
+		}
+		for blockKey := range storedBlocksMap {
+			delete(uniqueBlocksMap, blockKey)
+		}
+	}
+	if len(uniqueBlocksMap) == 0 {
+		return storedBlocksMap, nil
+	}
+	if opts.isOffline() {
+		return nil, fmt.Errorf("offline, master data for %v blocks is not in the event store", len(uniqueBlocksMap))
+	}
+
+	// then populate the master data for each remaining block from chain
+	chainBlocksMap, err := getBlockMasterData(ctx, evmChain, uniqueBlocksMap, opts)
+	if err != nil {
+		return nil, err
+	}
+	for blockKey, blockMapValue := range storedBlocksMap {
+		chainBlocksMap[blockKey] = blockMapValue
+	}
+	return chainBlocksMap, nil
+}
+
+// fetchBlockMasterDataFromChain reads the block master data from chain for the blocks the events are in
+func fetchBlockMasterDataFromChain(ctx context.Context, evmChain chain.EvmClient, allEvents []*chain.TransferEvent, opts Options) (
+	blocks.BlockMap, error) {
+	return getBlockMasterData(ctx, evmChain, blocks.BuildUniqueBlocksFromEvents(allEvents), opts)
+}
+
+// getBlockMasterData reads the block master data from chain for the blocks of uniqueBlocksMap
+func getBlockMasterData(ctx context.Context, evmChain chain.EvmClient, uniqueBlocksMap blocks.BlockMap, opts Options) (
+	blocks.BlockMap, error) {
+	if opts.ForceSerialExecution {
+		return getBlockMasterDataSerial(ctx, evmChain, uniqueBlocksMap, opts.BatchSize, opts.Progress)
+	}
+	return getBlockMasterDataConcurrent(ctx, evmChain, uniqueBlocksMap, opts.Pool, opts.BatchSize, opts.Progress)
+}
+
+// EnrichWithTimeEstimates returns the enriched slice with all time fields added, the master data
+// of every block the events are in must be in uniqueBlocksMap
+func EnrichWithTimeEstimates(events []*chain.TransferEvent,
+	uniqueBlocksMap blocks.BlockMap) ([]*chain.TransferEvent, error) {
+
+	addressTimeFirstSeenMap := make(map[common.Address]time.Time, 0)
+
+	for _, event := range events {
+		txTimestamp, err := blocks.GetEstimatedBlockTimeForTransaction(
+			uniqueBlocksMap,
+			event.BlockNumber,
+			event.TxIndex)
+		if err != nil {
+			return nil, err
+		}
+		event.TransactionTimestampEstimate = txTimestamp.Round(time.Millisecond)
+
+		// Store the first seen times
+		// For the FROM address
+		addressTimeFirstSeen, exists := addressTimeFirstSeenMap[event.LogAddressFrom]
+		if !exists {
+			addressTimeFirstSeenMap[event.LogAddressFrom] = event.TransactionTimestampEstimate
+		} else {
+			if addressTimeFirstSeen.After(event.TransactionTimestampEstimate) {
+				addressTimeFirstSeenMap[event.LogAddressFrom] = event.TransactionTimestampEstimate
+			}
+		}
+		// For the TO address
+		addressTimeFirstSeen, exists = addressTimeFirstSeenMap[event.LogAddressTo]
+		if !exists {
+			addressTimeFirstSeenMap[event.LogAddressTo] = event.TransactionTimestampEstimate
+		} else {
+			if addressTimeFirstSeen.After(event.TransactionTimestampEstimate) {
+				addressTimeFirstSeenMap[event.LogAddressTo] = event.TransactionTimestampEstimate
+			}
+		}
+	}
+
+	// Write back the first seen times for the FROM and TO addresses
+	for _, event := range events {
+		event.LogAddressFromFirstSeen, _ = addressTimeFirstSeenMap[event.LogAddressFrom]
+		event.LogAddressToFirstSeen, _ = addressTimeFirstSeenMap[event.LogAddressTo]
+	}
+
+	// For preparing test data
+	//fmt.Print("[]*Event{")
+	//for i, event := range events {
+	//	if i > 0 {
+	//		fmt.Print(", ")
+	//	}
+	//	fmt.Printf("&Event{%#v}", *event)
+	//}
+	//fmt.Println("}")
+
+	// Add index-equivalents of the timestamps
+	timeToIndexMap := GetTimeToIndexMap(events)
+	for _, event := range events {
+		event.TransactionTimestampEstimateIndex, _ = timeToIndexMap[event.TransactionTimestampEstimate]
+		event.LogAddressFromFirstSeenIndex, _ = timeToIndexMap[event.LogAddressFromFirstSeen]
+		event.LogAddressToFirstSeenIndex, _ = timeToIndexMap[event.LogAddressToFirstSeen]
+	}
+	return events, nil
+}
+
+// GetTimeToIndexMap takes the events.TransactionTimestampEstimate field, makes a unique list of them, and assigns an
+// index counter to them 0, 1, 2 etc.
+func GetTimeToIndexMap(events []*chain.TransferEvent) (timeToIndexMap map[time.Time]uint) {
+	// Create a slice to store unique event.TransactionTimestampEstimate values
+	uniqueTimestamps := make([]time.Time, 0)
+
+	// Create a map to store the index of each unique timestamp
+	timestampIndexMap := make(map[time.Time]uint)
+
+	// Loop through the events to collect unique timestamps
+	for _, event := range events {
+		if _, ok := timestampIndexMap[event.TransactionTimestampEstimate]; !ok {
+			uniqueTimestamps = append(uniqueTimestamps, event.TransactionTimestampEstimate)
+			timestampIndexMap[event.TransactionTimestampEstimate] = uint(len(uniqueTimestamps) - 1)
+		}
+	}
+
+	// Sort the unique timestamps slice in ascending order
+	sort.Slice(uniqueTimestamps, func(i, j int) bool {
+		return uniqueTimestamps[i].Before(uniqueTimestamps[j])
+	})
+
+	// Create a map to store the index of each unique timestamp
+	timeToIndexMap = make(map[time.Time]uint)
+	for _, timestamp := range uniqueTimestamps {
+		timeToIndexMap[timestamp] = timestampIndexMap[timestamp]
+	}
+
+	return timeToIndexMap
+}
+
+// LoadMasterData loads the token and address master data for the chain into opts.GraphOptions,
+// where the graph is built with them, deleting the local token cache first if
+// opts.ClearTokenCache is set. Master data already there for the same chain, such as from an
+// earlier run, is kept, so runs can share it.
+func LoadMasterData(evmChain chain.EvmClient, opts *Options) {
+	if opts.GraphOptions.Tokens == nil || opts.GraphOptions.Tokens.ChainId() != evmChain.ChainId {
+		if opts.ClearTokenCache {
+			tokens.DeleteTokenCache(evmChain.ChainId)
+		}
+		opts.GraphOptions.Tokens = tokens.Load(evmChain.ChainId)
+	}
+	if opts.GraphOptions.Addresses == nil || opts.GraphOptions.Addresses.ChainId() != evmChain.ChainId {
+		opts.GraphOptions.Addresses = addresses.Load(evmChain.ChainId)
+	}
+	logr.Trace.Printf("Loaded %v popular addresses and names\n", opts.GraphOptions.Addresses.GetAddressesLoadedCount())
+	logr.Trace.Printf("Loaded %v token addresses and symbols\n", opts.GraphOptions.Tokens.GetTokensLoadedCount())
+}
+
+// FetchMissingTokenMasterData reads the master data from chain for the tokens of the events that
+// have none yet, and adds it to the token master data loaded into opts.GraphOptions.Tokens with
+// LoadMasterData, and to the local token cache
+func FetchMissingTokenMasterData(ctx context.Context, evmChain chain.EvmClient, allEvents []*chain.TransferEvent, opts Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tokenMap := opts.GraphOptions.Tokens
+	if tokenMap == nil {
+		return errors.New("token master data is not loaded, see LoadMasterData")
+	}
+
+	// Augment the token master data (cache file and map) based on allEvents
+	uniqueAddressesMap := tokens.BuildUniqueTokenAddressesFromEvents(allEvents)
+
+	// Reduce to a UNIQUE list of UNKNOWN tokens (those without master data)
+	uniqueAddressesMap = tokenMap.RemoveUnknownTokens(uniqueAddressesMap)
+	logr.Info.Println("Tokens not seen before:", len(uniqueAddressesMap))
+	//tokens.PrintContents(uniqueAddressesMap)
+
+	// Populate the missing master data, with Multicall3 if the chain has it
+	var tokenMapToAdd map[string]tokens.TokenDataFromSource
+	if len(uniqueAddressesMap) > 0 {
+		resolver, err := tokens.NewTokenResolver(ctx, evmChain.Client)
+		if err != nil {
+			return err
+		}
+		if opts.ForceSerialExecution {
+			tokenMapToAdd, err = getTokenMasterDataForMissingTokensSerial(ctx, evmChain, resolver, uniqueAddressesMap, opts.BatchSize,
+				opts.Progress)
+		} else {
+			tokenMapToAdd, err = getTokenMasterDataForMissingTokensConcurrent(ctx, evmChain, resolver, uniqueAddressesMap, opts.Pool,
+				opts.BatchSize, opts.Progress)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Merge tokenMapToAdd entries into the tokenMap data
+	tokenMap.MergeTokens(tokenMapToAdd)
+
+	// Merge tokenMapAdd into the local .csv cache file
+	return tokenMap.WriteToCache()
+}
@@ -1,4 +1,4 @@
-package services
+package extract
 
 import (
 	"github.com/KevinSmall/ethgraph/chain"
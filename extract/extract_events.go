@@ -0,0 +1,76 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/store"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// FetchEvents reads the transfer events selected by opts, without any enrichment. Blocks already
+// read for the filter are read from the local event store, unless opts.NoEventStore is set. If
+// reading fails part way, for example because ctx is cancelled, the events read so far are
+// returned along with the error.
+func FetchEvents(ctx context.Context, evmChain chain.EvmClient, opts Options) ([]*chain.TransferEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.NoEventStore {
+		if opts.isOffline() {
+			return nil, errors.New("offline needs the event store")
+		}
+		return fetchTransferEvents(ctx, evmChain, opts.BlockFrom, opts.BlockTo, opts)
+	}
+
+	eventStore, err := store.Open(evmChain.ChainId)
+	if err != nil {
+		return nil, err
+	}
+	defer eventStore.Close()
+	return getTransferEventsUsingStore(ctx, evmChain, eventStore, opts)
+}
+
+// FetchEventsByTransactions reads the transfer events matching opts.Filter from the receipts
+// of the transactions, without any enrichment. The block range of opts is not used, and a
+// transaction given twice is only read once.
+func FetchEventsByTransactions(ctx context.Context, evmChain chain.EvmClient, txHashes []common.Hash, opts Options) (
+	[]*chain.TransferEvent, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Unique transactions, a hash given twice would double count its movements
+	var uniqueTxHashes []common.Hash
+	seenTxHashes := make(map[common.Hash]bool)
+	for _, txHash := range txHashes {
+		if !seenTxHashes[txHash] {
+			seenTxHashes[txHash] = true
+			uniqueTxHashes = append(uniqueTxHashes, txHash)
+		}
+	}
+
+	if opts.ForceSerialExecution {
+		return getEventsFromTransactionsSerial(ctx, evmChain, uniqueTxHashes, opts.Filter, opts.Progress)
+	}
+	return getEventsFromTransactionsConcurrent(ctx, evmChain, uniqueTxHashes, opts.Filter, opts.Pool, opts.Progress)
+}
+
+// fetchTransferEvents reads the transfer events selected by opts.Filter in the block range from
+// chain, without any enrichment
+func fetchTransferEvents(ctx context.Context, evmChain chain.EvmClient, blockFrom uint64, blockTo uint64, opts Options) (
+	[]*chain.TransferEvent, error) {
+	return fetchTransferEventsReporting(ctx, evmChain, blockFrom, blockTo, opts, nil)
+}
+
+// fetchTransferEventsReporting is fetchTransferEvents, calling onWindowFetched with the events of
+// each window of blocks as soon as it is read. In concurrent execution it is called from many
+// goroutines at once.
+func fetchTransferEventsReporting(ctx context.Context, evmChain chain.EvmClient, blockFrom uint64, blockTo uint64, opts Options,
+	onWindowFetched windowFetchedFunc) ([]*chain.TransferEvent, error) {
+	if opts.ForceSerialExecution {
+		return getEventsFromBlocksSerial(ctx, evmChain, blockFrom, blockTo, opts.Filter, onWindowFetched, opts.Progress)
+	}
+	return getEventsFromBlocksConcurrent(ctx, evmChain, blockFrom, blockTo, opts.Filter, onWindowFetched, opts.Pool, opts.Progress)
+}
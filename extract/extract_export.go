@@ -0,0 +1,216 @@
+package extract
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/conv"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/KevinSmall/ethgraph/masterdata/tokens"
+	"github.com/KevinSmall/ethgraph/parquetfile"
+	"os"
+	"strconv"
+	"time"
+)
+
+// EventColumns are the columns of the table of events written by WriteEvents
+var EventColumns = []string{
+	"blockNumber", "timestampEstimate", "txHash", "txIndex", "logIndex", "transferType", "from", "to",
+	"value", "scaledValue", "decimals", "nftId", "operator", "emitter", "symbol",
+}
+
+// eventTimestampLayout is the layout of timestampEstimate in the table of events, in UTC
+const eventTimestampLayout = "2006-01-02T15:04:05.000Z"
+
+// Formats of the table of events
+const (
+	EventFormatCsv     = "csv"
+	EventFormatTsv     = "tsv"
+	EventFormatParquet = "parquet"
+)
+
+// ExportEvents connects to the chain given in opts, or the local event store if offline, then
+// reads and enriches the events selected by opts like Run, but writes them as a table rather
+// than a graph, see WriteEvents. The file is named in opts, or named after the chain if none is
+// given. format is EventFormatCsv, EventFormatTsv, or EventFormatParquet for a Parquet file written
+// with the options in opts.WriteOptions.Parquet, empty means CSV. The client connected is closed
+// before ExportEvents returns.
+func ExportEvents(ctx context.Context, opts Options, format string) (Result, error) {
+	if format == "" {
+		format = EventFormatCsv
+	}
+	if format != EventFormatCsv && format != EventFormatTsv && format != EventFormatParquet {
+		return Result{}, fmt.Errorf("unknown events format %q, use one of %s, %s, %s", format,
+			EventFormatCsv, EventFormatTsv, EventFormatParquet)
+	}
+	if err := parquetfile.CheckCompression(opts.WriteOptions.Parquet.Compression); err != nil {
+		return Result{}, err
+	}
+	evmChain, err := connectFor(ctx, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	defer evmChain.Close()
+	result := Result{Chain: evmChain}
+	LoadMasterData(evmChain, &opts)
+	allEvents, err := FetchEvents(ctx, evmChain, opts)
+	if err != nil {
+		return result, err
+	}
+	allEvents, err = Enrich(ctx, evmChain, allEvents, opts)
+	if err != nil {
+		return result, err
+	}
+	result.Events = allEvents
+	result.CreationResult.Events = len(allEvents)
+
+	filename := opts.Filename
+	if filename == "" {
+		filename = fmt.Sprintf("%s_events.%s", evmChain.Name, format)
+	}
+	if format == EventFormatParquet {
+		err = WriteEventsParquet(filename, allEvents, opts.GraphOptions.Tokens, opts.WriteOptions.Parquet)
+	} else {
+		err = WriteEvents(filename, allEvents, opts.GraphOptions.Tokens, format == EventFormatTsv)
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Filename = filename
+	logr.Info.Printf("Chain Transfer Events: %v\n", len(allEvents))
+	return result, nil
+}
+
+// WriteEvents writes the events to filename as a table with a header row of EventColumns, comma
+// separated, or tab separated if tsv is true. value is the raw value of the log, and scaledValue
+// is the exact value scaled by the decimals of the token, both in full with no rounding.
+// decimals, scaledValue and symbol are empty for tokens with no master data in tokenMap, and
+// operator is empty for all but ERC1155.
+func WriteEvents(filename string, events []*chain.TransferEvent, tokenMap *tokens.TokenMap, tsv bool) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(file)
+	if tsv {
+		w.Comma = '\t'
+	}
+	w.Write(EventColumns)
+	for _, event := range events {
+		w.Write(eventRecord(event, tokenMap))
+	}
+	w.Flush()
+	err = w.Error()
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// eventRecord returns the values of the columns in EventColumns for event
+func eventRecord(event *chain.TransferEvent, tokenMap *tokens.TokenMap) []string {
+	decimals, scaledValue, symbol, operator := "", "", "", ""
+	tokenData, tokenMasterDataExists := tokenMap.GetTokenMasterData(event.LogEmitterAddress.Hex())
+	if tokenMasterDataExists {
+		decimals = strconv.Itoa(tokenData.Decimals)
+		scaledValue = conv.ScaleTokenValueExact(&event.LogTokenValue, tokenData.Decimals)
+		symbol = tokenData.Symbol
+	}
+	if event.TransferType == chain.ERC1155_SINGLE || event.TransferType == chain.ERC1155_BATCH {
+		operator = event.LogOperator.Hex()
+	}
+	return []string{
+		strconv.FormatUint(event.BlockNumber, 10),
+		formatEventTimestamp(event.TransactionTimestampEstimate),
+		event.TxHash.Hex(),
+		strconv.FormatUint(uint64(event.TxIndex), 10),
+		strconv.FormatUint(uint64(event.LogIndex), 10),
+		event.TransferType,
+		event.LogAddressFrom.Hex(),
+		event.LogAddressTo.Hex(),
+		event.LogTokenValue.String(),
+		scaledValue,
+		decimals,
+		event.LogNftId,
+		operator,
+		event.LogEmitterAddress.Hex(),
+		symbol,
+	}
+}
+
+// formatEventTimestamp returns the timestamp in UTC, or empty if it is not known
+func formatEventTimestamp(timestamp time.Time) string {
+	if timestamp.IsZero() {
+		return ""
+	}
+	return timestamp.UTC().Format(eventTimestampLayout)
+}
+
+// eventRow is a row of the table of events in Parquet, with the same columns as EventColumns.
+// Addresses and hashes are fixed length bytes, value is a decimal(78,0) that holds any uint256,
+// and timestampEstimate is milliseconds since the Unix epoch in UTC. Columns that are empty in
+// the CSV are null.
+type eventRow struct {
+	BlockNumber       int64   `parquet:"name=blockNumber, type=INT64, convertedtype=UINT_64"`
+	TimestampEstimate *int64  `parquet:"name=timestampEstimate, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	TxHash            string  `parquet:"name=txHash, type=FIXED_LEN_BYTE_ARRAY, length=32"`
+	TxIndex           int32   `parquet:"name=txIndex, type=INT32, convertedtype=UINT_32"`
+	LogIndex          int32   `parquet:"name=logIndex, type=INT32, convertedtype=UINT_32"`
+	TransferType      string  `parquet:"name=transferType, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	From              string  `parquet:"name=from, type=FIXED_LEN_BYTE_ARRAY, length=20"`
+	To                string  `parquet:"name=to, type=FIXED_LEN_BYTE_ARRAY, length=20"`
+	Value             string  `parquet:"name=value, type=FIXED_LEN_BYTE_ARRAY, length=33, convertedtype=DECIMAL, precision=78, scale=0"`
+	ScaledValue       *string `parquet:"name=scaledValue, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Decimals          *int32  `parquet:"name=decimals, type=INT32, repetitiontype=OPTIONAL"`
+	NftId             *string `parquet:"name=nftId, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Operator          *string `parquet:"name=operator, type=FIXED_LEN_BYTE_ARRAY, length=20, repetitiontype=OPTIONAL"`
+	Emitter           string  `parquet:"name=emitter, type=FIXED_LEN_BYTE_ARRAY, length=20"`
+	Symbol            *string `parquet:"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY, repetitiontype=OPTIONAL"`
+}
+
+// WriteEventsParquet writes the events to filename as a Parquet file with the columns of
+// EventColumns, typed as in eventRow, with the token master data in tokenMap, and with the
+// compression and row group size in options.
+func WriteEventsParquet(filename string, events []*chain.TransferEvent, tokenMap *tokens.TokenMap,
+	options parquetfile.Options) error {
+	return parquetfile.WriteStructs(filename, new(eventRow), len(events), func(i int) interface{} {
+		return newEventRow(events[i], tokenMap)
+	}, options)
+}
+
+// newEventRow returns the row of the table of events in Parquet for event
+func newEventRow(event *chain.TransferEvent, tokenMap *tokens.TokenMap) eventRow {
+	row := eventRow{
+		BlockNumber:  int64(event.BlockNumber),
+		TxHash:       parquetfile.Hash(event.TxHash),
+		TxIndex:      int32(event.TxIndex),
+		LogIndex:     int32(event.LogIndex),
+		TransferType: event.TransferType,
+		From:         parquetfile.Address(event.LogAddressFrom),
+		To:           parquetfile.Address(event.LogAddressTo),
+		Value:        parquetfile.Decimal(&event.LogTokenValue),
+		Emitter:      parquetfile.Address(event.LogEmitterAddress),
+	}
+	if !event.TransactionTimestampEstimate.IsZero() {
+		timestamp := parquetfile.TimestampMillis(event.TransactionTimestampEstimate)
+		row.TimestampEstimate = &timestamp
+	}
+	tokenData, tokenMasterDataExists := tokenMap.GetTokenMasterData(event.LogEmitterAddress.Hex())
+	if tokenMasterDataExists {
+		scaledValue := conv.ScaleTokenValueExact(&event.LogTokenValue, tokenData.Decimals)
+		decimals := int32(tokenData.Decimals)
+		symbol := tokenData.Symbol
+		row.ScaledValue, row.Decimals, row.Symbol = &scaledValue, &decimals, &symbol
+	}
+	if event.LogNftId != "" {
+		nftId := event.LogNftId
+		row.NftId = &nftId
+	}
+	if event.TransferType == chain.ERC1155_SINGLE || event.TransferType == chain.ERC1155_BATCH {
+		operator := parquetfile.Address(event.LogOperator)
+		row.Operator = &operator
+	}
+	return row
+}
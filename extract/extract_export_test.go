@@ -0,0 +1,123 @@
+package extract
+
+import (
+	"context"
+	"encoding/csv"
+	"github.com/KevinSmall/ethgraph/blocks"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/graph"
+	"github.com/KevinSmall/ethgraph/parquetfile"
+	"github.com/KevinSmall/ethgraph/store"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExportEventsOffline(t *testing.T) {
+	chdirTemp(t)
+
+	alice := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	bob := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	usdt := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	unknown := common.HexToAddress("0x472361d3cA5F49c8E633FB50385BfaD1e018b445")
+	txHash := common.HexToHash("0x244c8173556a0e15b26db7a7729a66cca0f8689a19a7b6e709ccfe47096074a0")
+	blockTime := time.Unix(1678752000, 0)
+	value, _ := new(big.Int).SetString("123456789012345678901", 10)
+	eventStore, err := store.Open("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = eventStore.SaveRange(chain.TransferFilter{}, store.BlockRange{From: 100, To: 110},
+		[]*chain.TransferEvent{
+			{BlockNumber: 101, TxHash: txHash, TxIndex: 0, LogIndex: 1, TransferType: chain.ERC20,
+				LogAddressFrom: alice, LogAddressTo: bob, LogTokenValue: *value, LogEmitterAddress: usdt},
+			{BlockNumber: 105, TxHash: txHash, TxIndex: 0, LogIndex: 2, TransferType: chain.ERC1155_SINGLE,
+				LogAddressFrom: bob, LogAddressTo: alice, LogTokenValue: *big.NewInt(3), LogNftId: "7",
+				LogOperator: bob, LogEmitterAddress: unknown},
+		},
+		blocks.BlockMap{
+			{BlockNumber: 101}: {BlockTimestamp: blockTime, TransactionCount: 1},
+			{BlockNumber: 105}: {BlockTimestamp: blockTime.Add(48 * time.Second), TransactionCount: 1},
+		})
+	eventStore.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ExportEvents(context.Background(), Options{
+		OfflineChainId:              "1",
+		BlockFrom:                   100,
+		BlockTo:                     110,
+		DoNotFetchMissingMasterData: true,
+	}, EventFormatTsv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Filename != "ethereum_events.tsv" || result.CreationResult.Events != 2 {
+		t.Errorf("expected 2 events in ethereum_events.tsv, got %v in %s", result.CreationResult.Events, result.Filename)
+	}
+
+	file, err := os.Open(result.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		EventColumns,
+		{"101", "2023-03-14T00:00:00.000Z", txHash.Hex(), "0", "1", chain.ERC20, alice.Hex(), bob.Hex(),
+			"123456789012345678901", "123456789012345.678901", "6", "", "", usdt.Hex(), "USDT"},
+		{"105", "2023-03-14T00:00:48.000Z", txHash.Hex(), "0", "2", chain.ERC1155_SINGLE, bob.Hex(), alice.Hex(),
+			"3", "", "", "7", bob.Hex(), unknown.Hex(), ""},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected records\n%v\ngot\n%v", expected, records)
+	}
+
+	// The same events as Parquet, with typed columns and nulls for the empty values
+	result, err = ExportEvents(context.Background(), Options{
+		OfflineChainId:              "1",
+		BlockFrom:                   100,
+		BlockTo:                     110,
+		DoNotFetchMissingMasterData: true,
+		WriteOptions:                graph.WriteOptions{Parquet: parquetfile.Options{Compression: parquetfile.CompressionGzip}},
+	}, EventFormatParquet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Filename != "ethereum_events.parquet" {
+		t.Errorf("expected ethereum_events.parquet, got %s", result.Filename)
+	}
+	columns, err := parquetfile.ReadColumns(result.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedColumns := []parquetfile.Column{
+		{Name: "blockNumber", Type: "INT64/UINT_64", Values: []interface{}{int64(101), int64(105)}},
+		{Name: "timestampEstimate", Type: "INT64/TIMESTAMP_MILLIS", Values: []interface{}{blockTime.UnixMilli(), blockTime.UnixMilli() + 48000}},
+		{Name: "txHash", Type: "FIXED_LEN_BYTE_ARRAY", Values: []interface{}{string(txHash.Bytes()), string(txHash.Bytes())}},
+		{Name: "txIndex", Type: "INT32/UINT_32", Values: []interface{}{int32(0), int32(0)}},
+		{Name: "logIndex", Type: "INT32/UINT_32", Values: []interface{}{int32(1), int32(2)}},
+		{Name: "transferType", Type: "BYTE_ARRAY/UTF8", Values: []interface{}{chain.ERC20, chain.ERC1155_SINGLE}},
+		{Name: "from", Type: "FIXED_LEN_BYTE_ARRAY", Values: []interface{}{string(alice.Bytes()), string(bob.Bytes())}},
+		{Name: "to", Type: "FIXED_LEN_BYTE_ARRAY", Values: []interface{}{string(bob.Bytes()), string(alice.Bytes())}},
+		{Name: "value", Type: "FIXED_LEN_BYTE_ARRAY/DECIMAL", Values: []interface{}{parquetfile.Decimal(value), parquetfile.Decimal(big.NewInt(3))}},
+		{Name: "scaledValue", Type: "BYTE_ARRAY/UTF8", Values: []interface{}{"123456789012345.678901", nil}},
+		{Name: "decimals", Type: "INT32", Values: []interface{}{int32(6), nil}},
+		{Name: "nftId", Type: "BYTE_ARRAY/UTF8", Values: []interface{}{nil, "7"}},
+		{Name: "operator", Type: "FIXED_LEN_BYTE_ARRAY", Values: []interface{}{nil, string(bob.Bytes())}},
+		{Name: "emitter", Type: "FIXED_LEN_BYTE_ARRAY", Values: []interface{}{string(usdt.Bytes()), string(unknown.Bytes())}},
+		{Name: "symbol", Type: "BYTE_ARRAY/UTF8", Values: []interface{}{"USDT", nil}},
+	}
+	if !reflect.DeepEqual(columns, expectedColumns) {
+		t.Errorf("expected columns\n%v\ngot\n%v", expectedColumns, columns)
+	}
+}
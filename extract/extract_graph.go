@@ -0,0 +1,88 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/graph"
+	"github.com/KevinSmall/ethgraph/parquetfile"
+	"github.com/yaricom/goGraphML/graphml"
+	"strings"
+)
+
+// Formats lists the formats of graph file WriteGraph writes, the first is the default: those
+// of graph.Formats, written from the graph, graph.FormatNeo4j, written from the graph and the
+// events, and graph.FormatParquet, written from the events
+var Formats = append(append([]string{}, graph.Formats...), graph.FormatNeo4j, graph.FormatParquet)
+
+// CheckFormat returns an error if format is not one of Formats, empty means the default
+func CheckFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	for _, f := range Formats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown graph format %q, use one of %s", format, strings.Join(Formats, ", "))
+}
+
+// CheckWriteOptions returns an error if the graph file cannot be written as writeOptions says,
+// so it can be checked before anything is read from chain
+func CheckWriteOptions(writeOptions graph.WriteOptions) error {
+	if err := CheckFormat(writeOptions.Format); err != nil {
+		return err
+	}
+	return parquetfile.CheckCompression(writeOptions.Parquet.Compression)
+}
+
+// BuildGraph creates the graph of the enriched events, most business logic inc master data
+// lookups is here. The Parquet format is written by WriteGraph straight from the events, so for
+// it no graph is created, only the counts of its nodes and edges, and the graph returned is nil.
+func BuildGraph(ctx context.Context, evmChain chain.EvmClient, allEvents []*chain.TransferEvent, opts Options) (
+	*graphml.GraphML, graph.CreationResult, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, graph.CreationResult{}, err
+	}
+	if opts.WriteOptions.Format == graph.FormatParquet {
+		creationResult := graph.ParquetCreationResult(allEvents)
+		creationResult.PrintSummary()
+		return nil, creationResult, nil
+	}
+	ethGraph, creationResult, err := graph.CreateGraphWithOptions(evmChain.Name, allEvents, opts.GraphOptions)
+	if err != nil {
+		return nil, graph.CreationResult{}, err
+	}
+	creationResult.PrintSummary()
+	return ethGraph, creationResult, nil
+}
+
+// WriteGraph writes the graph to the file named in opts, or named after the chain and format if
+// none is given, in the format given in opts, returning the filename. The Neo4j format is
+// written from ethGraph and allEvents, the events the graph was built from, and the Parquet
+// format from allEvents alone, ethGraph is not used.
+func WriteGraph(evmChain chain.EvmClient, ethGraph *graphml.GraphML, allEvents []*chain.TransferEvent, opts Options) (
+	filename string, err error) {
+	format := opts.WriteOptions.Format
+	if format == "" {
+		format = graph.FormatGraphML
+	}
+	filename = opts.Filename
+	if filename == "" {
+		filename = fmt.Sprintf("%s.%s", evmChain.Name, format)
+	}
+	switch format {
+	case graph.FormatNeo4j:
+		err = graph.WriteNeo4j(filename, ethGraph, allEvents)
+	case graph.FormatParquet:
+		err = graph.WriteParquet(filename, allEvents, opts.GraphOptions, opts.WriteOptions.Parquet)
+	default:
+		err = graph.WriteGraphWithOptions(filename, ethGraph, opts.WriteOptions)
+	}
+	if err != nil {
+		return "", err
+	}
+	return filename, nil
+}
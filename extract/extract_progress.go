@@ -0,0 +1,38 @@
+package extract
+
+// Steps of reading from chain that progress is reported for
+const (
+	ProgressBlocks     = "blocks"
+	ProgressBlockTimes = "block times"
+	ProgressTokens     = "tokens"
+	ProgressReceipts   = "receipts"
+)
+
+// ProgressStage is how far a step of reading from chain has got
+type ProgressStage int
+
+const (
+	// ProgressStarted is reported once when the step starts
+	ProgressStarted ProgressStage = iota
+
+	// ProgressAdvanced is reported after each call of the step, in serial execution only
+	ProgressAdvanced
+
+	// ProgressDone is reported once when the step has read everything
+	ProgressDone
+
+	// ProgressFailed is reported once when the step stops on an error
+	ProgressFailed
+)
+
+// ProgressFunc is told how each step of reading from chain goes, step is one of ProgressBlocks,
+// ProgressBlockTimes, ProgressTokens or ProgressReceipts. It is called from the goroutine
+// reading, never from two at the same time.
+type ProgressFunc func(step string, stage ProgressStage)
+
+// report calls f if it is not nil
+func (f ProgressFunc) report(step string, stage ProgressStage) {
+	if f != nil {
+		f(step, stage)
+	}
+}
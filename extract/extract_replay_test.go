@@ -0,0 +1,75 @@
+package extract
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"github.com/KevinSmall/ethgraph/chain"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden GraphML files from the test results")
+
+// TestRunReplaysCassette runs the whole pipeline with the calls to chain answered from a cassette
+// recorded with chain.DialOptions.RecordDir, and compares the graph written with the golden file. The
+// cassette has three ERC20 transfers between three wallets of two tokens unknown to the token
+// master data, in blocks 100 to 110 of chainId 1.
+func TestRunReplaysCassette(t *testing.T) {
+	cassetteDir, err := filepath.Abs("testdata/cassette_byblock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goldenFile, err := filepath.Abs("testdata/cassette_byblock.graphml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chdirTemp(t)
+	pinLocalToUtc(t)
+
+	server, err := chain.NewReplayServer(cassetteDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	result, err := Run(context.Background(), Options{
+		Urls:      []string{server.URL},
+		BlockFrom: 100,
+		BlockTo:   110,
+		Filename:  "replay.graphml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.CreationResult.Events != 3 || result.CreationResult.Nodes != 6 || result.CreationResult.Edges != 6 {
+		t.Errorf("expected 3 events, 6 nodes and 6 edges, got %+v", result.CreationResult)
+	}
+
+	written, err := os.ReadFile(result.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *updateGolden {
+		if err := os.WriteFile(goldenFile, written, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, golden) {
+		t.Errorf("graph written differs from %s, rerun with -update if the change is expected", goldenFile)
+	}
+}
+
+// pinLocalToUtc sets the local time zone to UTC for the test, as graph timestamps are written in
+// local time and the golden files are in UTC
+func pinLocalToUtc(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC
+	t.Cleanup(func() { time.Local = local })
+}
@@ -0,0 +1,162 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"github.com/KevinSmall/ethgraph/blocks"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/graph"
+	"github.com/KevinSmall/ethgraph/store"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+// chdirTemp runs the rest of the test in a temporary directory, so local store and cache files
+// are not left behind
+func chdirTemp(t *testing.T) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(workingDir) })
+}
+
+func TestRunOffline(t *testing.T) {
+	chdirTemp(t)
+
+	alice := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	bob := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	token := common.HexToAddress("0x472361d3cA5F49c8E633FB50385BfaD1e018b445")
+	blockTime := time.Unix(1678752000, 0)
+	eventStore, err := store.Open("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = eventStore.SaveRange(chain.TransferFilter{}, store.BlockRange{From: 100, To: 110},
+		[]*chain.TransferEvent{
+			{BlockNumber: 101, TxHash: common.HexToHash("0x01"), LogIndex: 1, TransferType: chain.ERC20, LogAddressFrom: alice, LogAddressTo: bob,
+				LogTokenValue: *big.NewInt(5), LogEmitterAddress: token},
+			{BlockNumber: 105, TxHash: common.HexToHash("0x05"), LogIndex: 1, TransferType: chain.ERC20, LogAddressFrom: bob, LogAddressTo: alice,
+				LogTokenValue: *big.NewInt(3), LogEmitterAddress: token},
+		},
+		blocks.BlockMap{
+			{BlockNumber: 101}: {BlockTimestamp: blockTime, TransactionCount: 1},
+			{BlockNumber: 105}: {BlockTimestamp: blockTime.Add(48 * time.Second), TransactionCount: 1},
+		})
+	eventStore.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Parquet is written straight from the events, with the same nodes and edges
+	testCases := []struct {
+		filename string
+		format   string
+	}{
+		{"offline.graphml", graph.FormatGraphML},
+		{"offline.neo4j", graph.FormatNeo4j},
+		{"offline.parquet", graph.FormatParquet},
+	}
+	for _, tc := range testCases {
+		result, err := Run(context.Background(), Options{
+			OfflineChainId: "1",
+			BlockFrom:      100,
+			BlockTo:        110,
+			Filename:       tc.filename,
+			WriteOptions:   graph.WriteOptions{Format: tc.format},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Events) != 2 || result.CreationResult.Events != 2 {
+			t.Errorf("%s: expected 2 events in the graph, got %v and %v", tc.format, len(result.Events),
+				result.CreationResult.Events)
+		}
+		if result.CreationResult.Nodes != 4 || result.CreationResult.Edges != 4 {
+			t.Errorf("%s: expected 4 nodes and 4 edges, got %+v", tc.format, result.CreationResult)
+		}
+		if !result.Events[1].TransactionTimestampEstimate.Equal(blockTime.Add(48 * time.Second)) {
+			t.Errorf("%s: expected the time of block 105 from the store, got %s", tc.format,
+				result.Events[1].TransactionTimestampEstimate)
+		}
+		if _, err = os.Stat(result.Filename); err != nil {
+			t.Errorf("%s: expected file %s written: %s", tc.format, result.Filename, err)
+		}
+	}
+}
+
+func TestEnrichOfflineFailsOnBlockMissingFromStore(t *testing.T) {
+	chdirTemp(t)
+
+	opts := Options{OfflineChainId: "1"}
+	events := []*chain.TransferEvent{{BlockNumber: 101}}
+	_, err := Enrich(context.Background(), ConnectOffline("1"), events, opts)
+	if err == nil {
+		t.Errorf("expected an error enriching an event whose block is not in the store")
+	}
+}
+
+func TestRunStopsWhenContextDone(t *testing.T) {
+	chdirTemp(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Run(ctx, Options{OfflineChainId: "1", BlockFrom: 100, BlockTo: 110})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled, got %v", err)
+	}
+}
+
+func TestRunWritesPartialGraphWhenContextDone(t *testing.T) {
+	chdirTemp(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := Run(ctx, Options{OfflineChainId: "1", BlockFrom: 100, BlockTo: 110, WritePartial: true,
+		Filename: "partial.graphml"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled, got %v", err)
+	}
+	if !result.Partial {
+		t.Errorf("expected a partial graph written")
+	}
+	if _, err = os.Stat("partial.graphml"); err != nil {
+		t.Errorf("expected file partial.graphml written: %s", err)
+	}
+}
+
+func TestEnrichWithTimeEstimatesFailsOnMissingBlock(t *testing.T) {
+	_, err := EnrichWithTimeEstimates([]*chain.TransferEvent{{BlockNumber: 101}}, blocks.BlockMap{})
+	if err == nil {
+		t.Errorf("expected an error for an event without block master data")
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	testCases := []struct {
+		format string
+		valid  bool
+	}{
+		{"", true},
+		{graph.FormatGraphML, true},
+		{graph.FormatNeo4j, true},
+		{graph.FormatParquet, true},
+		{"svg", false},
+	}
+	for _, tc := range testCases {
+		if err := CheckFormat(tc.format); (err == nil) != tc.valid {
+			t.Errorf("CheckFormat(%q): expected valid %v, got error %v", tc.format, tc.valid, err)
+		}
+	}
+	// Parquet is written from the events, so is not a format the graph alone is written in
+	if err := graph.CheckFormat(graph.FormatParquet); err == nil {
+		t.Errorf("expected graph.CheckFormat to refuse %q", graph.FormatParquet)
+	}
+}
@@ -0,0 +1,123 @@
+package extract
+
+import (
+	"context"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/work"
+)
+
+// concurrentSegments is how many segments a block range is split into for concurrent fetching,
+// each segment is fetched by one worker using adaptive log query windows
+const concurrentSegments = 20
+
+// windowFetchedFunc is called after each window of blocks has been read, it may be nil
+type windowFetchedFunc func(blockFrom uint64, blockTo uint64, events []*chain.TransferEvent)
+
+// getEventsFromBlocksSerial is the non-concurrent version. Like the concurrent version, if it
+// fails part way, for example because ctx is cancelled, the events read so far are returned
+// along with the error.
+func getEventsFromBlocksSerial(ctx context.Context, evmChain chain.EvmClient, blockFrom uint64, blockTo uint64, filter chain.TransferFilter,
+	onWindowFetched windowFetchedFunc, progress ProgressFunc) ([]*chain.TransferEvent, error) {
+	progress.report(ProgressBlocks, ProgressStarted)
+	fetcher := chain.NewRangeFetcher(evmChain.Client, filter)
+	fetcher.OnWindowFetched = func(blockFrom uint64, blockTo uint64, events []*chain.TransferEvent) {
+		if onWindowFetched != nil {
+			onWindowFetched(blockFrom, blockTo, events)
+		}
+		progress.report(ProgressBlocks, ProgressAdvanced)
+	}
+	allEvents, err := fetcher.FetchEvents(ctx, blockFrom, blockTo)
+	if err != nil {
+		progress.report(ProgressBlocks, ProgressFailed)
+		return allEvents, err
+	}
+	progress.report(ProgressBlocks, ProgressDone)
+	return allEvents, nil
+}
+
+// getBlockRangeWorker is to hold the work that needs done
+type getBlockRangeWorker struct {
+	client    chain.LogFetcher
+	blockFrom uint64
+	blockTo   uint64
+	filter    chain.TransferFilter
+	onWindow  windowFetchedFunc
+	nextBlock uint64                 // first block not read yet, a retry continues from here
+	events    []*chain.TransferEvent // events read so far
+}
+
+// Task is the work that needs done and fulfills the Pool's Worker interface. If it fails part
+// way, the events read so far are returned along with the error.
+func (w *getBlockRangeWorker) Task(ctx context.Context) ([]*chain.TransferEvent, error) {
+	fetcher := chain.NewRangeFetcher(w.client, w.filter)
+	fetcher.OnWindowFetched = func(blockFrom uint64, blockTo uint64, events []*chain.TransferEvent) {
+		w.events = append(w.events, events...)
+		w.nextBlock = blockTo + 1
+		if w.onWindow != nil {
+			w.onWindow(blockFrom, blockTo, events)
+		}
+	}
+	_, err := fetcher.FetchEvents(ctx, w.nextBlock, w.blockTo)
+	return w.events, err
+}
+
+func getEventsFromBlocksConcurrent(ctx context.Context, evmChain chain.EvmClient, blockFrom uint64, blockTo uint64, filter chain.TransferFilter,
+	onWindowFetched windowFetchedFunc, poolOpts work.Options, progress ProgressFunc) ([]*chain.TransferEvent, error) {
+
+	allEvents := make([]*chain.TransferEvent, 0)
+
+	segments := splitBlockRange(blockFrom, blockTo, concurrentSegments)
+	pool := work.New[[]*chain.TransferEvent](ctx, poolOpts)
+
+	progress.report(ProgressBlocks, ProgressStarted)
+
+	// The client is safe for concurrent use, so all workers share it
+	for _, segment := range segments {
+		worker := &getBlockRangeWorker{
+			client:    evmChain.Client,
+			blockFrom: segment[0],
+			blockTo:   segment[1],
+			filter:    filter,
+			onWindow:  onWindowFetched,
+			nextBlock: segment[0],
+		}
+		// blocks main thread if nobody able to pick up the work
+		if pool.Run(worker) != nil {
+			break
+		}
+	}
+
+	// Wait for the workers given work to finish, all of them even if one fails, keeping the
+	// events read so far
+	results, err := pool.Wait()
+	for _, result := range results {
+		allEvents = append(allEvents, result.Value...)
+	}
+	if err != nil {
+		progress.report(ProgressBlocks, ProgressFailed)
+		return allEvents, err
+	}
+	progress.report(ProgressBlocks, ProgressDone)
+	return allEvents, nil
+}
+
+// splitBlockRange splits the range [blockFrom, blockTo] into at most maxSegments contiguous
+// segments of [from, to] of roughly equal size
+func splitBlockRange(blockFrom uint64, blockTo uint64, maxSegments int) (segments [][2]uint64) {
+	blockCount := blockTo - blockFrom + 1
+	segmentSize := blockCount / uint64(maxSegments)
+	if blockCount%uint64(maxSegments) != 0 {
+		segmentSize++
+	}
+	for from := blockFrom; from <= blockTo; from += segmentSize {
+		to := blockTo
+		if blockTo-from >= segmentSize {
+			to = from + segmentSize - 1
+		}
+		segments = append(segments, [2]uint64{from, to})
+		if to == blockTo {
+			break
+		}
+	}
+	return segments
+}
@@ -0,0 +1,117 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/test/fakechain"
+	"github.com/KevinSmall/ethgraph/work"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSplitBlockRange(t *testing.T) {
+	testCases := []struct {
+		blockFrom        uint64
+		blockTo          uint64
+		maxSegments      int
+		expectedSegments int
+	}{
+		{100, 100, 20, 1},
+		{100, 109, 20, 10},
+		{100, 299, 20, 20},
+		{100, 10_099, 20, 20},
+	}
+
+	for _, tc := range testCases {
+		segments := splitBlockRange(tc.blockFrom, tc.blockTo, tc.maxSegments)
+		if len(segments) != tc.expectedSegments {
+			t.Errorf("splitBlockRange(%v, %v, %v) gave %v segments, expected %v",
+				tc.blockFrom, tc.blockTo, tc.maxSegments, len(segments), tc.expectedSegments)
+			continue
+		}
+		// Segments must be contiguous and cover the whole range
+		next := tc.blockFrom
+		for _, segment := range segments {
+			if segment[0] != next || segment[1] < segment[0] {
+				t.Errorf("splitBlockRange(%v, %v, %v) gave non-contiguous segment %v",
+					tc.blockFrom, tc.blockTo, tc.maxSegments, segment)
+			}
+			next = segment[1] + 1
+		}
+		if next != tc.blockTo+1 {
+			t.Errorf("splitBlockRange(%v, %v, %v) did not cover the whole range", tc.blockFrom, tc.blockTo, tc.maxSegments)
+		}
+	}
+}
+
+// failingLogFetcher returns no logs, failing its query number failOnQuery, and records the first
+// block of each query
+type failingLogFetcher struct {
+	failOnQuery int
+	queryFroms  []uint64
+}
+
+func (f *failingLogFetcher) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	f.queryFroms = append(f.queryFroms, q.FromBlock.Uint64())
+	if len(f.queryFroms) == f.failOnQuery {
+		return nil, errors.New("connection reset")
+	}
+	return nil, nil
+}
+
+func TestGetBlockRangeWorkerRetryContinues(t *testing.T) {
+	fake := &failingLogFetcher{failOnQuery: 2}
+	worker := &getBlockRangeWorker{client: fake, blockFrom: 100, blockTo: 10_000, nextBlock: 100}
+
+	if _, err := worker.Task(context.Background()); err == nil {
+		t.Fatal("expected the first run to fail")
+	}
+	failedFrom := fake.queryFroms[1]
+	if _, err := worker.Task(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The retry starts at the window that failed, not the start of the range
+	if retryFrom := fake.queryFroms[2]; retryFrom != failedFrom {
+		t.Errorf("expected the retry to continue from block %v, got %v", failedFrom, retryFrom)
+	}
+}
+
+// BenchmarkGetEventsFromBlocksConcurrent reads 100k and 1M transfer events over JSON-RPC from a
+// fake chain that refuses queries of more than 10,000 logs, as providers do
+func BenchmarkGetEventsFromBlocksConcurrent(b *testing.B) {
+	for _, bm := range []struct {
+		name   string
+		blocks uint64
+	}{
+		{"100k", 1_000},
+		{"1M", 10_000},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			config := fakechain.DefaultConfig()
+			config.LatestBlock = bm.blocks
+			server := httptest.NewServer(fakechain.New(config))
+			defer server.Close()
+
+			ctx := context.Background()
+			evmChain, err := chain.CreateEvmClientWithOptions(ctx, []string{server.URL}, chain.DialOptions{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer evmChain.Client.Close()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				events, err := getEventsFromBlocksConcurrent(ctx, evmChain, 1, bm.blocks, chain.TransferFilter{}, nil, work.Options{}, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if uint64(len(events)) < bm.blocks*uint64(config.TransfersPerBlock) {
+					b.Fatalf("expected at least %v events, got %v", bm.blocks*uint64(config.TransfersPerBlock), len(events))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package extract
+
+import (
+	"context"
+	"github.com/KevinSmall/ethgraph/blocks"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/work"
+	"sort"
+)
+
+// getBlockMasterDataSerial returns the block timestamps for the blocks of uniqueBlocksMap (non-concurrent version),
+// reading one batch of blocks at a time
+func getBlockMasterDataSerial(ctx context.Context, evmChain chain.EvmClient, uniqueBlocksMap blocks.BlockMap,
+	batchSize int, progress ProgressFunc) (blocks.BlockMap, error) {
+	updatedUniqueBlocksMap := make(blocks.BlockMap, len(uniqueBlocksMap))
+	progress.report(ProgressBlockTimes, ProgressStarted)
+
+	for _, batch := range splitIntoBatches(uniqueBlockKeys(uniqueBlocksMap), batchSize) {
+		if err := ctx.Err(); err != nil {
+			progress.report(ProgressBlockTimes, ProgressFailed)
+			return nil, err
+		}
+
+		blocksData, err := blocks.GetBlocksFromChain(ctx, evmChain.Client, batch, batchSize)
+		if err != nil {
+			progress.report(ProgressBlockTimes, ProgressFailed)
+			return nil, err
+		}
+		addBlocksData(updatedUniqueBlocksMap, blocksData)
+		progress.report(ProgressBlockTimes, ProgressAdvanced)
+	}
+	progress.report(ProgressBlockTimes, ProgressDone)
+	return updatedUniqueBlocksMap, nil
+}
+
+// getBlockAttrWorker is to hold the work that needs done
+type getBlockAttrWorker struct {
+	client    chain.BatchCaller
+	blockKeys []blocks.BlockKey // read in one batch request
+}
+
+// Task is the work that needs done and fulfills the Pool's Worker interface
+func (w *getBlockAttrWorker) Task(ctx context.Context) ([]blocks.BlockDataFromSource, error) {
+	return blocks.GetBlocksFromChain(ctx, w.client, w.blockKeys, len(w.blockKeys))
+}
+
+func getBlockMasterDataConcurrent(ctx context.Context, evmChain chain.EvmClient, uniqueBlocksMap blocks.BlockMap,
+	poolOpts work.Options, batchSize int, progress ProgressFunc) (blocks.BlockMap, error) {
+
+	updatedUniqueBlocksMap := make(blocks.BlockMap, 0)
+	pool := work.New[[]blocks.BlockDataFromSource](ctx, poolOpts)
+
+	progress.report(ProgressBlockTimes, ProgressStarted)
+
+	// The client is safe for concurrent use, so all workers share it
+	for _, batch := range splitIntoBatches(uniqueBlockKeys(uniqueBlocksMap), batchSize) {
+		worker := &getBlockAttrWorker{
+			client:    evmChain.Client,
+			blockKeys: batch,
+		}
+		// blocks main thread if nobody able to pick up the work
+		if pool.Run(worker) != nil {
+			break
+		}
+	}
+
+	// Wait for the workers given work to finish, all of them even if one fails
+	results, err := pool.Wait()
+	if err != nil {
+		progress.report(ProgressBlockTimes, ProgressFailed)
+		return nil, err
+	}
+	for _, result := range results {
+		addBlocksData(updatedUniqueBlocksMap, result.Value)
+	}
+	progress.report(ProgressBlockTimes, ProgressDone)
+	return updatedUniqueBlocksMap, nil
+}
+
+// uniqueBlockKeys returns the keys of uniqueBlocksMap in block order, so the same blocks are
+// always read in the same batches
+func uniqueBlockKeys(uniqueBlocksMap blocks.BlockMap) []blocks.BlockKey {
+	blockKeys := make([]blocks.BlockKey, 0, len(uniqueBlocksMap))
+	for blockKey := range uniqueBlocksMap {
+		blockKeys = append(blockKeys, blockKey)
+	}
+	sort.Slice(blockKeys, func(i, j int) bool {
+		return blockKeys[i].BlockNumber < blockKeys[j].BlockNumber
+	})
+	return blockKeys
+}
+
+// addBlocksData adds the timestamps and transaction counts of blocksData to blocksMap
+func addBlocksData(blocksMap blocks.BlockMap, blocksData []blocks.BlockDataFromSource) {
+	for _, blockData := range blocksData {
+		blocksMap[blocks.BlockKey{BlockNumber: blockData.BlockNumber}] = blocks.BlockMapValue{
+			BlockTimestamp:   blockData.BlockTimestamp,
+			TransactionCount: blockData.TransactionCount,
+		}
+	}
+}
+
+// splitIntoBatches splits items into batches of at most batchSize items, a batchSize of 0 or less
+// means chain.DefaultBatchSize
+func splitIntoBatches[T any](items []T, batchSize int) (batches [][]T) {
+	if batchSize <= 0 {
+		batchSize = chain.DefaultBatchSize
+	}
+	for from := 0; from < len(items); from += batchSize {
+		to := from + batchSize
+		if to > len(items) {
+			to = len(items)
+		}
+		batches = append(batches, items[from:to])
+	}
+	return batches
+}
@@ -0,0 +1,113 @@
+package extract
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/blocks"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/work"
+	"github.com/ethereum/go-ethereum/rpc"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeBlockClient answers batches of eth_getBlockByNumber with blocks timestamped at their number
+// of seconds, and counts the batch requests. Any other call panics, on the nil embedded Client.
+type fakeBlockClient struct {
+	chain.Client
+	requests int32
+	calls    int32
+}
+
+func (f *fakeBlockClient) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	atomic.AddInt32(&f.requests, 1)
+	for i := range b {
+		atomic.AddInt32(&f.calls, 1)
+		blockNumber, err := strconv.ParseUint(b[i].Args[0].(string)[2:], 16, 64)
+		if err != nil {
+			return err
+		}
+		header := fmt.Sprintf(`{"number":"0x%x","timestamp":"0x%x","transactions":[]}`, blockNumber, blockNumber)
+		*b[i].Result.(*json.RawMessage) = json.RawMessage(header)
+	}
+	return nil
+}
+
+func TestGetBlockMasterDataConcurrentBatchesOnSharedClient(t *testing.T) {
+	fake := &fakeBlockClient{}
+	evmChain := chain.EvmClient{ChainId: "1", Client: fake}
+	uniqueBlocksMap := make(blocks.BlockMap)
+	for blockNumber := uint64(100); blockNumber < 150; blockNumber++ {
+		uniqueBlocksMap[blocks.BlockKey{BlockNumber: blockNumber}] = blocks.BlockMapValue{}
+	}
+
+	updated, err := getBlockMasterDataConcurrent(context.Background(), evmChain, uniqueBlocksMap, work.Options{Workers: 5}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.requests != 5 || fake.calls != 50 || len(updated) != 50 {
+		t.Fatalf("expected 50 blocks read in 5 batch requests with the shared client, got %v calls in %v requests and %v blocks",
+			fake.calls, fake.requests, len(updated))
+	}
+	for blockKey, blockMapValue := range updated {
+		if expected := time.Unix(int64(blockKey.BlockNumber), 0); !blockMapValue.BlockTimestamp.Equal(expected) {
+			t.Errorf("block %v: expected timestamp %v, got %v", blockKey.BlockNumber, expected, blockMapValue.BlockTimestamp)
+		}
+	}
+}
+
+func TestSplitIntoBatches(t *testing.T) {
+	testCases := []struct {
+		items           int
+		batchSize       int
+		expectedBatches int
+	}{
+		{0, 10, 0},
+		{1, 10, 1},
+		{10, 10, 1},
+		{11, 10, 2},
+		{250, 0, 3},
+	}
+	for _, tc := range testCases {
+		items := make([]int, tc.items)
+		batches := splitIntoBatches(items, tc.batchSize)
+		if len(batches) != tc.expectedBatches {
+			t.Errorf("splitIntoBatches(%v items, %v) gave %v batches, expected %v", tc.items, tc.batchSize, len(batches), tc.expectedBatches)
+		}
+		total := 0
+		for _, batch := range batches {
+			total += len(batch)
+		}
+		if total != tc.items {
+			t.Errorf("splitIntoBatches(%v items, %v) gave %v items in all", tc.items, tc.batchSize, total)
+		}
+	}
+}
+
+func TestGetBlockMasterDataSerialReportsProgress(t *testing.T) {
+	fake := &fakeBlockClient{}
+	evmChain := chain.EvmClient{ChainId: "1", Client: fake}
+	uniqueBlocksMap := make(blocks.BlockMap)
+	for blockNumber := uint64(100); blockNumber < 125; blockNumber++ {
+		uniqueBlocksMap[blocks.BlockKey{BlockNumber: blockNumber}] = blocks.BlockMapValue{}
+	}
+
+	var stages []ProgressStage
+	progress := func(step string, stage ProgressStage) {
+		if step != ProgressBlockTimes {
+			t.Errorf("expected step %q, got %q", ProgressBlockTimes, step)
+		}
+		stages = append(stages, stage)
+	}
+	_, err := getBlockMasterDataSerial(context.Background(), evmChain, uniqueBlocksMap, 10, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ProgressStage{ProgressStarted, ProgressAdvanced, ProgressAdvanced, ProgressAdvanced, ProgressDone}
+	if fmt.Sprint(stages) != fmt.Sprint(expected) {
+		t.Errorf("expected stages %v, got %v", expected, stages)
+	}
+}
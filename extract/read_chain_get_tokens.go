@@ -0,0 +1,114 @@
+package extract
+
+import (
+	"bytes"
+	"context"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/masterdata/tokens"
+	"github.com/KevinSmall/ethgraph/work"
+	"github.com/ethereum/go-ethereum/common"
+	"sort"
+)
+
+// getTokenMasterDataForMissingTokensSerial is the non-concurrent version, reading one batch of
+// tokens at a time
+func getTokenMasterDataForMissingTokensSerial(
+	ctx context.Context,
+	evmChain chain.EvmClient,
+	resolver *tokens.TokenResolver,
+	tokensWithoutMasterData map[common.Address]*tokens.AddressMapValue,
+	batchSize int,
+	progress ProgressFunc) (
+	tokenMapToAdd map[string]tokens.TokenDataFromSource, err error) {
+
+	tokenMapToAdd = make(map[string]tokens.TokenDataFromSource, 0)
+	progress.report(ProgressTokens, ProgressStarted)
+	for _, batch := range splitIntoBatches(tokensToRead(tokensWithoutMasterData), batchSize) {
+		progress.report(ProgressTokens, ProgressAdvanced)
+		if err = ctx.Err(); err != nil {
+			progress.report(ProgressTokens, ProgressFailed)
+			return nil, err
+		}
+		tokensData, err := resolver.GetTokens(ctx, evmChain.ChainId, batch, batchSize)
+		if err != nil {
+			progress.report(ProgressTokens, ProgressFailed)
+			return nil, err
+		}
+		for _, tokenDataFromChain := range tokensData {
+			tokenMapToAdd[tokenDataFromChain.TokenAddress] = tokenDataFromChain
+		}
+	}
+	progress.report(ProgressTokens, ProgressDone)
+	return tokenMapToAdd, nil
+}
+
+// getTokenWorker is to hold the work that needs done
+type getTokenWorker struct {
+	chainId   string
+	resolver  *tokens.TokenResolver
+	batch     []tokens.TokenToRead // read in one batch request
+	batchSize int
+}
+
+// Task is the work that needs done and fulfills the Pool's Worker interface
+func (w *getTokenWorker) Task(ctx context.Context) ([]tokens.TokenDataFromSource, error) {
+	return w.resolver.GetTokens(ctx, w.chainId, w.batch, w.batchSize)
+}
+
+func getTokenMasterDataForMissingTokensConcurrent(
+	ctx context.Context,
+	evmChain chain.EvmClient,
+	resolver *tokens.TokenResolver,
+	tokensWithoutMasterData map[common.Address]*tokens.AddressMapValue,
+	poolOpts work.Options,
+	batchSize int,
+	progress ProgressFunc) (
+	tokenMapToAdd map[string]tokens.TokenDataFromSource, err error) {
+
+	tokenMapToAdd = make(map[string]tokens.TokenDataFromSource, 0)
+	pool := work.New[[]tokens.TokenDataFromSource](ctx, poolOpts)
+
+	progress.report(ProgressTokens, ProgressStarted)
+
+	// The resolver and its client are safe for concurrent use, so all workers share them
+	for _, batch := range splitIntoBatches(tokensToRead(tokensWithoutMasterData), batchSize) {
+
+		worker := &getTokenWorker{
+			chainId:   evmChain.ChainId,
+			resolver:  resolver,
+			batch:     batch,
+			batchSize: batchSize,
+		}
+		// blocks main thread if nobody able to pick up the work
+		if pool.Run(worker) != nil {
+			break
+		}
+	}
+
+	// Wait for the workers given work to finish, all of them even if one fails
+	results, err := pool.Wait()
+	if err != nil {
+		progress.report(ProgressTokens, ProgressFailed)
+		return nil, err
+	}
+	for _, result := range results {
+		for _, tokenDataFromChain := range result.Value {
+			tokenMapToAdd[tokenDataFromChain.TokenAddress] = tokenDataFromChain
+		}
+	}
+	progress.report(ProgressTokens, ProgressDone)
+	return tokenMapToAdd, nil
+}
+
+// tokensToRead returns the tokens of tokensWithoutMasterData to read from chain in address order,
+// so the same tokens are always read in the same batches
+func tokensToRead(tokensWithoutMasterData map[common.Address]*tokens.AddressMapValue) []tokens.TokenToRead {
+	toRead := make([]tokens.TokenToRead, 0, len(tokensWithoutMasterData))
+	for address, addressMapValue := range tokensWithoutMasterData {
+		toRead = append(toRead, tokens.TokenToRead{Address: address, TransferType: addressMapValue.TransferType})
+	}
+	sort.Slice(toRead, func(i, j int) bool {
+		return bytes.Compare(toRead[i].Address[:], toRead[j].Address[:]) < 0
+	})
+	return toRead
+}
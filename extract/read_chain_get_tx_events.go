@@ -0,0 +1,84 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/work"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// getEventsFromTransactionsSerial is the non-concurrent version
+func getEventsFromTransactionsSerial(ctx context.Context, evmChain chain.EvmClient, txHashes []common.Hash, filter chain.TransferFilter,
+	progress ProgressFunc) (
+	[]*chain.TransferEvent, error) {
+
+	var allEvents []*chain.TransferEvent
+	progress.report(ProgressReceipts, ProgressStarted)
+	for _, txHash := range txHashes {
+		if err := ctx.Err(); err != nil {
+			progress.report(ProgressReceipts, ProgressFailed)
+			return allEvents, err
+		}
+
+		events, err := chain.GetTransferEventsByTransaction(ctx, evmChain.Client, txHash, filter)
+		if err != nil {
+			progress.report(ProgressReceipts, ProgressFailed)
+			return allEvents, fmt.Errorf("transaction %s: %w", txHash.Hex(), err)
+		}
+		allEvents = append(allEvents, events...)
+		progress.report(ProgressReceipts, ProgressAdvanced)
+	}
+	progress.report(ProgressReceipts, ProgressDone)
+	return allEvents, nil
+}
+
+// getReceiptWorker is to hold the work that needs done
+type getReceiptWorker struct {
+	client chain.ReceiptFetcher
+	txHash common.Hash
+	filter chain.TransferFilter
+}
+
+// Task is the work that needs done and fulfills the Pool's Worker interface
+func (w *getReceiptWorker) Task(ctx context.Context) ([]*chain.TransferEvent, error) {
+	events, err := chain.GetTransferEventsByTransaction(ctx, w.client, w.txHash, w.filter)
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s: %w", w.txHash.Hex(), err)
+	}
+	return events, nil
+}
+
+func getEventsFromTransactionsConcurrent(ctx context.Context, evmChain chain.EvmClient, txHashes []common.Hash, filter chain.TransferFilter,
+	poolOpts work.Options, progress ProgressFunc) ([]*chain.TransferEvent, error) {
+
+	allEvents := make([]*chain.TransferEvent, 0)
+	pool := work.New[[]*chain.TransferEvent](ctx, poolOpts)
+
+	progress.report(ProgressReceipts, ProgressStarted)
+
+	// The client is safe for concurrent use, so all workers share it
+	for _, txHash := range txHashes {
+		worker := &getReceiptWorker{
+			client: evmChain.Client,
+			txHash: txHash,
+			filter: filter,
+		}
+		// blocks main thread if nobody able to pick up the work
+		if pool.Run(worker) != nil {
+			break
+		}
+	}
+
+	// Wait for the workers given work to finish, all of them even if one fails
+	results, err := pool.Wait()
+	for _, result := range results {
+		allEvents = append(allEvents, result.Value...)
+	}
+	if err != nil {
+		progress.report(ProgressReceipts, ProgressFailed)
+		return allEvents, err
+	}
+	progress.report(ProgressReceipts, ProgressDone)
+	return allEvents, nil
+}
@@ -0,0 +1,159 @@
+package extract
+
+import (
+	"context"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/conv"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/KevinSmall/ethgraph/store"
+	"sync"
+)
+
+// storeFinalityDepth is how many blocks behind the latest block a block must be before its
+// events are kept in the event store, blocks nearer the tip can still be reorganised
+const storeFinalityDepth = 64
+
+// getTransferEventsUsingStore reads the transfer events selected by opts, except blocks already
+// read for the filter are read from the local event store, and only the missing blocks are read
+// from chain and added to the store, along with the master data of their blocks. Blocks near the
+// tip are always read from chain, and never stored. If offline, nothing is read from chain and
+// the events are only those already in the store. Progress reading the missing blocks is
+// checkpointed, and if opts.Resume is true, an earlier run that was interrupted is continued.
+// If reading from chain fails part way, the events read so far are returned along with the error.
+func getTransferEventsUsingStore(ctx context.Context, evmChain chain.EvmClient, eventStore *store.EventStore, opts Options) (
+	[]*chain.TransferEvent, error) {
+
+	blockFrom := opts.BlockFrom
+	blockTo := opts.BlockTo
+	storedBlockTo := blockTo
+	if !opts.isOffline() {
+		finalBlock := uint64(0)
+		if evmChain.LatestBlockNumber > storeFinalityDepth {
+			finalBlock = evmChain.LatestBlockNumber - storeFinalityDepth
+		}
+		if finalBlock < storedBlockTo {
+			storedBlockTo = finalBlock
+		}
+	}
+
+	// Fill the gaps in the store
+	if blockFrom <= storedBlockTo {
+		missingRanges, err := eventStore.MissingRanges(opts.Filter, blockFrom, storedBlockTo)
+		if err != nil {
+			return nil, err
+		}
+		if opts.isOffline() {
+			for _, missingRange := range missingRanges {
+				logr.Warning.Printf("Offline, blocks %s to %s are not in the event store\n",
+					conv.PrettyBlockNumberWithUnderscores(missingRange.From), conv.PrettyBlockNumberWithUnderscores(missingRange.To))
+			}
+		} else if len(missingRanges) > 0 {
+			logr.Trace.Printf("Event store is missing %v block ranges\n", len(missingRanges))
+			checkpoint, err := store.OpenCheckpoint(evmChain.ChainId, opts.Filter, opts.BlockFrom, opts.BlockTo, opts.Resume)
+			if err != nil {
+				return nil, err
+			}
+			// Kept if reading stops part way, so the run can be resumed
+			defer checkpoint.Close()
+			for _, missingRange := range missingRanges {
+				rangeEvents, err := fetchTransferEventsResumable(ctx, evmChain, checkpoint, missingRange, opts)
+				if err != nil {
+					return eventsSoFar(eventStore, opts.Filter, blockFrom, storedBlockTo, rangeEvents, err)
+				}
+				rangeBlocksMap, err := fetchBlockMasterDataFromChain(ctx, evmChain, rangeEvents, opts)
+				if err != nil {
+					return eventsSoFar(eventStore, opts.Filter, blockFrom, storedBlockTo, rangeEvents, err)
+				}
+				err = eventStore.SaveRange(opts.Filter, missingRange, rangeEvents, rangeBlocksMap)
+				if err != nil {
+					return nil, err
+				}
+			}
+			err = checkpoint.Remove()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Everything stored is read back from the store, so the events are the same whether just
+	// read from chain or not
+	var allEvents []*chain.TransferEvent
+	if blockFrom <= storedBlockTo {
+		storedEvents, err := eventStore.GetEvents(opts.Filter, blockFrom, storedBlockTo)
+		if err != nil {
+			return nil, err
+		}
+		logr.Info.Printf("Events read from event store: %v\n", len(storedEvents))
+		allEvents = storedEvents
+	}
+
+	// Blocks near the tip
+	if storedBlockTo < blockTo {
+		tipBlockFrom := blockFrom
+		if storedBlockTo+1 > tipBlockFrom {
+			tipBlockFrom = storedBlockTo + 1
+		}
+		tipEvents, err := fetchTransferEvents(ctx, evmChain, tipBlockFrom, blockTo, opts)
+		allEvents = append(allEvents, tipEvents...)
+		if err != nil {
+			return allEvents, err
+		}
+	}
+	return allEvents, nil
+}
+
+// eventsSoFar returns the events already in the store for the block range, those of the ranges
+// read before fetchErr, plus rangeEvents, those read of the range being read when fetchErr
+// happened. fetchErr is always returned, unless reading the store fails too.
+func eventsSoFar(eventStore *store.EventStore, filter chain.TransferFilter, blockFrom uint64, blockTo uint64,
+	rangeEvents []*chain.TransferEvent, fetchErr error) ([]*chain.TransferEvent, error) {
+
+	storedEvents, err := eventStore.GetEvents(filter, blockFrom, blockTo)
+	if err != nil {
+		return nil, err
+	}
+	return append(storedEvents, rangeEvents...), fetchErr
+}
+
+// fetchTransferEventsResumable reads the transfer events in the block range from chain, except
+// for blocks the checkpoint already has events for. Each window of blocks read is recorded in
+// the checkpoint as soon as it is read. If reading fails part way, the events read so far are
+// returned along with the error.
+func fetchTransferEventsResumable(ctx context.Context, evmChain chain.EvmClient, checkpoint *store.Checkpoint, blockRange store.BlockRange,
+	opts Options) ([]*chain.TransferEvent, error) {
+
+	allEvents := checkpoint.Events(blockRange.From, blockRange.To)
+	missingRanges := store.MissingRanges(checkpoint.CompletedRanges(), blockRange)
+	if len(missingRanges) != 1 || missingRanges[0] != blockRange {
+		logr.Info.Printf("Resuming blocks %s to %s, with %v events already read\n",
+			conv.PrettyBlockNumberWithUnderscores(blockRange.From), conv.PrettyBlockNumberWithUnderscores(blockRange.To),
+			len(allEvents))
+	}
+
+	// Windows are recorded from many goroutines at once in concurrent execution, the first
+	// failure to record is kept
+	var recordLock sync.Mutex
+	var recordErr error
+	recordWindow := func(blockFrom uint64, blockTo uint64, events []*chain.TransferEvent) {
+		err := checkpoint.Record(blockFrom, blockTo, events)
+		if err != nil {
+			recordLock.Lock()
+			if recordErr == nil {
+				recordErr = err
+			}
+			recordLock.Unlock()
+		}
+	}
+	for _, missingRange := range missingRanges {
+		events, err := fetchTransferEventsReporting(ctx, evmChain, missingRange.From, missingRange.To, opts, recordWindow)
+		allEvents = append(allEvents, events...)
+		if err != nil {
+			return allEvents, err
+		}
+		if recordErr != nil {
+			return allEvents, recordErr
+		}
+	}
+	return allEvents, nil
+}
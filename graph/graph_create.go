@@ -4,7 +4,6 @@ package graph
 
 import (
 	"github.com/KevinSmall/ethgraph/chain"
-	"github.com/KevinSmall/ethgraph/logr"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/yaricom/goGraphML/graphml"
 	"sort"
@@ -22,7 +21,20 @@ const topNExistingTokens = 10
 func CreateGraph(graphTitle string,
 	events []*chain.TransferEvent) (
 	graphMlRoot *graphml.GraphML,
-	graphCreationResult CreationResult) {
+	graphCreationResult CreationResult,
+	err error) {
+
+	return CreateGraphWithOptions(graphTitle, events, Options{})
+}
+
+// CreateGraphWithOptions creates a GraphML graph from a slice of TransferEvents, like CreateGraph,
+// with additional attributes given in options
+func CreateGraphWithOptions(graphTitle string,
+	events []*chain.TransferEvent,
+	options Options) (
+	graphMlRoot *graphml.GraphML,
+	graphCreationResult CreationResult,
+	err error) {
 
 	// for preparing test data
 	//fmt.Print("var testData = []*chain.TransferEvent{")
@@ -38,19 +50,31 @@ func CreateGraph(graphTitle string,
 	graphMlRoot = graphml.NewGraphML(graphTitle)
 
 	// Graph
-	g, err := graphMlRoot.AddGraph(graphTitle, graphml.EdgeDirectionDirected, nil)
+	var graphAttributes map[string]interface{}
+	if options.Partial {
+		graphAttributes = map[string]interface{}{"partial": true}
+	}
+	g, err := graphMlRoot.AddGraph(graphTitle, graphml.EdgeDirectionDirected, graphAttributes)
 	if err != nil {
-		logr.Error.Panicln(err)
+		return nil, CreationResult{}, err
 	}
 
 	// Movement from/to addresses become Address Graph Nodes, these nodes are always required, these have nodeType 1
-	uniqueAddressesToNodeMap := addAddressNodesToGraph(events, g)
-	var uniqueMovementsToNodeMap map[mvtNodeKey]*graphml.Node
+	uniqueAddressesToNodeMap, err := addAddressNodesToGraph(events, options, g)
+	if err != nil {
+		return nil, CreationResult{}, err
+	}
 	// Movement Events == More Nodes
-	uniqueMovementsToNodeMap = addMovementNodesToGraph(events, g)
+	uniqueMovementsToNodeMap, err := addMovementNodesToGraph(events, options.Tokens, g)
+	if err != nil {
+		return nil, CreationResult{}, err
+	}
 
 	// Movement Events == Edges as well, create edges AND add them to graph at the same time
-	addEdgesToGraph(uniqueAddressesToNodeMap, uniqueMovementsToNodeMap, events, g)
+	err = addEdgesToGraph(uniqueAddressesToNodeMap, uniqueMovementsToNodeMap, events, g)
+	if err != nil {
+		return nil, CreationResult{}, err
+	}
 
 	// Build results (not part of the graphML, this is for info)
 	graphCreationResult = CreationResult{
@@ -1,8 +1,9 @@
 package graph
 
 import (
+	"errors"
+	"fmt"
 	"github.com/KevinSmall/ethgraph/chain"
-	"github.com/KevinSmall/ethgraph/logr"
 	"github.com/yaricom/goGraphML/graphml"
 )
 
@@ -10,7 +11,7 @@ func addEdgesToGraph(
 	uniqueAddressesToNodeMap map[string]*graphml.Node,
 	uniqueMovementsToNodeMap map[mvtNodeKey]*graphml.Node,
 	events []*chain.TransferEvent,
-	g *graphml.Graph) {
+	g *graphml.Graph) error {
 
 	for _, event := range events {
 
@@ -18,11 +19,11 @@ func addEdgesToGraph(
 		// the transfer event node in the middle
 		nodeFrom, exists := uniqueAddressesToNodeMap[event.LogAddressFrom.Hex()]
 		if !exists {
-			logr.Error.Panicln("NodeFrom missing in internal map")
+			return errors.New("NodeFrom missing in internal map")
 		}
 		nodeTo, exists := uniqueAddressesToNodeMap[event.LogAddressTo.Hex()]
 		if !exists {
-			logr.Error.Panicln("NodeTo missing in internal map")
+			return errors.New("NodeTo missing in internal map")
 		}
 		nodeForEventKey := mvtNodeKey{
 			edgeFrom: event.LogAddressFrom.Hex(),
@@ -33,7 +34,7 @@ func addEdgesToGraph(
 		}
 		nodeForEvent, exists := uniqueMovementsToNodeMap[nodeForEventKey]
 		if !exists {
-			logr.Error.Panicln("nodeForTransferEventMovement missing in internal map ", nodeForEventKey)
+			return fmt.Errorf("nodeForTransferEventMovement missing in internal map %v", nodeForEventKey)
 		}
 
 		// Edge creation
@@ -41,7 +42,7 @@ func addEdgesToGraph(
 		attributes["transferType"] = event.TransferType
 		nodeAttrs, err := nodeForEvent.GetAttributes()
 		if err != nil {
-			logr.Error.Panicln(err)
+			return err
 		}
 		attributes["symbol"] = nodeAttrs["symbol"]
 		attributes["timestampEstimate"] = formatTimestamp(event.TransactionTimestampEstimate)
@@ -55,7 +56,7 @@ func addEdgesToGraph(
 				// Occasional bad data in ERC1155 batches, just ignore
 				continue
 			} else {
-				logr.Error.Panicln(err)
+				return err
 			}
 		}
 		// Create edge "transfer event middle node" to "transfer log to-address"
@@ -65,8 +66,9 @@ func addEdgesToGraph(
 				// Occasional bad data in ERC1155 batches, just ignore
 				continue
 			} else {
-				logr.Error.Panicln(err)
+				return err
 			}
 		}
 	}
+	return nil
 }
@@ -12,8 +12,8 @@ import (
 	"github.com/yaricom/goGraphML/graphml"
 )
 
-func addAddressNodesToGraph(events []*chain.TransferEvent, gr *graphml.Graph) (
-	uniqueAddressesAsNodesMap map[string]*graphml.Node) {
+func addAddressNodesToGraph(events []*chain.TransferEvent, options Options, gr *graphml.Graph) (
+	uniqueAddressesAsNodesMap map[string]*graphml.Node, err error) {
 
 	// Populate map to store unique addresses == nodes
 	uniqueAddressesAsNodesMap = make(map[string]*graphml.Node)
@@ -22,7 +22,10 @@ func addAddressNodesToGraph(events []*chain.TransferEvent, gr *graphml.Graph) (
 		_, exists := uniqueAddressesAsNodesMap[event.LogAddressFrom.Hex()]
 		if !exists {
 			// we've not seen node before
-			n := createAddressNodeAndAddToGraph(true, event, gr)
+			n, err := createAddressNodeAndAddToGraph(true, event, options.AddressAttributes[event.LogAddressFrom], options.Addresses, gr)
+			if err != nil {
+				return nil, err
+			}
 			uniqueAddressesAsNodesMap[event.LogAddressFrom.Hex()] = n
 		}
 
@@ -30,26 +33,29 @@ func addAddressNodesToGraph(events []*chain.TransferEvent, gr *graphml.Graph) (
 		_, exists = uniqueAddressesAsNodesMap[event.LogAddressTo.Hex()]
 		if !exists {
 			// we've not seen node before
-			n := createAddressNodeAndAddToGraph(false, event, gr)
+			n, err := createAddressNodeAndAddToGraph(false, event, options.AddressAttributes[event.LogAddressTo], options.Addresses, gr)
+			if err != nil {
+				return nil, err
+			}
 			uniqueAddressesAsNodesMap[event.LogAddressTo.Hex()] = n
 		}
 	}
-	return uniqueAddressesAsNodesMap
+	return uniqueAddressesAsNodesMap, nil
 }
 
-func createAddressNodeAndAddToGraph(isFromAddress bool, event *chain.TransferEvent, gr *graphml.Graph) *graphml.Node {
+func createAddressNodeAndAddToGraph(isFromAddress bool, event *chain.TransferEvent,
+	extraAttributes map[string]interface{}, addressMap *addresses.AddressMap, gr *graphml.Graph) (*graphml.Node, error) {
 	attributes := make(map[string]interface{})
+	for name, value := range extraAttributes {
+		attributes[name] = value
+	}
 	address := event.LogAddressTo.Hex()
 	if isFromAddress {
 		address = event.LogAddressFrom.Hex()
 	}
 	attributes["address"] = address
-	label := conv.PrettyShortenAddress(address)
-	addressData, addressMasterDataExists := addresses.GetAddressMasterData(address)
-	if addressMasterDataExists {
-		label = addressData.Description
-	}
-	attributes["description"] = addressData.Description
+	label, description := addressLabel(address, addressMap)
+	attributes["description"] = description
 	attributes["nodeType"] = 1
 	timestamp := formatTimestamp(event.LogAddressToFirstSeen)
 	timeIndex := event.LogAddressToFirstSeenIndex
@@ -60,15 +66,11 @@ func createAddressNodeAndAddToGraph(isFromAddress bool, event *chain.TransferEve
 	attributes["timestampEstimate"] = timestamp
 	attributes["appearanceIndex"] = int(timeIndex)
 
-	n, err := gr.AddNode(attributes, label)
-	if err != nil {
-		logr.Error.Panicln(err)
-	}
-	return n
+	return gr.AddNode(attributes, label)
 }
 
-func addMovementNodesToGraph(events []*chain.TransferEvent, gr *graphml.Graph) (
-	uniqueMovementsAsNodesMap map[mvtNodeKey]*graphml.Node) {
+func addMovementNodesToGraph(events []*chain.TransferEvent, tokenMap *tokens.TokenMap, gr *graphml.Graph) (
+	uniqueMovementsAsNodesMap map[mvtNodeKey]*graphml.Node, err error) {
 
 	// Populate map to store unique movements == nodes
 	uniqueMovementsAsNodesMap = make(map[mvtNodeKey]*graphml.Node)
@@ -76,12 +78,8 @@ func addMovementNodesToGraph(events []*chain.TransferEvent, gr *graphml.Graph) (
 
 		// Create new node(s) for each transfer event
 		attributes := make(map[string]interface{})
-		tokenData, tokenMasterDataExists := tokens.GetTokenMasterData(event.LogEmitterAddress.Hex())
-		attributes["symbol"] = tokenData.Symbol
-		tokenValue := float64(0)
-		if tokenMasterDataExists {
-			tokenValue = conv.SafeScaleTokenValue(&event.LogTokenValue, tokenData.Decimals)
-		}
+		symbol, tokenValue, _ := movementValue(event, tokenMap)
+		attributes["symbol"] = symbol
 		attributes["value"] = tokenValue
 		attributes["nodeType"] = 0
 		attributes["nftId"] = event.LogNftId
@@ -92,23 +90,15 @@ func addMovementNodesToGraph(events []*chain.TransferEvent, gr *graphml.Graph) (
 		attributes["appearanceIndex"] = int(event.TransactionTimestampEstimateIndex)
 
 		// Add node to graph
-		label := ""
-		timeStamp := formatTimestampShort(event.TransactionTimestampEstimate)
-		switch event.TransferType {
-		case chain.ERC20:
-			label = fmt.Sprintf("%v %s (%s)", tokenValue, tokenData.Symbol, timeStamp)
-		case chain.ERC721:
-			label = fmt.Sprintf("NFT %s %s (%s)", event.LogNftId, tokenData.Symbol, timeStamp)
-		case chain.ERC1155_SINGLE, chain.ERC1155_BATCH:
-			label = fmt.Sprintf("%v of NFT %s %s (%s)", tokenValue, event.LogNftId, tokenData.Symbol, timeStamp)
-		default:
+		label, isKnownType := movementLabel(event, symbol, tokenValue)
+		if !isKnownType {
 			logr.Warning.Printf("Unknown transfer type %s.", event.TransferType)
 			continue
 		}
 
 		n, err := gr.AddNode(attributes, label)
 		if err != nil {
-			logr.Error.Panicln(err)
+			return nil, err
 		}
 
 		// Store graph node for later reference during edge processing
@@ -121,5 +111,40 @@ func addMovementNodesToGraph(events []*chain.TransferEvent, gr *graphml.Graph) (
 		}
 		uniqueMovementsAsNodesMap[movementNodeKey] = n
 	}
-	return uniqueMovementsAsNodesMap
+	return uniqueMovementsAsNodesMap, nil
+}
+
+// addressLabel returns the label of the node of address, and its description from the address
+// master data, the label is the description if there is one
+func addressLabel(address string, addressMap *addresses.AddressMap) (label string, description string) {
+	addressData, addressMasterDataExists := addressMap.GetAddressMasterData(address)
+	if addressMasterDataExists {
+		return addressData.Description, addressData.Description
+	}
+	return conv.PrettyShortenAddress(address), addressData.Description
+}
+
+// movementValue returns the token symbol and the value scaled by the token decimals of the
+// movement of event. If the token has no master data the value is 0 and exists is false.
+func movementValue(event *chain.TransferEvent, tokenMap *tokens.TokenMap) (symbol string, tokenValue float64, exists bool) {
+	tokenData, exists := tokenMap.GetTokenMasterData(event.LogEmitterAddress.Hex())
+	if exists {
+		tokenValue = conv.SafeScaleTokenValue(&event.LogTokenValue, tokenData.Decimals)
+	}
+	return tokenData.Symbol, tokenValue, exists
+}
+
+// movementLabel returns the label of the node of the movement of event, isKnownType is false if
+// the movement is of a transfer type there is no node for
+func movementLabel(event *chain.TransferEvent, symbol string, tokenValue float64) (label string, isKnownType bool) {
+	timeStamp := formatTimestampShort(event.TransactionTimestampEstimate)
+	switch event.TransferType {
+	case chain.ERC20:
+		return fmt.Sprintf("%v %s (%s)", tokenValue, symbol, timeStamp), true
+	case chain.ERC721:
+		return fmt.Sprintf("NFT %s %s (%s)", event.LogNftId, symbol, timeStamp), true
+	case chain.ERC1155_SINGLE, chain.ERC1155_BATCH:
+		return fmt.Sprintf("%v of NFT %s %s (%s)", tokenValue, event.LogNftId, symbol, timeStamp), true
+	}
+	return "", false
 }
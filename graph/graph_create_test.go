@@ -1,8 +1,10 @@
 package graph
 
 import (
+	"context"
 	"fmt"
 	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/test/fakechain"
 	"github.com/ethereum/go-ethereum/common"
 	"math/big"
 	"testing"
@@ -61,7 +63,10 @@ var testData = []*chain.TransferEvent{
 }
 
 func TestCreateGraph(t *testing.T) {
-	wot, creationResult := CreateGraph("HelloWorld", testData)
+	wot, creationResult, err := CreateGraph("HelloWorld", testData)
+	if err != nil {
+		t.Fatal(err)
+	}
 	fmt.Println(wot)
 	if creationResult.Nodes != 5 {
 		t.Errorf("Expected 5 nodes, got %v", creationResult.Nodes)
@@ -75,3 +80,81 @@ func TestCreateGraph(t *testing.T) {
 	t.Logf("Created %v nodes, %v edges, %v events",
 		creationResult.Nodes, creationResult.Edges, creationResult.Events)
 }
+
+func TestCreateGraphWithAddressAttributes(t *testing.T) {
+	options := Options{AddressAttributes: map[common.Address]map[string]interface{}{
+		testData[0].LogAddressFrom: {"hopDistance": 0},
+		zeroAddress:                {"hopDistance": 1},
+	}}
+	g, creationResult, err := CreateGraphWithOptions("HelloWorld", testData, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creationResult.Nodes != 5 {
+		t.Errorf("Expected 5 nodes, got %v", creationResult.Nodes)
+	}
+
+	nodesWithHopDistance := 0
+	for _, node := range g.Graphs[0].Nodes {
+		attributes, err := node.GetAttributes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, exists := attributes["hopDistance"]; exists {
+			nodesWithHopDistance++
+		}
+	}
+	if nodesWithHopDistance != 2 {
+		t.Errorf("Expected 2 nodes with hopDistance, got %v", nodesWithHopDistance)
+	}
+}
+
+func TestCreateGraphPartial(t *testing.T) {
+	testCases := []struct {
+		partial  bool
+		expected bool
+	}{
+		{false, false},
+		{true, true},
+	}
+	for _, tc := range testCases {
+		g, _, err := CreateGraphWithOptions("HelloWorld", testData, Options{Partial: tc.partial})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := g.Graphs[0].Data
+		if exists := len(data) == 1 && data[0].Value == "true"; exists != tc.expected {
+			t.Errorf("Partial %v: expected partial attribute %v, got %v", tc.partial, tc.expected, exists)
+		}
+	}
+}
+
+// BenchmarkCreateGraph builds the graphs of 100k and 1M transfer events generated by a fake chain,
+// the 1M graph needs several GB of memory
+func BenchmarkCreateGraph(b *testing.B) {
+	for _, bm := range []struct {
+		name   string
+		blocks uint64
+	}{
+		{"100k", 1_000},
+		{"1M", 10_000},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			config := fakechain.DefaultConfig()
+			config.LatestBlock = bm.blocks
+			config.MaxLogsPerQuery = 0
+			events, err := chain.GetTransferEventsByBlockRange(context.Background(), fakechain.New(config), 1, bm.blocks,
+				chain.TransferFilter{})
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := CreateGraph("benchmark", events); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
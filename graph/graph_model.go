@@ -1,10 +1,54 @@
 package graph
 
 import (
+	"fmt"
+	"github.com/KevinSmall/ethgraph/chain"
 	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/KevinSmall/ethgraph/masterdata/addresses"
+	"github.com/KevinSmall/ethgraph/masterdata/tokens"
+	"github.com/ethereum/go-ethereum/common"
 	"time"
 )
 
+// Options holds optional extras for graph creation
+type Options struct {
+	// AddressAttributes are additional attributes for address nodes, keyed on address
+	AddressAttributes map[common.Address]map[string]interface{}
+
+	// Partial if true marks the graph with the attribute partial=true, because it has only the
+	// events read before reading was stopped
+	Partial bool
+
+	// Tokens is the token master data movements are labelled and valued with, nil means none
+	Tokens *tokens.TokenMap
+
+	// Addresses is the address master data addresses are labelled with, nil means none
+	Addresses *addresses.AddressMap
+}
+
+// color is a colour for the file formats that have them
+type color struct {
+	R uint8
+	G uint8
+	B uint8
+}
+
+// hex returns the colour as #rrggbb
+func (c color) hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// transferTypeColors are the colours of movement nodes and edges by transferType
+var transferTypeColors = map[string]color{
+	chain.ERC20:          {R: 46, G: 160, B: 67},
+	chain.ERC721:         {R: 31, G: 119, B: 180},
+	chain.ERC1155_SINGLE: {R: 255, G: 127, B: 14},
+	chain.ERC1155_BATCH:  {R: 214, G: 39, B: 40},
+}
+
+// addressColor is the colour of address nodes
+var addressColor = color{R: 127, G: 127, B: 127}
+
 type CreationResult struct {
 	Nodes  int
 	Edges  int
@@ -34,8 +78,11 @@ func (mvt *mvtNodeKey) Print(title string) {
 	logr.Info.Println("---------------------------------------------------")
 }
 
+// timestampLayout is the layout of the timestampEstimate attributes
+const timestampLayout = "2006-01-02 15:04:05.999"
+
 func formatTimestamp(time time.Time) string {
-	return time.Format("2006-01-02 15:04:05.999")
+	return time.Format(timestampLayout)
 }
 
 func formatTimestampShort(time time.Time) string {
@@ -2,18 +2,104 @@ package graph
 
 import (
 	"bufio"
-	"github.com/KevinSmall/ethgraph/logr"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/parquetfile"
 	"github.com/yaricom/goGraphML/graphml"
+	"io"
 	"os"
+	"strings"
 )
 
+// Formats of graph file that can be written
+const (
+	FormatGraphML = "graphml"
+	FormatGexf    = "gexf"
+	FormatDot     = "dot"
+	FormatNeo4j   = "neo4j"
+	FormatParquet = "parquet"
+)
+
+// Formats lists the formats of graph file WriteGraphWithOptions writes from the GraphML graph,
+// the first is the default. FormatNeo4j and FormatParquet are not among them, as they are
+// written with the events, see WriteNeo4j and WriteParquet.
+var Formats = []string{FormatGraphML, FormatGexf, FormatDot}
+
+// WriteOptions says how the graph file is written
+type WriteOptions struct {
+	// Format is one of Formats, FormatNeo4j or FormatParquet, empty means GraphML
+	Format string
+
+	// ClusterByTx if true groups the movement nodes of each transaction together, in DOT only
+	ClusterByTx bool
+
+	// Parquet says how Parquet files are written, such as their compression
+	Parquet parquetfile.Options
+}
+
+// CheckFormat returns an error if format is not one of Formats, empty means the default
+func CheckFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	for _, f := range Formats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown graph format %q, use one of %s", format, strings.Join(Formats, ", "))
+}
+
 func WriteGraph(filename string, gr *graphml.GraphML) error {
+	return writeFile(filename, func(writer io.Writer) error {
+		return gr.Encode(writer, false)
+	})
+}
+
+// WriteGraphWithOptions writes the graph to filename, like WriteGraph, in the format and with
+// the extras given in options, which must be one of Formats
+func WriteGraphWithOptions(filename string, gr *graphml.GraphML, options WriteOptions) error {
+	switch options.Format {
+	case "", FormatGraphML:
+		return WriteGraph(filename, gr)
+	case FormatGexf:
+		return WriteGexf(filename, gr)
+	case FormatDot:
+		return WriteDot(filename, gr, options.ClusterByTx)
+	}
+	return CheckFormat(options.Format)
+}
+
+// isPartial returns true if the first graph in gr has the attribute partial=true
+func isPartial(gr *graphml.GraphML) bool {
+	keys := make(map[string]*graphml.Key)
+	for _, key := range gr.Keys {
+		keys[key.ID] = key
+	}
+	for _, data := range gr.Graphs[0].Data {
+		if key, exists := keys[data.Key]; exists && key.Name == "partial" && data.Value == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteEscaper escapes a string for the double quoted strings of DOT and Cypher
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeFile creates filename and writes it with encode, buffered
+func writeFile(filename string, encode func(writer io.Writer) error) error {
 	file, err := os.Create(filename)
 	if err != nil {
-		logr.Error.Panicln(err)
+		return err
 	}
-	defer file.Close()
 	writer := bufio.NewWriter(file)
-	err = gr.Encode(writer, false)
+	err = encode(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
 	return err
 }
@@ -0,0 +1,123 @@
+package graph
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/yaricom/goGraphML/graphml"
+	"io"
+)
+
+// dotShapes are the shapes of movement nodes by transferType, address nodes are ellipses
+var dotShapes = map[string]string{
+	chain.ERC20:          "box",
+	chain.ERC721:         "diamond",
+	chain.ERC1155_SINGLE: "hexagon",
+	chain.ERC1155_BATCH:  "octagon",
+}
+
+// dotNode is a node with the attributes needed to draw it
+type dotNode struct {
+	id           string
+	label        string
+	transferType string
+	txHash       string
+}
+
+// WriteDot writes the graph to filename as DOT, for rendering with Graphviz dot or sfdp. Nodes
+// have the same labels as in GraphML. Address nodes are grey ellipses, and movement nodes and
+// edges are shaped and coloured by transferType. If clusterByTx is true, the movement nodes of
+// each transaction are drawn together in a cluster labelled with the transaction hash.
+func WriteDot(filename string, gr *graphml.GraphML, clusterByTx bool) error {
+	if len(gr.Graphs) == 0 {
+		return errors.New("no graph to write")
+	}
+	return writeFile(filename, func(writer io.Writer) error {
+		w := bufio.NewWriter(writer)
+		writeDot(w, gr, clusterByTx)
+		return w.Flush()
+	})
+}
+
+// writeDot writes the first graph in gr as DOT to w, errors are returned by w.Flush
+func writeDot(w *bufio.Writer, gr *graphml.GraphML, clusterByTx bool) {
+	graph := gr.Graphs[0]
+	keys := make(map[string]*graphml.Key)
+	for _, key := range gr.Keys {
+		keys[key.ID] = key
+	}
+	title := graph.Description
+	if isPartial(gr) {
+		title += " (partial)"
+	}
+
+	fmt.Fprintf(w, "digraph %s {\n", dotQuote(graph.Description))
+	fmt.Fprintf(w, "\tgraph [label=%s, labelloc=t, fontname=Helvetica];\n", dotQuote(title))
+	fmt.Fprintf(w, "\tnode [fontname=Helvetica, fontsize=10, style=filled];\n")
+	fmt.Fprintf(w, "\tedge [fontname=Helvetica, fontsize=8];\n")
+
+	// Nodes, movements grouped by transaction in the order transactions are first seen
+	var txHashes []string
+	movementsByTx := make(map[string][]dotNode)
+	for _, node := range graph.Nodes {
+		n := dotNode{id: node.ID, label: node.Description}
+		for _, data := range node.Data {
+			if key, exists := keys[data.Key]; exists {
+				switch key.Name {
+				case "transferType":
+					n.transferType = data.Value
+				case "txHash":
+					n.txHash = data.Value
+				}
+			}
+		}
+		if n.transferType == "" || !clusterByTx {
+			writeDotNode(w, "\t", n)
+			continue
+		}
+		if _, exists := movementsByTx[n.txHash]; !exists {
+			txHashes = append(txHashes, n.txHash)
+		}
+		movementsByTx[n.txHash] = append(movementsByTx[n.txHash], n)
+	}
+	for i, txHash := range txHashes {
+		fmt.Fprintf(w, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(w, "\t\tlabel=%s;\n", dotQuote(txHash))
+		fmt.Fprintf(w, "\t\tstyle=rounded;\n")
+		for _, n := range movementsByTx[txHash] {
+			writeDotNode(w, "\t\t", n)
+		}
+		fmt.Fprintf(w, "\t}\n")
+	}
+
+	// Edges
+	for _, edge := range graph.Edges {
+		c := addressColor
+		for _, data := range edge.Data {
+			if key, exists := keys[data.Key]; exists && key.Name == "transferType" {
+				if transferTypeColor, exists := transferTypeColors[data.Value]; exists {
+					c = transferTypeColor
+				}
+			}
+		}
+		fmt.Fprintf(w, "\t%s -> %s [color=%s];\n", edge.Source, edge.Target, dotQuote(c.hex()))
+	}
+	fmt.Fprintf(w, "}\n")
+}
+
+// writeDotNode writes a node statement, shaped and coloured by transferType
+func writeDotNode(w *bufio.Writer, indent string, n dotNode) {
+	shape := "ellipse"
+	c := addressColor
+	if transferTypeShape, exists := dotShapes[n.transferType]; exists {
+		shape = transferTypeShape
+		c = transferTypeColors[n.transferType]
+	}
+	fmt.Fprintf(w, "%s%s [label=%s, shape=%s, fillcolor=%s];\n", indent, n.id, dotQuote(n.label), shape, dotQuote(c.hex()))
+}
+
+// dotQuote returns s as a DOT quoted string
+func dotQuote(s string) string {
+	return `"` + quoteEscaper.Replace(s) + `"`
+}
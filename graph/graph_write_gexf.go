@@ -0,0 +1,216 @@
+package graph
+
+import (
+	"encoding/xml"
+	"errors"
+	"github.com/yaricom/goGraphML/graphml"
+	"io"
+	"time"
+)
+
+// GEXF 1.3, see https://gexf.net/schema.html. The graph is written in dynamic mode, so Gephi's
+// timeline shows nodes and edges appear over time with no conversion in Gephi.
+const (
+	gexfNamespace    = "http://gexf.net/1.3"
+	gexfVizNamespace = "http://gexf.net/1.3/viz"
+	gexfVersion      = "1.3"
+	gexfTimeFormat   = "2006-01-02T15:04:05.999"
+)
+
+// gexfTypes are the GEXF attribute types for the GraphML key types
+var gexfTypes = map[graphml.DataType]string{
+	graphml.BooleanType: "boolean",
+	graphml.IntType:     "integer",
+	graphml.LongType:    "long",
+	graphml.FloatType:   "float",
+	graphml.DoubleType:  "double",
+	graphml.StringType:  "string",
+}
+
+const (
+	gexfAddressSize  = 10
+	gexfMovementSize = 4
+)
+
+type gexf struct {
+	XMLName  xml.Name  `xml:"gexf"`
+	XmlNS    string    `xml:"xmlns,attr"`
+	XmlnsViz string    `xml:"xmlns:viz,attr"`
+	Version  string    `xml:"version,attr"`
+	Meta     gexfMeta  `xml:"meta"`
+	Graph    gexfGraph `xml:"graph"`
+}
+
+type gexfMeta struct {
+	LastModifiedDate string `xml:"lastmodifieddate,attr"`
+	Creator          string `xml:"creator"`
+	Keywords         string `xml:"keywords,omitempty"`
+	Description      string `xml:"description,omitempty"`
+}
+
+type gexfGraph struct {
+	Mode               string           `xml:"mode,attr"`
+	DefaultEdgeType    string           `xml:"defaultedgetype,attr"`
+	TimeFormat         string           `xml:"timeformat,attr"`
+	TimeRepresentation string           `xml:"timerepresentation,attr"`
+	Attributes         []gexfAttributes `xml:"attributes"`
+	Nodes              []*gexfNode      `xml:"nodes>node"`
+	Edges              []*gexfEdge      `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	Start     string         `xml:"start,attr,omitempty"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+	Color     gexfColor      `xml:"viz:color"`
+	Size      gexfSize       `xml:"viz:size"`
+}
+
+type gexfEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Start     string         `xml:"start,attr,omitempty"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+	Color     gexfColor      `xml:"viz:color"`
+}
+
+type gexfColor struct {
+	R uint8 `xml:"r,attr"`
+	G uint8 `xml:"g,attr"`
+	B uint8 `xml:"b,attr"`
+}
+
+type gexfSize struct {
+	Value float64 `xml:"value,attr"`
+}
+
+// WriteGexf writes the graph to filename as GEXF for Gephi. Nodes and edges get a start time
+// from their timestampEstimate, when an address was first seen or a movement happened, and are
+// coloured by transferType, address nodes are grey.
+func WriteGexf(filename string, gr *graphml.GraphML) error {
+	g, err := toGexf(gr)
+	if err != nil {
+		return err
+	}
+	return writeFile(filename, func(writer io.Writer) error {
+		if _, err := io.WriteString(writer, xml.Header); err != nil {
+			return err
+		}
+		return xml.NewEncoder(writer).Encode(g)
+	})
+}
+
+// toGexf converts the first graph in gr, with its typed attributes, to GEXF
+func toGexf(gr *graphml.GraphML) (*gexf, error) {
+	if len(gr.Graphs) == 0 {
+		return nil, errors.New("no graph to write")
+	}
+	graph := gr.Graphs[0]
+	g := &gexf{
+		XmlNS:    gexfNamespace,
+		XmlnsViz: gexfVizNamespace,
+		Version:  gexfVersion,
+		Meta: gexfMeta{
+			LastModifiedDate: time.Now().Format("2006-01-02"),
+			Creator:          "ethgraph",
+			Description:      graph.Description,
+		},
+		Graph: gexfGraph{
+			Mode:               "dynamic",
+			DefaultEdgeType:    "directed",
+			TimeFormat:         "datetime",
+			TimeRepresentation: "interval",
+		},
+	}
+
+	// Attributes, the GraphML keys
+	keys := make(map[string]*graphml.Key)
+	nodeAttributes := gexfAttributes{Class: "node"}
+	edgeAttributes := gexfAttributes{Class: "edge"}
+	for _, key := range gr.Keys {
+		keys[key.ID] = key
+		attribute := gexfAttribute{ID: key.ID, Title: key.Name, Type: gexfTypes[key.KeyType]}
+		switch key.Target {
+		case graphml.KeyForNode:
+			nodeAttributes.Attributes = append(nodeAttributes.Attributes, attribute)
+		case graphml.KeyForEdge:
+			edgeAttributes.Attributes = append(edgeAttributes.Attributes, attribute)
+		}
+	}
+	g.Graph.Attributes = []gexfAttributes{nodeAttributes, edgeAttributes}
+
+	// Graph attributes have no place in GEXF, partial is kept as a keyword
+	if isPartial(gr) {
+		g.Meta.Keywords = "partial"
+	}
+
+	for _, node := range graph.Nodes {
+		attValues, start, transferType := gexfData(node.Data, keys)
+		n := &gexfNode{ID: node.ID, Label: node.Description, Start: start, AttValues: attValues,
+			Color: gexfColor(addressColor), Size: gexfSize{Value: gexfAddressSize}}
+		if c, exists := transferTypeColors[transferType]; exists {
+			n.Color = gexfColor(c)
+			n.Size.Value = gexfMovementSize
+		}
+		g.Graph.Nodes = append(g.Graph.Nodes, n)
+	}
+	for _, edge := range graph.Edges {
+		attValues, start, transferType := gexfData(edge.Data, keys)
+		e := &gexfEdge{ID: edge.ID, Source: edge.Source, Target: edge.Target, Start: start, AttValues: attValues,
+			Color: gexfColor(addressColor)}
+		if c, exists := transferTypeColors[transferType]; exists {
+			e.Color = gexfColor(c)
+		}
+		g.Graph.Edges = append(g.Graph.Edges, e)
+	}
+	return g, nil
+}
+
+// gexfData returns the attribute values of a node or edge, its start time from its
+// timestampEstimate, and its transferType if it has one
+func gexfData(data []*graphml.Data, keys map[string]*graphml.Key) (attValues []gexfAttValue, start string,
+	transferType string) {
+
+	for _, d := range data {
+		attValues = append(attValues, gexfAttValue{For: d.Key, Value: d.Value})
+		key, exists := keys[d.Key]
+		if !exists {
+			continue
+		}
+		switch key.Name {
+		case "timestampEstimate":
+			start = gexfTime(d.Value)
+		case "transferType":
+			transferType = d.Value
+		}
+	}
+	return attValues, start, transferType
+}
+
+// gexfTime converts a timestamp written by formatTimestamp to an xsd:dateTime, in the same
+// time zone as the timestamp, or returns empty if it is not known
+func gexfTime(timestamp string) string {
+	t, err := time.Parse(timestampLayout, timestamp)
+	if err != nil || t.Year() <= 1 {
+		return ""
+	}
+	return t.Format(gexfTimeFormat)
+}
@@ -0,0 +1,420 @@
+package graph
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/yaricom/goGraphML/graphml"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Neo4j labels and relationship types. Movements are (:Address)-[:SENT]->(:Movement)-[:TO]->(:Address)
+// and (:Movement)-[:OF_TOKEN]->(:Token).
+const (
+	neo4jAddress  = "Address"
+	neo4jMovement = "Movement"
+	neo4jToken    = "Token"
+	neo4jSent     = "SENT"
+	neo4jTo       = "TO"
+	neo4jOfToken  = "OF_TOKEN"
+)
+
+// neo4jCypherFile is the Cypher script written alongside the CSVs, and neo4jBatchSize is how
+// many rows each UNWIND in it has
+const (
+	neo4jCypherFile = "import.cypher"
+	neo4jBatchSize  = 1000
+)
+
+// neo4jPartialComment starts the Cypher script of a graph with the attribute partial=true
+const neo4jPartialComment = "// partial: true, only the events read before the run was stopped"
+
+// neo4jLogIndexKey and neo4jTokenAddressKey are the properties of movements taken from the
+// events, as the GraphML movement nodes do not have them
+var (
+	neo4jLogIndexKey     = &graphml.Key{ID: "logIndex", Name: "logIndex", KeyType: graphml.IntType}
+	neo4jTokenAddressKey = &graphml.Key{ID: "tokenAddress", Name: "tokenAddress", KeyType: graphml.StringType}
+)
+
+// neo4jTypes are the neo4j-admin import types for the GraphML key types, strings need no type
+var neo4jTypes = map[graphml.DataType]string{
+	graphml.BooleanType: "boolean",
+	graphml.IntType:     "int",
+	graphml.LongType:    "long",
+	graphml.FloatType:   "float",
+	graphml.DoubleType:  "double",
+}
+
+// neo4jNodes are the nodes with one label, with values for the properties in keys
+type neo4jNodes struct {
+	label      string
+	filename   string
+	idProperty string
+	keys       []*graphml.Key
+	ids        []string
+	values     []map[string]string
+}
+
+// neo4jRelationships are the relationships of one type, with values for the properties in keys
+type neo4jRelationships struct {
+	relType  string
+	filename string
+	start    *neo4jNodes
+	end      *neo4jNodes
+	keys     []*graphml.Key
+	startIds []string
+	endIds   []string
+	values   []map[string]string
+}
+
+// WriteNeo4j writes the graph to the directory dirname as CSVs for neo4j-admin import, one for
+// each label and relationship type, and as a Cypher script import.cypher that merges the same
+// nodes and relationships into a running database, for loading graphs incrementally. The graph
+// must be that of CreateGraphWithOptions for events, which give the movements their log index
+// and token address. Addresses are identified by address, tokens by token address, and
+// movements by transaction hash, log index and NFT id, so the same movement read again is
+// merged rather than duplicated. A graph with the attribute partial=true has a comment saying
+// so at the top of import.cypher. The CSVs are imported with:
+//
+//	neo4j-admin database import full --nodes=Address=addresses.csv --nodes=Movement=movements.csv \
+//	  --nodes=Token=tokens.csv --relationships=SENT=sent.csv --relationships=TO=to.csv \
+//	  --relationships=OF_TOKEN=of_token.csv
+func WriteNeo4j(dirname string, gr *graphml.GraphML, events []*chain.TransferEvent) error {
+	nodes, relationships, err := toNeo4j(gr, events)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dirname, 0755); err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if err = writeFile(filepath.Join(dirname, n.filename), n.writeCsv); err != nil {
+			return err
+		}
+	}
+	for _, r := range relationships {
+		if err = writeFile(filepath.Join(dirname, r.filename), r.writeCsv); err != nil {
+			return err
+		}
+	}
+	return writeFile(filepath.Join(dirname, neo4jCypherFile), func(writer io.Writer) error {
+		return writeCypher(writer, nodes, relationships, isPartial(gr))
+	})
+}
+
+// toNeo4j splits the first graph in gr into nodes by label and relationships by type. The k-th
+// movement node is of the k-th event of a known transfer type, as CreateGraphWithOptions adds
+// them in the order of the events, and it is an error if the events are not those of the graph.
+func toNeo4j(gr *graphml.GraphML, events []*chain.TransferEvent) ([]*neo4jNodes, []*neo4jRelationships, error) {
+	if len(gr.Graphs) == 0 {
+		return nil, nil, errors.New("no graph to write")
+	}
+	graph := gr.Graphs[0]
+	keys := make(map[string]*graphml.Key)
+	for _, key := range gr.Keys {
+		keys[key.ID] = key
+	}
+	addresses := &neo4jNodes{label: neo4jAddress, filename: "addresses.csv", idProperty: "address"}
+	movements := &neo4jNodes{label: neo4jMovement, filename: "movements.csv", idProperty: "id"}
+	tokens := &neo4jNodes{label: neo4jToken, filename: "tokens.csv", idProperty: "address"}
+	sent := &neo4jRelationships{relType: neo4jSent, filename: "sent.csv", start: addresses, end: movements}
+	to := &neo4jRelationships{relType: neo4jTo, filename: "to.csv", start: movements, end: addresses}
+	ofToken := &neo4jRelationships{relType: neo4jOfToken, filename: "of_token.csv", start: movements, end: tokens}
+
+	// Nodes, address nodes have nodeType 1, and tokens are found from the movements
+	nodeIds := make(map[string]string)
+	nodeEvents := make(map[string]*chain.TransferEvent) // the event of each movement node
+	addressKeys := make(map[string]bool)
+	movementKeys := make(map[string]bool)
+	movementIds := make(map[string]bool)
+	skipped := make(map[string]bool)
+	tokenIds := make(map[string]bool)
+	var symbolKey *graphml.Key
+	var movementEvents []*chain.TransferEvent
+	for _, event := range events {
+		if _, isKnownType := movementLabel(event, "", 0); isKnownType {
+			movementEvents = append(movementEvents, event)
+		}
+	}
+	movementCount := 0
+	for _, node := range graph.Nodes {
+		values := make(map[string]string)
+		byName := make(map[string]string)
+		for _, data := range node.Data {
+			key, exists := keys[data.Key]
+			if !exists {
+				continue
+			}
+			values[key.ID] = data.Value
+			byName[key.Name] = data.Value
+			if key.Name == "symbol" {
+				symbolKey = key
+			}
+		}
+		if byName["nodeType"] == "1" {
+			id := byName["address"]
+			for keyId := range values {
+				if keys[keyId].Name != addresses.idProperty {
+					addressKeys[keyId] = true
+				}
+			}
+			nodeIds[node.ID] = id
+			addresses.ids = append(addresses.ids, id)
+			addresses.values = append(addresses.values, values)
+			continue
+		}
+		if movementCount == len(movementEvents) {
+			return nil, nil, fmt.Errorf("graph has more than the %v movements of the events", len(movementEvents))
+		}
+		event := movementEvents[movementCount]
+		movementCount++
+		if byName["txHash"] != event.TxHash.Hex() || byName["nftId"] != event.LogNftId {
+			return nil, nil, fmt.Errorf("movement node %v is not of the event in transaction %s", node.ID, event.TxHash.Hex())
+		}
+		id := eventMovementId(event)
+		nodeIds[node.ID] = id
+		nodeEvents[node.ID] = event
+		if movementIds[id] {
+			// Occasional bad data in ERC1155 batches repeats an NFT id, the id must be unique, so
+			// the repeat and its relationships are left out
+			skipped[node.ID] = true
+			continue
+		}
+		movementIds[id] = true
+		for keyId := range values {
+			movementKeys[keyId] = true
+		}
+		tokenAddress := event.LogEmitterAddress.Hex()
+		values[neo4jLogIndexKey.ID] = strconv.Itoa(int(event.LogIndex))
+		values[neo4jTokenAddressKey.ID] = tokenAddress
+		movements.ids = append(movements.ids, id)
+		movements.values = append(movements.values, values)
+
+		ofToken.startIds = append(ofToken.startIds, id)
+		ofToken.endIds = append(ofToken.endIds, tokenAddress)
+		ofToken.values = append(ofToken.values, nil)
+		if !tokenIds[tokenAddress] {
+			tokenIds[tokenAddress] = true
+			tokens.ids = append(tokens.ids, tokenAddress)
+			values := make(map[string]string)
+			if symbolKey != nil {
+				values[symbolKey.ID] = byName["symbol"]
+			}
+			tokens.values = append(tokens.values, values)
+		}
+	}
+	if movementCount != len(movementEvents) {
+		return nil, nil, fmt.Errorf("graph has %v of the %v movements of the events", movementCount, len(movementEvents))
+	}
+	if symbolKey != nil {
+		tokens.keys = []*graphml.Key{symbolKey}
+	}
+
+	// Relationships, edges are from an address to a movement or from a movement to an address
+	edgeKeys := make(map[string]bool)
+	for _, edge := range graph.Edges {
+		startId, startExists := nodeIds[edge.Source]
+		endId, endExists := nodeIds[edge.Target]
+		if !startExists || !endExists {
+			return nil, nil, fmt.Errorf("edge %v is between nodes not in the graph", edge.ID)
+		}
+		if skipped[edge.Source] || skipped[edge.Target] {
+			continue
+		}
+		// The addresses must be those of the event of the movement, or its log index would be wrong
+		r := sent
+		event, isFromMovement := nodeEvents[edge.Source]
+		if isFromMovement {
+			r = to
+			if endId != event.LogAddressTo.Hex() {
+				return nil, nil, fmt.Errorf("edge %v is not to the address of the event of its movement", edge.ID)
+			}
+		} else if event = nodeEvents[edge.Target]; event == nil || startId != event.LogAddressFrom.Hex() {
+			return nil, nil, fmt.Errorf("edge %v is not from the address of the event of its movement", edge.ID)
+		}
+		values := make(map[string]string)
+		for _, data := range edge.Data {
+			if _, exists := keys[data.Key]; exists {
+				values[data.Key] = data.Value
+				edgeKeys[data.Key] = true
+			}
+		}
+		r.startIds = append(r.startIds, startId)
+		r.endIds = append(r.endIds, endId)
+		r.values = append(r.values, values)
+	}
+
+	// Properties in the order of the keys
+	for _, key := range gr.Keys {
+		if addressKeys[key.ID] {
+			addresses.keys = append(addresses.keys, key)
+		}
+		if movementKeys[key.ID] {
+			movements.keys = append(movements.keys, key)
+		}
+		if edgeKeys[key.ID] {
+			sent.keys = append(sent.keys, key)
+			to.keys = append(to.keys, key)
+		}
+	}
+	movements.keys = append(movements.keys, neo4jLogIndexKey, neo4jTokenAddressKey)
+	return []*neo4jNodes{addresses, movements, tokens}, []*neo4jRelationships{sent, to, ofToken}, nil
+}
+
+// movementId identifies a movement, ERC1155 batches have a movement for each NFT id in a log
+func movementId(txHash string, logIndex string, nftId string) string {
+	id := txHash + "-" + logIndex
+	if nftId != "" {
+		id += "-" + nftId
+	}
+	return id
+}
+
+// eventMovementId returns the id of the movement node of event
+func eventMovementId(event *chain.TransferEvent) string {
+	return movementId(event.TxHash.Hex(), strconv.Itoa(int(event.LogIndex)), event.LogNftId)
+}
+
+// neo4jHeader returns the CSV header of a property, with its type if it is not a string
+func neo4jHeader(key *graphml.Key) string {
+	if neo4jType, exists := neo4jTypes[key.KeyType]; exists {
+		return key.Name + ":" + neo4jType
+	}
+	return key.Name
+}
+
+func (n *neo4jNodes) writeCsv(writer io.Writer) error {
+	w := csv.NewWriter(writer)
+	header := []string{fmt.Sprintf("%s:ID(%s)", n.idProperty, n.label), ":LABEL"}
+	for _, key := range n.keys {
+		header = append(header, neo4jHeader(key))
+	}
+	w.Write(header)
+	for i, id := range n.ids {
+		record := []string{id, n.label}
+		for _, key := range n.keys {
+			record = append(record, n.values[i][key.ID])
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func (r *neo4jRelationships) writeCsv(writer io.Writer) error {
+	w := csv.NewWriter(writer)
+	header := []string{fmt.Sprintf(":START_ID(%s)", r.start.label), fmt.Sprintf(":END_ID(%s)", r.end.label), ":TYPE"}
+	for _, key := range r.keys {
+		header = append(header, neo4jHeader(key))
+	}
+	w.Write(header)
+	for i := range r.startIds {
+		record := []string{r.startIds[i], r.endIds[i], r.relType}
+		for _, key := range r.keys {
+			record = append(record, r.values[i][key.ID])
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writeCypher writes a script that merges the nodes and relationships, in batches of
+// neo4jBatchSize rows, with a uniqueness constraint on the id property of each label. If
+// partial is true the script starts with a comment saying the graph is partial.
+func writeCypher(writer io.Writer, nodes []*neo4jNodes, relationships []*neo4jRelationships, partial bool) error {
+	var err error
+	write := func(format string, a ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(writer, format, a...)
+		}
+	}
+	if partial {
+		write("%s\n", neo4jPartialComment)
+	}
+	for _, n := range nodes {
+		write("CREATE CONSTRAINT %s_%s IF NOT EXISTS FOR (n:%s) REQUIRE n.%s IS UNIQUE;\n",
+			strings.ToLower(n.label), n.idProperty, n.label, n.idProperty)
+	}
+	for _, n := range nodes {
+		for from := 0; from < len(n.ids); from += neo4jBatchSize {
+			to := from + neo4jBatchSize
+			if to > len(n.ids) {
+				to = len(n.ids)
+			}
+			write("UNWIND [")
+			for i := from; i < to; i++ {
+				if i > from {
+					write(",\n")
+				}
+				write("{%s: %s", n.idProperty, cypherQuote(n.ids[i]))
+				for _, key := range n.keys {
+					write(", %s: %s", key.Name, cypherValue(n.values[i][key.ID], key.KeyType))
+				}
+				write("}")
+			}
+			write("] AS row\nMERGE (n:%s {%s: row.%s})\nSET n += row;\n", n.label, n.idProperty, n.idProperty)
+		}
+	}
+	for _, r := range relationships {
+		for from := 0; from < len(r.startIds); from += neo4jBatchSize {
+			to := from + neo4jBatchSize
+			if to > len(r.startIds) {
+				to = len(r.startIds)
+			}
+			write("UNWIND [")
+			for i := from; i < to; i++ {
+				if i > from {
+					write(",\n")
+				}
+				write("{start: %s, end: %s, properties: {", cypherQuote(r.startIds[i]), cypherQuote(r.endIds[i]))
+				for j, key := range r.keys {
+					if j > 0 {
+						write(", ")
+					}
+					write("%s: %s", key.Name, cypherValue(r.values[i][key.ID], key.KeyType))
+				}
+				write("}}")
+			}
+			write("] AS row\nMATCH (s:%s {%s: row.start})\nMATCH (e:%s {%s: row.end})\nMERGE (s)-[r:%s]->(e)\nSET r += row.properties;\n",
+				r.start.label, r.start.idProperty, r.end.label, r.end.idProperty, r.relType)
+		}
+	}
+	return err
+}
+
+// cypherValue returns value as a Cypher literal of the GraphML key type
+func cypherValue(value string, keyType graphml.DataType) string {
+	switch keyType {
+	case graphml.StringType:
+		return cypherQuote(value)
+	case graphml.FloatType, graphml.DoubleType:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "null"
+		}
+		// Cypher has no + in exponents
+		return strings.Replace(strconv.FormatFloat(f, 'g', -1, 64), "e+", "e", 1)
+	case graphml.IntType, graphml.LongType:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "null"
+		}
+		return value
+	case graphml.BooleanType:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return "null"
+		}
+		return strings.ToLower(value)
+	}
+	return cypherQuote(value)
+}
+
+// cypherQuote returns s as a Cypher string literal
+func cypherQuote(s string) string {
+	return `"` + quoteEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,356 @@
+package graph
+
+import (
+	"fmt"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/masterdata/tokens"
+	"github.com/KevinSmall/ethgraph/parquetfile"
+	"github.com/ethereum/go-ethereum/common"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// parquetNodesFile and parquetEdgesFile are the tables written to the Parquet directory
+const (
+	parquetNodesFile = "nodes.parquet"
+	parquetEdgesFile = "edges.parquet"
+)
+
+// Parquet column types
+const (
+	parquetStringType     = "type=BYTE_ARRAY, convertedtype=UTF8"
+	parquetDictionaryType = "type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"
+	parquetBooleanType    = "type=BOOLEAN"
+	parquetInt32Type      = "type=INT32"
+	parquetInt64Type      = "type=INT64"
+	parquetDoubleType     = "type=DOUBLE"
+	parquetAddressType    = "type=FIXED_LEN_BYTE_ARRAY, length=20"
+	parquetHashType       = "type=FIXED_LEN_BYTE_ARRAY, length=32"
+	parquetTimestampType  = "type=INT64, convertedtype=TIMESTAMP_MILLIS"
+	parquetDecimalType    = "type=FIXED_LEN_BYTE_ARRAY, length=33, convertedtype=DECIMAL, precision=78, scale=0"
+)
+
+// parquetColumn is a column of a Parquet table
+type parquetColumn struct {
+	name       string
+	columnType string
+	optional   bool
+}
+
+// parquetNodeColumns are the columns of the nodes table, the address columns are null for
+// movements and the movement columns are null for addresses. A column for each additional
+// address attribute follows them.
+var parquetNodeColumns = []parquetColumn{
+	{"id", parquetStringType, false},
+	{"label", parquetStringType, false},
+	{"nodeType", parquetInt32Type, false},
+	{"timestampEstimate", parquetTimestampType, true},
+	{"appearanceIndex", parquetInt32Type, false},
+	{"address", parquetAddressType, true},
+	{"description", parquetStringType, true},
+	{"transferType", parquetDictionaryType, true},
+	{"symbol", parquetDictionaryType, true},
+	{"value", parquetDoubleType, true},
+	{"rawValue", parquetDecimalType, true},
+	{"nftId", parquetStringType, true},
+	{"tokenAddress", parquetAddressType, true},
+	{"txHash", parquetHashType, true},
+	{"txIndex", parquetInt32Type, true},
+	{"logIndex", parquetInt32Type, true},
+}
+
+// parquetEdgeColumns are the columns of the edges table
+var parquetEdgeColumns = []parquetColumn{
+	{"id", parquetStringType, false},
+	{"source", parquetStringType, false},
+	{"target", parquetStringType, false},
+	{"timestampEstimate", parquetTimestampType, true},
+	{"appearanceIndex", parquetInt32Type, false},
+	{"transferType", parquetDictionaryType, false},
+	{"symbol", parquetDictionaryType, true},
+	{"rawValue", parquetDecimalType, false},
+}
+
+// parquetAddressNode is an address node, with the event it was first seen in
+type parquetAddressNode struct {
+	address common.Address
+	event   *chain.TransferEvent
+	isFrom  bool
+}
+
+// parquetAttribute is an additional address attribute, with the column type of its values
+type parquetAttribute struct {
+	name       string
+	columnType string
+}
+
+// WriteParquet writes the graph of the events to the directory dirname as two Parquet tables,
+// nodes.parquet and edges.parquet, for DuckDB, Spark and the like. The nodes and edges are
+// those of CreateGraphWithOptions with options, but typed straight from the events: addresses
+// and transaction hashes are fixed length bytes, timestampEstimate is a timestamp in UTC, and
+// the value of a movement is both scaled by the token decimals and as logged, a decimal(78,0).
+// Address nodes are identified by their address and movement nodes by transaction hash, log
+// index and NFT id. Values a node or edge does not have are null. If options.Partial is true
+// both tables have the key/value metadata partial=true.
+func WriteParquet(dirname string, events []*chain.TransferEvent, options Options, parquetOptions parquetfile.Options) error {
+	if options.Partial {
+		metadata := map[string]string{"partial": "true"}
+		for key, value := range parquetOptions.Metadata {
+			metadata[key] = value
+		}
+		parquetOptions.Metadata = metadata
+	}
+	addressNodes, movements := parquetNodes(events)
+	attributes := parquetAttributes(options.AddressAttributes)
+
+	nodeColumns := parquetNodeColumns
+	for _, attribute := range attributes {
+		nodeColumns = append(nodeColumns, parquetColumn{attribute.name, attribute.columnType, true})
+	}
+	nodeRow := func(i int) []interface{} {
+		if i < len(addressNodes) {
+			return parquetAddressRow(addressNodes[i], attributes, options)
+		}
+		return parquetMovementRow(movements[i-len(addressNodes)], len(attributes), options.Tokens)
+	}
+	// Each movement has an edge from its from address and one to its to address
+	edgeRow := func(i int) []interface{} {
+		return parquetEdgeRow(i, movements[i/2], i%2 == 0, options.Tokens)
+	}
+
+	if err := os.MkdirAll(dirname, 0755); err != nil {
+		return err
+	}
+	err := parquetfile.WriteRecords(filepath.Join(dirname, parquetNodesFile), parquetMetadata(nodeColumns),
+		len(addressNodes)+len(movements), nodeRow, parquetOptions)
+	if err != nil {
+		return err
+	}
+	return parquetfile.WriteRecords(filepath.Join(dirname, parquetEdgesFile), parquetMetadata(parquetEdgeColumns),
+		2*len(movements), edgeRow, parquetOptions)
+}
+
+// ParquetCreationResult returns the counts of the nodes and edges WriteParquet writes for the
+// events, without creating the graph
+func ParquetCreationResult(events []*chain.TransferEvent) CreationResult {
+	addressNodes, movements := parquetNodes(events)
+	return CreationResult{
+		Nodes:  len(addressNodes) + len(movements),
+		Edges:  2 * len(movements),
+		Events: len(events),
+	}
+}
+
+// parquetNodes returns the address nodes in the order first seen, and the events of the
+// movement nodes. Movements of unknown transfer types have no node, and a movement repeated
+// by bad data in an ERC1155 batch has only one.
+func parquetNodes(events []*chain.TransferEvent) (addressNodes []parquetAddressNode, movements []*chain.TransferEvent) {
+	isAddressNode := make(map[common.Address]bool)
+	isMovementNode := make(map[string]bool)
+	for _, event := range events {
+		for _, node := range []parquetAddressNode{{event.LogAddressFrom, event, true}, {event.LogAddressTo, event, false}} {
+			if !isAddressNode[node.address] {
+				isAddressNode[node.address] = true
+				addressNodes = append(addressNodes, node)
+			}
+		}
+	}
+	for _, event := range events {
+		if _, isKnownType := movementLabel(event, "", 0); !isKnownType {
+			continue
+		}
+		id := eventMovementId(event)
+		if !isMovementNode[id] {
+			isMovementNode[id] = true
+			movements = append(movements, event)
+		}
+	}
+	return addressNodes, movements
+}
+
+// parquetAttributes returns the additional address attributes in name order, each with the
+// column type of its values, except those with the name of a column of every node
+func parquetAttributes(addressAttributes map[common.Address]map[string]interface{}) []parquetAttribute {
+	isNodeColumn := make(map[string]bool)
+	for _, column := range parquetNodeColumns {
+		isNodeColumn[column.name] = true
+	}
+	columnTypes := make(map[string]string)
+	for _, attributes := range addressAttributes {
+		for name, value := range attributes {
+			if _, exists := columnTypes[name]; !exists && !isNodeColumn[name] {
+				columnTypes[name] = parquetAttributeType(value)
+			}
+		}
+	}
+	attributes := make([]parquetAttribute, 0, len(columnTypes))
+	for name, columnType := range columnTypes {
+		attributes = append(attributes, parquetAttribute{name, columnType})
+	}
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].name < attributes[j].name
+	})
+	return attributes
+}
+
+// parquetAttributeType returns the column type of the values of an address attribute like value
+func parquetAttributeType(value interface{}) string {
+	switch value.(type) {
+	case bool:
+		return parquetBooleanType
+	case int32:
+		return parquetInt32Type
+	case int, int64:
+		return parquetInt64Type
+	case float32, float64:
+		return parquetDoubleType
+	}
+	return parquetStringType
+}
+
+// parquetAttributeValue converts value to the value of a column of type columnType
+func parquetAttributeValue(value interface{}, columnType string) interface{} {
+	switch v := value.(type) {
+	case bool:
+		if columnType == parquetBooleanType {
+			return v
+		}
+	case int32:
+		if columnType == parquetInt32Type {
+			return v
+		}
+	case int:
+		if columnType == parquetInt64Type {
+			return int64(v)
+		}
+	case int64:
+		if columnType == parquetInt64Type {
+			return v
+		}
+	case float32:
+		if columnType == parquetDoubleType {
+			return float64(v)
+		}
+	case float64:
+		if columnType == parquetDoubleType {
+			return v
+		}
+	}
+	if columnType == parquetStringType {
+		return fmt.Sprint(value)
+	}
+	// A value of another type than the other values of the attribute
+	return nil
+}
+
+// parquetAddressRow returns the row of the nodes table for an address node
+func parquetAddressRow(node parquetAddressNode, attributes []parquetAttribute, options Options) []interface{} {
+	label, description := addressLabel(node.address.Hex(), options.Addresses)
+	firstSeen := node.event.LogAddressToFirstSeen
+	firstSeenIndex := node.event.LogAddressToFirstSeenIndex
+	if node.isFrom {
+		firstSeen = node.event.LogAddressFromFirstSeen
+		firstSeenIndex = node.event.LogAddressFromFirstSeenIndex
+	}
+	row := []interface{}{
+		node.address.Hex(),
+		label,
+		int32(1),
+		parquetTimestamp(firstSeen),
+		int32(firstSeenIndex),
+		parquetfile.Address(node.address),
+		parquetOptionalString(description),
+		nil, nil, nil, nil, nil, nil, nil, nil, nil,
+	}
+	for _, attribute := range attributes {
+		value, exists := options.AddressAttributes[node.address][attribute.name]
+		if !exists {
+			row = append(row, nil)
+			continue
+		}
+		row = append(row, parquetAttributeValue(value, attribute.columnType))
+	}
+	return row
+}
+
+// parquetMovementRow returns the row of the nodes table for the movement node of event, with
+// attributeCount null additional address attributes
+func parquetMovementRow(event *chain.TransferEvent, attributeCount int, tokenMap *tokens.TokenMap) []interface{} {
+	symbol, tokenValue, exists := movementValue(event, tokenMap)
+	label, _ := movementLabel(event, symbol, tokenValue)
+	var value interface{}
+	if exists {
+		value = tokenValue
+	}
+	row := []interface{}{
+		eventMovementId(event),
+		label,
+		int32(0),
+		parquetTimestamp(event.TransactionTimestampEstimate),
+		int32(event.TransactionTimestampEstimateIndex),
+		nil,
+		nil,
+		event.TransferType,
+		parquetOptionalString(symbol),
+		value,
+		parquetfile.Decimal(&event.LogTokenValue),
+		parquetOptionalString(event.LogNftId),
+		parquetfile.Address(event.LogEmitterAddress),
+		parquetfile.Hash(event.TxHash),
+		int32(event.TxIndex),
+		int32(event.LogIndex),
+	}
+	return append(row, make([]interface{}, attributeCount)...)
+}
+
+// parquetEdgeRow returns row i of the edges table, the edge from the from address to the
+// movement of event if isFromEdge is true, else from the movement to the to address
+func parquetEdgeRow(i int, event *chain.TransferEvent, isFromEdge bool, tokenMap *tokens.TokenMap) []interface{} {
+	source, target := event.LogAddressFrom.Hex(), eventMovementId(event)
+	if !isFromEdge {
+		source, target = eventMovementId(event), event.LogAddressTo.Hex()
+	}
+	symbol, _, _ := movementValue(event, tokenMap)
+	return []interface{}{
+		"e" + strconv.Itoa(i),
+		source,
+		target,
+		parquetTimestamp(event.TransactionTimestampEstimate),
+		int32(event.TransactionTimestampEstimateIndex),
+		event.TransferType,
+		parquetOptionalString(symbol),
+		parquetfile.Decimal(&event.LogTokenValue),
+	}
+}
+
+// parquetTimestamp returns the value of a timestamp column, null if the time is not known
+func parquetTimestamp(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return parquetfile.TimestampMillis(t)
+}
+
+// parquetOptionalString returns the value of an optional string column, null if s is empty
+func parquetOptionalString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// parquetMetadata returns the metadata of the columns for parquetfile.WriteRecords
+func parquetMetadata(columns []parquetColumn) []string {
+	metadata := make([]string, 0, len(columns))
+	for _, column := range columns {
+		repetitionType := "REQUIRED"
+		if column.optional {
+			repetitionType = "OPTIONAL"
+		}
+		metadata = append(metadata, fmt.Sprintf("name=%s, %s, repetitiontype=%s", column.name, column.columnType, repetitionType))
+	}
+	return metadata
+}
@@ -0,0 +1,503 @@
+package graph
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/parquetfile"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/yaricom/goGraphML/graphml"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteGraph(t *testing.T) {
+	g, _, err := CreateGraph("HelloWorld", testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "hello.graphml")
+	if err = WriteGraph(filename, g); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() == 0 {
+		t.Errorf("Expected GraphML written to %s, file is empty", filename)
+	}
+}
+
+func TestWriteGraphReturnsError(t *testing.T) {
+	g, _, err := CreateGraph("HelloWorld", testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "missing-dir", "hello.graphml")
+	if err = WriteGraph(filename, g); err == nil {
+		t.Errorf("Expected an error writing to %s", filename)
+	}
+}
+
+func TestWriteGexf(t *testing.T) {
+	g, _, err := CreateGraphWithOptions("HelloWorld", testData, Options{Partial: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "hello.gexf")
+	if err = WriteGraphWithOptions(filename, g, WriteOptions{Format: FormatGexf}); err != nil {
+		t.Fatal(err)
+	}
+	written, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gexfRead gexf
+	if err = xml.Unmarshal(written, &gexfRead); err != nil {
+		t.Fatal(err)
+	}
+
+	graph := gexfRead.Graph
+	if graph.Mode != "dynamic" || graph.TimeFormat != "datetime" || gexfRead.Meta.Keywords != "partial" {
+		t.Errorf("expected a dynamic graph with datetimes marked partial, got %+v %+v", graph, gexfRead.Meta)
+	}
+	if len(graph.Nodes) != 5 || len(graph.Edges) != 4 {
+		t.Fatalf("expected 5 nodes and 4 edges, got %v nodes and %v edges", len(graph.Nodes), len(graph.Edges))
+	}
+	for _, node := range graph.Nodes {
+		if node.Start != "2022-09-22T00:12:43.145" {
+			t.Errorf("node %v: expected start 2022-09-22T00:12:43.145, got %q", node.ID, node.Start)
+		}
+	}
+	for _, edge := range graph.Edges {
+		if edge.Start != "2022-09-22T00:12:43.145" {
+			t.Errorf("edge %v: expected start 2022-09-22T00:12:43.145, got %q", edge.ID, edge.Start)
+		}
+	}
+
+	// Attributes keep their types
+	types := make(map[string]string)
+	for _, attributes := range graph.Attributes {
+		for _, attribute := range attributes.Attributes {
+			types[attributes.Class+"."+attribute.Title] = attribute.Type
+		}
+	}
+	expectedTypes := map[string]string{
+		"node.appearanceIndex":   "integer",
+		"node.value":             "double",
+		"node.address":           "string",
+		"edge.transferType":      "string",
+		"edge.timestampEstimate": "string",
+	}
+	for name, expected := range expectedTypes {
+		if types[name] != expected {
+			t.Errorf("attribute %v: expected type %v, got %q", name, expected, types[name])
+		}
+	}
+
+	// Address nodes are grey, ERC20 movements and their edges green
+	text := string(written)
+	if count := strings.Count(text, `<viz:color r="127" g="127" b="127"></viz:color>`); count != 3 {
+		t.Errorf("expected 3 grey address nodes, got %v", count)
+	}
+	if count := strings.Count(text, `<viz:color r="46" g="160" b="67"></viz:color>`); count != 6 {
+		t.Errorf("expected 2 green ERC20 nodes and 4 green edges, got %v", count)
+	}
+}
+
+func TestWriteGraphWithOptionsUnknownFormat(t *testing.T) {
+	g, _, err := CreateGraph("HelloWorld", testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "hello.svg")
+	if err = WriteGraphWithOptions(filename, g, WriteOptions{Format: "svg"}); err == nil {
+		t.Errorf("Expected an error writing format svg")
+	}
+	if _, err = os.Stat(filename); err == nil {
+		t.Errorf("Expected no file written for format svg")
+	}
+}
+
+func TestWriteDot(t *testing.T) {
+	g, _, err := CreateGraph("HelloWorld", testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		clusterByTx bool
+		clusters    int
+	}{
+		{false, 0},
+		{true, 1},
+	}
+	for _, tc := range testCases {
+		filename := filepath.Join(t.TempDir(), "hello.dot")
+		if err = WriteGraphWithOptions(filename, g, WriteOptions{Format: FormatDot, ClusterByTx: tc.clusterByTx}); err != nil {
+			t.Fatal(err)
+		}
+		written, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := string(written)
+		if !strings.HasPrefix(text, `digraph "HelloWorld" {`) || !strings.HasSuffix(text, "}\n") {
+			t.Errorf("cluster %v: expected a digraph, got %s", tc.clusterByTx, text)
+		}
+		counts := []struct {
+			name     string
+			fragment string
+			expected int
+		}{
+			{"address nodes", `shape=ellipse, fillcolor="#7f7f7f"`, 3},
+			{"ERC20 movement nodes", `shape=box, fillcolor="#2ea043"`, 2},
+			{"ERC20 edges", `[color="#2ea043"]`, 4},
+			{"zero address", `[label="0x0000...00"`, 1},
+			{"clusters", "subgraph cluster_", tc.clusters},
+			{"transaction labels", `label="0x244c8173556a0e15b26db7a7729a66cca0f8689a19a7b6e709ccfe47096074a0"`, tc.clusters},
+		}
+		for _, count := range counts {
+			if actual := strings.Count(text, count.fragment); actual != count.expected {
+				t.Errorf("cluster %v: expected %v %s, got %v", tc.clusterByTx, count.expected, count.name, actual)
+			}
+		}
+	}
+}
+
+func TestDotQuote(t *testing.T) {
+	testCases := []struct {
+		s        string
+		expected string
+	}{
+		{"USDT", `"USDT"`},
+		{`Say "hi"`, `"Say \"hi\""`},
+		{`a\b`, `"a\\b"`},
+		{"two\nlines", `"two\nlines"`},
+	}
+	for _, tc := range testCases {
+		if actual := dotQuote(tc.s); actual != tc.expected {
+			t.Errorf("dotQuote(%q): expected %s, got %s", tc.s, tc.expected, actual)
+		}
+	}
+}
+
+func TestWriteNeo4j(t *testing.T) {
+	g, _, err := CreateGraph("HelloWorld", testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirname := filepath.Join(t.TempDir(), "hello.neo4j")
+	if err = WriteNeo4j(dirname, g, testData); err != nil {
+		t.Fatal(err)
+	}
+	readCsv := func(filename string) [][]string {
+		file, err := os.Open(filepath.Join(dirname, filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		records, err := csv.NewReader(file).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return records
+	}
+
+	txHash := "0x244c8173556a0e15b26db7a7729a66cca0f8689a19a7b6e709ccfe47096074a0"
+	testCases := []struct {
+		filename    string
+		header      string
+		rows        int
+		firstRecord string
+	}{
+		{"addresses.csv", "address:ID(Address),:LABEL,appearanceIndex:int,description,nodeType:int,timestampEstimate", 3,
+			"0x08f47FFbB40aAE4662eB5f4F284f2d056Deb0dc2,Address,0,,1,2022-09-22 00:12:43.145"},
+		{"movements.csv", "id:ID(Movement),:LABEL,appearanceIndex:int,nodeType:int,timestampEstimate,nftId,symbol,transferType,txHash,txIndex:int,value:double,logIndex:int,tokenAddress", 2,
+			txHash + "-8,Movement,0,0,2022-09-22 00:12:43.145,,UNKNOWN,ERC20," + txHash + ",2,0,8,0x472361d3cA5F49c8E633FB50385BfaD1e018b445"},
+		{"tokens.csv", "address:ID(Token),:LABEL,symbol", 2, "0x472361d3cA5F49c8E633FB50385BfaD1e018b445,Token,UNKNOWN"},
+		{"sent.csv", ":START_ID(Address),:END_ID(Movement),:TYPE,appearanceIndex:int,symbol,timestampEstimate,transferType", 2,
+			"0x08f47FFbB40aAE4662eB5f4F284f2d056Deb0dc2," + txHash + "-8,SENT,0,UNKNOWN,2022-09-22 00:12:43.145,ERC20"},
+		{"to.csv", ":START_ID(Movement),:END_ID(Address),:TYPE,appearanceIndex:int,symbol,timestampEstimate,transferType", 2,
+			txHash + "-8,0x0000000000000000000000000000000000000000,TO,0,UNKNOWN,2022-09-22 00:12:43.145,ERC20"},
+		{"of_token.csv", ":START_ID(Movement),:END_ID(Token),:TYPE", 2,
+			txHash + "-8,0x472361d3cA5F49c8E633FB50385BfaD1e018b445,OF_TOKEN"},
+	}
+	for _, tc := range testCases {
+		records := readCsv(tc.filename)
+		if len(records) != tc.rows+1 {
+			t.Errorf("%s: expected %v rows, got %v", tc.filename, tc.rows, len(records)-1)
+			continue
+		}
+		if header := strings.Join(records[0], ","); header != tc.header {
+			t.Errorf("%s: expected header %s, got %s", tc.filename, tc.header, header)
+		}
+		if record := strings.Join(records[1], ","); record != tc.firstRecord {
+			t.Errorf("%s: expected first record %s, got %s", tc.filename, tc.firstRecord, record)
+		}
+	}
+
+	cypher, err := os.ReadFile(filepath.Join(dirname, "import.cypher"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragments := []string{
+		"CREATE CONSTRAINT address_address IF NOT EXISTS FOR (n:Address) REQUIRE n.address IS UNIQUE;",
+		`UNWIND [{address: "0x08f47FFbB40aAE4662eB5f4F284f2d056Deb0dc2", appearanceIndex: 0, description: "", nodeType: 1, timestampEstimate: "2022-09-22 00:12:43.145"},`,
+		"MERGE (n:Movement {id: row.id})",
+		"MATCH (s:Movement {id: row.start})\nMATCH (e:Token {address: row.end})\nMERGE (s)-[r:OF_TOKEN]->(e)",
+	}
+	for _, fragment := range fragments {
+		if !strings.Contains(string(cypher), fragment) {
+			t.Errorf("expected import.cypher to contain %s", fragment)
+		}
+	}
+}
+
+func TestWriteNeo4jPartial(t *testing.T) {
+	testCases := []struct {
+		partial  bool
+		expected bool
+	}{
+		{false, false},
+		{true, true},
+	}
+	for _, tc := range testCases {
+		g, _, err := CreateGraphWithOptions("HelloWorld", testData, Options{Partial: tc.partial})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dirname := filepath.Join(t.TempDir(), "hello.neo4j")
+		if err = WriteNeo4j(dirname, g, testData); err != nil {
+			t.Fatal(err)
+		}
+		cypher, err := os.ReadFile(filepath.Join(dirname, "import.cypher"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isMarked := strings.HasPrefix(string(cypher), neo4jPartialComment+"\n"); isMarked != tc.expected {
+			t.Errorf("Partial %v: expected import.cypher marked partial %v, got %v", tc.partial, tc.expected, isMarked)
+		}
+	}
+}
+
+func TestToNeo4jSkipsRepeatedMovement(t *testing.T) {
+	g, _, err := CreateGraph("HelloWorld", testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Repeat a movement node with the same transaction hash and log index, and its edges
+	graph := g.Graphs[0]
+	movementCount := 0
+	var repeats []*graphml.Node
+	for _, node := range graph.Nodes {
+		if isMovementNode(g, node) {
+			movementCount++
+			repeat := *node
+			repeat.ID = node.ID + "-repeat"
+			repeats = append(repeats, &repeat)
+		}
+	}
+	graph.Nodes = append(graph.Nodes, repeats...)
+	edgeCount := len(graph.Edges)
+	for _, edge := range graph.Edges[:edgeCount] {
+		repeat := *edge
+		repeat.ID = edge.ID + "-repeat"
+		for _, node := range repeats {
+			if repeat.Source+"-repeat" == node.ID {
+				repeat.Source = node.ID
+			}
+			if repeat.Target+"-repeat" == node.ID {
+				repeat.Target = node.ID
+			}
+		}
+		graph.Edges = append(graph.Edges, &repeat)
+	}
+
+	nodes, relationships, err := toNeo4j(g, append(append([]*chain.TransferEvent{}, testData...), testData...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movements := len(nodes[1].ids); movements != movementCount {
+		t.Errorf("expected %v movements, got %v", movementCount, movements)
+	}
+	if sentAndTo := len(relationships[0].startIds) + len(relationships[1].startIds); sentAndTo != edgeCount {
+		t.Errorf("expected %v SENT and TO relationships, got %v", edgeCount, sentAndTo)
+	}
+}
+
+func TestToNeo4jChecksEvents(t *testing.T) {
+	g, _, err := CreateGraph("HelloWorld", testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name   string
+		events []*chain.TransferEvent
+	}{
+		{"no events", nil},
+		{"fewer events", testData[:1]},
+		{"more events", append(append([]*chain.TransferEvent{}, testData...), testData...)},
+		{"other order", []*chain.TransferEvent{testData[1], testData[0]}},
+	}
+	for _, tc := range testCases {
+		if _, _, err := toNeo4j(g, tc.events); err == nil {
+			t.Errorf("%s: expected an error for events that are not those of the graph", tc.name)
+		}
+	}
+}
+
+// isMovementNode returns true if node is a movement rather than an address
+func isMovementNode(g *graphml.GraphML, node *graphml.Node) bool {
+	for _, data := range node.Data {
+		for _, key := range g.Keys {
+			if key.ID == data.Key && key.Name == "nodeType" {
+				return data.Value != "1"
+			}
+		}
+	}
+	return false
+}
+
+func TestCypherValue(t *testing.T) {
+	testCases := []struct {
+		value    string
+		keyType  graphml.DataType
+		expected string
+	}{
+		{"USDT", graphml.StringType, `"USDT"`},
+		{`say "hi"`, graphml.StringType, `"say \"hi\""`},
+		{"12", graphml.IntType, "12"},
+		{"", graphml.IntType, "null"},
+		{"1.5", graphml.DoubleType, "1.5"},
+		{"1e+21", graphml.DoubleType, "1e21"},
+		{"true", graphml.BooleanType, "true"},
+	}
+	for _, tc := range testCases {
+		if actual := cypherValue(tc.value, tc.keyType); actual != tc.expected {
+			t.Errorf("cypherValue(%q, %v): expected %s, got %s", tc.value, tc.keyType, tc.expected, actual)
+		}
+	}
+}
+
+func TestWriteParquet(t *testing.T) {
+	// A copy of testData with a value too large for a double to hold exactly, and the first
+	// timestamp in another zone, which must still be written as the same instant
+	value, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	events := []*chain.TransferEvent{new(chain.TransferEvent), new(chain.TransferEvent)}
+	*events[0], *events[1] = *testData[0], *testData[1]
+	events[0].LogTokenValue = *value
+	newYork := time.FixedZone("EST", -5*60*60)
+	events[0].TransactionTimestampEstimate = events[0].TransactionTimestampEstimate.In(newYork)
+	options := Options{AddressAttributes: map[common.Address]map[string]interface{}{
+		testData[0].LogAddressFrom: {"hopDistance": 0},
+	}}
+	dirname := filepath.Join(t.TempDir(), "hello.parquet")
+	if err := WriteParquet(dirname, events, options, parquetfile.Options{Compression: parquetfile.CompressionZstd}); err != nil {
+		t.Fatal(err)
+	}
+
+	timestamp := time.Date(2022, time.September, 22, 0, 12, 43, 145000000, time.UTC).UnixMilli()
+	from := common.HexToAddress("0x08f47FFbB40aAE4662eB5f4F284f2d056Deb0dc2")
+	movement := "0x244c8173556a0e15b26db7a7729a66cca0f8689a19a7b6e709ccfe47096074a0-8"
+	tokenAddress := parquetfile.Address(common.HexToAddress("0x472361d3cA5F49c8E633FB50385BfaD1e018b445"))
+	txHash := parquetfile.Hash(common.HexToHash("0x244c8173556a0e15b26db7a7729a66cca0f8689a19a7b6e709ccfe47096074a0"))
+	testCases := []struct {
+		filename string
+		columns  string
+		rows     int
+		values   map[string][]interface{}
+	}{
+		{"nodes.parquet", "id:BYTE_ARRAY/UTF8,label:BYTE_ARRAY/UTF8,nodeType:INT32,timestampEstimate:INT64/TIMESTAMP_MILLIS," +
+			"appearanceIndex:INT32,address:FIXED_LEN_BYTE_ARRAY,description:BYTE_ARRAY/UTF8,transferType:BYTE_ARRAY/UTF8," +
+			"symbol:BYTE_ARRAY/UTF8,value:DOUBLE,rawValue:FIXED_LEN_BYTE_ARRAY/DECIMAL,nftId:BYTE_ARRAY/UTF8," +
+			"tokenAddress:FIXED_LEN_BYTE_ARRAY,txHash:FIXED_LEN_BYTE_ARRAY,txIndex:INT32,logIndex:INT32,hopDistance:INT64", 5,
+			map[string][]interface{}{
+				"id":                {from.Hex(), zeroAddress.Hex(), testData[1].LogAddressFrom.Hex(), movement},
+				"nodeType":          {int32(1), int32(1), int32(1), int32(0)},
+				"timestampEstimate": {timestamp, timestamp, timestamp, timestamp},
+				"address":           {parquetfile.Address(from), parquetfile.Address(zeroAddress), parquetfile.Address(testData[1].LogAddressFrom), nil},
+				"transferType":      {nil, nil, nil, "ERC20"},
+				"value":             {nil, nil, nil, nil},
+				"rawValue":          {nil, nil, nil, parquetfile.Decimal(value)},
+				"tokenAddress":      {nil, nil, nil, tokenAddress},
+				"txHash":            {nil, nil, nil, txHash},
+				"logIndex":          {nil, nil, nil, int32(8)},
+				"hopDistance":       {int64(0), nil, nil, nil},
+			}},
+		{"edges.parquet", "id:BYTE_ARRAY/UTF8,source:BYTE_ARRAY/UTF8,target:BYTE_ARRAY/UTF8," +
+			"timestampEstimate:INT64/TIMESTAMP_MILLIS,appearanceIndex:INT32,transferType:BYTE_ARRAY/UTF8," +
+			"symbol:BYTE_ARRAY/UTF8,rawValue:FIXED_LEN_BYTE_ARRAY/DECIMAL", 4,
+			map[string][]interface{}{
+				"id":                {"e0", "e1"},
+				"source":            {from.Hex(), movement},
+				"target":            {movement, zeroAddress.Hex()},
+				"timestampEstimate": {timestamp},
+				"transferType":      {"ERC20"},
+				"rawValue":          {parquetfile.Decimal(value), parquetfile.Decimal(value)},
+			}},
+	}
+	for _, tc := range testCases {
+		columns, err := parquetfile.ReadColumns(filepath.Join(dirname, tc.filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, column := range columns {
+			names = append(names, column.Name+":"+column.Type)
+			if len(column.Values) != tc.rows {
+				t.Errorf("%s: expected %v rows in %s, got %v", tc.filename, tc.rows, column.Name, len(column.Values))
+				continue
+			}
+			for i, expected := range tc.values[column.Name] {
+				if column.Values[i] != expected {
+					t.Errorf("%s: expected %s of row %v %q, got %q", tc.filename, column.Name, i, expected, column.Values[i])
+				}
+			}
+		}
+		if actual := strings.Join(names, ","); actual != tc.columns {
+			t.Errorf("%s: expected columns %s, got %s", tc.filename, tc.columns, actual)
+		}
+	}
+}
+
+func TestWriteParquetPartial(t *testing.T) {
+	testCases := []struct {
+		partial  bool
+		expected map[string]string
+	}{
+		{false, map[string]string{}},
+		{true, map[string]string{"partial": "true"}},
+	}
+	for _, tc := range testCases {
+		dirname := filepath.Join(t.TempDir(), "hello.parquet")
+		if err := WriteParquet(dirname, testData, Options{Partial: tc.partial}, parquetfile.Options{}); err != nil {
+			t.Fatal(err)
+		}
+		for _, filename := range []string{parquetNodesFile, parquetEdgesFile} {
+			metadata, err := parquetfile.ReadMetadata(filepath.Join(dirname, filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(metadata, tc.expected) {
+				t.Errorf("Partial %v: expected %s metadata %v, got %v", tc.partial, filename, tc.expected, metadata)
+			}
+		}
+	}
+}
+
+func TestWriteGraphWithOptionsParquet(t *testing.T) {
+	g, _, err := CreateGraph("HelloWorld", testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirname := filepath.Join(t.TempDir(), "hello.parquet")
+	if err = WriteGraphWithOptions(dirname, g, WriteOptions{Format: FormatParquet}); err == nil {
+		t.Errorf("Expected an error writing a Parquet graph without its events")
+	}
+}
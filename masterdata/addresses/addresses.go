@@ -1,36 +1,53 @@
 package addresses
 
-var addressMap = make(map[string]addressPopularData)
+// AddressMap holds the address master data of one chain. It is not changed once loaded, so can
+// be shared by runs on the same chain. A nil AddressMap has no master data.
+type AddressMap struct {
+	chainId   string
+	addresses map[string]addressPopularData
+}
 
-// Init is called manually to load just the master data for the desired chainId
-// (standard init() didn't know the chainId yet)
-func Init(chainId string) {
-	if len(addressMap) == 0 {
+// Load is called to load just the master data for the desired chainId, from the embedded data
+// then the local file
+func Load(chainId string) *AddressMap {
+	m := &AddressMap{chainId: chainId, addresses: make(map[string]addressPopularData)}
 
-		// Embedded address data
-		loadAddressesEmbedded(chainId)
+	// Embedded address data
+	m.loadAddressesEmbedded()
 
-		// Local file of address data
-		loadAddressesCached(chainId)
-	}
+	// Local file of address data
+	m.loadAddressesCached()
+	return m
+}
+
+// ChainId returns the chainId the master data is for
+func (m *AddressMap) ChainId() string {
+	return m.chainId
 }
 
-func GetAddressesLoadedCount() uint {
-	return uint(len(addressMap))
+// GetAddressesLoadedCount returns how many addresses have master data
+func (m *AddressMap) GetAddressesLoadedCount() uint {
+	if m == nil {
+		return 0
+	}
+	return uint(len(m.addresses))
 }
 
 // GetAddressMasterData returns master data for address, or correct defaults if no
 // master data found.
-func GetAddressMasterData(addr string) (addressData AddressData, exists bool) {
+func (m *AddressMap) GetAddressMasterData(addr string) (addressData AddressData, exists bool) {
 
 	// Defaults
 	addressData = AddressData{
 		Description: "",
 	}
 	exists = false
+	if m == nil {
+		return
+	}
 
-	// lookup our addressMap keyed on address, to get its master data
-	addressMapEntry, mapExists := addressMap[addr]
+	// lookup our addresses keyed on address, to get its master data
+	addressMapEntry, mapExists := m.addresses[addr]
 	if mapExists {
 		addressData.Description = addressMapEntry.Description
 		exists = true
@@ -18,7 +18,8 @@ var f embed.FS
 // loadAddressesEmbedded loads embedded CSV files of addresses and master data
 // like name. It is intended for non-tokens, and the data is informational data not available
 // on chain, so exchange names and the like that can be shown for a node.
-func loadAddressesEmbedded(chainId string) {
+func (m *AddressMap) loadAddressesEmbedded() {
+	chainId := m.chainId
 
 	// Validate against embedded files
 	if chainId != "1" && chainId != "56" && chainId != "43114" {
@@ -53,14 +54,15 @@ func loadAddressesEmbedded(chainId string) {
 			}
 			// Only tokens for chosen chain, and only those with valid length for hex address
 			if addressData.ChainId == chainId && len(addressData.Address) == 42 {
-				addressMap[addressData.Address] = addressData
+				m.addresses[addressData.Address] = addressData
 			}
 		}
 	}
 }
 
 // loadAddressesCached loads local CSV file of address master data
-func loadAddressesCached(chainId string) {
+func (m *AddressMap) loadAddressesCached() {
+	chainId := m.chainId
 
 	// Read cache CSV file
 	filename := getAddressCacheFilename(chainId)
@@ -84,7 +86,8 @@ func loadAddressesCached(chainId string) {
 	// Skip first row of headers
 	_, err = reader.Read()
 	if err != nil {
-		logr.Error.Panicln("Error when processing file: ", filename, ". Try deleting it and rerun.", err)
+		logr.Warning.Println("Error when processing file: ", filename, ". Try deleting it and rerun.", err)
+		return
 	}
 
 	for {
@@ -93,7 +96,8 @@ func loadAddressesCached(chainId string) {
 			break
 		}
 		if err != nil {
-			logr.Error.Panicln("Error when processing file: ", filename, ". Try deleting it and rerun.", err)
+			logr.Warning.Println("Error when processing file: ", filename, ". Try deleting it and rerun.", err)
+			break
 		}
 		if len(record) != 3 {
 			continue
@@ -107,7 +111,7 @@ func loadAddressesCached(chainId string) {
 		}
 		// Only tokens for chosen chain, and only those with valid length for hex address
 		if addressData.ChainId == chainId && len(addressData.Address) == 42 {
-			addressMap[addressData.Address] = addressData
+			m.addresses[addressData.Address] = addressData
 		}
 	}
 }
@@ -8,15 +8,16 @@ const embeddedAddressGarbage = "0xThisIsNotAValidAddress"
 func TestLoadingEmbeddedAddresses(t *testing.T) {
 
 	// Load Eth embedded addresses
-	loadAddressesEmbedded("1")
-	if len(addressMap) > 0 {
+	addressMap := &AddressMap{chainId: "1", addresses: make(map[string]addressPopularData)}
+	addressMap.loadAddressesEmbedded()
+	if len(addressMap.addresses) > 0 {
 		t.Logf("Loaded some embedded addresses ok")
 	} else {
 		t.Errorf("Failed to load any embedded addresses")
 	}
 
 	// Inspect an actual address
-	address, exists := GetAddressMasterData(embeddedAddressPresent)
+	address, exists := addressMap.GetAddressMasterData(embeddedAddressPresent)
 	if !exists {
 		t.Errorf("Failed to read expected embedded address %s", embeddedAddressPresent)
 	} else {
@@ -28,7 +29,7 @@ func TestLoadingEmbeddedAddresses(t *testing.T) {
 	}
 
 	// Inspect a garbage address
-	address, exists = GetAddressMasterData(embeddedAddressGarbage)
+	address, exists = addressMap.GetAddressMasterData(embeddedAddressGarbage)
 	if exists {
 		t.Errorf("Should not be able to read a non-existing address %s", embeddedAddressGarbage)
 	} else {
@@ -18,9 +18,10 @@ import (
 var f embed.FS
 
 // loadTokensEmbedded loads embedded CSV files of token addresses and master data
-// like name, symbol. This function returns a map, keyed on token address ( == the address that
+// like name, symbol, into the map keyed on token address ( == the address that
 // emitted the transfer event) with a value containing a struct of token master data.
-func loadTokensEmbedded(chainId string) {
+func (m *TokenMap) loadTokensEmbedded() {
+	chainId := m.chainId
 
 	// Validate against embedded files
 	if chainId != "1" && chainId != "56" && chainId != "43114" {
@@ -36,18 +37,20 @@ func loadTokensEmbedded(chainId string) {
 		if err != nil {
 			logr.Error.Panicln("Error when opening file: ", filename, " ", err)
 		}
-		addFileContentsToGlobalTokenMap(chainId, filename, fileContents)
+		m.addFileContents(filename, fileContents)
 	}
 }
 
-func addFileContentsToGlobalTokenMap(chainId string, filename string, fileContents []byte) {
+// addFileContents adds the tokens of the chain in the CSV fileContents to the map
+func (m *TokenMap) addFileContents(filename string, fileContents []byte) {
 	// Parse CSV data
 	reader := csv.NewReader(strings.NewReader(string(fileContents)))
 
 	// Skip first row of headers
 	_, err := reader.Read()
 	if err != nil {
-		logr.Error.Panicf("Error when processing token file %s %s. Try deleting it and rerunning.", filename, err)
+		logr.Warning.Printf("Error when processing token file %s %s. Try deleting it and rerunning.", filename, err)
+		return
 	}
 
 	for {
@@ -72,16 +75,17 @@ func addFileContentsToGlobalTokenMap(chainId string, filename string, fileConten
 			TokenAddress: record[4],
 		}
 		// Only tokens for chosen chain, and only those with valid length for hex address
-		if tokenData.ChainId == chainId && len(tokenData.TokenAddress) == 42 {
-			tokenMap[tokenData.TokenAddress] = tokenData
+		if tokenData.ChainId == m.chainId && len(tokenData.TokenAddress) == 42 {
+			m.tokens[tokenData.TokenAddress] = tokenData
 		}
 	}
 }
 
 // loadTokensCached loads the cached CSV file of token addresses and master data
-// like name, symbol. This function updates the global map.
-// The data is filtered to only be for the passed chainId.
-func loadTokensCached(chainId string) {
+// like name, symbol. This function updates the map.
+// The data is filtered to only be for the chainId of the map.
+func (m *TokenMap) loadTokensCached() {
+	chainId := m.chainId
 
 	// Read cache CSV file
 	filename := getTokenCacheFilename(chainId)
@@ -98,18 +102,20 @@ func loadTokensCached(chainId string) {
 		logr.Warning.Printf("Local CSV cache not read for chainId %s. Error: %s.", chainId, err)
 		return
 	}
-	addFileContentsToGlobalTokenMap(chainId, filename, fileContents)
+	m.addFileContents(filename, fileContents)
 }
 
 func getTokenCacheFilename(chainId string) (filename string) {
 	return fmt.Sprintf(".tokens_%s_cache.csv", chainId)
 }
 
-// WriteGlobalTokenMapToCache takes the whole of the tokenMap master data and dumps it all out
-// to the local cache .csv file. If any troubles, it just does nothing.
-func WriteGlobalTokenMapToCache(chainId string) {
+// WriteToCache takes the whole of the map of master data and dumps it all out to the local
+// cache .csv file. Runs sharing the map write the file one at a time.
+func (m *TokenMap) WriteToCache() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 	var tokenInfo [][]string
-	for _, t := range tokenMap {
+	for _, t := range m.tokens {
 		tokenInfo = append(tokenInfo, []string{
 			t.ChainId,
 			t.Name,
@@ -117,8 +123,8 @@ func WriteGlobalTokenMapToCache(chainId string) {
 			strconv.Itoa(t.Decimals),
 			t.TokenAddress})
 	}
-	filename := getTokenCacheFilename(chainId)
-	WriteTokenInfoToFile(filename, tokenInfo)
+	filename := getTokenCacheFilename(m.chainId)
+	return WriteTokenInfoToFile(filename, tokenInfo)
 }
 
 func DeleteTokenCache(chainId string) {
@@ -139,29 +145,33 @@ func DeleteTokenCache(chainId string) {
 	}
 }
 
-func WriteTokenInfoToFile(filename string, tokenInfo [][]string) {
+func WriteTokenInfoToFile(filename string, tokenInfo [][]string) error {
 	// Create a new file for writing
 	file, err := os.Create(filename)
 	if err != nil {
-		logr.Error.Panicln(err)
+		return err
 	}
 	defer file.Close()
 
 	// Create a new CSV writer
 	writer := csv.NewWriter(file)
-	defer writer.Flush()
 
 	// Write the header row
 	err = writer.Write([]string{"ChainId", "Name", "Symbol", "Decimals", "TokenAddress"})
 	if err != nil {
-		logr.Error.Panicln(err)
+		return err
 	}
 
 	// Write the token information rows
 	for _, row := range tokenInfo {
 		err = writer.Write(row)
 		if err != nil {
-			logr.Error.Panicln(err)
+			return err
 		}
 	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return err
+	}
+	return file.Close()
 }
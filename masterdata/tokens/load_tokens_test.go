@@ -4,19 +4,21 @@ import "testing"
 
 const embeddedTokenPresent = "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"
 const embeddedTokenGarbage = "0xThisIsNotAValidToken"
+const embeddedTokenOnlyEth = "0x6B175474E89094C44Da98b954EedeAC495271d0F" // DAI
 
 func TestLoadingEmbeddedTokens(t *testing.T) {
 
 	// Load Eth embedded tokens
-	loadTokensEmbedded("1")
-	if len(tokenMap) > 0 {
+	tokenMap := &TokenMap{chainId: "1", tokens: make(map[string]TokenDataFromSource)}
+	tokenMap.loadTokensEmbedded()
+	if len(tokenMap.tokens) > 0 {
 		t.Logf("Loaded some embedded tokens")
 	} else {
 		t.Errorf("Failed to load any embedded tokens")
 	}
 
 	// Inspect an actual token
-	token, exists := GetTokenMasterData(embeddedTokenPresent)
+	token, exists := tokenMap.GetTokenMasterData(embeddedTokenPresent)
 	if !exists {
 		t.Errorf("Failed to read an expected embedded token %s", embeddedTokenPresent)
 	} else {
@@ -28,7 +30,7 @@ func TestLoadingEmbeddedTokens(t *testing.T) {
 	}
 
 	// Inspect a garbage token
-	token, exists = GetTokenMasterData(embeddedTokenGarbage)
+	token, exists = tokenMap.GetTokenMasterData(embeddedTokenGarbage)
 	if exists {
 		t.Errorf("Should not be able to read a non-existing token %s", embeddedTokenGarbage)
 	} else {
@@ -39,3 +41,25 @@ func TestLoadingEmbeddedTokens(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadKeepsChainsApart(t *testing.T) {
+	testCases := []struct {
+		chainId  string
+		expected bool
+	}{
+		{"1", true},
+		{"56", false},
+		{"1", true},
+	}
+	for _, tc := range testCases {
+		_, exists := Load(tc.chainId).GetTokenMasterData(embeddedTokenOnlyEth)
+		if exists != tc.expected {
+			t.Errorf("chainId %s: expected master data of %s %v, got %v", tc.chainId, embeddedTokenOnlyEth, tc.expected, exists)
+		}
+	}
+
+	var noTokens *TokenMap
+	if token, exists := noTokens.GetTokenMasterData(embeddedTokenPresent); exists || token.Symbol != "UNKNOWN" {
+		t.Errorf("expected no master data from a nil TokenMap, got %v", token)
+	}
+}
@@ -5,32 +5,50 @@ import (
 	"github.com/KevinSmall/ethgraph/logr"
 	"github.com/ethereum/go-ethereum/common"
 	"sort"
+	"sync"
 )
 
-// tokenMap is package global holding all token master data from any source, could
-// be from embedded data, or local cache or anywhere else.
-var tokenMap = make(map[string]TokenDataFromSource)
+// TokenMap holds all token master data of one chain from any source, could be from embedded
+// data, or local cache or anywhere else. It is safe to use from several goroutines, so can be
+// shared by runs on the same chain. A nil TokenMap has no master data.
+type TokenMap struct {
+	chainId string
+	lock    sync.RWMutex // guards tokens
+	tokens  map[string]TokenDataFromSource
+}
 
-// Init is called to load just the master data for the desired chainId
-func Init(chainId string) {
-	if len(tokenMap) == 0 {
+// Load is called to load just the master data for the desired chainId, from the embedded data
+// then the local cache
+func Load(chainId string) *TokenMap {
+	m := &TokenMap{chainId: chainId, tokens: make(map[string]TokenDataFromSource)}
 
-		// Embedded tokens
-		loadTokensEmbedded(chainId)
+	// Embedded tokens
+	m.loadTokensEmbedded()
 
-		// Locally cached tokens
-		loadTokensCached(chainId)
-	}
+	// Locally cached tokens
+	m.loadTokensCached()
+	return m
 }
 
-func GetGlobalTokensLoadedCount() uint {
-	return uint(len(tokenMap))
+// ChainId returns the chainId the master data is for
+func (m *TokenMap) ChainId() string {
+	return m.chainId
+}
+
+// GetTokensLoadedCount returns how many tokens have master data
+func (m *TokenMap) GetTokensLoadedCount() uint {
+	if m == nil {
+		return 0
+	}
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return uint(len(m.tokens))
 }
 
 // GetTokenMasterData returns master data for token, or correct defaults if no
 // master data found. This function returns valid data regardless of the token
 // type (ERC20, ERC721, ERC1155).
-func GetTokenMasterData(tokenAddr string) (tokenData TokenData, exists bool) {
+func (m *TokenMap) GetTokenMasterData(tokenAddr string) (tokenData TokenData, exists bool) {
 
 	// Defaults shine through if missing
 	tokenData = TokenData{
@@ -39,9 +57,14 @@ func GetTokenMasterData(tokenAddr string) (tokenData TokenData, exists bool) {
 		Decimals: 0,
 	}
 	exists = false
+	if m == nil {
+		return
+	}
 
-	// lookup our tokenMap keyed on address, to see what the token Symbol is
-	tokenMapEntry, mapExists := tokenMap[tokenAddr]
+	// lookup our tokens keyed on address, to see what the token Symbol is
+	m.lock.RLock()
+	tokenMapEntry, mapExists := m.tokens[tokenAddr]
+	m.lock.RUnlock()
 	if mapExists {
 		tokenData.Name = tokenMapEntry.Name
 		tokenData.Symbol = tokenMapEntry.Symbol
@@ -51,10 +74,16 @@ func GetTokenMasterData(tokenAddr string) (tokenData TokenData, exists bool) {
 	return
 }
 
-// RemoveUnknownTokens takes a map of addresses and removes those that are not known in the global tokenMap
-func RemoveUnknownTokens(addressesMap map[common.Address]*AddressMapValue) map[common.Address]*AddressMapValue {
-	for address, _ := range addressesMap {
-		_, mapExists := tokenMap[address.Hex()]
+// RemoveUnknownTokens takes a map of addresses and removes those that already have master data,
+// leaving only the tokens still unknown
+func (m *TokenMap) RemoveUnknownTokens(addressesMap map[common.Address]*AddressMapValue) map[common.Address]*AddressMapValue {
+	if m == nil {
+		return addressesMap
+	}
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for address := range addressesMap {
+		_, mapExists := m.tokens[address.Hex()]
 		if mapExists {
 			delete(addressesMap, address)
 		}
@@ -68,9 +97,12 @@ func PrintContents(addressesMap map[common.Address]*AddressMapValue) {
 	}
 }
 
-func MergeTokensIntoGlobalTokenMap(newTokens map[string]TokenDataFromSource) {
+// MergeTokens adds the master data of newTokens, replacing any the tokens already had
+func (m *TokenMap) MergeTokens(newTokens map[string]TokenDataFromSource) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 	for a, t := range newTokens {
-		tokenMap[a] = t
+		m.tokens[a] = t
 	}
 }
 
@@ -1,81 +1,129 @@
 package tokens
 
 import (
+	"context"
 	"github.com/KevinSmall/ethgraph/chain"
 	"github.com/KevinSmall/ethgraph/logr"
 	"github.com/KevinSmall/ethgraph/masterdata/tokens/contracts/erc20"
 	"github.com/KevinSmall/ethgraph/masterdata/tokens/contracts/erc721"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
 	"strings"
 )
 
-func GetTokenFromChain(chainId string, client *ethclient.Client, tokenAddr common.Address, transferType string) (tokenData TokenDataFromSource) {
-	var tokenName, tokenSymbol string
-	var tokenDecimals uint8
-	if transferType == chain.ERC20 {
-		tokenName, tokenSymbol, tokenDecimals = getTokenERC20FromChain(client, tokenAddr)
-	} else if transferType == chain.ERC721 {
-		tokenName, tokenSymbol = getTokenERC721FromChain(client, tokenAddr)
-	} else if transferType == chain.ERC1155_SINGLE || transferType == chain.ERC1155_BATCH {
-		// ERC1155 decided not to include name or symbol
-		// See Metadata Choices section in https://eips.ethereum.org/EIPS/eip-1155
-		// Try anyway, and if it fails defaults will show anyway.
-		tokenName, tokenSymbol = getTokenERC721FromChain(client, tokenAddr)
-	} else {
-		logr.Warning.Printf("Unknown transferType for address %s transferType %s.", tokenAddr.Hex(), transferType)
-		return
-	}
-	tokenData = TokenDataFromSource{
-		ChainId:      chainId,
-		Name:         tokenName,
-		Symbol:       tokenSymbol,
-		Decimals:     int(tokenDecimals),
-		TokenAddress: tokenAddr.Hex(),
-	}
-	return tokenData
+// TokenToRead is a token contract to read master data for, TransferType says which calls it has
+type TokenToRead struct {
+	Address      common.Address
+	TransferType string
 }
 
-func getTokenERC20FromChain(client *ethclient.Client, tokenAddr common.Address) (name string, symbol string, decimals uint8) {
+// tokenCall is one eth_call to a token contract for a value of its master data
+type tokenCall struct {
+	token  int // index of the token in the tokens read
+	method string
+	abi    *abi.ABI
+	input  []byte
+	output hexutil.Bytes
+}
 
-	// Defaults shine through if any errors
-	name = "Unknown"
-	symbol = "UNKNOWN"
-	decimals = 0
+// GetTokensFromChain reads the name, symbol and decimals of the tokens from their contracts, with
+// the eth_calls for all of them sent in batch requests of batchSize calls. Any call that fails
+// leaves the default for that value. The tokens are returned in the order of tokensToRead.
+func GetTokensFromChain(ctx context.Context, chainId string, client chain.BatchCaller, tokensToRead []TokenToRead,
+	batchSize int) ([]TokenDataFromSource, error) {
 
-	// Create a new ERC20 instance using the token address and client
-	erc20Instance, err := erc20.NewErc20(tokenAddr, client)
-	if err == nil {
-		name, err = erc20Instance.Name(nil)
-		if err == nil {
-			name = strings.ReplaceAll(name, ",", " ")
+	tokensData, tokenCalls, err := newTokenCalls(chainId, tokensToRead)
+	if err != nil {
+		return nil, err
+	}
+	calls := make([]rpc.BatchElem, len(tokenCalls))
+	for i, tc := range tokenCalls {
+		calls[i] = rpc.BatchElem{
+			Method: "eth_call",
+			Args: []interface{}{
+				map[string]interface{}{"to": tokensToRead[tc.token].Address, "data": hexutil.Bytes(tc.input)},
+				"latest"},
+			Result: &tc.output,
 		}
-		symbol, err = erc20Instance.Symbol(nil)
-		if err == nil {
-			symbol = strings.ReplaceAll(symbol, ",", " ")
+	}
+	if err := chain.SendBatches(ctx, client, calls, batchSize); err != nil {
+		return nil, err
+	}
+
+	for i, tc := range tokenCalls {
+		if calls[i].Error == nil {
+			tc.setValue(&tokensData[tc.token], tc.output)
 		}
-		decimals, _ = erc20Instance.Decimals(nil)
 	}
-	return
+	return tokensData, nil
 }
 
-func getTokenERC721FromChain(client *ethclient.Client, tokenAddr common.Address) (name string, symbol string) {
-
-	// Defaults shine through if any errors
-	name = "Unknown"
-	symbol = "UNKNOWN"
+// newTokenCalls returns the default master data of the tokens, and the calls to make to their
+// contracts to read it
+func newTokenCalls(chainId string, tokensToRead []TokenToRead) ([]TokenDataFromSource, []*tokenCall, error) {
+	erc20Abi, err := erc20.Erc20MetaData.GetAbi()
+	if err != nil {
+		return nil, nil, err
+	}
+	erc721Abi, err := erc721.Erc721MetaData.GetAbi()
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// Create a new ERC721 instance using the token address and client
-	erc20Instance, err := erc721.NewErc721(tokenAddr, client)
-	if err == nil {
-		name, err = erc20Instance.Name(nil)
-		if err == nil {
-			name = strings.ReplaceAll(name, ",", " ")
+	// Defaults shine through if any call fails
+	tokensData := make([]TokenDataFromSource, len(tokensToRead))
+	var tokenCalls []*tokenCall
+	for i, token := range tokensToRead {
+		if token.TransferType == chain.ERC20 {
+			tokenCalls = append(tokenCalls,
+				&tokenCall{token: i, method: "name", abi: erc20Abi},
+				&tokenCall{token: i, method: "symbol", abi: erc20Abi},
+				&tokenCall{token: i, method: "decimals", abi: erc20Abi})
+		} else if token.TransferType == chain.ERC721 || token.TransferType == chain.ERC1155_SINGLE || token.TransferType == chain.ERC1155_BATCH {
+			// ERC1155 decided not to include name or symbol
+			// See Metadata Choices section in https://eips.ethereum.org/EIPS/eip-1155
+			// Try anyway, and if it fails defaults will show anyway.
+			tokenCalls = append(tokenCalls,
+				&tokenCall{token: i, method: "name", abi: erc721Abi},
+				&tokenCall{token: i, method: "symbol", abi: erc721Abi})
+		} else {
+			logr.Warning.Printf("Unknown transferType for address %s transferType %s.", token.Address.Hex(), token.TransferType)
+			continue
+		}
+		tokensData[i] = TokenDataFromSource{
+			ChainId:      chainId,
+			Name:         "Unknown",
+			Symbol:       "UNKNOWN",
+			Decimals:     0,
+			TokenAddress: token.Address.Hex(),
 		}
-		symbol, err = erc20Instance.Symbol(nil)
-		if err == nil {
-			symbol = strings.ReplaceAll(symbol, ",", " ")
+	}
+	for _, tc := range tokenCalls {
+		if tc.input, err = tc.abi.Pack(tc.method); err != nil {
+			return nil, nil, err
+		}
+	}
+	return tokensData, tokenCalls, nil
+}
+
+// setValue sets the value of tokenData the call is for from the output of the call, leaving the
+// default if the output is not a valid value
+func (tc *tokenCall) setValue(tokenData *TokenDataFromSource, output []byte) {
+	values, err := tc.abi.Unpack(tc.method, output)
+	if err != nil || len(values) == 0 {
+		return
+	}
+	switch value := values[0].(type) {
+	case string:
+		value = strings.ReplaceAll(value, ",", " ")
+		if tc.method == "name" {
+			tokenData.Name = value
+		} else {
+			tokenData.Symbol = value
 		}
+	case uint8:
+		tokenData.Decimals = int(value)
 	}
-	return
 }
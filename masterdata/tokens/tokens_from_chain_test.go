@@ -0,0 +1,80 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/masterdata/tokens/contracts/erc20"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"testing"
+)
+
+var (
+	goodToken   = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	brokenToken = common.HexToAddress("0x2000000000000000000000000000000000000002")
+)
+
+// fakeTokenCaller answers eth_calls to the ERC20 methods of goodToken, and fails the symbol call
+// of brokenToken, counting the batch requests
+type fakeTokenCaller struct {
+	t        *testing.T
+	requests int
+}
+
+func (f *fakeTokenCaller) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	f.requests++
+	erc20Abi, _ := erc20.Erc20MetaData.GetAbi()
+	for i := range b {
+		args := b[i].Args[0].(map[string]interface{})
+		data := args["data"].(hexutil.Bytes)
+		method, err := erc20Abi.MethodById(data[:4])
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		var output []byte
+		switch method.Name {
+		case "name":
+			output, err = method.Outputs.Pack("Good, Token")
+		case "symbol":
+			if args["to"] == brokenToken {
+				b[i].Error = errors.New("execution reverted")
+				continue
+			}
+			output, err = method.Outputs.Pack("GOOD")
+		case "decimals":
+			output, err = method.Outputs.Pack(uint8(6))
+		}
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		*b[i].Result.(*hexutil.Bytes) = output
+	}
+	return nil
+}
+
+func TestGetTokensFromChain(t *testing.T) {
+	caller := &fakeTokenCaller{t: t}
+	tokensToRead := []TokenToRead{
+		{Address: goodToken, TransferType: chain.ERC20},
+		{Address: brokenToken, TransferType: chain.ERC20},
+	}
+	tokensData, err := GetTokensFromChain(context.Background(), "1", caller, tokensToRead, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 6 calls in batches of 4
+	if caller.requests != 2 {
+		t.Errorf("expected 2 batch requests, got %v", caller.requests)
+	}
+	expected := []TokenDataFromSource{
+		{ChainId: "1", Name: "Good  Token", Symbol: "GOOD", Decimals: 6, TokenAddress: goodToken.Hex()},
+		{ChainId: "1", Name: "Good  Token", Symbol: "UNKNOWN", Decimals: 6, TokenAddress: brokenToken.Hex()},
+	}
+	for i, tokenData := range tokensData {
+		if tokenData != expected[i] {
+			t.Errorf("token %v: expected %+v, got %+v", i, expected[i], tokenData)
+		}
+	}
+}
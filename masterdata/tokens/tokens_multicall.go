@@ -0,0 +1,130 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"strings"
+)
+
+// Multicall3Address is where Multicall3 is deployed on most EVM chains, see https://www.multicall3.com
+var Multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+// multicall3Abi is the part of the Multicall3 ABI needed, its tryAggregate function
+const multicall3Abi = `[{"inputs":[{"internalType":"bool","name":"requireSuccess","type":"bool"},{"components":[{"internalType":"address","name":"target","type":"address"},{"internalType":"bytes","name":"callData","type":"bytes"}],"internalType":"struct Multicall3.Call[]","name":"calls","type":"tuple[]"}],"name":"tryAggregate","outputs":[{"components":[{"internalType":"bool","name":"success","type":"bool"},{"internalType":"bytes","name":"returnData","type":"bytes"}],"internalType":"struct Multicall3.Result[]","name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
+
+// multicallCall and multicallResult are the Multicall3 Call and Result structs
+type multicallCall struct {
+	Target   common.Address
+	CallData []byte
+}
+
+type multicallResult struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// TokenReader is the part of an EVM client needed to read token master data, with eth_calls or
+// with Multicall3. It is satisfied by chain.Client and allows fakes to be injected in tests.
+type TokenReader interface {
+	bind.ContractCaller
+	chain.BatchCaller
+}
+
+// TokenResolver reads token master data from chain. If Multicall3 is deployed on the chain, the
+// calls for a batch of tokens are made in one eth_call to it, otherwise each call is its own
+// eth_call, sent in batch requests.
+type TokenResolver struct {
+	client       TokenReader
+	useMulticall bool
+}
+
+// NewTokenResolver returns a TokenResolver for the chain, which uses Multicall3 if the chain has
+// contract code at Multicall3Address. If the code cannot be read, because the provider rejects or
+// fails eth_getCode, the resolver reads each token without Multicall3. Only a cancelled ctx is
+// an error.
+func NewTokenResolver(ctx context.Context, client TokenReader) (*TokenResolver, error) {
+	code, err := client.CodeAt(ctx, Multicall3Address, nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		logr.Warning.Println("Cannot check for Multicall3, token master data read without it:", err)
+		return &TokenResolver{client: client}, nil
+	}
+	if len(code) > 0 {
+		logr.Trace.Println("Multicall3 found, token master data read with multicalls")
+	}
+	return &TokenResolver{client: client, useMulticall: len(code) > 0}, nil
+}
+
+// GetTokens is GetTokensFromChain, made with Multicall3 if the chain has it. If a multicall fails,
+// for example because it runs out of gas, the batch is read without Multicall3.
+func (r *TokenResolver) GetTokens(ctx context.Context, chainId string, tokensToRead []TokenToRead, batchSize int) (
+	[]TokenDataFromSource, error) {
+
+	if r.useMulticall {
+		tokensData, err := getTokensFromChainMulticall(ctx, chainId, r.client, tokensToRead, batchSize)
+		if err == nil || ctx.Err() != nil {
+			return tokensData, err
+		}
+		logr.Trace.Printf("Multicall for %v tokens failed, reading them without: %s\n", len(tokensToRead), err)
+	}
+	return GetTokensFromChain(ctx, chainId, r.client, tokensToRead, batchSize)
+}
+
+// getTokensFromChainMulticall is GetTokensFromChain with the calls made in eth_calls to Multicall3
+// tryAggregate of batchSize calls each, so a failed call does not fail the others
+func getTokensFromChainMulticall(ctx context.Context, chainId string, client bind.ContractCaller,
+	tokensToRead []TokenToRead, batchSize int) ([]TokenDataFromSource, error) {
+
+	multicallAbi, err := abi.JSON(strings.NewReader(multicall3Abi))
+	if err != nil {
+		return nil, err
+	}
+	tokensData, tokenCalls, err := newTokenCalls(chainId, tokensToRead)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize <= 0 {
+		batchSize = chain.DefaultBatchSize
+	}
+
+	for from := 0; from < len(tokenCalls); from += batchSize {
+		to := from + batchSize
+		if to > len(tokenCalls) {
+			to = len(tokenCalls)
+		}
+		calls := make([]multicallCall, 0, to-from)
+		for _, tc := range tokenCalls[from:to] {
+			calls = append(calls, multicallCall{Target: tokensToRead[tc.token].Address, CallData: tc.input})
+		}
+		input, err := multicallAbi.Pack("tryAggregate", false, calls)
+		if err != nil {
+			return nil, err
+		}
+		output, err := client.CallContract(ctx, ethereum.CallMsg{To: &Multicall3Address, Data: input}, nil)
+		if err != nil {
+			return nil, err
+		}
+		values, err := multicallAbi.Unpack("tryAggregate", output)
+		if err != nil {
+			return nil, err
+		}
+		results := *abi.ConvertType(values[0], new([]multicallResult)).(*[]multicallResult)
+		if len(results) != to-from {
+			return nil, errors.New("multicall returned a different number of results than calls made")
+		}
+		for i, result := range results {
+			if result.Success {
+				tokenCalls[from+i].setValue(&tokensData[tokenCalls[from+i].token], result.ReturnData)
+			}
+		}
+	}
+	return tokensData, nil
+}
@@ -0,0 +1,121 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/test"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"testing"
+)
+
+var (
+	usdc    = common.HexToAddress("0x3000000000000000000000000000000000000003")
+	weth    = common.HexToAddress("0x4000000000000000000000000000000000000004")
+	noToken = common.HexToAddress("0x5000000000000000000000000000000000000005")
+)
+
+// simulatedChain is a simulated backend as a TokenReader, counting the batch requests, which it
+// does not support
+type simulatedChain struct {
+	*backends.SimulatedBackend
+	batchRequests int
+}
+
+func (s *simulatedChain) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	s.batchRequests++
+	return errors.New("batch requests not supported")
+}
+
+func TestTokenResolverUsesMulticall(t *testing.T) {
+	backend := test.GetMockClientWithContracts(map[common.Address][]byte{
+		Multicall3Address: test.MockMulticall3Code,
+		usdc:              test.MockErc20Code("USD, Coin", "USDC", 6),
+		weth:              test.MockErc20Code("Wrapped Ether", "WETH", 18),
+	})
+	defer backend.Close()
+	client := &simulatedChain{SimulatedBackend: backend}
+
+	resolver, err := NewTokenResolver(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokensToRead := []TokenToRead{
+		{Address: usdc, TransferType: chain.ERC20},
+		{Address: weth, TransferType: chain.ERC20},
+		{Address: noToken, TransferType: chain.ERC20},
+	}
+	// 9 calls in multicalls of 4
+	tokensData, err := resolver.GetTokens(context.Background(), "1", tokensToRead, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.batchRequests != 0 {
+		t.Errorf("expected every call made with Multicall3, got %v batch requests", client.batchRequests)
+	}
+	expected := []TokenDataFromSource{
+		{ChainId: "1", Name: "USD  Coin", Symbol: "USDC", Decimals: 6, TokenAddress: usdc.Hex()},
+		{ChainId: "1", Name: "Wrapped Ether", Symbol: "WETH", Decimals: 18, TokenAddress: weth.Hex()},
+		{ChainId: "1", Name: "Unknown", Symbol: "UNKNOWN", Decimals: 0, TokenAddress: noToken.Hex()},
+	}
+	for i, tokenData := range tokensData {
+		if tokenData != expected[i] {
+			t.Errorf("token %v: expected %+v, got %+v", i, expected[i], tokenData)
+		}
+	}
+}
+
+func TestTokenResolverFallsBackWithoutMulticall(t *testing.T) {
+	backend := test.GetMockClientWithContracts(map[common.Address][]byte{
+		usdc: test.MockErc20Code("USD Coin", "USDC", 6),
+	})
+	defer backend.Close()
+	client := &simulatedChain{SimulatedBackend: backend}
+
+	resolver, err := NewTokenResolver(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolver.useMulticall {
+		t.Fatal("expected Multicall3 not found")
+	}
+	// The simulated backend has no batch requests, so the per-token path fails
+	_, err = resolver.GetTokens(context.Background(), "1", []TokenToRead{{Address: usdc, TransferType: chain.ERC20}}, 10)
+	if err == nil || client.batchRequests != 1 {
+		t.Errorf("expected the tokens read with a batch request, got %v batch requests and error %v", client.batchRequests, err)
+	}
+}
+
+// failingCodeChain is a simulatedChain whose provider rejects eth_getCode
+type failingCodeChain struct {
+	simulatedChain
+}
+
+func (f *failingCodeChain) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return nil, errors.New("method eth_getCode not supported")
+}
+
+func TestTokenResolverFallsBackWhenCodeAtFails(t *testing.T) {
+	backend := test.GetMockClientWithContracts(map[common.Address][]byte{
+		Multicall3Address: test.MockMulticall3Code,
+	})
+	defer backend.Close()
+	client := &failingCodeChain{simulatedChain{SimulatedBackend: backend}}
+
+	resolver, err := NewTokenResolver(context.Background(), client)
+	if err != nil {
+		t.Fatalf("expected a resolver without Multicall3, got error %v", err)
+	}
+	if resolver.useMulticall {
+		t.Error("expected Multicall3 not used when its code cannot be read")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = NewTokenResolver(ctx, client); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
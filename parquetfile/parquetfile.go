@@ -0,0 +1,260 @@
+// Package parquetfile writes tables as Apache Parquet files, with typed columns and compressed
+// row groups, for loading large datasets into DuckDB, Spark and the like.
+package parquetfile
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/xitongsys/parquet-go-source/local"
+	parquetcommon "github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/writer"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Compressions of the pages of a Parquet file
+const (
+	CompressionSnappy = "snappy"
+	CompressionGzip   = "gzip"
+	CompressionZstd   = "zstd"
+	CompressionNone   = "none"
+)
+
+// Compressions lists the compressions that can be used, the first is the default
+var Compressions = []string{CompressionSnappy, CompressionGzip, CompressionZstd, CompressionNone}
+
+var compressionCodecs = map[string]parquet.CompressionCodec{
+	CompressionSnappy: parquet.CompressionCodec_SNAPPY,
+	CompressionGzip:   parquet.CompressionCodec_GZIP,
+	CompressionZstd:   parquet.CompressionCodec_ZSTD,
+	CompressionNone:   parquet.CompressionCodec_UNCOMPRESSED,
+}
+
+// DefaultRowGroupSize is the size in bytes of a row group if none is given
+const DefaultRowGroupSize = 128 * 1024 * 1024
+
+// DecimalLength is the length in bytes of a decimal(78,0), the 78 digits of any uint256 and a
+// sign bit
+const DecimalLength = 33
+
+// parallelism is how many goroutines marshal the rows of a row group
+const parallelism = 4
+
+// Options says how Parquet files are written
+type Options struct {
+	// Compression is one of Compressions, empty means snappy
+	Compression string
+
+	// RowGroupSize is the size in bytes of a row group, 0 means DefaultRowGroupSize. Larger row
+	// groups compress better, smaller ones need less memory to write and read.
+	RowGroupSize int64
+
+	// Metadata is key/value metadata written in the footer of the file, such as whether the
+	// table is complete
+	Metadata map[string]string
+}
+
+// CheckCompression returns an error if compression is not one of Compressions, empty means
+// the default
+func CheckCompression(compression string) error {
+	if _, exists := compressionCodecs[compression]; compression == "" || exists {
+		return nil
+	}
+	return fmt.Errorf("unknown Parquet compression %q, use one of %s", compression, strings.Join(Compressions, ", "))
+}
+
+// Address returns the value of a FIXED_LEN_BYTE_ARRAY(20) column for address
+func Address(address common.Address) string {
+	return string(address.Bytes())
+}
+
+// Hash returns the value of a FIXED_LEN_BYTE_ARRAY(32) column for hash
+func Hash(hash common.Hash) string {
+	return string(hash.Bytes())
+}
+
+// Decimal returns the value of a decimal(78,0) FIXED_LEN_BYTE_ARRAY(33) column for value, big
+// endian two's complement
+func Decimal(value *big.Int) string {
+	b := make([]byte, DecimalLength)
+	if value.Sign() >= 0 {
+		value.FillBytes(b)
+		return string(b)
+	}
+	// Two's complement of a negative value is 2^(8*DecimalLength) + value
+	modulus := new(big.Int).Lsh(big.NewInt(1), 8*DecimalLength)
+	new(big.Int).Add(modulus, value).FillBytes(b)
+	return string(b)
+}
+
+// TimestampMillis returns the value of a TIMESTAMP_MILLIS column for t, milliseconds since the
+// Unix epoch in UTC
+func TimestampMillis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+// WriteStructs writes rows rows to filename, with the schema given by the parquet tags of the
+// struct schema points to. row returns row i, a struct of the same type, so a large table need
+// not be held twice in memory.
+func WriteStructs(filename string, schema interface{}, rows int, row func(i int) interface{},
+	options Options) error {
+
+	return write(filename, options, rows, row, func(w io.Writer) (*writer.ParquetWriter, error) {
+		return writer.NewParquetWriterFromWriter(w, schema, parallelism)
+	})
+}
+
+// WriteRecords writes rows rows to filename, with the schema given by a metadata tag for each
+// column, such as "name=block, type=INT64, repetitiontype=OPTIONAL". row returns row i, with a
+// value for each column, nil for a missing optional value.
+func WriteRecords(filename string, metadata []string, rows int, row func(i int) []interface{},
+	options Options) error {
+
+	record := func(i int) interface{} {
+		return row(i)
+	}
+	return write(filename, options, rows, record, func(w io.Writer) (*writer.ParquetWriter, error) {
+		csvWriter, err := writer.NewCSVWriterFromWriter(metadata, w, parallelism)
+		if err != nil {
+			return nil, err
+		}
+		return &csvWriter.ParquetWriter, nil
+	})
+}
+
+// write creates filename and writes the rows to it with the writer from newWriter, buffered
+func write(filename string, options Options, rows int, row func(i int) interface{},
+	newWriter func(w io.Writer) (*writer.ParquetWriter, error)) error {
+
+	if err := CheckCompression(options.Compression); err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	buffered := bufio.NewWriter(file)
+	err = writeRows(buffered, options, rows, row, newWriter)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeRows writes the rows to w as a Parquet file, in row groups of the size and with the
+// compression in options
+func writeRows(w io.Writer, options Options, rows int, row func(i int) interface{},
+	newWriter func(w io.Writer) (*writer.ParquetWriter, error)) error {
+
+	pw, err := newWriter(w)
+	if err != nil {
+		return err
+	}
+	pw.RowGroupSize = DefaultRowGroupSize
+	if options.RowGroupSize > 0 {
+		pw.RowGroupSize = options.RowGroupSize
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	if options.Compression != "" {
+		pw.CompressionType = compressionCodecs[options.Compression]
+	}
+	for i := 0; i < rows; i++ {
+		if err = pw.Write(row(i)); err != nil {
+			return err
+		}
+	}
+	pw.Footer.KeyValueMetadata = keyValueMetadata(options.Metadata)
+	return pw.WriteStop()
+}
+
+// keyValueMetadata returns metadata as the key/value metadata of the footer, in key order so
+// the same metadata is always written the same way
+func keyValueMetadata(metadata map[string]string) []*parquet.KeyValue {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	keyValues := make([]*parquet.KeyValue, 0, len(keys))
+	for _, key := range keys {
+		value := metadata[key]
+		keyValues = append(keyValues, &parquet.KeyValue{Key: key, Value: &value})
+	}
+	return keyValues
+}
+
+// Column is a column of a Parquet file read by ReadColumns
+type Column struct {
+	Name string
+
+	// Type is the physical type of the column, then its converted type if it has one, such as
+	// INT64/TIMESTAMP_MILLIS
+	Type string
+
+	// Values has the value of each row, nil if it is null
+	Values []interface{}
+}
+
+// ReadMetadata reads the key/value metadata of the Parquet file filename, for checking what was
+// written
+func ReadMetadata(filename string) (map[string]string, error) {
+	file, err := local.NewLocalFileReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	pr, err := reader.NewParquetColumnReader(file, parallelism)
+	if err != nil {
+		return nil, err
+	}
+	defer pr.ReadStop()
+	metadata := make(map[string]string)
+	for _, keyValue := range pr.Footer.KeyValueMetadata {
+		if keyValue.Value != nil {
+			metadata[keyValue.Key] = *keyValue.Value
+		}
+	}
+	return metadata, nil
+}
+
+// ReadColumns reads every column of the Parquet file filename, for checking what was written
+func ReadColumns(filename string) ([]Column, error) {
+	file, err := local.NewLocalFileReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	pr, err := reader.NewParquetColumnReader(file, parallelism)
+	if err != nil {
+		return nil, err
+	}
+	defer pr.ReadStop()
+	var columns []Column
+	root := pr.SchemaHandler.GetRootExName()
+	for i, element := range pr.Footer.Schema {
+		if element.Type == nil {
+			continue
+		}
+		column := Column{Name: pr.SchemaHandler.Infos[i].ExName, Type: element.Type.String()}
+		if element.ConvertedType != nil {
+			column.Type += "/" + element.ConvertedType.String()
+		}
+		column.Values, _, _, err = pr.ReadColumnByPath(root+parquetcommon.PAR_GO_PATH_DELIMITER+column.Name, pr.GetNumRows())
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
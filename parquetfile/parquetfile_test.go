@@ -0,0 +1,116 @@
+package parquetfile
+
+import (
+	"encoding/hex"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecimal(t *testing.T) {
+	maxUint256 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	testCases := []struct {
+		value    *big.Int
+		expected string
+	}{
+		{big.NewInt(0), strings.Repeat("00", 33)},
+		{big.NewInt(258), strings.Repeat("00", 31) + "0102"},
+		{big.NewInt(-1), strings.Repeat("ff", 33)},
+		{maxUint256, "00" + strings.Repeat("ff", 32)},
+	}
+	for _, tc := range testCases {
+		if actual := hex.EncodeToString([]byte(Decimal(tc.value))); actual != tc.expected {
+			t.Errorf("%v: expected %s, got %s", tc.value, tc.expected, actual)
+		}
+	}
+}
+
+func TestCheckCompression(t *testing.T) {
+	testCases := []struct {
+		compression string
+		valid       bool
+	}{
+		{"", true},
+		{CompressionSnappy, true},
+		{CompressionGzip, true},
+		{CompressionZstd, true},
+		{CompressionNone, true},
+		{"lzo", false},
+	}
+	for _, tc := range testCases {
+		if err := CheckCompression(tc.compression); (err == nil) != tc.valid {
+			t.Errorf("%q: expected valid %v, got %v", tc.compression, tc.valid, err)
+		}
+	}
+}
+
+type testRow struct {
+	Block     int64   `parquet:"name=block, type=INT64, convertedtype=UINT_64"`
+	Address   string  `parquet:"name=address, type=FIXED_LEN_BYTE_ARRAY, length=20"`
+	Value     string  `parquet:"name=value, type=FIXED_LEN_BYTE_ARRAY, length=33, convertedtype=DECIMAL, precision=78, scale=0"`
+	Timestamp *int64  `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	Symbol    *string `parquet:"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+}
+
+func TestWriteStructsAndRecords(t *testing.T) {
+	address := common.HexToAddress("0x472361d3cA5F49c8E633FB50385BfaD1e018b445")
+	timestamp := TimestampMillis(time.Unix(1678752000, 0))
+	symbol := "USDT"
+	rows := []testRow{
+		testRow{Block: 16670050, Address: Address(address), Value: Decimal(big.NewInt(5)), Timestamp: &timestamp, Symbol: &symbol},
+		testRow{Block: 16670051, Address: Address(address), Value: Decimal(big.NewInt(6))},
+	}
+	metadata := []string{
+		"name=block, type=INT64, convertedtype=UINT_64",
+		"name=address, type=FIXED_LEN_BYTE_ARRAY, length=20",
+		"name=value, type=FIXED_LEN_BYTE_ARRAY, length=33, convertedtype=DECIMAL, precision=78, scale=0",
+		"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL",
+		"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL",
+	}
+	records := [][]interface{}{
+		{int64(16670050), Address(address), Decimal(big.NewInt(5)), timestamp, symbol},
+		{int64(16670051), Address(address), Decimal(big.NewInt(6)), nil, nil},
+	}
+	expected := []Column{
+		{"block", "INT64/UINT_64", []interface{}{int64(16670050), int64(16670051)}},
+		{"address", "FIXED_LEN_BYTE_ARRAY", []interface{}{Address(address), Address(address)}},
+		{"value", "FIXED_LEN_BYTE_ARRAY/DECIMAL", []interface{}{Decimal(big.NewInt(5)), Decimal(big.NewInt(6))}},
+		{"timestamp", "INT64/TIMESTAMP_MILLIS", []interface{}{timestamp, nil}},
+		{"symbol", "BYTE_ARRAY/UTF8", []interface{}{symbol, nil}},
+	}
+
+	dirname := t.TempDir()
+	for _, compression := range Compressions {
+		options := Options{Compression: compression, RowGroupSize: 1024, Metadata: map[string]string{"partial": "true"}}
+		structsFile := filepath.Join(dirname, compression+"_structs.parquet")
+		err := WriteStructs(structsFile, new(testRow), len(rows), func(i int) interface{} { return rows[i] }, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recordsFile := filepath.Join(dirname, compression+"_records.parquet")
+		err = WriteRecords(recordsFile, metadata, len(records), func(i int) []interface{} { return records[i] }, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, filename := range []string{structsFile, recordsFile} {
+			columns, err := ReadColumns(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(columns, expected) {
+				t.Errorf("%s: expected %v, got %v", filepath.Base(filename), expected, columns)
+			}
+			metadata, err := ReadMetadata(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(metadata, options.Metadata) {
+				t.Errorf("%s: expected metadata %v, got %v", filepath.Base(filename), options.Metadata, metadata)
+			}
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/blocks"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/conv"
+	"github.com/KevinSmall/ethgraph/extract"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/ethereum/go-ethereum/core/types"
+	"strings"
+	"time"
+)
+
+// maxReadAttempts is how many times blocks are read for one head while the chain looks
+// reorganised, before giving up until the next head. With several endpoints, one lagging behind
+// can keep answering with blocks the others have not got yet.
+const maxReadAttempts = 3
+
+// BuildByFollow is entry point for building graph live, following new blocks as they arrive
+// on chain. Following starts at the latest block, and each block is read once it has
+// confirmations blocks on top of it. The graph grows with each new block and the graph file
+// is rewritten at most every writeInterval, and once more when following stops. If reading
+// blocks fails, they are read again at the next head, so one failed call does not end following.
+//   - For ws:// and wss:// urls new heads are subscribed to, else the chain is polled every
+//     pollInterval.
+//   - If stopAfterBlocks is non-zero, following stops after that many blocks, else it runs
+//     until ctx is cancelled, as it is by Ctrl+C.
+//   - Events are selected by the filter of opts, its block range is not used.
+func BuildByFollow(ctx context.Context, confirmations uint64, pollInterval time.Duration, writeInterval time.Duration,
+	stopAfterBlocks uint64, opts extract.Options) error {
+	if err := extract.CheckWriteOptions(opts.WriteOptions); err != nil {
+		return err
+	}
+
+	// Client
+	evmChain, err := extract.Connect(ctx, opts.Urls, opts.Dial)
+	if err != nil {
+		return err
+	}
+	defer evmChain.Close()
+
+	// Blocks followed are near the tip so are never kept in the event store
+	opts.NoEventStore = true
+
+	// Master data is loaded once, missing token master data is fetched per increment
+	extract.LoadMasterData(evmChain, &opts)
+
+	heads, stopHeads := watchHeads(ctx, evmChain, pollInterval)
+	defer stopHeads()
+
+	state := newFollowState(evmChain.LatestBlockNumber)
+	tracker := blocks.NewChainTracker(evmChain.Client)
+	logr.Info.Printf("Following from block %s with %v confirmations, press Ctrl+C to stop\n",
+		conv.PrettyBlockNumberWithUnderscores(state.nextBlock), confirmations)
+
+	var filename string
+	lastWrite := time.Now()
+	isWritePending := false
+	isFollowing := true
+	for isFollowing {
+		select {
+		case <-ctx.Done():
+			isFollowing = false
+
+		case head := <-heads:
+			blockFrom, blockTo, isReady := confirmedBlockRange(state.nextBlock, head, confirmations)
+			if !isReady {
+				continue
+			}
+			if stopAfterBlocks > 0 && blockTo-state.firstBlock+1 > stopAfterBlocks {
+				blockTo = state.firstBlock + stopAfterBlocks - 1
+			}
+
+			newEvents, isRolledBack, err := readIncrement(ctx, evmChain, tracker, state, blockTo, pollInterval, opts)
+			if isRolledBack {
+				isWritePending = true
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					isFollowing = false
+					continue
+				}
+				// The blocks are read again at the next head
+				logr.Warning.Printf("Reading blocks %s to %s failed, trying again at the next head: %v\n",
+					conv.PrettyBlockNumberWithUnderscores(blockFrom), conv.PrettyBlockNumberWithUnderscores(blockTo), err)
+				continue
+			}
+			logr.Info.Printf("Blocks %s to %s: %v new events, %v in total\n",
+				conv.PrettyBlockNumberWithUnderscores(blockFrom), conv.PrettyBlockNumberWithUnderscores(blockTo),
+				len(newEvents), len(state.events))
+
+			if len(newEvents) > 0 {
+				isWritePending = true
+				if !opts.DoNotFetchMissingMasterData {
+					err = extract.FetchMissingTokenMasterData(ctx, evmChain, newEvents, opts)
+					if err != nil && ctx.Err() != nil {
+						// The graph is written once following stops
+						isFollowing = false
+						continue
+					}
+					if err != nil {
+						logr.Warning.Println("Token master data not fetched for the new events:", err)
+					}
+				}
+			}
+			if isWritePending && time.Since(lastWrite) >= writeInterval {
+				filename, err = writeFollowGraph(ctx, evmChain, state.events, opts)
+				if err != nil && ctx.Err() != nil {
+					isFollowing = false
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				lastWrite = time.Now()
+				isWritePending = false
+			}
+			if stopAfterBlocks > 0 && state.nextBlock-state.firstBlock >= stopAfterBlocks {
+				isFollowing = false
+			}
+		}
+	}
+
+	if isWritePending {
+		// Written even if ctx is done, so the blocks followed so far are not lost, whatever call
+		// was in flight when following stopped
+		filename, err = writeFollowGraph(context.Background(), evmChain, state.events, opts)
+		if err != nil {
+			return err
+		}
+	}
+	logr.Info.Printf("Followed blocks: %v\n", state.nextBlock-state.firstBlock)
+	if filename != "" {
+		logr.Info.Printf("File created: %s\n", filename)
+	} else {
+		logr.Info.Println("No events found, no file created")
+	}
+	return nil
+}
+
+// writeFollowGraph creates the graph from the events followed so far and writes it, returning the filename
+func writeFollowGraph(ctx context.Context, evmChain chain.EvmClient, events []*chain.TransferEvent, opts extract.Options) (
+	string, error) {
+	ethGraph, _, err := extract.BuildGraph(ctx, evmChain, events, opts)
+	if err != nil {
+		return "", err
+	}
+	return extract.WriteGraph(evmChain, ethGraph, events, opts)
+}
+
+// followState holds everything seen so far while following the chain
+type followState struct {
+	// firstBlock is the first block followed
+	firstBlock uint64
+
+	// nextBlock is the next block to be read, all blocks before it have been read
+	nextBlock uint64
+
+	// events are all events read so far
+	events []*chain.TransferEvent
+
+	// blocksMap holds the block master data for the blocks of all events read so far
+	blocksMap blocks.BlockMap
+}
+
+func newFollowState(firstBlock uint64) *followState {
+	return &followState{
+		firstBlock: firstBlock,
+		nextBlock:  firstBlock,
+		blocksMap:  make(blocks.BlockMap),
+	}
+}
+
+// addIncrement adds the events read up to and including block blockTo. The time enrichment
+// is redone over all events, so the first seen times and indexes of addresses are the same as
+// if all blocks had been read in one go.
+func (s *followState) addIncrement(blockTo uint64, events []*chain.TransferEvent, blocksMap blocks.BlockMap) error {
+	for blockKey, blockMapValue := range blocksMap {
+		s.blocksMap[blockKey] = blockMapValue
+	}
+	allEvents, err := extract.EnrichWithTimeEstimates(append(s.events, events...), s.blocksMap)
+	if err != nil {
+		return err
+	}
+	s.events = allEvents
+	s.nextBlock = blockTo + 1
+	return nil
+}
+
+// readIncrement reads the events from the next block of state up to and including block blockTo,
+// and adds them to state. The blocks read are checked to link to the blocks read before, and
+// events are checked to be from those blocks. If the chain has been reorganised, the events of
+// the blocks reorganised away are discarded and the blocks are read again, and isRolledBack is
+// true if any blocks read before were discarded. Blocks are read at most maxReadAttempts times,
+// waiting pollInterval in between, before an error is returned. If reading fails, state is left
+// as it was, apart from any blocks rolled back, so the blocks can be read again.
+func readIncrement(
+	ctx context.Context,
+	evmChain chain.EvmClient,
+	tracker *blocks.ChainTracker,
+	state *followState,
+	blockTo uint64,
+	pollInterval time.Duration,
+	opts extract.Options) (newEvents []*chain.TransferEvent, isRolledBack bool, err error) {
+
+	for attempt := 1; ; attempt++ {
+		if attempt > maxReadAttempts {
+			return nil, isRolledBack, fmt.Errorf("chain still reorganising after %v reads", maxReadAttempts)
+		}
+		if attempt > 1 {
+			select {
+			case <-time.After(pollInterval):
+			case <-ctx.Done():
+				return nil, isRolledBack, ctx.Err()
+			}
+		}
+
+		blockFrom := state.nextBlock
+		forkBlock, isReorg, err := tracker.Extend(ctx, blockFrom, blockTo)
+		if err != nil {
+			return nil, isRolledBack, err
+		}
+		if isReorg {
+			if forkBlock < blockFrom {
+				discardedCount := state.rollback(forkBlock)
+				isRolledBack = true
+				logr.Warning.Printf("Chain reorganisation: blocks %s to %s rolled back, %v events discarded\n",
+					conv.PrettyBlockNumberWithUnderscores(forkBlock), conv.PrettyBlockNumberWithUnderscores(blockFrom-1),
+					discardedCount)
+			} else {
+				logr.Warning.Printf("Chain reorganisation at block %s while reading, reading again\n",
+					conv.PrettyBlockNumberWithUnderscores(forkBlock))
+			}
+			continue
+		}
+
+		opts.BlockFrom = blockFrom
+		opts.BlockTo = blockTo
+		newEvents, err = extract.FetchEvents(ctx, evmChain, opts)
+		if err != nil {
+			tracker.Rollback(blockFrom)
+			return nil, isRolledBack, err
+		}
+
+		// Logs can be read from a different block to the header if the chain reorganised in between
+		isConsistent := true
+		for _, event := range newEvents {
+			if !tracker.IsCanonical(event.BlockNumber, event.BlockHash) {
+				logr.Warning.Printf("Chain reorganisation at block %s while reading, reading again\n",
+					conv.PrettyBlockNumberWithUnderscores(event.BlockNumber))
+				isConsistent = false
+				break
+			}
+		}
+		if !isConsistent {
+			tracker.Rollback(blockFrom)
+			continue
+		}
+
+		newBlocksMap, err := extract.FetchBlockMasterData(ctx, evmChain, newEvents, opts)
+		if err != nil {
+			tracker.Rollback(blockFrom)
+			return nil, isRolledBack, err
+		}
+		err = state.addIncrement(blockTo, newEvents, newBlocksMap)
+		return newEvents, isRolledBack, err
+	}
+}
+
+// rollback discards the events and block master data of blocks from forkBlock onwards, so they
+// can be read again, returning the number of events discarded
+func (s *followState) rollback(forkBlock uint64) (discardedCount int) {
+	keptEvents := s.events[:0]
+	for _, event := range s.events {
+		if event.BlockNumber < forkBlock {
+			keptEvents = append(keptEvents, event)
+		}
+	}
+	discardedCount = len(s.events) - len(keptEvents)
+	s.events = keptEvents
+	for blockKey := range s.blocksMap {
+		if blockKey.BlockNumber >= forkBlock {
+			delete(s.blocksMap, blockKey)
+		}
+	}
+	if forkBlock < s.nextBlock {
+		s.nextBlock = forkBlock
+	}
+	return discardedCount
+}
+
+// confirmedBlockRange returns the range of blocks from nextBlock that have at least
+// confirmations blocks on top of them when the chain head is at block head. isReady is false
+// when there are no such blocks yet.
+func confirmedBlockRange(nextBlock uint64, head uint64, confirmations uint64) (
+	blockFrom uint64, blockTo uint64, isReady bool) {
+
+	if head < confirmations || head-confirmations < nextBlock {
+		return 0, 0, false
+	}
+	return nextBlock, head - confirmations, true
+}
+
+// watchHeads returns a channel that receives the block number of the chain head each time it
+// changes, and a function to stop watching. New heads are subscribed to for websocket urls,
+// falling back to polling if the subscription fails.
+func watchHeads(ctx context.Context, evmChain chain.EvmClient, pollInterval time.Duration) (heads <-chan uint64, stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	headsChan := make(chan uint64)
+
+	go func() {
+		if strings.HasPrefix(evmChain.Urls[0], "ws://") || strings.HasPrefix(evmChain.Urls[0], "wss://") {
+			err := subscribeHeads(ctx, evmChain, headsChan)
+			if err == nil {
+				return
+			}
+			logr.Warning.Println("New head subscription failed, polling instead:", err)
+		}
+		pollHeads(ctx, evmChain, pollInterval, headsChan)
+	}()
+	return headsChan, cancel
+}
+
+// subscribeHeads sends new heads from an eth_subscribe subscription until ctx is done
+func subscribeHeads(ctx context.Context, evmChain chain.EvmClient, headsChan chan<- uint64) error {
+	headers := make(chan *types.Header)
+	subscription, err := evmChain.Client.SubscribeNewHead(ctx, headers)
+	if err != nil {
+		return err
+	}
+	defer subscription.Unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-subscription.Err():
+			return err
+		case header := <-headers:
+			select {
+			case headsChan <- header.Number.Uint64():
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// pollHeads polls the latest block number and sends it when it changes, until ctx is done
+func pollHeads(ctx context.Context, evmChain chain.EvmClient, pollInterval time.Duration, headsChan chan<- uint64) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastHead := uint64(0)
+	for {
+		head, err := evmChain.Client.BlockNumber(ctx)
+		if err != nil {
+			logr.Warning.Println("Polling latest block number failed:", err)
+		} else if head != lastHead {
+			lastHead = head
+			select {
+			case headsChan <- head:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
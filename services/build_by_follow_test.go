@@ -0,0 +1,251 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/blocks"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/extract"
+	"github.com/KevinSmall/ethgraph/test/fakechain"
+	"github.com/ethereum/go-ethereum/common"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConfirmedBlockRange(t *testing.T) {
+	testCases := []struct {
+		nextBlock     uint64
+		head          uint64
+		confirmations uint64
+		expectedReady bool
+		expectedFrom  uint64
+		expectedTo    uint64
+	}{
+		{100, 100, 0, true, 100, 100},
+		{100, 105, 3, true, 100, 102},
+		{100, 102, 3, false, 0, 0},
+		{100, 99, 0, false, 0, 0},
+		// Head below the confirmation depth must not underflow
+		{0, 2, 12, false, 0, 0},
+	}
+	for _, tc := range testCases {
+		blockFrom, blockTo, isReady := confirmedBlockRange(tc.nextBlock, tc.head, tc.confirmations)
+		if isReady != tc.expectedReady || blockFrom != tc.expectedFrom || blockTo != tc.expectedTo {
+			t.Errorf("confirmedBlockRange(%v, %v, %v) = %v, %v, %v, expected %v, %v, %v",
+				tc.nextBlock, tc.head, tc.confirmations, blockFrom, blockTo, isReady,
+				tc.expectedFrom, tc.expectedTo, tc.expectedReady)
+		}
+	}
+}
+
+func TestFollowStateKeepsFirstSeenAcrossIncrements(t *testing.T) {
+	alice := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	bob := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	carol := common.HexToAddress("0x0000000000000000000000000000000000000003")
+	blockTime := time.Date(2023, time.March, 14, 0, 0, 0, 0, time.UTC)
+
+	state := newFollowState(100)
+	err := state.addIncrement(100,
+		[]*chain.TransferEvent{{BlockNumber: 100, LogAddressFrom: alice, LogAddressTo: bob}},
+		blocks.BlockMap{{BlockNumber: 100}: {BlockTimestamp: blockTime, TransactionCount: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = state.addIncrement(101,
+		[]*chain.TransferEvent{{BlockNumber: 101, LogAddressFrom: bob, LogAddressTo: carol}},
+		blocks.BlockMap{{BlockNumber: 101}: {BlockTimestamp: blockTime.Add(12 * time.Second), TransactionCount: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.nextBlock != 102 {
+		t.Errorf("expected next block 102, got %v", state.nextBlock)
+	}
+	if len(state.events) != 2 {
+		t.Fatalf("expected 2 events, got %v", len(state.events))
+	}
+	// Bob was first seen in the first increment
+	secondEvent := state.events[1]
+	if !secondEvent.LogAddressFromFirstSeen.Equal(blockTime) {
+		t.Errorf("expected bob first seen at %s, got %s", blockTime, secondEvent.LogAddressFromFirstSeen)
+	}
+	if secondEvent.LogAddressFromFirstSeenIndex != 0 || secondEvent.LogAddressToFirstSeenIndex != 1 {
+		t.Errorf("expected first seen indexes 0 and 1, got %v and %v",
+			secondEvent.LogAddressFromFirstSeenIndex, secondEvent.LogAddressToFirstSeenIndex)
+	}
+}
+
+func TestFollowStateRollback(t *testing.T) {
+	state := newFollowState(100)
+	err := state.addIncrement(102,
+		[]*chain.TransferEvent{{BlockNumber: 100}, {BlockNumber: 101}, {BlockNumber: 102}},
+		blocks.BlockMap{{BlockNumber: 100}: {TransactionCount: 1}, {BlockNumber: 101}: {TransactionCount: 1},
+			{BlockNumber: 102}: {TransactionCount: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discardedCount := state.rollback(101)
+	if discardedCount != 2 || len(state.events) != 1 {
+		t.Errorf("expected 2 events discarded and 1 kept, got %v and %v", discardedCount, len(state.events))
+	}
+	if state.nextBlock != 101 {
+		t.Errorf("expected next block 101, got %v", state.nextBlock)
+	}
+	if _, exists := state.blocksMap[blocks.BlockKey{BlockNumber: 101}]; exists {
+		t.Errorf("expected block 101 master data discarded")
+	}
+}
+
+// TestReadIncrementGivesUpWhenHashesNeverAgree checks that when the logs always come from
+// blocks other than the headers, as they can from a lagging endpoint, blocks are read
+// maxReadAttempts times and then an error is returned for the next head to read them again
+func TestReadIncrementGivesUpWhenHashesNeverAgree(t *testing.T) {
+	chdirTemp(t)
+	logsChain := fakechain.New(fakechain.DefaultConfig())
+	headersConfig := fakechain.DefaultConfig()
+	headersConfig.Seed = 2
+	headersChain := fakechain.New(headersConfig)
+	var getLogsCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if bytes.Contains(body, []byte(`"eth_getLogs"`)) {
+			atomic.AddInt32(&getLogsCalls, 1)
+			logsChain.ServeHTTP(w, r)
+			return
+		}
+		headersChain.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	evmChain, err := extract.Connect(ctx, []string{server.URL}, chain.DialOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer evmChain.Close()
+	state := newFollowState(500)
+	opts := extract.Options{DoNotFetchMissingMasterData: true, ForceSerialExecution: true, NoEventStore: true}
+	_, _, err = readIncrement(ctx, evmChain, blocks.NewChainTracker(evmChain.Client), state, 500, time.Millisecond, opts)
+	if err == nil {
+		t.Errorf("expected an error once the reads are used up")
+	}
+	if getLogsCalls != maxReadAttempts {
+		t.Errorf("expected %v eth_getLogs calls, got %v", maxReadAttempts, getLogsCalls)
+	}
+	if state.nextBlock != 500 || len(state.events) != 0 {
+		t.Errorf("expected state left as it was, got next block %v and %v events", state.nextBlock, len(state.events))
+	}
+}
+
+// followServer serves a fake chain whose head moves on a block each time it is asked for. Each
+// eth_getLogs call is first passed to getLogs with its count, and only answered by the chain if
+// getLogs returns false.
+func followServer(t *testing.T, getLogs func(call int32, w http.ResponseWriter) bool) string {
+	config := fakechain.DefaultConfig()
+	config.TransfersPerBlock = 2
+	fakeChain := fakechain.New(config)
+	var head, getLogsCalls int32 = 500, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var request struct {
+			Id     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		json.Unmarshal(body, &request)
+		switch request.Method {
+		case "eth_blockNumber":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"0x%x"}`, request.Id, atomic.AddInt32(&head, 1))
+			return
+		case "eth_getLogs":
+			if getLogs(atomic.AddInt32(&getLogsCalls, 1), w) {
+				return
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fakeChain.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// chdirTemp changes to a temporary directory for the test, returning it
+func chdirTemp(t *testing.T) string {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(workingDir) })
+	return dir
+}
+
+// TestBuildByFollowRetriesFailedRead checks that when the first eth_getLogs fails, following
+// goes on, reading the blocks again at the next head, and the graph is written
+func TestBuildByFollowRetriesFailedRead(t *testing.T) {
+	dir := chdirTemp(t)
+	var getLogsCalls int32
+	url := followServer(t, func(call int32, w http.ResponseWriter) bool {
+		getLogsCalls = call
+		if call == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return true
+		}
+		return false
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	opts := extract.Options{Urls: []string{url}, DoNotFetchMissingMasterData: true}
+	err := BuildByFollow(ctx, 0, time.Millisecond, 0, 3, opts)
+	if err != nil {
+		t.Fatalf("expected following to go on after a failed read, got %v", err)
+	}
+	if getLogsCalls < 2 {
+		t.Errorf("expected the failed blocks read again, got %v eth_getLogs calls", getLogsCalls)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.graphml"))
+	if err != nil || len(files) != 1 {
+		t.Errorf("expected the graph written, got files %v, error %v", files, err)
+	}
+}
+
+// TestBuildByFollowWritesWhenCancelledWhileReading checks that when ctx is cancelled while
+// blocks are being read, the events read before, not yet written, are still written
+func TestBuildByFollowWritesWhenCancelledWhileReading(t *testing.T) {
+	dir := chdirTemp(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	url := followServer(t, func(call int32, w http.ResponseWriter) bool {
+		if call == 2 {
+			cancel()
+			w.WriteHeader(http.StatusInternalServerError)
+			return true
+		}
+		return false
+	})
+
+	// Serial execution reads each increment with one eth_getLogs, and the write interval is never
+	// reached while following
+	opts := extract.Options{Urls: []string{url}, DoNotFetchMissingMasterData: true, ForceSerialExecution: true}
+	err := BuildByFollow(ctx, 0, time.Millisecond, time.Hour, 0, opts)
+	if err != nil {
+		t.Fatalf("expected following to stop cleanly, got %v", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.graphml"))
+	if err != nil || len(files) != 1 {
+		t.Errorf("expected the graph of the blocks read before written, got files %v, error %v", files, err)
+	}
+}
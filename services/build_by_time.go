@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/KevinSmall/ethgraph/blocks"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/conv"
+	"github.com/KevinSmall/ethgraph/extract"
+	"github.com/KevinSmall/ethgraph/logr"
+	"time"
+)
+
+// BuildByTimeRange is entry point for building graph based on a time window selection. The
+// window is resolved to a block range by searching block timestamps on chain.
+//   - If last is non-zero, the window is the last duration up to the latest block, and
+//     timeFrom and timeTo are ignored.
+//   - If timeTo is zero, the window runs up to the latest block.
+//   - The block range of opts is replaced by the one resolved, the rest of opts is as for
+//     BuildByBlockRange.
+func BuildByTimeRange(ctx context.Context, timeFrom time.Time, timeTo time.Time, last time.Duration,
+	opts extract.Options) error {
+	start := time.Now()
+
+	// Client
+	evmChain, err := extract.Connect(ctx, opts.Urls, opts.Dial)
+	if err != nil {
+		return err
+	}
+	defer evmChain.Close()
+
+	blockFrom, blockTo, err := resolveTimeRange(ctx, evmChain, timeFrom, timeTo, last)
+	if err != nil {
+		return err
+	}
+	logr.Info.Printf("Time range resolved to blocks: %s to %s\n",
+		conv.PrettyBlockNumberWithUnderscores(blockFrom), conv.PrettyBlockNumberWithUnderscores(blockTo))
+
+	opts.BlockFrom, opts.BlockTo = blockFrom, blockTo
+	result, err := extract.RunOnChain(ctx, evmChain, opts)
+	return logRunResult(start, result, err)
+}
+
+// resolveTimeRange returns the block range of blocks with timestamps in the time window, see
+// BuildByTimeRange for the meaning of the parameters
+func resolveTimeRange(ctx context.Context, evmChain chain.EvmClient, timeFrom time.Time, timeTo time.Time, last time.Duration) (
+	blockFrom uint64, blockTo uint64, err error) {
+
+	probes := blocks.LoadTimeProbes(evmChain.ChainId)
+	defer probes.Save()
+
+	if last > 0 {
+		latestTime, err := probes.GetBlockTime(ctx, evmChain.Client, evmChain.LatestBlockNumber)
+		if err != nil {
+			return 0, 0, err
+		}
+		timeFrom = latestTime.Add(-last)
+		timeTo = time.Time{}
+	}
+
+	blockFrom, err = blocks.FindFirstBlockAtOrAfter(ctx, evmChain.Client, probes, timeFrom, evmChain.LatestBlockNumber)
+	if err != nil {
+		return 0, 0, err
+	}
+	blockTo = evmChain.LatestBlockNumber
+	if !timeTo.IsZero() {
+		blockTo, err = blocks.FindLastBlockAtOrBefore(ctx, evmChain.Client, probes, timeTo, evmChain.LatestBlockNumber)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if blockFrom > blockTo {
+		return 0, 0, errors.New("no blocks found in the time range")
+	}
+	return blockFrom, blockTo, nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/extract"
+	"github.com/KevinSmall/ethgraph/logr"
+	"github.com/ethereum/go-ethereum/common"
+	"sort"
+	"time"
+)
+
+// hopDistanceAttribute is the address node attribute holding how many hops the address is from a seed
+const hopDistanceAttribute = "hopDistance"
+
+// BuildByTrace is entry point for building graph by following the money outwards from seed
+// addresses. At each hop the transfers of the addresses discovered at the previous hop are
+// read from chain, and their counterparties become the addresses for the next hop.
+//   - maxFanOut caps how many counterparties are followed at each hop, the most active win.
+//   - Counterparties that are excluded, the zero address or known addresses like exchanges,
+//     appear in the graph but are never followed.
+//   - Events are read in the block range of opts, selected by its filter with the wallet
+//     addresses of each hop.
+func BuildByTrace(ctx context.Context, seedAddresses []string, hops int, maxFanOut int, excludeAddresses []string,
+	opts extract.Options) error {
+	start := time.Now()
+	if err := extract.CheckWriteOptions(opts.WriteOptions); err != nil {
+		return err
+	}
+
+	// Client
+	evmChain, err := extract.Connect(ctx, opts.Urls, opts.Dial)
+	if err != nil {
+		return err
+	}
+	defer evmChain.Close()
+	opts.NoEventStore = true
+	filter := opts.Filter
+
+	// Address master data is needed up front to know which addresses are excluded
+	extract.LoadMasterData(evmChain, &opts)
+	excluded := make(map[common.Address]bool)
+	excluded[common.Address{}] = true
+	for _, excludeAddress := range excludeAddresses {
+		excluded[common.HexToAddress(excludeAddress)] = true
+	}
+	isExcluded := func(address common.Address) bool {
+		_, isKnownAddress := opts.GraphOptions.Addresses.GetAddressMasterData(address.Hex())
+		return excluded[address] || isKnownAddress
+	}
+
+	// Seeds are hop zero
+	hopDistances := make(map[common.Address]int)
+	var frontier []common.Address
+	for _, seedAddress := range seedAddresses {
+		address := common.HexToAddress(seedAddress)
+		if _, exists := hopDistances[address]; !exists {
+			hopDistances[address] = 0
+			frontier = append(frontier, address)
+		}
+	}
+
+	// Follow the money, hop by hop
+	var allEvents []*chain.TransferEvent
+	seenEvents := make(map[eventKey]bool)
+	for hop := 0; hop < hops && len(frontier) > 0; hop++ {
+		logr.Info.Printf("Hop %v: following %v addresses\n", hop+1, len(frontier))
+		opts.Filter = filter
+		opts.Filter.WalletAddresses = frontier
+		hopEvents, err := extract.FetchEvents(ctx, evmChain, opts)
+		if err != nil {
+			return err
+		}
+
+		// Events between addresses at different hops are read once per hop, keep only new ones
+		var newEvents []*chain.TransferEvent
+		for _, event := range hopEvents {
+			key := newEventKey(event)
+			if !seenEvents[key] {
+				seenEvents[key] = true
+				newEvents = append(newEvents, event)
+			}
+		}
+		allEvents = append(allEvents, newEvents...)
+
+		frontier = selectNextFrontier(newEvents, frontier, hopDistances, hop+1, maxFanOut, isExcluded)
+	}
+	logr.Info.Printf("Addresses found: %v\n", len(hopDistances))
+
+	// Enrichment only once all hops are known, so first-seen times span the whole trace
+	allEvents, err = extract.Enrich(ctx, evmChain, allEvents, opts)
+	if err != nil {
+		return err
+	}
+
+	// Prepare and write Graph, with hop distances on the address nodes
+	addressAttributes := make(map[common.Address]map[string]interface{}, len(hopDistances))
+	for address, hopDistance := range hopDistances {
+		addressAttributes[address] = map[string]interface{}{hopDistanceAttribute: hopDistance}
+	}
+	opts.GraphOptions.AddressAttributes = addressAttributes
+	ethGraph, _, err := extract.BuildGraph(ctx, evmChain, allEvents, opts)
+	if err != nil {
+		return err
+	}
+	filename, err := extract.WriteGraph(evmChain, ethGraph, allEvents, opts)
+	if err != nil {
+		return err
+	}
+	logRuntime(start, filename)
+	return nil
+}
+
+// eventKey uniquely identifies a movement, ERC1155 batches have many movements per log
+type eventKey struct {
+	txHash   common.Hash
+	logIndex uint
+	nftId    string
+}
+
+func newEventKey(event *chain.TransferEvent) eventKey {
+	return eventKey{txHash: event.TxHash, logIndex: event.LogIndex, nftId: event.LogNftId}
+}
+
+// selectNextFrontier records the hop distance of every new counterparty of the frontier addresses
+// found in events, and returns the counterparties to follow at the next hop. These are the
+// counterparties that are not excluded, most active first, capped at maxFanOut.
+func selectNextFrontier(
+	events []*chain.TransferEvent,
+	frontier []common.Address,
+	hopDistances map[common.Address]int,
+	hopDistance int,
+	maxFanOut int,
+	isExcluded func(address common.Address) bool) (nextFrontier []common.Address) {
+
+	inFrontier := make(map[common.Address]bool, len(frontier))
+	for _, address := range frontier {
+		inFrontier[address] = true
+	}
+
+	// Count movements per new counterparty
+	counterpartyCounts := make(map[common.Address]int)
+	countCounterparty := func(address common.Address) {
+		if _, exists := hopDistances[address]; exists {
+			if _, isNew := counterpartyCounts[address]; !isNew {
+				return
+			}
+		}
+		hopDistances[address] = hopDistance
+		counterpartyCounts[address]++
+	}
+	for _, event := range events {
+		if inFrontier[event.LogAddressFrom] {
+			countCounterparty(event.LogAddressTo)
+		}
+		if inFrontier[event.LogAddressTo] {
+			countCounterparty(event.LogAddressFrom)
+		}
+	}
+
+	for address := range counterpartyCounts {
+		if !isExcluded(address) {
+			nextFrontier = append(nextFrontier, address)
+		}
+	}
+	// Most active first, then by address so the selection is repeatable
+	sort.Slice(nextFrontier, func(i, j int) bool {
+		countI := counterpartyCounts[nextFrontier[i]]
+		countJ := counterpartyCounts[nextFrontier[j]]
+		if countI != countJ {
+			return countI > countJ
+		}
+		return nextFrontier[i].Hex() < nextFrontier[j].Hex()
+	})
+	if maxFanOut > 0 && len(nextFrontier) > maxFanOut {
+		logr.Trace.Printf("Hop %v: %v counterparties capped to %v\n", hopDistance, len(nextFrontier), maxFanOut)
+		nextFrontier = nextFrontier[:maxFanOut]
+	}
+	return nextFrontier
+}
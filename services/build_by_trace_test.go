@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/extract"
+	"github.com/KevinSmall/ethgraph/graph"
+	"github.com/ethereum/go-ethereum/common"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSelectNextFrontier(t *testing.T) {
+	seed := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	busy := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	quiet := common.HexToAddress("0x0000000000000000000000000000000000000003")
+	exchange := common.HexToAddress("0x0000000000000000000000000000000000000004")
+	other := common.HexToAddress("0x0000000000000000000000000000000000000005")
+
+	events := []*chain.TransferEvent{
+		{LogAddressFrom: seed, LogAddressTo: busy},
+		{LogAddressFrom: busy, LogAddressTo: seed},
+		{LogAddressFrom: seed, LogAddressTo: quiet},
+		{LogAddressFrom: seed, LogAddressTo: exchange},
+		{LogAddressFrom: seed, LogAddressTo: exchange},
+		{LogAddressFrom: seed, LogAddressTo: exchange},
+		// Not touching the frontier, so not a counterparty
+		{LogAddressFrom: busy, LogAddressTo: other},
+	}
+	hopDistances := map[common.Address]int{seed: 0}
+	isExcluded := func(address common.Address) bool { return address == exchange }
+
+	nextFrontier := selectNextFrontier(events, []common.Address{seed}, hopDistances, 1, 1, isExcluded)
+
+	if len(nextFrontier) != 1 || nextFrontier[0] != busy {
+		t.Errorf("expected next frontier of only the busiest counterparty, got %v", nextFrontier)
+	}
+	expectedHopDistances := map[common.Address]int{seed: 0, busy: 1, quiet: 1, exchange: 1}
+	if len(hopDistances) != len(expectedHopDistances) {
+		t.Errorf("expected %v hop distances, got %v", len(expectedHopDistances), len(hopDistances))
+	}
+	for address, expected := range expectedHopDistances {
+		if actual, exists := hopDistances[address]; !exists || actual != expected {
+			t.Errorf("expected hop distance %v for %s, got %v", expected, address.Hex(), actual)
+		}
+	}
+}
+
+// TestWriteOptionsCheckedFirst checks that a graph file that cannot be written is refused
+// before any call to chain
+func TestWriteOptionsCheckedFirst(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name  string
+		build func(opts extract.Options) error
+	}{
+		{"trace", func(opts extract.Options) error {
+			return BuildByTrace(context.Background(), []string{"0x0000000000000000000000000000000000000001"}, 1, 1, nil, opts)
+		}},
+		{"transactions", func(opts extract.Options) error {
+			return BuildByTransactions(context.Background(), []string{"0x01"}, opts)
+		}},
+		{"follow", func(opts extract.Options) error {
+			return BuildByFollow(context.Background(), 0, time.Millisecond, time.Millisecond, 1, opts)
+		}},
+	}
+	for _, tc := range testCases {
+		for _, writeOptions := range []graph.WriteOptions{{Format: "svg"}, {Format: graph.FormatParquet}} {
+			writeOptions.Parquet.Compression = "lzo"
+			err := tc.build(extract.Options{Urls: []string{server.URL}, WriteOptions: writeOptions})
+			if err == nil {
+				t.Errorf("%s: expected an error for %+v", tc.name, writeOptions)
+			}
+		}
+		if calls != 0 {
+			t.Errorf("%s: expected no calls to chain, got %v", tc.name, calls)
+		}
+	}
+}
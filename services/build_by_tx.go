@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"github.com/KevinSmall/ethgraph/extract"
+	"github.com/ethereum/go-ethereum/common"
+	"time"
+)
+
+// BuildByTransactions is entry point for building graph of the token movements in a list of
+// transactions. The transfer events are read from the transaction receipts, and selected by the
+// filter of opts, the block range of opts is not used.
+func BuildByTransactions(ctx context.Context, txHashes []string, opts extract.Options) error {
+	start := time.Now()
+	if err := extract.CheckWriteOptions(opts.WriteOptions); err != nil {
+		return err
+	}
+
+	// Client
+	evmChain, err := extract.Connect(ctx, opts.Urls, opts.Dial)
+	if err != nil {
+		return err
+	}
+	defer evmChain.Close()
+	opts.NoEventStore = true
+	extract.LoadMasterData(evmChain, &opts)
+
+	// Prepare []allEvents, with the same enrichment as any other selection
+	hashes := make([]common.Hash, 0, len(txHashes))
+	for _, txHash := range txHashes {
+		hashes = append(hashes, common.HexToHash(txHash))
+	}
+	allEvents, err := extract.FetchEventsByTransactions(ctx, evmChain, hashes, opts)
+	if err != nil {
+		return err
+	}
+	allEvents, err = extract.Enrich(ctx, evmChain, allEvents, opts)
+	if err != nil {
+		return err
+	}
+
+	// Prepare and write Graph
+	ethGraph, _, err := extract.BuildGraph(ctx, evmChain, allEvents, opts)
+	if err != nil {
+		return err
+	}
+	filename, err := extract.WriteGraph(evmChain, ethGraph, allEvents, opts)
+	if err != nil {
+		return err
+	}
+	logRuntime(start, filename)
+	return nil
+}
@@ -1,8 +1,10 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/extract"
 	"github.com/KevinSmall/ethgraph/logr"
 	"github.com/KevinSmall/ethgraph/masterdata/tokens"
 	"strconv"
@@ -11,30 +13,25 @@ import (
 
 const destinationFilenameTemplate string = "masterdata/tokens/data/tokens_%s_working.csv"
 
-func BuildMasterData(url string, blockFrom uint64, blockTo uint64) {
+// BuildMasterData writes a file of the token master data of every token with transfer events
+// in the block range, read from the chain at urls, calling it as dialOptions says
+func BuildMasterData(ctx context.Context, urls []string, blockFrom uint64, blockTo uint64, batchSize int,
+	dialOptions chain.DialOptions) error {
 	start := time.Now()
 
-	evmChain, err := chain.CreateEvmClient(url)
+	evmChain, err := extract.Connect(ctx, urls, dialOptions)
 	if err != nil {
-		logr.Error.Panicln(err)
+		return err
 	}
-	logr.Info.Printf("Connecting to: %s with ChainId: %s", evmChain.Name, evmChain.ChainId)
-
-	// Prepare master data lookups
-	tokens.Init(evmChain.ChainId)
+	defer evmChain.Close()
 
 	//-------------------------------------------------------------------------
 	// GET EVENTS
 	//-------------------------------------------------------------------------
-	var allEvents []*chain.TransferEvent
-	blockCount := int(blockTo-blockFrom) + 1
-	for i := 0; i < blockCount; i++ {
-		events, err := chain.GetTransferEventsByBlock(evmChain.Client, blockFrom, "")
-		if err != nil {
-			logr.Error.Panicln(err)
-		}
-		blockFrom++
-		allEvents = append(allEvents, events...)
+	fetcher := chain.NewRangeFetcher(evmChain.Client, chain.TransferFilter{})
+	allEvents, err := fetcher.FetchEvents(ctx, blockFrom, blockTo)
+	if err != nil {
+		return err
 	}
 	logr.Info.Printf("Total events: %v", len(allEvents))
 
@@ -56,25 +53,38 @@ func BuildMasterData(url string, blockFrom uint64, blockTo uint64) {
 
 	// Iterate through the unique addresses and get the token information for each address
 	logr.Info.Printf("Unique token addresses: %d\n", len(uniqueTokenAddresses))
-	chunkSize := (len(uniqueTokenAddresses) / 100) + 1
-	i := 0
-	for _, a := range uniqueTokenAddresses {
-		if i%chunkSize == 0 {
-			// Calculate the current progress as a percentage
-			progress := ((i * 100) / len(uniqueTokenAddresses)) + 1
+	resolver, err := tokens.NewTokenResolver(ctx, evmChain.Client)
+	if err != nil {
+		return err
+	}
+	if batchSize <= 0 {
+		batchSize = chain.DefaultBatchSize
+	}
+	for i := 0; i < len(uniqueTokenAddresses); i += batchSize {
+		// PrintSummary out the progress as a percentage
+		progress := ((i * 100) / len(uniqueTokenAddresses)) + 1
+		logr.Info.Printf("Progress: %d%%\n", progress)
 
-			// PrintSummary out the progress as a percentage
-			logr.Info.Printf("Progress: %d%%\n", progress)
+		batchEnd := i + batchSize
+		if batchEnd > len(uniqueTokenAddresses) {
+			batchEnd = len(uniqueTokenAddresses)
+		}
+		var batch []tokens.TokenToRead
+		for _, a := range uniqueTokenAddresses[i:batchEnd] {
+			batch = append(batch, tokens.TokenToRead{Address: a.Address, TransferType: a.TransferType})
+		}
+		tokensData, err := resolver.GetTokens(ctx, evmChain.ChainId, batch, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, tokenData := range tokensData {
+			tokenInfo = append(tokenInfo, []string{
+				evmChain.ChainId,
+				tokenData.Name,
+				tokenData.Symbol,
+				strconv.Itoa(tokenData.Decimals),
+				tokenData.TokenAddress})
 		}
-
-		tokenData := tokens.GetTokenFromChain(evmChain.ChainId, evmChain.Client, a.Address, a.TransferType)
-		tokenInfo = append(tokenInfo, []string{
-			evmChain.ChainId,
-			tokenData.Name,
-			tokenData.Symbol,
-			strconv.Itoa(tokenData.Decimals),
-			tokenData.TokenAddress})
-		i++
 	}
 	// tokenInfo is built
 
@@ -82,9 +92,13 @@ func BuildMasterData(url string, blockFrom uint64, blockTo uint64) {
 	// WRITE THE FILE
 	//-------------------------------------------------------------------------
 	filename := fmt.Sprintf(destinationFilenameTemplate, evmChain.ChainId)
-	tokens.WriteTokenInfoToFile(filename, tokenInfo)
+	err = tokens.WriteTokenInfoToFile(filename, tokenInfo)
+	if err != nil {
+		return err
+	}
 
 	logr.Info.Println("Tokens written: ", len(tokenInfo), " to file: ", filename)
 	elapsed := time.Since(start)
 	logr.Info.Printf("Runtime: %s", elapsed)
+	return nil
 }
@@ -0,0 +1,16 @@
+package services
+
+import (
+	"context"
+	"github.com/KevinSmall/ethgraph/extract"
+	"time"
+)
+
+// ExportEventsByBlockRange is entry point for exporting the transfer events of a block range
+// as a table rather than a graph, in format, one of the extract.EventFormat values, with
+// opts.WriteOptions.Parquet for Parquet. opts is as for BuildByBlockRange.
+func ExportEventsByBlockRange(ctx context.Context, opts extract.Options, format string) error {
+	start := time.Now()
+	result, err := extract.ExportEvents(ctx, opts, format)
+	return logRunResult(start, result, err)
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/conv"
+	"github.com/KevinSmall/ethgraph/extract"
+	"github.com/KevinSmall/ethgraph/logr"
+	"time"
+)
+
+// GetLatestBlockNumber logs the latest block number of the chain at urls, calling it as
+// dialOptions says
+func GetLatestBlockNumber(ctx context.Context, urls []string, dialOptions chain.DialOptions) error {
+	start := time.Now()
+
+	evmChain, err := extract.Connect(ctx, urls, dialOptions)
+	if err != nil {
+		return err
+	}
+	defer evmChain.Close()
+
+	// PrintSummary the latest block number.
+	logr.Info.Println("Latest block number: ", conv.PrettyBlockNumberWithUnderscores(evmChain.LatestBlockNumber))
+
+	elapsed := time.Since(start)
+	logr.Info.Printf("Runtime: %s", elapsed)
+	return nil
+}
@@ -0,0 +1,305 @@
+// Package store holds transfer events and block master data read from chain in a local file
+// per chainId, along with which block ranges have been read completely for each filter, so that
+// reruns only read the blocks not seen before.
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/blocks"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/ethereum/go-ethereum/common"
+	bolt "go.etcd.io/bbolt"
+	"math/big"
+	"time"
+)
+
+var eventsBucket = []byte("events")
+var blocksBucket = []byte("blocks")
+var rangesBucket = []byte("ranges")
+
+// openTimeout is how long to wait for another ethgraph process to release the store file
+const openTimeout = time.Second * 5
+
+// EventStore is the local store of transfer events for one chain
+type EventStore struct {
+	db *bolt.DB
+}
+
+// storedEvent is the part of a TransferEvent read from chain, the enrichment fields are
+// recalculated for each graph so are not stored
+type storedEvent struct {
+	BlockNumber       uint64
+	BlockHash         common.Hash
+	TxHash            common.Hash
+	TxIndex           uint
+	TransferType      string
+	LogIndex          uint
+	LogAddressFrom    common.Address
+	LogAddressTo      common.Address
+	LogTokenValue     string
+	LogNftId          string
+	LogOperator       common.Address
+	LogEmitterAddress common.Address
+}
+
+// storedBlock is the block master data
+type storedBlock struct {
+	BlockTimestamp   int64
+	TransactionCount uint
+}
+
+// Open opens the store file for chainId, creating it if it does not exist yet
+func Open(chainId string) (*EventStore, error) {
+	db, err := bolt.Open(getStoreFilename(chainId), 0644, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{eventsBucket, blocksBucket, rangesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &EventStore{db: db}, nil
+}
+
+// Close closes the store file
+func (s *EventStore) Close() error {
+	return s.db.Close()
+}
+
+// MissingRanges returns the parts of the block range [blockFrom, blockTo] not yet read
+// completely for the filter. Ranges read for all events count for every filter.
+func (s *EventStore) MissingRanges(filter chain.TransferFilter, blockFrom uint64, blockTo uint64) ([]BlockRange, error) {
+	var completed []BlockRange
+	err := s.db.View(func(tx *bolt.Tx) error {
+		filterKeys := []string{chain.TransferFilter{}.Key()}
+		if !filter.IsAll() {
+			filterKeys = append(filterKeys, filter.Key())
+		}
+		for _, filterKey := range filterKeys {
+			filterRanges, err := readRanges(tx, filterKey)
+			if err != nil {
+				return err
+			}
+			completed = append(completed, filterRanges...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return MissingRanges(completed, BlockRange{From: blockFrom, To: blockTo}), nil
+}
+
+// SaveRange stores the events and block master data read from chain for the block range,
+// and records the range as read completely for the filter. It is all or nothing, so an
+// interrupted run never leaves a range recorded with events missing.
+func (s *EventStore) SaveRange(filter chain.TransferFilter, blockRange BlockRange,
+	events []*chain.TransferEvent, blocksMap blocks.BlockMap) error {
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		// Events of an ERC1155 batch share a log, so are told apart by their position in it
+		eventsBkt := tx.Bucket(eventsBucket)
+		var previousLog [2]uint64
+		position := uint32(0)
+		for _, event := range events {
+			thisLog := [2]uint64{event.BlockNumber, uint64(event.LogIndex)}
+			if thisLog == previousLog {
+				position++
+			} else {
+				position = 0
+			}
+			previousLog = thisLog
+
+			value, err := json.Marshal(newStoredEvent(event))
+			if err != nil {
+				return err
+			}
+			if err = eventsBkt.Put(eventKey(event.BlockNumber, event.LogIndex, position), value); err != nil {
+				return err
+			}
+		}
+
+		blocksBkt := tx.Bucket(blocksBucket)
+		for blockKey, blockMapValue := range blocksMap {
+			value, err := json.Marshal(storedBlock{
+				BlockTimestamp:   blockMapValue.BlockTimestamp.Unix(),
+				TransactionCount: blockMapValue.TransactionCount,
+			})
+			if err != nil {
+				return err
+			}
+			if err = blocksBkt.Put(uint64ToBytes(blockKey.BlockNumber), value); err != nil {
+				return err
+			}
+		}
+
+		filterRanges, err := readRanges(tx, filter.Key())
+		if err != nil {
+			return err
+		}
+		return writeRanges(tx, filter.Key(), MergeRanges(append(filterRanges, blockRange)))
+	})
+}
+
+// GetEvents returns the stored events in the block range [blockFrom, blockTo] that match the
+// filter, in block and log order
+func (s *EventStore) GetEvents(filter chain.TransferFilter, blockFrom uint64, blockTo uint64) (
+	events []*chain.TransferEvent, err error) {
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(eventsBucket).Cursor()
+		for key, value := cursor.Seek(uint64ToBytes(blockFrom)); key != nil; key, value = cursor.Next() {
+			if binary.BigEndian.Uint64(key[:8]) > blockTo {
+				break
+			}
+			var stored storedEvent
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return err
+			}
+			event, err := stored.toTransferEvent()
+			if err != nil {
+				return err
+			}
+			if filter.MatchesEvent(event) {
+				events = append(events, event)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetBlocks returns the stored block master data for those blocks of blocksMap that are in the
+// store, blocks not in the store are left out
+func (s *EventStore) GetBlocks(blocksMap blocks.BlockMap) (storedBlocksMap blocks.BlockMap, err error) {
+	storedBlocksMap = make(blocks.BlockMap)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		blocksBkt := tx.Bucket(blocksBucket)
+		for blockKey := range blocksMap {
+			value := blocksBkt.Get(uint64ToBytes(blockKey.BlockNumber))
+			if value == nil {
+				continue
+			}
+			var stored storedBlock
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return err
+			}
+			storedBlocksMap[blockKey] = blocks.BlockMapValue{
+				BlockTimestamp:   time.Unix(stored.BlockTimestamp, 0),
+				TransactionCount: stored.TransactionCount,
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return storedBlocksMap, nil
+}
+
+func newStoredEvent(event *chain.TransferEvent) storedEvent {
+	return storedEvent{
+		BlockNumber:       event.BlockNumber,
+		BlockHash:         event.BlockHash,
+		TxHash:            event.TxHash,
+		TxIndex:           event.TxIndex,
+		TransferType:      event.TransferType,
+		LogIndex:          event.LogIndex,
+		LogAddressFrom:    event.LogAddressFrom,
+		LogAddressTo:      event.LogAddressTo,
+		LogTokenValue:     event.LogTokenValue.String(),
+		LogNftId:          event.LogNftId,
+		LogOperator:       event.LogOperator,
+		LogEmitterAddress: event.LogEmitterAddress,
+	}
+}
+
+func (stored storedEvent) toTransferEvent() (*chain.TransferEvent, error) {
+	value, ok := new(big.Int).SetString(stored.LogTokenValue, 10)
+	if !ok {
+		return nil, fmt.Errorf("stored event value %s in block %v is not a number", stored.LogTokenValue, stored.BlockNumber)
+	}
+	return &chain.TransferEvent{
+		BlockNumber:       stored.BlockNumber,
+		BlockHash:         stored.BlockHash,
+		TxHash:            stored.TxHash,
+		TxIndex:           stored.TxIndex,
+		TransferType:      stored.TransferType,
+		LogIndex:          stored.LogIndex,
+		LogAddressFrom:    stored.LogAddressFrom,
+		LogAddressTo:      stored.LogAddressTo,
+		LogTokenValue:     *value,
+		LogNftId:          stored.LogNftId,
+		LogOperator:       stored.LogOperator,
+		LogEmitterAddress: stored.LogEmitterAddress,
+	}, nil
+}
+
+// eventKey sorts events by block then log, the log index is unique within a block
+func eventKey(blockNumber uint64, logIndex uint, position uint32) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[0:8], blockNumber)
+	binary.BigEndian.PutUint32(key[8:12], uint32(logIndex))
+	binary.BigEndian.PutUint32(key[12:16], position)
+	return key
+}
+
+func uint64ToBytes(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	return b
+}
+
+// readRanges reads the completed ranges for a filter, each stored as from block key to to block value
+func readRanges(tx *bolt.Tx, filterKey string) ([]BlockRange, error) {
+	filterBkt := tx.Bucket(rangesBucket).Bucket([]byte(filterKey))
+	if filterBkt == nil {
+		return nil, nil
+	}
+	var blockRanges []BlockRange
+	err := filterBkt.ForEach(func(key []byte, value []byte) error {
+		blockRanges = append(blockRanges, BlockRange{
+			From: binary.BigEndian.Uint64(key),
+			To:   binary.BigEndian.Uint64(value),
+		})
+		return nil
+	})
+	return blockRanges, err
+}
+
+// writeRanges replaces the completed ranges for a filter
+func writeRanges(tx *bolt.Tx, filterKey string, blockRanges []BlockRange) error {
+	rangesBkt := tx.Bucket(rangesBucket)
+	if rangesBkt.Bucket([]byte(filterKey)) != nil {
+		if err := rangesBkt.DeleteBucket([]byte(filterKey)); err != nil {
+			return err
+		}
+	}
+	filterBkt, err := rangesBkt.CreateBucket([]byte(filterKey))
+	if err != nil {
+		return err
+	}
+	for _, blockRange := range blockRanges {
+		if err = filterBkt.Put(uint64ToBytes(blockRange.From), uint64ToBytes(blockRange.To)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getStoreFilename(chainId string) string {
+	return fmt.Sprintf(".events_%s_store.db", chainId)
+}
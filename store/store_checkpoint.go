@@ -0,0 +1,191 @@
+package store
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/logr"
+	"os"
+	"sync"
+)
+
+// Checkpoint records the events of each window of blocks as soon as it is read from chain, in
+// a file per chainId, filter and block range. If a run dies part way through a long block
+// range, the next run for the same filter and block range can resume, only reading the blocks
+// not recorded.
+type Checkpoint struct {
+	filename string
+	file     *os.File
+	lock     sync.Mutex
+
+	// completed and events are those recorded by an earlier run that was resumed
+	completed []BlockRange
+	events    []*chain.TransferEvent
+}
+
+// checkpointHeader is the first line of the checkpoint file
+type checkpointHeader struct {
+	FilterKey string
+}
+
+// checkpointWindow is every other line of the checkpoint file, one per window of blocks read
+type checkpointWindow struct {
+	From   uint64
+	To     uint64
+	Events []storedEvent
+}
+
+// OpenCheckpoint starts a checkpoint for reading events that match the filter from chainId in
+// the block range [blockFrom, blockTo]. If resume is true, the windows recorded by an earlier
+// run for the same filter and block range are kept, else its checkpoint is discarded. Runs for
+// other filters or block ranges have checkpoints of their own, and are not affected.
+func OpenCheckpoint(chainId string, filter chain.TransferFilter, blockFrom uint64, blockTo uint64, resume bool) (
+	*Checkpoint, error) {
+
+	checkpoint := &Checkpoint{filename: getCheckpointFilename(chainId, filter, blockFrom, blockTo)}
+
+	var keptWindows []checkpointWindow
+	_, err := os.Stat(checkpoint.filename)
+	if err == nil {
+		if resume {
+			keptWindows, err = readCheckpoint(checkpoint.filename, filter.Key())
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			logr.Warning.Printf("An earlier run was interrupted, its progress in %s is discarded. Use --resume to continue it.\n", checkpoint.filename)
+		}
+	}
+
+	for _, window := range keptWindows {
+		checkpoint.completed = append(checkpoint.completed, BlockRange{From: window.From, To: window.To})
+		for _, stored := range window.Events {
+			event, err := stored.toTransferEvent()
+			if err != nil {
+				return nil, err
+			}
+			checkpoint.events = append(checkpoint.events, event)
+		}
+	}
+
+	// The file is rewritten with only the windows kept, so a partly written last line from a
+	// run that died is dropped
+	checkpoint.file, err = os.Create(checkpoint.filename)
+	if err != nil {
+		return nil, err
+	}
+	err = checkpoint.writeLine(checkpointHeader{FilterKey: filter.Key()})
+	if err != nil {
+		checkpoint.Close()
+		return nil, err
+	}
+	for _, window := range keptWindows {
+		if err = checkpoint.writeLine(window); err != nil {
+			checkpoint.Close()
+			return nil, err
+		}
+	}
+	return checkpoint, nil
+}
+
+// readCheckpoint reads the windows recorded in an earlier checkpoint file, if it was for the same filter
+func readCheckpoint(filename string, filterKey string) ([]checkpointWindow, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 256*1024*1024)
+	if !scanner.Scan() {
+		return nil, scanner.Err()
+	}
+	var header checkpointHeader
+	if err = json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, fmt.Errorf("checkpoint file %s is not valid, try deleting it: %w", filename, err)
+	}
+	if header.FilterKey != filterKey {
+		logr.Warning.Printf("The checkpoint in %s is for different filters, it is discarded\n", filename)
+		return nil, nil
+	}
+
+	var windows []checkpointWindow
+	for scanner.Scan() {
+		var window checkpointWindow
+		if err = json.Unmarshal(scanner.Bytes(), &window); err != nil {
+			// The run died while writing this line
+			logr.Trace.Printf("Checkpoint %s ends with a partly written line\n", filename)
+			break
+		}
+		windows = append(windows, window)
+	}
+	return windows, scanner.Err()
+}
+
+// Record records the events of a window of blocks read from chain. It is safe for concurrent use.
+func (c *Checkpoint) Record(blockFrom uint64, blockTo uint64, events []*chain.TransferEvent) error {
+	window := checkpointWindow{From: blockFrom, To: blockTo, Events: make([]storedEvent, 0, len(events))}
+	for _, event := range events {
+		window.Events = append(window.Events, newStoredEvent(event))
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.writeLine(window)
+}
+
+// writeLine writes a line straight to the file, unbuffered, so it survives the process dying
+func (c *Checkpoint) writeLine(line interface{}) error {
+	b, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = c.file.Write(append(b, '\n'))
+	return err
+}
+
+// CompletedRanges returns the block ranges already read by the earlier run that was resumed
+func (c *Checkpoint) CompletedRanges() []BlockRange {
+	return c.completed
+}
+
+// Events returns the events already read by the earlier run that was resumed, in the block
+// range [blockFrom, blockTo]
+func (c *Checkpoint) Events(blockFrom uint64, blockTo uint64) []*chain.TransferEvent {
+	var events []*chain.TransferEvent
+	for _, event := range c.events {
+		if event.BlockNumber >= blockFrom && event.BlockNumber <= blockTo {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Close closes the checkpoint file and keeps it, so a later run can resume. Closing a
+// checkpoint already closed or removed does nothing.
+func (c *Checkpoint) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+// Remove closes and deletes the checkpoint file, once everything it recorded is safely stored
+func (c *Checkpoint) Remove() error {
+	if err := c.Close(); err != nil {
+		return err
+	}
+	return os.Remove(c.filename)
+}
+
+// getCheckpointFilename returns the checkpoint file of a run, the filter key is hashed as it
+// can list many addresses
+func getCheckpointFilename(chainId string, filter chain.TransferFilter, blockFrom uint64, blockTo uint64) string {
+	hash := sha256.Sum256([]byte(filter.Key()))
+	return fmt.Sprintf(".checkpoint_%s_%d_%d_%s.jsonl", chainId, blockFrom, blockTo, hex.EncodeToString(hash[:4]))
+}
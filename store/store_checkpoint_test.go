@@ -0,0 +1,131 @@
+package store
+
+import (
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"os"
+	"testing"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workingDir)
+
+	filter := chain.TransferFilter{}
+	checkpoint, err := OpenCheckpoint("1", filter, 100, 199, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := big.NewInt(1000)
+	err = checkpoint.Record(100, 109, []*chain.TransferEvent{{BlockNumber: 105, LogTokenValue: *value}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The run dies
+	checkpoint.file.Close()
+
+	resumed, err := OpenCheckpoint("1", filter, 100, 199, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed := resumed.CompletedRanges()
+	if len(completed) != 1 || completed[0] != (BlockRange{100, 109}) {
+		t.Errorf("expected completed range 100-109, got %v", completed)
+	}
+	events := resumed.Events(100, 200)
+	if len(events) != 1 || events[0].LogTokenValue.Cmp(value) != 0 {
+		t.Errorf("expected 1 resumed event with value %s, got %v", value, events)
+	}
+	if len(resumed.Events(106, 200)) != 0 {
+		t.Errorf("expected no resumed events outside the block range")
+	}
+	if err = resumed.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Runs of a different filter or block range do not resume it, nor discard it
+	walletFilter := chain.TransferFilter{WalletAddresses: []common.Address{common.BigToAddress(big.NewInt(42))}}
+	testCases := []struct {
+		filter    chain.TransferFilter
+		blockFrom uint64
+		blockTo   uint64
+	}{
+		{walletFilter, 100, 199},
+		{filter, 100, 299},
+	}
+	for _, tc := range testCases {
+		otherCheckpoint, err := OpenCheckpoint("1", tc.filter, tc.blockFrom, tc.blockTo, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(otherCheckpoint.CompletedRanges()) != 0 {
+			t.Errorf("expected nothing resumed for filter %s blocks %v-%v, got %v", tc.filter.Key(), tc.blockFrom,
+				tc.blockTo, otherCheckpoint.CompletedRanges())
+		}
+		if err = otherCheckpoint.Remove(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resumed, err = OpenCheckpoint("1", filter, 100, 199, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed = resumed.CompletedRanges(); len(completed) != 1 {
+		t.Errorf("expected completed range 100-109 kept after other runs, got %v", completed)
+	}
+
+	err = resumed.Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(getCheckpointFilename("1", filter, 100, 199)); !os.IsNotExist(err) {
+		t.Errorf("expected checkpoint file removed")
+	}
+	if err = resumed.Close(); err != nil {
+		t.Errorf("expected closing a removed checkpoint to do nothing, got %v", err)
+	}
+}
+
+func TestCheckpointDropsPartlyWrittenLine(t *testing.T) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workingDir)
+
+	checkpoint, err := OpenCheckpoint("1", chain.TransferFilter{}, 120, 139, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkpoint.Record(120, 129, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = checkpoint.file.WriteString(`{"From":130,"To":13`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint.file.Close()
+
+	resumed, err := OpenCheckpoint("1", chain.TransferFilter{}, 120, 139, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Remove()
+	completed := resumed.CompletedRanges()
+	if len(completed) != 1 || completed[0] != (BlockRange{120, 129}) {
+		t.Errorf("expected only completed range 120-129, got %v", completed)
+	}
+}
@@ -0,0 +1,55 @@
+package store
+
+import "sort"
+
+// BlockRange is the blocks from From to To inclusive
+type BlockRange struct {
+	From uint64
+	To   uint64
+}
+
+// MergeRanges returns the ranges sorted, with overlapping and adjacent ranges merged into one
+func MergeRanges(blockRanges []BlockRange) []BlockRange {
+	if len(blockRanges) == 0 {
+		return nil
+	}
+	sorted := make([]BlockRange, len(blockRanges))
+	copy(sorted, blockRanges)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].From < sorted[j].From
+	})
+
+	merged := []BlockRange{sorted[0]}
+	for _, blockRange := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if blockRange.From <= last.To+1 {
+			if blockRange.To > last.To {
+				last.To = blockRange.To
+			}
+		} else {
+			merged = append(merged, blockRange)
+		}
+	}
+	return merged
+}
+
+// MissingRanges returns the parts of wanted that are not in any of the completed ranges
+func MissingRanges(completed []BlockRange, wanted BlockRange) (missing []BlockRange) {
+	next := wanted.From
+	for _, blockRange := range MergeRanges(completed) {
+		if blockRange.To < next {
+			continue
+		}
+		if blockRange.From > wanted.To {
+			break
+		}
+		if blockRange.From > next {
+			missing = append(missing, BlockRange{From: next, To: blockRange.From - 1})
+		}
+		if blockRange.To >= wanted.To {
+			return missing
+		}
+		next = blockRange.To + 1
+	}
+	return append(missing, BlockRange{From: next, To: wanted.To})
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeRanges(t *testing.T) {
+	merged := MergeRanges([]BlockRange{{20, 30}, {1, 5}, {6, 10}, {25, 40}, {50, 50}})
+	expected := []BlockRange{{1, 10}, {20, 40}, {50, 50}}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %v, got %v", expected, merged)
+	}
+}
+
+func TestMissingRanges(t *testing.T) {
+	completed := []BlockRange{{10, 19}, {30, 39}}
+	testCases := []struct {
+		wanted   BlockRange
+		expected []BlockRange
+	}{
+		{BlockRange{0, 50}, []BlockRange{{0, 9}, {20, 29}, {40, 50}}},
+		{BlockRange{12, 15}, nil},
+		{BlockRange{15, 35}, []BlockRange{{20, 29}}},
+		{BlockRange{40, 45}, []BlockRange{{40, 45}}},
+		{BlockRange{0, 5}, []BlockRange{{0, 5}}},
+	}
+	for _, tc := range testCases {
+		missing := MissingRanges(completed, tc.wanted)
+		if !reflect.DeepEqual(missing, tc.expected) {
+			t.Errorf("MissingRanges(%v) expected %v, got %v", tc.wanted, tc.expected, missing)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"github.com/KevinSmall/ethgraph/blocks"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *EventStore {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(workingDir) })
+
+	eventStore, err := Open("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eventStore.Close() })
+	return eventStore
+}
+
+func TestEventStoreRoundTrip(t *testing.T) {
+	eventStore := openTestStore(t)
+	wallet := common.HexToAddress("0x71660c4005BA85c37ccec55d0C4493E66Fe775d3")
+	other := common.BigToAddress(big.NewInt(42))
+	value, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	events := []*chain.TransferEvent{
+		{BlockNumber: 101, LogIndex: 3, TransferType: chain.ERC20, LogAddressFrom: wallet, LogAddressTo: other, LogTokenValue: *value},
+		// Two movements of an ERC1155 batch share a log
+		{BlockNumber: 105, LogIndex: 1, TransferType: chain.ERC1155_BATCH, LogAddressFrom: other, LogAddressTo: other, LogNftId: "7"},
+		{BlockNumber: 105, LogIndex: 1, TransferType: chain.ERC1155_BATCH, LogAddressFrom: other, LogAddressTo: other, LogNftId: "8"},
+	}
+	blockTime := time.Unix(1678752000, 0)
+	blocksMap := blocks.BlockMap{
+		{BlockNumber: 101}: {BlockTimestamp: blockTime, TransactionCount: 10},
+		{BlockNumber: 105}: {BlockTimestamp: blockTime.Add(48 * time.Second), TransactionCount: 20},
+	}
+
+	err := eventStore.SaveRange(chain.TransferFilter{}, BlockRange{100, 110}, events, blocksMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The unfiltered range counts for any filter
+	walletFilter := chain.TransferFilter{WalletAddresses: []common.Address{wallet}}
+	missing, err := eventStore.MissingRanges(walletFilter, 95, 115)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 2 || missing[0] != (BlockRange{95, 99}) || missing[1] != (BlockRange{111, 115}) {
+		t.Errorf("expected missing ranges 95-99 and 111-115, got %v", missing)
+	}
+
+	storedEvents, err := eventStore.GetEvents(chain.TransferFilter{}, 100, 110)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(storedEvents) != 3 {
+		t.Fatalf("expected 3 events, got %v", len(storedEvents))
+	}
+	if storedEvents[0].LogTokenValue.Cmp(value) != 0 {
+		t.Errorf("expected value %s, got %s", value, storedEvents[0].LogTokenValue.String())
+	}
+	if storedEvents[2].LogNftId != "8" {
+		t.Errorf("expected second batch movement to keep its nft id, got %s", storedEvents[2].LogNftId)
+	}
+	wantedBlocksMap := blocks.BuildUniqueBlocksFromEvents(storedEvents)
+	wantedBlocksMap[blocks.BlockKey{BlockNumber: 200}] = blocks.BlockMapValue{}
+	storedBlocksMap, err := eventStore.GetBlocks(wantedBlocksMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !storedBlocksMap[blocks.BlockKey{BlockNumber: 105}].BlockTimestamp.Equal(blockTime.Add(48 * time.Second)) {
+		t.Errorf("expected block 105 timestamp restored, got %v", storedBlocksMap[blocks.BlockKey{BlockNumber: 105}])
+	}
+	if _, exists := storedBlocksMap[blocks.BlockKey{BlockNumber: 200}]; exists {
+		t.Errorf("expected block 200 not in store")
+	}
+
+	// Filtering is done locally
+	walletEvents, err := eventStore.GetEvents(walletFilter, 100, 110)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(walletEvents) != 1 {
+		t.Errorf("expected 1 event for wallet, got %v", len(walletEvents))
+	}
+}
+
+func TestEventStoreRangesArePerFilter(t *testing.T) {
+	eventStore := openTestStore(t)
+	walletFilter := chain.TransferFilter{WalletAddresses: []common.Address{common.BigToAddress(big.NewInt(42))}}
+
+	err := eventStore.SaveRange(walletFilter, BlockRange{100, 110}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A wallet filter range does not count for all events
+	missing, err := eventStore.MissingRanges(chain.TransferFilter{}, 100, 110)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0] != (BlockRange{100, 110}) {
+		t.Errorf("expected all of 100-110 missing for all events, got %v", missing)
+	}
+	missing, err = eventStore.MissingRanges(walletFilter, 100, 110)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("expected nothing missing for wallet filter, got %v", missing)
+	}
+}
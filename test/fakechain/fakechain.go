@@ -0,0 +1,452 @@
+// Package fakechain is a stand-in for the JSON-RPC endpoint of an EVM chain. Instead of reading
+// a real chain it generates ERC20, ERC721 and ERC1155 transfers from a seed, the same seed always
+// giving the same chain, so large-scale behaviour can be tested and benchmarked without a provider.
+package fakechain
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"math/rand"
+	"sync"
+)
+
+// Address prefixes, the first byte of the addresses of the wallets and token contracts of the
+// chain, the last 8 bytes are their index
+const (
+	walletPrefix  byte = 0xbb
+	erc20Prefix   byte = 0x20
+	erc721Prefix  byte = 0x72
+	erc1155Prefix byte = 0x11
+)
+
+// maxNftId is one more than the highest ERC721 and ERC1155 id transferred
+const maxNftId = 10_000
+
+var transferTopic = common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+var transferSingleTopic = common.HexToHash("0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62")
+var transferBatchTopic = common.HexToHash("0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb")
+
+// transferBatchData is the (uint256[] ids, uint256[] values) data of a TransferBatch log
+var transferBatchData abi.Arguments
+
+func init() {
+	uint256Array, err := abi.NewType("uint256[]", "", nil)
+	if err != nil {
+		panic(err)
+	}
+	transferBatchData = abi.Arguments{{Type: uint256Array}, {Type: uint256Array}}
+}
+
+// Config says what the chain looks like and how its transfers are distributed. Shares are
+// probabilities between 0 and 1.
+type Config struct {
+	// Seed the transfers are generated from, the same seed always gives the same transfers
+	Seed int64
+
+	// ChainId reported by eth_chainId and net_version
+	ChainId uint64
+
+	// LatestBlock is the number of the latest block, blocks 0 to LatestBlock exist
+	LatestBlock uint64
+
+	// TransfersPerBlock is the number of transfer logs in every block, each in its own transaction.
+	// A TransferBatch log is one log but as many transfer events as it has ids.
+	TransfersPerBlock int
+
+	// Wallets is the number of wallet addresses transfers are between
+	Wallets int
+
+	// Hubs is the number of wallets, the first ones, that are hubs such as exchanges
+	Hubs int
+
+	// HubShare is the share of from and to addresses that are a hub rather than any wallet
+	HubShare float64
+
+	// MintShare is the share of transfers from the zero address
+	MintShare float64
+
+	// Tokens is the number of token contracts of each of ERC20, ERC721 and ERC1155
+	Tokens int
+
+	// Erc721Share and Erc1155Share are the shares of transfers of those standards, the rest are ERC20
+	Erc721Share  float64
+	Erc1155Share float64
+
+	// BatchShare is the share of ERC1155 transfers that are a TransferBatch rather than a TransferSingle
+	BatchShare float64
+
+	// MaxBatchLength is the most ids in a TransferBatch, there are always at least 2
+	MaxBatchLength int
+
+	// GenesisTime is the unix time of block 0, and BlockTime the seconds between blocks
+	GenesisTime uint64
+	BlockTime   uint64
+
+	// MaxLogsPerQuery is the most logs one eth_getLogs returns, beyond that the query is refused
+	// like providers do. 0 means no limit.
+	MaxLogsPerQuery int
+}
+
+// DefaultConfig returns a chain of 100 transfers a block between 10,000 wallets, a fifth of them
+// to or from 10 hubs
+func DefaultConfig() Config {
+	return Config{
+		Seed:              1,
+		ChainId:           1337,
+		LatestBlock:       100_000,
+		TransfersPerBlock: 100,
+		Wallets:           10_000,
+		Hubs:              10,
+		HubShare:          0.2,
+		MintShare:         0.05,
+		Tokens:            20,
+		Erc721Share:       0.2,
+		Erc1155Share:      0.1,
+		BatchShare:        0.3,
+		MaxBatchLength:    5,
+		GenesisTime:       1_600_000_000,
+		BlockTime:         12,
+		MaxLogsPerQuery:   10_000,
+	}
+}
+
+// Chain is a chain of generated transfers. It serves JSON-RPC over HTTP, and is also a
+// chain.LogFetcher so it can be read in-process. It is safe for concurrent use.
+type Chain struct {
+	config Config
+
+	// hashes of blocks 0 onwards, computed as far as blocks have been asked for, since each
+	// block hash depends on the hash of the block before it
+	lock   sync.Mutex
+	hashes []common.Hash
+}
+
+// New creates a chain of generated transfers. Counts in config that are too small to generate
+// transfers from are raised to the smallest that work.
+func New(config Config) *Chain {
+	if config.Wallets < 2 {
+		config.Wallets = 2
+	}
+	if config.Hubs > config.Wallets {
+		config.Hubs = config.Wallets
+	}
+	if config.Tokens < 1 {
+		config.Tokens = 1
+	}
+	if config.MaxBatchLength < 2 {
+		config.MaxBatchLength = 2
+	}
+	return &Chain{config: config}
+}
+
+// Config returns the config the chain was created with
+func (c *Chain) Config() Config {
+	return c.config
+}
+
+// WalletAddress returns the address of wallet index, the hubs are the first wallets
+func WalletAddress(index int) common.Address {
+	return indexAddress(walletPrefix, index)
+}
+
+// Erc20Address, Erc721Address and Erc1155Address return the addresses of token contract index
+// of each standard
+func Erc20Address(index int) common.Address {
+	return indexAddress(erc20Prefix, index)
+}
+
+func Erc721Address(index int) common.Address {
+	return indexAddress(erc721Prefix, index)
+}
+
+func Erc1155Address(index int) common.Address {
+	return indexAddress(erc1155Prefix, index)
+}
+
+func indexAddress(prefix byte, index int) common.Address {
+	var address common.Address
+	address[0] = prefix
+	binary.BigEndian.PutUint64(address[12:], uint64(index))
+	return address
+}
+
+// FilterLogs returns the transfer logs the query selects, as eth_getLogs would. A nil FromBlock
+// or ToBlock means the latest block.
+func (c *Chain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	if q.BlockHash != nil {
+		return nil, fmt.Errorf("filtering logs by block hash is not supported")
+	}
+	blockFrom, blockTo := c.config.LatestBlock, c.config.LatestBlock
+	if q.FromBlock != nil {
+		blockFrom = q.FromBlock.Uint64()
+	}
+	if q.ToBlock != nil && q.ToBlock.Uint64() < blockTo {
+		blockTo = q.ToBlock.Uint64()
+	}
+
+	var logs []types.Log
+	for blockNumber := blockFrom; blockNumber <= blockTo; blockNumber++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, log := range c.blockLogs(blockNumber) {
+			if matchesQuery(&log, q) {
+				logs = append(logs, log)
+			}
+		}
+		if c.config.MaxLogsPerQuery > 0 && len(logs) > c.config.MaxLogsPerQuery {
+			return nil, limitExceededError{maxLogs: c.config.MaxLogsPerQuery}
+		}
+	}
+	return logs, nil
+}
+
+// limitExceededError is the error for a log query that selects more than MaxLogsPerQuery logs,
+// worded as providers word it
+type limitExceededError struct {
+	maxLogs int
+}
+
+func (e limitExceededError) Error() string {
+	return fmt.Sprintf("query returned more than %v results", e.maxLogs)
+}
+
+// matchesQuery returns true if the log is selected by the addresses and topics of the query.
+// An empty list of topics in a position matches any topic.
+func matchesQuery(log *types.Log, q ethereum.FilterQuery) bool {
+	if len(q.Addresses) > 0 {
+		found := false
+		for _, address := range q.Addresses {
+			if address == log.Address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(q.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, topics := range q.Topics {
+		if len(topics) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range topics {
+			if topic == log.Topics[i] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Header returns the header of the block. Each block links to the one before it by parent hash.
+func (c *Chain) Header(blockNumber uint64) *types.Header {
+	var parentHash common.Hash
+	if blockNumber > 0 {
+		parentHash = c.blockHash(blockNumber - 1)
+	}
+	return c.newHeader(blockNumber, parentHash)
+}
+
+// newHeader returns the header of the block, the block has no state and its transactions are
+// not served, so the roots are those of empty tries
+func (c *Chain) newHeader(blockNumber uint64, parentHash common.Hash) *types.Header {
+	seed := make([]byte, 8)
+	binary.BigEndian.PutUint64(seed, uint64(c.config.Seed))
+	return &types.Header{
+		ParentHash:  parentHash,
+		UncleHash:   types.EmptyUncleHash,
+		Root:        types.EmptyRootHash,
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+		Difficulty:  new(big.Int),
+		Number:      new(big.Int).SetUint64(blockNumber),
+		GasLimit:    30_000_000,
+		Time:        c.config.GenesisTime + blockNumber*c.config.BlockTime,
+		Extra:       seed,
+	}
+}
+
+// blockHash returns the hash of the block, computing the hashes of the blocks before it first
+// if they are not known yet
+func (c *Chain) blockHash(blockNumber uint64) common.Hash {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for uint64(len(c.hashes)) <= blockNumber {
+		var parentHash common.Hash
+		if len(c.hashes) > 0 {
+			parentHash = c.hashes[len(c.hashes)-1]
+		}
+		c.hashes = append(c.hashes, c.newHeader(uint64(len(c.hashes)), parentHash).Hash())
+	}
+	return c.hashes[blockNumber]
+}
+
+// txHash returns the hash of transaction txIndex of the block
+func txHash(blockHash common.Hash, txIndex int) common.Hash {
+	index := make([]byte, 8)
+	binary.BigEndian.PutUint64(index, uint64(txIndex))
+	return crypto.Keccak256Hash(blockHash.Bytes(), index)
+}
+
+// TxHashes returns the hashes of the transactions of the block, one per transfer log
+func (c *Chain) TxHashes(blockNumber uint64) []common.Hash {
+	blockHash := c.blockHash(blockNumber)
+	hashes := make([]common.Hash, c.config.TransfersPerBlock)
+	for i := range hashes {
+		hashes[i] = txHash(blockHash, i)
+	}
+	return hashes
+}
+
+// blockLogs generates the transfer logs of the block. The random source is seeded by the seed
+// and the block number, so any block can be generated on its own.
+func (c *Chain) blockLogs(blockNumber uint64) []types.Log {
+	if blockNumber > c.config.LatestBlock {
+		return nil
+	}
+	config := c.config
+	blockHash := c.blockHash(blockNumber)
+	rng := rand.New(rand.NewSource(config.Seed ^ int64(blockNumber*0x9e3779b97f4a7c15)))
+
+	logs := make([]types.Log, config.TransfersPerBlock)
+	for i := range logs {
+		log := &logs[i]
+		log.BlockNumber = blockNumber
+		log.BlockHash = blockHash
+		log.TxHash = txHash(blockHash, i)
+		log.TxIndex = uint(i)
+		log.Index = uint(i)
+
+		fromIndex := -1
+		from := common.Address{}
+		if rng.Float64() >= config.MintShare {
+			fromIndex = c.randomWallet(rng, -1)
+			from = WalletAddress(fromIndex)
+		}
+		to := WalletAddress(c.randomWallet(rng, fromIndex))
+		tokenIndex := rng.Intn(config.Tokens)
+
+		standard := rng.Float64()
+		switch {
+		case standard < config.Erc721Share:
+			log.Address = Erc721Address(tokenIndex)
+			log.Topics = []common.Hash{transferTopic, from.Hash(), to.Hash(),
+				common.BigToHash(big.NewInt(rng.Int63n(maxNftId)))}
+		case standard < config.Erc721Share+config.Erc1155Share:
+			// The operator is whoever sends the tokens, or receives minted ones
+			operator := from
+			if fromIndex < 0 {
+				operator = to
+			}
+			log.Address = Erc1155Address(tokenIndex)
+			if rng.Float64() < config.BatchShare {
+				count := 2 + rng.Intn(config.MaxBatchLength-1)
+				ids := make([]*big.Int, count)
+				values := make([]*big.Int, count)
+				for j := range ids {
+					ids[j] = big.NewInt(rng.Int63n(maxNftId))
+					values[j] = big.NewInt(1 + rng.Int63n(10))
+				}
+				data, err := transferBatchData.Pack(ids, values)
+				if err != nil {
+					panic(err)
+				}
+				log.Topics = []common.Hash{transferBatchTopic, operator.Hash(), from.Hash(), to.Hash()}
+				log.Data = data
+			} else {
+				id := common.BigToHash(big.NewInt(rng.Int63n(maxNftId)))
+				value := common.BigToHash(big.NewInt(1 + rng.Int63n(10)))
+				log.Topics = []common.Hash{transferSingleTopic, operator.Hash(), from.Hash(), to.Hash()}
+				log.Data = append(id.Bytes(), value.Bytes()...)
+			}
+		default:
+			value := new(big.Int).Mul(big.NewInt(1+rng.Int63n(1_000_000)),
+				new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(erc20Decimals(tokenIndex))), nil))
+			log.Address = Erc20Address(tokenIndex)
+			log.Topics = []common.Hash{transferTopic, from.Hash(), to.Hash()}
+			log.Data = common.BigToHash(value).Bytes()
+		}
+	}
+	return logs
+}
+
+// randomWallet returns the index of a wallet, a hub for HubShare of the wallets, and never
+// notIndex so nobody transfers to themselves
+func (c *Chain) randomWallet(rng *rand.Rand, notIndex int) int {
+	var index int
+	if c.config.Hubs > 0 && rng.Float64() < c.config.HubShare {
+		index = rng.Intn(c.config.Hubs)
+	} else {
+		index = rng.Intn(c.config.Wallets)
+	}
+	if index == notIndex {
+		index = (index + 1) % c.config.Wallets
+	}
+	return index
+}
+
+// token returns the transfer type and index of the token contract at address, ok is false if
+// there is no token contract there
+func (c *Chain) token(address common.Address) (transferType string, index int, ok bool) {
+	for _, b := range address[1:12] {
+		if b != 0 {
+			return "", 0, false
+		}
+	}
+	index64 := binary.BigEndian.Uint64(address[12:])
+	if index64 >= uint64(c.config.Tokens) {
+		return "", 0, false
+	}
+	index = int(index64)
+	switch address[0] {
+	case erc20Prefix:
+		return chain.ERC20, index, true
+	case erc721Prefix:
+		return chain.ERC721, index, true
+	case erc1155Prefix:
+		return chain.ERC1155_SINGLE, index, true
+	}
+	return "", 0, false
+}
+
+// TokenName and TokenSymbol return the name and symbol of token contract index of a standard,
+// transferType is chain.ERC20, chain.ERC721 or either of the ERC1155 types
+func TokenName(transferType string, index int) string {
+	return fmt.Sprintf("Fake %s %d", standardName(transferType), index)
+}
+
+func TokenSymbol(transferType string, index int) string {
+	return fmt.Sprintf("F%sT%d", standardName(transferType)[3:], index)
+}
+
+func standardName(transferType string) string {
+	if transferType == chain.ERC1155_SINGLE || transferType == chain.ERC1155_BATCH {
+		return "ERC1155"
+	}
+	return transferType
+}
+
+// erc20Decimals returns the decimals of ERC20 token contract index, alternately 18 and 6
+func erc20Decimals(index int) uint8 {
+	if index%2 == 0 {
+		return 18
+	}
+	return 6
+}
@@ -0,0 +1,319 @@
+package fakechain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/masterdata/tokens/contracts/erc20"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// JSON-RPC error codes, as geth uses them
+const (
+	errorCodeMethodNotFound = -32601
+	errorCodeInvalidParams  = -32602
+	errorCodeServer         = -32000
+	errorCodeLimitExceeded  = -32005
+)
+
+// tokenCode is the code eth_getCode returns for the token contracts, anything not empty will do
+// since calls to them are answered without running it
+var tokenCode = hexutil.Bytes{0xfe}
+
+var errExecutionReverted = errors.New("execution reverted")
+
+type rpcRequest struct {
+	Id     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// ServeHTTP answers a JSON-RPC request or batch request
+func (c *Chain) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var response interface{}
+	if body = bytes.TrimSpace(body); len(body) > 0 && body[0] == '[' {
+		var requests []rpcRequest
+		if err := json.Unmarshal(body, &requests); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		responses := make([]rpcResponse, len(requests))
+		for i, request := range requests {
+			responses[i] = c.handle(r.Context(), request)
+		}
+		response = responses
+	} else {
+		var request rpcRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response = c.handle(r.Context(), request)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handle answers one JSON-RPC call
+func (c *Chain) handle(ctx context.Context, request rpcRequest) rpcResponse {
+	response := rpcResponse{Version: "2.0", Id: request.Id}
+	result, callErr := c.call(ctx, request.Method, request.Params)
+	if callErr != nil {
+		response.Error = callErr
+		return response
+	}
+	var err error
+	response.Result, err = json.Marshal(result)
+	if err != nil {
+		response.Error = &rpcError{Code: errorCodeServer, Message: err.Error()}
+	}
+	return response
+}
+
+// call returns the result of the method
+func (c *Chain) call(ctx context.Context, method string, params []json.RawMessage) (interface{}, *rpcError) {
+	switch method {
+	case "eth_chainId":
+		return hexutil.Uint64(c.config.ChainId), nil
+	case "net_version":
+		return strconv.FormatUint(c.config.ChainId, 10), nil
+	case "eth_blockNumber":
+		return hexutil.Uint64(c.config.LatestBlock), nil
+	case "eth_getBlockByNumber":
+		if len(params) < 2 {
+			return nil, invalidParams("expected block number and full transactions flag")
+		}
+		blockNumber, err := c.parseBlockNumber(params[0])
+		if err != nil {
+			return nil, invalidParams(err.Error())
+		}
+		var fullTransactions bool
+		if err := json.Unmarshal(params[1], &fullTransactions); err != nil {
+			return nil, invalidParams(err.Error())
+		}
+		return c.block(blockNumber, fullTransactions)
+	case "eth_getLogs":
+		if len(params) < 1 {
+			return nil, invalidParams("expected filter")
+		}
+		query, err := c.parseFilter(params[0])
+		if err != nil {
+			return nil, invalidParams(err.Error())
+		}
+		if query.BlockHash != nil {
+			return nil, invalidParams("filtering logs by block hash is not supported")
+		}
+		logs, err := c.FilterLogs(ctx, query)
+		if err != nil {
+			code := errorCodeServer
+			if errors.As(err, &limitExceededError{}) {
+				code = errorCodeLimitExceeded
+			}
+			return nil, &rpcError{Code: code, Message: err.Error()}
+		}
+		if logs == nil {
+			return []interface{}{}, nil
+		}
+		return logs, nil
+	case "eth_call":
+		if len(params) < 1 {
+			return nil, invalidParams("expected call")
+		}
+		var args struct {
+			To    common.Address `json:"to"`
+			Data  hexutil.Bytes  `json:"data"`
+			Input hexutil.Bytes  `json:"input"`
+		}
+		if err := json.Unmarshal(params[0], &args); err != nil {
+			return nil, invalidParams(err.Error())
+		}
+		if len(args.Input) > 0 {
+			args.Data = args.Input
+		}
+		output, err := c.callContract(args.To, args.Data)
+		if err != nil {
+			return nil, &rpcError{Code: errorCodeServer, Message: err.Error()}
+		}
+		return hexutil.Bytes(output), nil
+	case "eth_getCode":
+		if len(params) < 1 {
+			return nil, invalidParams("expected address")
+		}
+		var address common.Address
+		if err := json.Unmarshal(params[0], &address); err != nil {
+			return nil, invalidParams(err.Error())
+		}
+		if _, _, ok := c.token(address); ok {
+			return tokenCode, nil
+		}
+		return hexutil.Bytes{}, nil
+	}
+	return nil, &rpcError{Code: errorCodeMethodNotFound,
+		Message: fmt.Sprintf("the method %s does not exist/is not available", method)}
+}
+
+func invalidParams(message string) *rpcError {
+	return &rpcError{Code: errorCodeInvalidParams, Message: "invalid argument: " + message}
+}
+
+// block returns the eth_getBlockByNumber result for the block, or nil if there is no such block.
+// Transactions are only served as hashes, a request for full transactions gets none.
+func (c *Chain) block(blockNumber uint64, fullTransactions bool) (interface{}, *rpcError) {
+	if blockNumber > c.config.LatestBlock {
+		return nil, nil
+	}
+	headerJson, err := json.Marshal(c.Header(blockNumber))
+	if err != nil {
+		return nil, &rpcError{Code: errorCodeServer, Message: err.Error()}
+	}
+	var block map[string]json.RawMessage
+	if err := json.Unmarshal(headerJson, &block); err != nil {
+		return nil, &rpcError{Code: errorCodeServer, Message: err.Error()}
+	}
+	transactions := []common.Hash{}
+	if !fullTransactions {
+		transactions = c.TxHashes(blockNumber)
+	}
+	block["transactions"], _ = json.Marshal(transactions)
+	block["uncles"] = json.RawMessage("[]")
+	return block, nil
+}
+
+// parseBlockNumber returns the block number of a hex number or a tag such as "latest"
+func (c *Chain) parseBlockNumber(raw json.RawMessage) (uint64, error) {
+	var blockNumber string
+	if err := json.Unmarshal(raw, &blockNumber); err != nil {
+		return 0, err
+	}
+	switch blockNumber {
+	case "", "latest", "pending", "safe", "finalized":
+		return c.config.LatestBlock, nil
+	case "earliest":
+		return 0, nil
+	}
+	return hexutil.DecodeUint64(blockNumber)
+}
+
+// parseFilter returns the query of an eth_getLogs filter. The address can be one address or a
+// list, and each topic position null, one topic or a list.
+func (c *Chain) parseFilter(raw json.RawMessage) (ethereum.FilterQuery, error) {
+	var filter struct {
+		FromBlock json.RawMessage   `json:"fromBlock"`
+		ToBlock   json.RawMessage   `json:"toBlock"`
+		BlockHash *common.Hash      `json:"blockHash"`
+		Address   json.RawMessage   `json:"address"`
+		Topics    []json.RawMessage `json:"topics"`
+	}
+	if err := json.Unmarshal(raw, &filter); err != nil {
+		return ethereum.FilterQuery{}, err
+	}
+	query := ethereum.FilterQuery{BlockHash: filter.BlockHash}
+
+	for _, block := range []struct {
+		raw    json.RawMessage
+		target **big.Int
+	}{{filter.FromBlock, &query.FromBlock}, {filter.ToBlock, &query.ToBlock}} {
+		if len(block.raw) == 0 || string(block.raw) == "null" {
+			continue
+		}
+		blockNumber, err := c.parseBlockNumber(block.raw)
+		if err != nil {
+			return ethereum.FilterQuery{}, err
+		}
+		*block.target = new(big.Int).SetUint64(blockNumber)
+	}
+
+	if len(filter.Address) > 0 && string(filter.Address) != "null" {
+		if strings.HasPrefix(string(filter.Address), "[") {
+			if err := json.Unmarshal(filter.Address, &query.Addresses); err != nil {
+				return ethereum.FilterQuery{}, err
+			}
+		} else {
+			var address common.Address
+			if err := json.Unmarshal(filter.Address, &address); err != nil {
+				return ethereum.FilterQuery{}, err
+			}
+			query.Addresses = []common.Address{address}
+		}
+	}
+
+	query.Topics = make([][]common.Hash, len(filter.Topics))
+	for i, topic := range filter.Topics {
+		switch {
+		case len(topic) == 0 || string(topic) == "null":
+		case strings.HasPrefix(string(topic), "["):
+			if err := json.Unmarshal(topic, &query.Topics[i]); err != nil {
+				return ethereum.FilterQuery{}, err
+			}
+		default:
+			var hash common.Hash
+			if err := json.Unmarshal(topic, &hash); err != nil {
+				return ethereum.FilterQuery{}, err
+			}
+			query.Topics[i] = []common.Hash{hash}
+		}
+	}
+	return query, nil
+}
+
+// callContract returns the output of a call to the name, symbol or decimals of a token contract.
+// A call to an address that is not a token contract returns nothing, as for a wallet.
+func (c *Chain) callContract(to common.Address, input []byte) ([]byte, error) {
+	transferType, index, ok := c.token(to)
+	if !ok {
+		return nil, nil
+	}
+	erc20Abi, err := erc20.Erc20MetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	if len(input) < 4 {
+		return nil, errExecutionReverted
+	}
+	method, err := erc20Abi.MethodById(input[:4])
+	if err != nil {
+		return nil, errExecutionReverted
+	}
+	switch method.Name {
+	case "name":
+		return method.Outputs.Pack(TokenName(transferType, index))
+	case "symbol":
+		return method.Outputs.Pack(TokenSymbol(transferType, index))
+	case "decimals":
+		if transferType == chain.ERC20 {
+			return method.Outputs.Pack(erc20Decimals(index))
+		}
+	}
+	return nil, errExecutionReverted
+}
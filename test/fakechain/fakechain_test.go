@@ -0,0 +1,186 @@
+package fakechain
+
+import (
+	"context"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/masterdata/tokens"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// testConfig returns a small chain, with no log limit so whole ranges can be read at once
+func testConfig() Config {
+	config := DefaultConfig()
+	config.LatestBlock = 200
+	config.TransfersPerBlock = 20
+	config.Wallets = 50
+	config.Tokens = 3
+	config.MaxLogsPerQuery = 0
+	return config
+}
+
+func getAllLogs(t *testing.T, c *Chain, blockFrom uint64, blockTo uint64) []*chain.TransferEvent {
+	t.Helper()
+	events, err := chain.GetTransferEventsByBlockRange(context.Background(), c, blockFrom, blockTo, chain.TransferFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestSameSeedGivesSameTransfers(t *testing.T) {
+	first := getAllLogs(t, New(testConfig()), 10, 20)
+	second := getAllLogs(t, New(testConfig()), 10, 20)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("same seed gave different transfers")
+	}
+
+	// A block is the same whether or not the blocks before it were read
+	alone := getAllLogs(t, New(testConfig()), 20, 20)
+	if !reflect.DeepEqual(alone, second[len(second)-len(alone):]) {
+		t.Errorf("block 20 read alone differs from block 20 read in a range")
+	}
+
+	config := testConfig()
+	config.Seed = 2
+	other := getAllLogs(t, New(config), 10, 20)
+	if reflect.DeepEqual(first, other) {
+		t.Errorf("different seeds gave the same transfers")
+	}
+}
+
+func TestDistributions(t *testing.T) {
+	testCases := []struct {
+		name   string
+		change func(config *Config)
+		check  func(event *chain.TransferEvent) bool
+	}{
+		{"all mints", func(config *Config) { config.MintShare = 1 },
+			func(event *chain.TransferEvent) bool { return event.LogAddressFrom == common.Address{} }},
+		{"all to hubs", func(config *Config) { config.MintShare = 1; config.HubShare = 1; config.Hubs = 2 },
+			func(event *chain.TransferEvent) bool {
+				return event.LogAddressTo == WalletAddress(0) || event.LogAddressTo == WalletAddress(1)
+			}},
+		{"all ERC20", func(config *Config) { config.Erc721Share = 0; config.Erc1155Share = 0 },
+			func(event *chain.TransferEvent) bool { return event.TransferType == chain.ERC20 }},
+		{"all ERC721", func(config *Config) { config.Erc721Share = 1 },
+			func(event *chain.TransferEvent) bool { return event.TransferType == chain.ERC721 }},
+		{"all ERC1155 batches", func(config *Config) { config.Erc721Share = 0; config.Erc1155Share = 1; config.BatchShare = 1 },
+			func(event *chain.TransferEvent) bool { return event.TransferType == chain.ERC1155_BATCH }},
+		{"nobody sends to themselves", func(config *Config) { config.Wallets = 2 },
+			func(event *chain.TransferEvent) bool { return event.LogAddressFrom != event.LogAddressTo }},
+	}
+
+	for _, tc := range testCases {
+		config := testConfig()
+		tc.change(&config)
+		events := getAllLogs(t, New(config), 1, 10)
+		if len(events) < 10*config.TransfersPerBlock {
+			t.Errorf("%s: expected at least %v events, got %v", tc.name, 10*config.TransfersPerBlock, len(events))
+		}
+		for _, event := range events {
+			if !tc.check(event) {
+				t.Errorf("%s: unexpected event %+v", tc.name, event)
+				break
+			}
+		}
+	}
+}
+
+func TestFilterLogsRefusesLargeQueries(t *testing.T) {
+	config := testConfig()
+	config.MaxLogsPerQuery = 50
+	c := New(config)
+
+	_, err := c.FilterLogs(context.Background(), ethereum.FilterQuery{FromBlock: big.NewInt(1), ToBlock: big.NewInt(10)})
+	if err == nil {
+		t.Fatalf("expected a query of 200 logs to be refused")
+	}
+
+	// The range fetcher shrinks its window until the chain answers
+	events, err := chain.NewRangeFetcher(c, chain.TransferFilter{}).FetchEvents(context.Background(), 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) < 10*config.TransfersPerBlock {
+		t.Errorf("expected at least %v events, got %v", 10*config.TransfersPerBlock, len(events))
+	}
+}
+
+// TestServe reads the chain over JSON-RPC the way ethgraph reads a real chain
+func TestServe(t *testing.T) {
+	c := New(testConfig())
+	server := httptest.NewServer(c)
+	defer server.Close()
+	ctx := context.Background()
+
+	evmChain, err := chain.CreateEvmClientWithOptions(ctx, []string{server.URL}, chain.DialOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer evmChain.Client.Close()
+	if evmChain.ChainId != "1337" || evmChain.LatestBlockNumber != 200 {
+		t.Errorf("expected chainId 1337 at block 200, got chainId %v at block %v", evmChain.ChainId, evmChain.LatestBlockNumber)
+	}
+
+	// Logs over JSON-RPC are the logs read in-process
+	filter := chain.NewTransferFilter(Erc20Address(1).Hex())
+	served, err := chain.GetTransferEventsByBlockRange(ctx, evmChain.Client, 5, 15, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, err := chain.GetTransferEventsByBlockRange(ctx, c, 5, 15, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(served) == 0 || !reflect.DeepEqual(served, direct) {
+		t.Errorf("served %v events, expected the %v read in-process", len(served), len(direct))
+	}
+
+	// Headers link by parent hash, and the logs carry the block hash
+	header, err := evmChain.Client.HeaderByNumber(ctx, big.NewInt(15))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, err := evmChain.Client.HeaderByNumber(ctx, big.NewInt(14))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.ParentHash != parent.Hash() {
+		t.Errorf("block 15 does not link to block 14")
+	}
+	if header.Time != 1_600_000_000+15*12 {
+		t.Errorf("unexpected block 15 time %v", header.Time)
+	}
+	if last := served[len(served)-1]; last.BlockNumber == 15 && last.BlockHash != header.Hash() {
+		t.Errorf("log block hash %v is not the header hash %v", last.BlockHash, header.Hash())
+	}
+
+	// Token master data
+	tokensData, err := tokens.GetTokensFromChain(ctx, evmChain.ChainId, evmChain.Client, []tokens.TokenToRead{
+		{Address: Erc20Address(1), TransferType: chain.ERC20},
+		{Address: Erc721Address(2), TransferType: chain.ERC721},
+		{Address: Erc1155Address(0), TransferType: chain.ERC1155_SINGLE},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		name     string
+		symbol   string
+		decimals int
+	}{
+		{"Fake ERC20 1", "F20T1", 6},
+		{"Fake ERC721 2", "F721T2", 0},
+		{"Fake ERC1155 0", "F1155T0", 0},
+	}
+	for i, tokenData := range tokensData {
+		if tokenData.Name != expected[i].name || tokenData.Symbol != expected[i].symbol || tokenData.Decimals != expected[i].decimals {
+			t.Errorf("token %v: expected %+v, got %+v", i, expected[i], tokenData)
+		}
+	}
+}
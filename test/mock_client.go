@@ -1,25 +1,42 @@
 package test
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
 	"math/big"
 )
 
 var zeroAddress = common.Address{}
 
 func GetMockClient() (*backends.SimulatedBackend, common.Address, error) {
+	client, auth, err := GetMockClientWithAccount()
+	if err != nil {
+		return nil, zeroAddress, err
+	}
+	return client, auth.From, nil
+}
+
+// GetMockClientWithAccount is GetMockClient returning the account holding 10 eth as a transactor,
+// for sending transactions to the simulated chain
+func GetMockClientWithAccount() (*backends.SimulatedBackend, *bind.TransactOpts, error) {
 	// See https://goethereumbook.org/en/client-simulated/
 	privateKey, err := crypto.GenerateKey()
 	if err != nil {
-		return nil, zeroAddress, err
+		return nil, nil, err
 	}
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, big.NewInt(1))
+	// The simulated chain has chainId 1337
+	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, big.NewInt(1337))
 	if err != nil {
-		return nil, zeroAddress, err
+		return nil, nil, err
 	}
 	balance := new(big.Int)
 	balance.SetString("10000000000000000000", 10) // 10 eth in wei
@@ -31,5 +48,42 @@ func GetMockClient() (*backends.SimulatedBackend, common.Address, error) {
 	}
 	blockGasLimit := uint64(4712388)
 	client := backends.NewSimulatedBackend(genesisAlloc, blockGasLimit)
-	return client, address, nil
+	return client, auth, nil
+}
+
+// SimulatedClient is a simulated backend that also answers batch requests, of eth_call only,
+// which is enough to read token master data from it
+type SimulatedClient struct {
+	*backends.SimulatedBackend
+}
+
+func (c SimulatedClient) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	for i := range b {
+		if b[i].Method != "eth_call" || len(b[i].Args) == 0 {
+			b[i].Error = fmt.Errorf("method %s is not supported by the simulated client", b[i].Method)
+			continue
+		}
+		argsJson, err := json.Marshal(b[i].Args[0])
+		if err != nil {
+			return err
+		}
+		var args struct {
+			To   *common.Address `json:"to"`
+			Data hexutil.Bytes   `json:"data"`
+		}
+		if err := json.Unmarshal(argsJson, &args); err != nil {
+			return err
+		}
+		output, err := c.CallContract(ctx, ethereum.CallMsg{To: args.To, Data: args.Data}, nil)
+		if err != nil {
+			b[i].Error = err
+			continue
+		}
+		resultJson, err := json.Marshal(hexutil.Bytes(output))
+		if err != nil {
+			return err
+		}
+		b[i].Error = json.Unmarshal(resultJson, b[i].Result)
+	}
+	return nil
 }
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"encoding/binary"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+)
+
+// MockMulticall3Code is the runtime code of a contract with the same ABI as the Multicall3
+// tryAggregate(bool requireSuccess, (address target, bytes callData)[] calls) function, which
+// it answers for any call. Every call is made, whatever requireSuccess is, and its success and
+// return data returned. Assembled from:
+//
+//	    PUSH1 0x20 PUSH1 0 MSTORE                ; offset of the results array
+//	    PUSH1 0x44 CALLDATALOAD                  ; [n] number of calls
+//	    DUP1 PUSH1 0x20 MSTORE                   ; length of the results array
+//	    DUP1 PUSH1 5 SHL PUSH1 0x40 ADD          ; [n tail] where the next result is written
+//	    PUSH1 0                                  ; [n tail i]
+//	loop:
+//	    JUMPDEST DUP3 DUP2 LT ISZERO PUSH2 end JUMPI
+//	    DUP1 PUSH1 5 SHL PUSH1 0x64 ADD CALLDATALOAD PUSH1 0x64 ADD   ; [n tail i call]
+//	    DUP1 PUSH1 0x20 ADD CALLDATALOAD DUP2 ADD                     ; [n tail i call data]
+//	    DUP1 CALLDATALOAD                                              ; [n tail i call data len]
+//	    DUP1 DUP3 PUSH1 0x20 ADD DUP7 PUSH1 0x60 ADD CALLDATACOPY      ; copy callData to tail+0x60
+//	    PUSH1 0 PUSH1 0 DUP3 DUP8 PUSH1 0x60 ADD PUSH1 0 DUP8 CALLDATALOAD GAS CALL  ; [... success]
+//	    RETURNDATASIZE PUSH1 0 DUP8 PUSH1 0x60 ADD RETURNDATACOPY      ; return data to tail+0x60
+//	    PUSH1 0 RETURNDATASIZE DUP8 ADD PUSH1 0x60 ADD MSTORE          ; zero its padding
+//	    DUP6 MSTORE                                                    ; success
+//	    PUSH1 0x40 DUP6 PUSH1 0x20 ADD MSTORE                          ; offset of return data
+//	    RETURNDATASIZE DUP6 PUSH1 0x40 ADD MSTORE                      ; length of return data
+//	    PUSH1 0x40 DUP6 SUB DUP5 PUSH1 5 SHL PUSH1 0x40 ADD MSTORE     ; offset of the result
+//	    POP POP POP                                                    ; [n tail i]
+//	    RETURNDATASIZE PUSH1 31 ADD PUSH1 5 SHR PUSH1 5 SHL PUSH1 0x60 ADD DUP3 ADD SWAP2 POP
+//	    PUSH1 1 ADD PUSH2 loop JUMP                                    ; [n tail' i+1]
+//	end:
+//	    JUMPDEST POP PUSH1 0 RETURN
+var MockMulticall3Code = hexutil.MustDecode("0x6020600052604435806020528060051b60400160005b82811015610092578060051b" +
+	"6064013560640180602001358101803580826020018660600137600060008287606001600087355af13d60008760" +
+	"60013e60003d8701606001528552604085602001523d8560400152604085038460051b604001525050503d601f01" +
+	"60051c60051b60600182019150600101610015565b506000f3")
+
+// MockErc20Code returns the runtime code of a contract answering the ERC20 name(), symbol() and
+// decimals() calls with the values given, and reverting any other call
+func MockErc20Code(name string, symbol string, decimals uint8) []byte {
+	stringType, _ := abi.NewType("string", "", nil)
+	nameData, _ := abi.Arguments{{Type: stringType}}.Pack(name)
+	symbolData, _ := abi.Arguments{{Type: stringType}}.Pack(symbol)
+
+	// The code is the dispatch on the function selector, one block per function, then the
+	// ABI encoded name and symbol that those blocks copy into memory and return
+	const decimalsBlock, nameBlock, symbolBlock, dataStart = 40, 51, 67, 83
+	code := hexutil.MustDecode("0x60003560e01c" +
+		"806306fdde031460" + "33" + "57" + // name() jumps to nameBlock
+		"806395d89b411460" + "43" + "57" + // symbol() jumps to symbolBlock
+		"8063313ce5671460" + "28" + "57" + // decimals() jumps to decimalsBlock
+		"600080fd")
+	code = append(code, 0x5b, 0x60, decimals, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3)
+	code = append(code, returnCodeBlock(dataStart, len(nameData))...)
+	code = append(code, returnCodeBlock(dataStart+len(nameData), len(symbolData))...)
+	if len(code) != dataStart || decimalsBlock+11 != nameBlock || nameBlock+16 != symbolBlock {
+		panic("mock ERC20 code layout is wrong")
+	}
+	code = append(code, nameData...)
+	return append(code, symbolData...)
+}
+
+// returnCodeBlock returns code that copies size bytes of the code from offset into memory and
+// returns them
+func returnCodeBlock(offset int, size int) []byte {
+	block := []byte{0x5b, 0x61, 0, 0, 0x61, 0, 0, 0x60, 0x00, 0x39, 0x61, 0, 0, 0x60, 0x00, 0xf3}
+	binary.BigEndian.PutUint16(block[2:], uint16(size))
+	binary.BigEndian.PutUint16(block[5:], uint16(offset))
+	binary.BigEndian.PutUint16(block[11:], uint16(size))
+	return block
+}
+
+// GetMockClientWithContracts is GetMockClient with the contract code given deployed at genesis at
+// each address
+func GetMockClientWithContracts(contracts map[common.Address][]byte) *backends.SimulatedBackend {
+	genesisAlloc := make(core.GenesisAlloc, len(contracts))
+	for address, code := range contracts {
+		genesisAlloc[address] = core.GenesisAccount{Code: code, Balance: common.Big0}
+	}
+	blockGasLimit := uint64(4712388)
+	return backends.NewSimulatedBackend(genesisAlloc, blockGasLimit)
+}
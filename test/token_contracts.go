@@ -0,0 +1,526 @@
+package test
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/asm"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"strings"
+)
+
+// The test token contracts are written in EVM assembly, in the syntax of go-ethereum's core/asm,
+// one instruction per line. They implement enough of the ABIs of the bindings in
+// masterdata/tokens/contracts for those bindings to mint and transfer through them, and emit the
+// same Transfer, TransferSingle and TransferBatch events as real token contracts. There are no
+// approvals, only the owner of tokens can transfer them, and anyone can mint.
+
+const transferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+const transferSingleTopic = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"
+const transferBatchTopic = "0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb"
+
+// erc20Constructor mints the supply to the deployer, the balance of an address is at the slot
+// of the address
+const erc20Constructor = `
+	PUSH %[1]s
+	DUP1
+	CALLER
+	SSTORE
+	PUSH 0
+	MSTORE
+	CALLER
+	PUSH 0
+	PUSH ` + transferTopic + `
+	PUSH 0x20
+	PUSH 0
+	LOG3
+`
+
+// erc20Methods are balanceOf(address) and transfer(address to, uint256 amount)
+const erc20Methods = `
+balanceOf:
+	PUSH 4
+	CALLDATALOAD
+	SLOAD
+	PUSH 0
+	MSTORE
+	PUSH 0x20
+	PUSH 0
+	RETURN
+transfer:
+	;; [sel balance amount], the caller must have the amount
+	CALLER
+	SLOAD
+	PUSH 0x24
+	CALLDATALOAD
+	DUP1
+	DUP3
+	LT
+	JUMPI @revert
+	DUP1
+	DUP3
+	SUB
+	CALLER
+	SSTORE
+	;; credit the amount to the recipient
+	PUSH 4
+	CALLDATALOAD
+	DUP1
+	SLOAD
+	DUP3
+	ADD
+	SWAP1
+	SSTORE
+	;; emit Transfer(caller, to, amount) and return true
+	PUSH 0
+	MSTORE
+	PUSH 4
+	CALLDATALOAD
+	CALLER
+	PUSH ` + transferTopic + `
+	PUSH 0x20
+	PUSH 0
+	LOG3
+	PUSH 1
+	PUSH 0
+	MSTORE
+	PUSH 0x20
+	PUSH 0
+	RETURN
+decimals:
+	PUSH %[1]d
+	PUSH 0
+	MSTORE
+	PUSH 0x20
+	PUSH 0
+	RETURN
+`
+
+// erc721Methods are safeMint(address to, string uri), which mints the next id, ownerOf(uint256)
+// and transferFrom(address from, address to, uint256 id). The owner of an id is at the slot of
+// the id, and the next id at the last slot.
+const erc721Methods = `
+safeMint:
+	;; [sel id], store the next id
+	PUSH 0
+	NOT
+	SLOAD
+	DUP1
+	PUSH 1
+	ADD
+	PUSH 0
+	NOT
+	SSTORE
+	;; [sel id to], the owner of the id is the recipient
+	PUSH 4
+	CALLDATALOAD
+	DUP1
+	DUP3
+	SSTORE
+	;; emit Transfer(0, to, id)
+	DUP2
+	SWAP1
+	PUSH 0
+	PUSH ` + transferTopic + `
+	PUSH 0
+	DUP1
+	LOG4
+	STOP
+ownerOf:
+	PUSH 4
+	CALLDATALOAD
+	SLOAD
+	DUP1
+	ISZERO
+	JUMPI @revert
+	PUSH 0
+	MSTORE
+	PUSH 0x20
+	PUSH 0
+	RETURN
+transferFrom:
+	;; [sel id], the owner must be from and the caller
+	PUSH 0x44
+	CALLDATALOAD
+	DUP1
+	SLOAD
+	PUSH 4
+	CALLDATALOAD
+	EQ
+	ISZERO
+	JUMPI @revert
+	PUSH 4
+	CALLDATALOAD
+	CALLER
+	EQ
+	ISZERO
+	JUMPI @revert
+	;; [sel id to], the owner of the id is the recipient
+	PUSH 0x24
+	CALLDATALOAD
+	DUP1
+	DUP3
+	SSTORE
+	;; emit Transfer(from, to, id)
+	PUSH 4
+	CALLDATALOAD
+	PUSH ` + transferTopic + `
+	PUSH 0
+	DUP1
+	LOG4
+	STOP
+`
+
+// erc1155BalanceSlot replaces [account id] on the stack with the slot of the balance of the
+// account for the id, keccak256(account, id), using memory 0x00 to 0x40
+const erc1155BalanceSlot = `
+	PUSH 0x20
+	MSTORE
+	PUSH 0
+	MSTORE
+	PUSH 0x40
+	PUSH 0
+	KECCAK256
+`
+
+// erc1155Methods are balanceOf(address account, uint256 id), mint(address to, uint256 id,
+// uint256 amount, bytes data), mintBatch(address to, uint256[] ids, uint256[] amounts, bytes data)
+// and the safeTransferFrom and safeBatchTransferFrom of them. The data is ignored and recipients
+// are not checked for being able to receive tokens.
+const erc1155Methods = `
+balanceOf:
+	PUSH 4
+	CALLDATALOAD
+	PUSH 0x24
+	CALLDATALOAD
+` + erc1155BalanceSlot + `
+	SLOAD
+	PUSH 0
+	MSTORE
+	PUSH 0x20
+	PUSH 0
+	RETURN
+mint:
+	PUSH 0
+	PUSH 4
+	CALLDATALOAD
+	PUSH 0x24
+	CALLDATALOAD
+	PUSH 0x44
+	CALLDATALOAD
+	JUMP @single
+safeTransferFrom:
+	PUSH 4
+	CALLDATALOAD
+	DUP1
+	CALLER
+	EQ
+	ISZERO
+	JUMPI @revert
+	PUSH 0x24
+	CALLDATALOAD
+	PUSH 0x44
+	CALLDATALOAD
+	PUSH 0x64
+	CALLDATALOAD
+	JUMP @single
+mintBatch:
+	PUSH 0
+	PUSH 4
+	CALLDATALOAD
+	PUSH 0x24
+	CALLDATALOAD
+	PUSH 4
+	ADD
+	PUSH 0x44
+	CALLDATALOAD
+	PUSH 4
+	ADD
+	JUMP @batch
+safeBatchTransferFrom:
+	PUSH 4
+	CALLDATALOAD
+	DUP1
+	CALLER
+	EQ
+	ISZERO
+	JUMPI @revert
+	PUSH 0x24
+	CALLDATALOAD
+	PUSH 0x44
+	CALLDATALOAD
+	PUSH 4
+	ADD
+	PUSH 0x64
+	CALLDATALOAD
+	PUSH 4
+	ADD
+	JUMP @batch
+
+single:
+	;; [sel from to id amount], move the amount then emit TransferSingle(caller, from, to, id, amount)
+	PUSH @singleLog
+	DUP5
+	DUP5
+	DUP5
+	DUP5
+	JUMP @move
+singleLog:
+	PUSH 0x60
+	MSTORE
+	PUSH 0x40
+	MSTORE
+	SWAP1
+	CALLER
+	PUSH ` + transferSingleTopic + `
+	PUSH 0x40
+	PUSH 0x40
+	LOG4
+	STOP
+
+batch:
+	;; [sel from to ids amounts] with ids and amounts the calldata offsets of the arrays, which
+	;; must be the same length n
+	DUP2
+	CALLDATALOAD
+	DUP1
+	DUP3
+	CALLDATALOAD
+	EQ
+	ISZERO
+	JUMPI @revert
+	;; [sel from to ids amounts n], the event data from 0x40 is the offsets of the arrays then
+	;; the arrays, copied from calldata
+	PUSH 0x40
+	PUSH 0x40
+	MSTORE
+	DUP1
+	PUSH 5
+	SHL
+	PUSH 0x60
+	ADD
+	DUP1
+	PUSH 0x60
+	MSTORE
+	DUP2
+	PUSH 1
+	ADD
+	PUSH 5
+	SHL
+	DUP1
+	DUP6
+	PUSH 0x80
+	CALLDATACOPY
+	DUP1
+	DUP5
+	DUP4
+	PUSH 0x40
+	ADD
+	CALLDATACOPY
+	ADD
+	;; [sel from to ids amounts n length i], move each id
+	PUSH 0
+batchLoop:
+	DUP3
+	DUP2
+	LT
+	ISZERO
+	JUMPI @batchLog
+	PUSH @batchNext
+	DUP8
+	DUP8
+	DUP4
+	PUSH 5
+	SHL
+	PUSH 0x20
+	ADD
+	DUP9
+	ADD
+	CALLDATALOAD
+	DUP5
+	PUSH 5
+	SHL
+	PUSH 0x20
+	ADD
+	DUP9
+	ADD
+	CALLDATALOAD
+	JUMP @move
+batchNext:
+	PUSH 1
+	ADD
+	JUMP @batchLoop
+batchLog:
+	;; emit TransferBatch(caller, from, to, ids, amounts)
+	POP
+	DUP5
+	DUP7
+	CALLER
+	PUSH ` + transferBatchTopic + `
+	DUP5
+	PUSH 0x40
+	LOG4
+	STOP
+
+move:
+	;; [return from to id amount], debit from unless minting, credit to, then return
+	DUP4
+	ISZERO
+	JUMPI @moveCredit
+	DUP4
+	DUP3
+` + erc1155BalanceSlot + `
+	DUP1
+	SLOAD
+	DUP3
+	DUP2
+	LT
+	JUMPI @revert
+	DUP3
+	SWAP1
+	SUB
+	SWAP1
+	SSTORE
+moveCredit:
+	DUP3
+	DUP3
+` + erc1155BalanceSlot + `
+	DUP1
+	SLOAD
+	DUP3
+	ADD
+	SWAP1
+	SSTORE
+	POP
+	POP
+	POP
+	POP
+	JUMP
+`
+
+// DeployTestErc20 deploys an ERC20 contract that mints supply to the deployer, as a Transfer from
+// the zero address. Tokens are transferred with the erc20 binding.
+func DeployTestErc20(auth *bind.TransactOpts, backend bind.ContractBackend, name string, symbol string,
+	decimals uint8, supply *big.Int) (common.Address, *types.Transaction, error) {
+
+	runtime, err := tokenRuntimeCode([]string{"balanceOf(address)", "transfer(address,uint256)", "decimals()"},
+		fmt.Sprintf(erc20Methods, decimals), name, symbol)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	return deployCode(auth, backend, fmt.Sprintf(erc20Constructor, supply.String()), runtime)
+}
+
+// DeployTestErc721 deploys an ERC721 contract. Tokens are minted, with ids counting up from 0,
+// and transferred with the erc721 binding.
+func DeployTestErc721(auth *bind.TransactOpts, backend bind.ContractBackend, name string, symbol string) (
+	common.Address, *types.Transaction, error) {
+
+	runtime, err := tokenRuntimeCode(
+		[]string{"safeMint(address,string)", "ownerOf(uint256)", "transferFrom(address,address,uint256)"},
+		erc721Methods, name, symbol)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	return deployCode(auth, backend, "", runtime)
+}
+
+// DeployTestErc1155 deploys an ERC1155 contract, that also has a name and symbol like an ERC721.
+// Tokens are minted and transferred with the erc1155 binding.
+func DeployTestErc1155(auth *bind.TransactOpts, backend bind.ContractBackend, name string, symbol string) (
+	common.Address, *types.Transaction, error) {
+
+	runtime, err := tokenRuntimeCode([]string{
+		"balanceOf(address,uint256)",
+		"mint(address,uint256,uint256,bytes)",
+		"safeTransferFrom(address,address,uint256,uint256,bytes)",
+		"mintBatch(address,uint256[],uint256[],bytes)",
+		"safeBatchTransferFrom(address,address,uint256[],uint256[],bytes)"},
+		erc1155Methods, name, symbol)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	return deployCode(auth, backend, "", runtime)
+}
+
+// tokenRuntimeCode assembles the runtime code of a token contract. The code dispatches on the
+// function selector to the label with the name of each method signature given, or to the name()
+// and symbol() methods returning the name and symbol, and reverts any other call.
+func tokenRuntimeCode(methods []string, methodsSource string, name string, symbol string) (
+	[]byte, error) {
+
+	stringType, err := abi.NewType("string", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	nameData, err := abi.Arguments{{Type: stringType}}.Pack(name)
+	if err != nil {
+		return nil, err
+	}
+	symbolData, err := abi.Arguments{{Type: stringType}}.Pack(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	var source strings.Builder
+	source.WriteString("\tPUSH 0\n\tCALLDATALOAD\n\tPUSH 0xe0\n\tSHR\n")
+	for _, signature := range append([]string{"name()", "symbol()"}, methods...) {
+		selector := crypto.Keccak256([]byte(signature))[:4]
+		label := signature[:strings.Index(signature, "(")]
+		fmt.Fprintf(&source, "\tDUP1\n\tPUSH 0x%x\n\tEQ\n\tJUMPI @%s\n", selector, label)
+	}
+	source.WriteString("revert:\n\tPUSH 0\n\tDUP1\n\tREVERT\n")
+	source.WriteString(methodsSource)
+
+	// name() and symbol() return their ABI encoded values, which follow the data label
+	fmt.Fprintf(&source, "name:\n\tPUSH %d\n\tPUSH @data\n\tPUSH 1\n\tADD\n\tPUSH 0\n\tCODECOPY\n\tPUSH %d\n\tPUSH 0\n\tRETURN\n",
+		len(nameData), len(nameData))
+	fmt.Fprintf(&source, "symbol:\n\tPUSH %d\n\tPUSH @data\n\tPUSH %d\n\tADD\n\tPUSH 0\n\tCODECOPY\n\tPUSH %d\n\tPUSH 0\n\tRETURN\n",
+		len(symbolData), 1+len(nameData), len(symbolData))
+	source.WriteString("data:\n")
+
+	code, err := assemble(source.String())
+	if err != nil {
+		return nil, err
+	}
+	code = append(code, nameData...)
+	return append(code, symbolData...), nil
+}
+
+// deployCode deploys a contract whose creation code runs constructorSource then returns runtime
+func deployCode(auth *bind.TransactOpts, backend bind.ContractBackend, constructorSource string, runtime []byte) (
+	common.Address, *types.Transaction, error) {
+
+	// The runtime code is at the end of the creation code
+	creation, err := assemble(constructorSource + fmt.Sprintf(`
+	PUSH %d
+	DUP1
+	DUP1
+	CODESIZE
+	SUB
+	PUSH 0
+	CODECOPY
+	PUSH 0
+	RETURN
+`, len(runtime)))
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	address, tx, _, err := bind.DeployContract(auth, abi.ABI{}, append(creation, runtime...), backend)
+	return address, tx, err
+}
+
+// assemble compiles EVM assembly to code
+func assemble(source string) ([]byte, error) {
+	compiler := asm.NewCompiler(false)
+	compiler.Feed(asm.Lex([]byte(source), false))
+	code, errs := compiler.Compile()
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("assembling contract: %v", errs[0])
+	}
+	return hexutil.Decode("0x" + code)
+}
@@ -0,0 +1,200 @@
+package test
+
+import (
+	"context"
+	"github.com/KevinSmall/ethgraph/chain"
+	"github.com/KevinSmall/ethgraph/graph"
+	"github.com/KevinSmall/ethgraph/masterdata/tokens"
+	"github.com/KevinSmall/ethgraph/masterdata/tokens/contracts/erc1155"
+	"github.com/KevinSmall/ethgraph/masterdata/tokens/contracts/erc20"
+	"github.com/KevinSmall/ethgraph/masterdata/tokens/contracts/erc721"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"testing"
+)
+
+var (
+	walletB = common.HexToAddress("0xb000000000000000000000000000000000000001")
+	walletC = common.HexToAddress("0xc000000000000000000000000000000000000001")
+)
+
+// mined sends a transaction with send and mines it in a block of its own, failing the test if
+// the transaction fails
+func mined(t *testing.T, backend *backends.SimulatedBackend, send func() (*types.Transaction, error)) {
+	t.Helper()
+	tx, err := send()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.Commit()
+	receipt, err := backend.TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("transaction %v failed", tx.Hash().Hex())
+	}
+}
+
+// TestTokenContracts mints and transfers tokens through the test token contracts with the
+// bindings, then reads the transfers back as events, the token master data, and the graph
+func TestTokenContracts(t *testing.T) {
+	backend, auth, err := GetMockClientWithAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	ctx := context.Background()
+	walletA := auth.From
+	ether := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	tokens100 := new(big.Int).Mul(big.NewInt(100), ether)
+
+	// Deploy, the ERC20 mints its supply to the deployer
+	var erc20Address, erc721Address, erc1155Address common.Address
+	mined(t, backend, func() (tx *types.Transaction, err error) {
+		erc20Address, tx, err = DeployTestErc20(auth, backend, "Test Token", "TST", 18, new(big.Int).Mul(tokens100, big.NewInt(10)))
+		return tx, err
+	})
+	mined(t, backend, func() (tx *types.Transaction, err error) {
+		erc721Address, tx, err = DeployTestErc721(auth, backend, "Test NFT", "TNFT")
+		return tx, err
+	})
+	mined(t, backend, func() (tx *types.Transaction, err error) {
+		erc1155Address, tx, err = DeployTestErc1155(auth, backend, "Test Multi, Token", "TMT")
+		return tx, err
+	})
+	erc20Token, err := erc20.NewErc20(erc20Address, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	erc721Token, err := erc721.NewErc721(erc721Address, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	erc1155Token, err := erc1155.NewErc1155(erc1155Address, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mint and transfer
+	mined(t, backend, func() (*types.Transaction, error) { return erc20Token.Transfer(auth, walletB, tokens100) })
+	mined(t, backend, func() (*types.Transaction, error) { return erc20Token.Transfer(auth, walletC, ether) })
+	mined(t, backend, func() (*types.Transaction, error) { return erc721Token.SafeMint(auth, walletB, "") })
+	mined(t, backend, func() (*types.Transaction, error) { return erc721Token.SafeMint(auth, walletA, "") })
+	mined(t, backend, func() (*types.Transaction, error) {
+		return erc721Token.TransferFrom(auth, walletA, walletC, big.NewInt(1))
+	})
+	mined(t, backend, func() (*types.Transaction, error) {
+		return erc1155Token.Mint(auth, walletA, big.NewInt(7), big.NewInt(10), nil)
+	})
+	mined(t, backend, func() (*types.Transaction, error) {
+		return erc1155Token.MintBatch(auth, walletA, []*big.Int{big.NewInt(1), big.NewInt(2)},
+			[]*big.Int{big.NewInt(5), big.NewInt(6)}, nil)
+	})
+	mined(t, backend, func() (*types.Transaction, error) {
+		return erc1155Token.SafeTransferFrom(auth, walletA, walletB, big.NewInt(7), big.NewInt(3), nil)
+	})
+	mined(t, backend, func() (*types.Transaction, error) {
+		return erc1155Token.SafeBatchTransferFrom(auth, walletA, walletC, []*big.Int{big.NewInt(1), big.NewInt(2)},
+			[]*big.Int{big.NewInt(2), big.NewInt(3)}, nil)
+	})
+
+	// Only the owner can transfer, and only what they have
+	if _, err := erc721Token.TransferFrom(auth, walletB, walletC, big.NewInt(0)); err == nil {
+		t.Errorf("expected a transfer not by the owner to fail")
+	}
+	if _, err := erc1155Token.SafeTransferFrom(auth, walletA, walletB, big.NewInt(7), big.NewInt(8), nil); err == nil {
+		t.Errorf("expected a transfer of more than the balance to fail")
+	}
+
+	// The contracts hold the balances the transfers leave
+	callOpts := &bind.CallOpts{Context: ctx}
+	balance, err := erc20Token.BalanceOf(callOpts, walletB)
+	if err != nil || balance.Cmp(tokens100) != 0 {
+		t.Errorf("expected ERC20 balance %v, got %v, %v", tokens100, balance, err)
+	}
+	owner, err := erc721Token.OwnerOf(callOpts, big.NewInt(1))
+	if err != nil || owner != walletC {
+		t.Errorf("expected ERC721 owner %v, got %v, %v", walletC.Hex(), owner.Hex(), err)
+	}
+	balance, err = erc1155Token.BalanceOf(callOpts, walletA, big.NewInt(2))
+	if err != nil || balance.Int64() != 3 {
+		t.Errorf("expected ERC1155 balance 3, got %v, %v", balance, err)
+	}
+
+	// Events
+	latest := backend.Blockchain().CurrentBlock().NumberU64()
+	events, err := chain.GetTransferEventsByBlockRange(ctx, backend, 0, latest, chain.TransferFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero := common.Address{}
+	expectedEvents := []struct {
+		transferType string
+		emitter      common.Address
+		from         common.Address
+		to           common.Address
+		value        *big.Int
+		nftId        string
+	}{
+		{chain.ERC20, erc20Address, zero, walletA, new(big.Int).Mul(tokens100, big.NewInt(10)), ""},
+		{chain.ERC20, erc20Address, walletA, walletB, tokens100, ""},
+		{chain.ERC20, erc20Address, walletA, walletC, ether, ""},
+		{chain.ERC721, erc721Address, zero, walletB, big.NewInt(0), "0"},
+		{chain.ERC721, erc721Address, zero, walletA, big.NewInt(0), "1"},
+		{chain.ERC721, erc721Address, walletA, walletC, big.NewInt(0), "1"},
+		{chain.ERC1155_SINGLE, erc1155Address, zero, walletA, big.NewInt(10), "7"},
+		{chain.ERC1155_BATCH, erc1155Address, zero, walletA, big.NewInt(5), "1"},
+		{chain.ERC1155_BATCH, erc1155Address, zero, walletA, big.NewInt(6), "2"},
+		{chain.ERC1155_SINGLE, erc1155Address, walletA, walletB, big.NewInt(3), "7"},
+		{chain.ERC1155_BATCH, erc1155Address, walletA, walletC, big.NewInt(2), "1"},
+		{chain.ERC1155_BATCH, erc1155Address, walletA, walletC, big.NewInt(3), "2"},
+	}
+	if len(events) != len(expectedEvents) {
+		t.Fatalf("expected %v events, got %v", len(expectedEvents), len(events))
+	}
+	for i, expected := range expectedEvents {
+		event := events[i]
+		if event.TransferType != expected.transferType || event.LogEmitterAddress != expected.emitter ||
+			event.LogAddressFrom != expected.from || event.LogAddressTo != expected.to ||
+			event.LogTokenValue.Cmp(expected.value) != 0 || event.LogNftId != expected.nftId {
+			t.Errorf("event %v: expected %+v, got %+v", i, expected, event)
+		}
+		if (expected.transferType == chain.ERC1155_SINGLE || expected.transferType == chain.ERC1155_BATCH) &&
+			event.LogOperator != walletA {
+			t.Errorf("event %v: expected operator %v, got %v", i, walletA.Hex(), event.LogOperator.Hex())
+		}
+	}
+
+	// Token master data
+	tokensData, err := tokens.GetTokensFromChain(ctx, "1337", SimulatedClient{backend}, []tokens.TokenToRead{
+		{Address: erc20Address, TransferType: chain.ERC20},
+		{Address: erc721Address, TransferType: chain.ERC721},
+		{Address: erc1155Address, TransferType: chain.ERC1155_SINGLE},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTokens := []tokens.TokenDataFromSource{
+		{ChainId: "1337", Name: "Test Token", Symbol: "TST", Decimals: 18, TokenAddress: erc20Address.Hex()},
+		{ChainId: "1337", Name: "Test NFT", Symbol: "TNFT", Decimals: 0, TokenAddress: erc721Address.Hex()},
+		{ChainId: "1337", Name: "Test Multi  Token", Symbol: "TMT", Decimals: 0, TokenAddress: erc1155Address.Hex()},
+	}
+	for i, tokenData := range tokensData {
+		if tokenData != expectedTokens[i] {
+			t.Errorf("token %v: expected %+v, got %+v", i, expectedTokens[i], tokenData)
+		}
+	}
+
+	// Graph, the zero address and 3 wallets, and a node and 2 edges for each event
+	_, result, err := graph.CreateGraph("contracts", events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Events != 12 || result.Nodes != 16 || result.Edges != 24 {
+		t.Errorf("expected 12 events, 16 nodes and 24 edges, got %+v", result)
+	}
+}
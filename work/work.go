@@ -1,30 +1,98 @@
+// Package work runs tasks on a bounded pool of goroutines. A task that fails can be retried with
+// exponential backoff, and the result of every task submitted is collected, failed or not.
 package work
 
-import "sync"
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
 
-// Worker must be implemented by types that want to use the work pool
-type Worker interface {
-	Task()
+// DefaultWorkers is how many goroutines a pool has if Options.Workers is not set
+const DefaultWorkers = 20
+
+// Default delays between retries of a failed task, if Options does not set them
+const defaultBackoffBase = 250 * time.Millisecond
+const defaultBackoffMax = 10 * time.Second
+
+// Worker must be implemented by types that want to use the work pool. A task may be run more
+// than once if it fails and the pool retries it.
+type Worker[T any] interface {
+	Task(ctx context.Context) (T, error)
+}
+
+// Options says how a pool runs its tasks
+type Options struct {
+	// Workers is how many goroutines run tasks at the same time, DefaultWorkers if not set
+	Workers int
+
+	// Retries is how many times a failed task is run again, 0 means failed tasks are not retried
+	Retries int
+
+	// BackoffBase is the delay before the first retry of a task, doubled for each retry after
+	// that, 250ms if not set. The delay used is randomised to between half and all of it.
+	BackoffBase time.Duration
+
+	// BackoffMax caps the delay between retries, 10s if not set
+	BackoffMax time.Duration
+
+	// IsRetryable optionally says which errors are worth retrying, if nil every error is. Tasks
+	// are never retried once the pool's context is done.
+	IsRetryable func(err error) bool
+}
+
+// Result is the outcome of one task
+type Result[T any] struct {
+	// Value is what the task returned on its last run, which can be a partial value if it failed
+	Value T
+
+	// Err is the error of the task's last run, nil if it succeeded
+	Err error
+
+	// Attempts is how many times the task was run, 0 if it never was
+	Attempts int
 }
 
 // Pool provides a pool of goroutines to execute Worker tasks
-type Pool struct {
-	work chan Worker    // single unbuffered channel
-	wg   sync.WaitGroup // single wait group
+type Pool[T any] struct {
+	ctx     context.Context // tasks run with this, once done no more work is dispatched
+	opts    Options
+	work    chan job[T]    // single unbuffered channel
+	wg      sync.WaitGroup // single wait group
+	lock    sync.Mutex     // guards results
+	results []Result[T]    // one per task submitted, in the order submitted
+}
+
+// job is a task along with where its result goes
+type job[T any] struct {
+	index  int
+	worker Worker[T]
 }
 
-// New creates a new work pool
-func New(maxGoroutines int) *Pool {
-	p := Pool{
-		work: make(chan Worker),
+// New creates a new work pool, whose tasks are run with ctx
+func New[T any](ctx context.Context, opts Options) *Pool[T] {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.BackoffBase <= 0 {
+		opts.BackoffBase = defaultBackoffBase
+	}
+	if opts.BackoffMax <= 0 {
+		opts.BackoffMax = defaultBackoffMax
+	}
+	p := Pool[T]{
+		ctx:  ctx,
+		opts: opts,
+		work: make(chan job[T]),
 	}
 
-	p.wg.Add(maxGoroutines)
-	for i := 0; i < maxGoroutines; i++ {
+	p.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
 		// Spawn the worker goroutines
 		go func() {
-			for w := range p.work { // blocks until something appears in channel
-				w.Task()
+			for j := range p.work { // blocks until something appears in channel
+				p.setResult(j.index, p.runTask(j.worker))
 			}
 			p.wg.Done() // only called when channel closes
 		}() // goroutine executed right away
@@ -32,13 +100,87 @@ func New(maxGoroutines int) *Pool {
 	return &p
 }
 
-// Run submits work to the pool
-func (p *Pool) Run(w Worker) {
-	p.work <- w
+// Run submits work to the pool, blocking until a goroutine picks it up. If the pool's context
+// is done first, the work is never run, and the context's error is both its result and returned.
+func (p *Pool[T]) Run(w Worker[T]) error {
+	p.lock.Lock()
+	index := len(p.results)
+	p.results = append(p.results, Result[T]{})
+	p.lock.Unlock()
+
+	// Checked first, so no more work is dispatched once done even if a goroutine is free
+	if err := p.ctx.Err(); err != nil {
+		p.setResult(index, Result[T]{Err: err})
+		return err
+	}
+	select {
+	case p.work <- job[T]{index: index, worker: w}:
+		return nil
+	case <-p.ctx.Done():
+		p.setResult(index, Result[T]{Err: p.ctx.Err()})
+		return p.ctx.Err()
+	}
 }
 
-// Shutdown waits for all the goroutines to shutdown
-func (p *Pool) Shutdown() {
+// Wait waits for all the goroutines to shutdown, after the tasks already picked up finish, and
+// returns the result of every task submitted, in the order submitted. If any task failed the
+// error is Errors, holding the error of each task that did. Nothing can be submitted after Wait.
+func (p *Pool[T]) Wait() ([]Result[T], error) {
 	close(p.work)
 	p.wg.Wait()
+
+	var errs Errors
+	for _, result := range p.results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	if len(errs) > 0 {
+		return p.results, errs
+	}
+	return p.results, nil
+}
+
+// runTask runs the task, and again after a backoff delay each time it fails, up to the retries
+// allowed
+func (p *Pool[T]) runTask(w Worker[T]) Result[T] {
+	for attempt := 1; ; attempt++ {
+		value, err := w.Task(p.ctx)
+		if err == nil || attempt > p.opts.Retries || !p.isRetryable(err) {
+			return Result[T]{Value: value, Err: err, Attempts: attempt}
+		}
+		select {
+		case <-time.After(p.backoff(attempt)):
+		case <-p.ctx.Done():
+			return Result[T]{Value: value, Err: err, Attempts: attempt}
+		}
+	}
+}
+
+// isRetryable returns true if a task that failed with err is worth running again
+func (p *Pool[T]) isRetryable(err error) bool {
+	if p.ctx.Err() != nil {
+		return false
+	}
+	return p.opts.IsRetryable == nil || p.opts.IsRetryable(err)
+}
+
+// backoff returns the delay before retrying a task that has failed attempt times, the delay
+// doubles with each attempt up to BackoffMax, with jitter so tasks failing together do not all
+// retry together
+func (p *Pool[T]) backoff(attempt int) time.Duration {
+	delay := p.opts.BackoffBase
+	for i := 1; i < attempt && delay < p.opts.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > p.opts.BackoffMax {
+		delay = p.opts.BackoffMax
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (p *Pool[T]) setResult(index int, result Result[T]) {
+	p.lock.Lock()
+	p.results[index] = result
+	p.lock.Unlock()
 }
@@ -0,0 +1,41 @@
+package work
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors holds the error of each task of a pool that failed, in the order the tasks were
+// submitted
+type Errors []error
+
+// Error gives how many tasks failed and the first of their errors
+func (e Errors) Error() string {
+	switch len(e) {
+	case 0:
+		return "no tasks failed"
+	case 1:
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v tasks failed, first error: %s", len(e), e[0])
+}
+
+// Is returns true if the error of any task matches target, so errors.Is works on Errors
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error of any task that matches target, so errors.As works on Errors
+func (e Errors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
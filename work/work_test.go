@@ -1,36 +1,225 @@
 package work
 
 import (
+	"context"
+	"errors"
 	"sync/atomic"
 	"testing"
 	"time"
 )
 
-type testWorker struct {
-	executed int32
+// squareWorker returns the square of its n
+type squareWorker struct {
+	n int
 }
 
-func (t *testWorker) Task() {
-	atomic.AddInt32(&t.executed, 1)
+func (s *squareWorker) Task(ctx context.Context) (int, error) {
+	return s.n * s.n, nil
 }
 
 func TestPool_Run(t *testing.T) {
-	maxGoroutines := 5
-	pool := New(maxGoroutines)
-	tw := &testWorker{}
+	pool := New[int](context.Background(), Options{Workers: 5})
 
 	// Submit test workers to the pool
 	for i := 0; i < 10; i++ {
-		pool.Run(tw)
+		if err := pool.Run(&squareWorker{n: i}); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	// Give some time for the tasks to be executed
-	time.Sleep(1 * time.Second)
+	// Every task's result, in the order submitted
+	results, err := pool.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 10 {
+		t.Fatalf("Expected 10 results, but got %d", len(results))
+	}
+	for i, result := range results {
+		if result.Value != i*i || result.Attempts != 1 {
+			t.Errorf("Task %d: expected value %d after 1 attempt, got %d after %d", i, i*i, result.Value, result.Attempts)
+		}
+	}
+}
+
+// concurrencyWorker records the most tasks it sees running at the same time
+type concurrencyWorker struct {
+	running    *int32
+	maxRunning *int32
+}
+
+func (c *concurrencyWorker) Task(ctx context.Context) (int, error) {
+	running := atomic.AddInt32(c.running, 1)
+	for {
+		maxRunning := atomic.LoadInt32(c.maxRunning)
+		if running <= maxRunning || atomic.CompareAndSwapInt32(c.maxRunning, maxRunning, running) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	atomic.AddInt32(c.running, -1)
+	return 0, nil
+}
+
+func TestPool_RunBoundsConcurrency(t *testing.T) {
+	pool := New[int](context.Background(), Options{Workers: 3})
+	var running, maxRunning int32
+	for i := 0; i < 30; i++ {
+		if err := pool.Run(&concurrencyWorker{running: &running, maxRunning: &maxRunning}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := pool.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning > 3 {
+		t.Errorf("Expected at most 3 tasks running at the same time, but got %d", maxRunning)
+	}
+}
+
+// flakyWorker fails until it has been run succeedOnAttempt times
+type flakyWorker struct {
+	attempts         int
+	succeedOnAttempt int
+}
+
+var errFlaky = errors.New("flaky")
+
+func (f *flakyWorker) Task(ctx context.Context) (int, error) {
+	f.attempts++
+	if f.attempts < f.succeedOnAttempt {
+		return 0, errFlaky
+	}
+	return f.attempts, nil
+}
+
+func TestPool_RunRetries(t *testing.T) {
+	testCases := []struct {
+		retries          int
+		succeedOnAttempt int
+		expectedAttempts int
+		expectedErr      error
+	}{
+		{0, 1, 1, nil},
+		{0, 2, 1, errFlaky},
+		{2, 3, 3, nil},
+		{2, 4, 3, errFlaky},
+	}
+	for _, tc := range testCases {
+		pool := New[int](context.Background(), Options{Workers: 1, Retries: tc.retries, BackoffBase: time.Millisecond})
+		if err := pool.Run(&flakyWorker{succeedOnAttempt: tc.succeedOnAttempt}); err != nil {
+			t.Fatal(err)
+		}
+		results, err := pool.Wait()
+		if !errors.Is(err, tc.expectedErr) || (tc.expectedErr == nil && err != nil) {
+			t.Errorf("Retries %d, succeed on attempt %d: expected error %v, got %v",
+				tc.retries, tc.succeedOnAttempt, tc.expectedErr, err)
+		}
+		if results[0].Attempts != tc.expectedAttempts {
+			t.Errorf("Retries %d, succeed on attempt %d: expected %d attempts, got %d",
+				tc.retries, tc.succeedOnAttempt, tc.expectedAttempts, results[0].Attempts)
+		}
+	}
+}
 
-	// Check if all tasks have been executed
-	if tw.executed != 10 {
-		t.Errorf("Expected 10 tasks to be executed, but got %d", tw.executed)
+func TestPool_RunRetriesOnlyRetryableErrors(t *testing.T) {
+	pool := New[int](context.Background(), Options{Workers: 1, Retries: 5, BackoffBase: time.Millisecond,
+		IsRetryable: func(err error) bool { return !errors.Is(err, errFlaky) }})
+	if err := pool.Run(&flakyWorker{succeedOnAttempt: 3}); err != nil {
+		t.Fatal(err)
 	}
+	results, _ := pool.Wait()
+	if results[0].Attempts != 1 {
+		t.Errorf("Expected an error that is not retryable to be tried once, got %d attempts", results[0].Attempts)
+	}
+}
+
+func TestPool_WaitAggregatesErrors(t *testing.T) {
+	pool := New[int](context.Background(), Options{Workers: 2})
+	for i := 0; i < 4; i++ {
+		succeedOnAttempt := 1
+		if i%2 == 1 {
+			succeedOnAttempt = 2
+		}
+		if err := pool.Run(&flakyWorker{succeedOnAttempt: succeedOnAttempt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results, err := pool.Wait()
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Expected Errors of 2 failed tasks, got %v", err)
+	}
+	if !errors.Is(err, errFlaky) {
+		t.Errorf("Expected errors.Is to find the task error in %v", err)
+	}
+	if len(results) != 4 || results[0].Err != nil || results[1].Err == nil {
+		t.Errorf("Expected a result for every task, with only the odd ones failed, got %+v", results)
+	}
+}
+
+// blockingWorker runs until its context is done
+type blockingWorker struct {
+	started  chan struct{}
+	finished int32
+}
+
+func (b *blockingWorker) Task(ctx context.Context) (int, error) {
+	b.started <- struct{}{}
+	<-ctx.Done()
+	atomic.AddInt32(&b.finished, 1)
+	return 0, ctx.Err()
+}
 
-	pool.Shutdown()
+func TestPool_RunStopsDispatchWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := New[int](ctx, Options{Workers: 1, Retries: 3})
+	bw := &blockingWorker{started: make(chan struct{}, 1)}
+
+	if err := pool.Run(bw); err != nil {
+		t.Fatal(err)
+	}
+	<-bw.started
+	cancel()
+
+	// The only goroutine is busy, and the context is done, so the work is refused
+	err := pool.Run(bw)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context canceled, got %v", err)
+	}
+
+	// Wait drains the task in flight, which is not retried, and accounts for the refused task
+	results, err := pool.Wait()
+	if bw.finished != 1 {
+		t.Errorf("Expected 1 task finished, but got %d", bw.finished)
+	}
+	if len(results) != 2 || results[1].Attempts != 0 {
+		t.Errorf("Expected 2 results, the refused task never run, got %+v", results)
+	}
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 2 || !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Errors of 2 cancelled tasks, got %v", err)
+	}
+}
+
+func TestPool_Backoff(t *testing.T) {
+	pool := New[int](context.Background(), Options{Workers: 1, BackoffBase: 100 * time.Millisecond, BackoffMax: time.Second})
+	defer pool.Wait()
+	testCases := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	}
+	for _, tc := range testCases {
+		for i := 0; i < 20; i++ {
+			if delay := pool.backoff(tc.attempt); delay < tc.max/2 || delay > tc.max {
+				t.Errorf("Attempt %d: expected a delay between %s and %s, got %s", tc.attempt, tc.max/2, tc.max, delay)
+			}
+		}
+	}
 }